@@ -33,10 +33,26 @@ func (p *Program) TokenLiteral() string {
 }
 
 func (p *Program) String() string {
+	return statementsString(p.Statements)
+}
+
+// statementsString renders statements so that they parse back the same:
+// an expression statement followed by another statement is terminated with
+// a semicolon, which would otherwise be needed to tell `f; (x)` from
+// `f(x)`.
+func statementsString(statements []Statement) string {
 	var str bytes.Buffer
 
-	for _, stmt := range p.Statements {
+	for i, stmt := range statements {
 		str.WriteString(stmt.String())
+
+		if i == len(statements)-1 {
+			break
+		}
+		if _, ok := stmt.(*ExpressionStatement); ok {
+			str.WriteString(";")
+		}
+		str.WriteString(" ")
 	}
 
 	return str.String()
@@ -45,8 +61,27 @@ func (p *Program) String() string {
 type Identifier struct {
 	Token token.Token
 	Value string
+
+	// Scope, Depth and Slot are filled in by the resolver. A LocalScope
+	// identifier refers to slot Slot of the function or match arm scope Depth
+	// scopes out from where it appears, or, for a binding of a function
+	// around its own, of the closure environment just out of its function;
+	// other bindings are found by name.
+	Scope ScopeKind
+	Depth int
+	Slot  int
 }
 
+// ScopeKind says where the binding an identifier refers to lives.
+type ScopeKind int
+
+const (
+	Unresolved ScopeKind = iota
+	GlobalScope
+	LocalScope
+	BuiltinScope
+)
+
 func (i Identifier) expressionNode() {}
 func (i *Identifier) TokenLiteral() string {
 	return i.Value
@@ -55,9 +90,13 @@ func (i *Identifier) String() string {
 	return i.Value
 }
 
+// LetStatement binds Value to Name. Name is usually an *Identifier but may be
+// an array or hash pattern that destructures the value. Type is the optional
+// annotation of the bound value.
 type LetStatement struct {
 	Token token.Token
-	Name  *Identifier
+	Name  Pattern
+	Type  TypeExpression
 	Value Expression
 }
 
@@ -69,7 +108,11 @@ func (ls *LetStatement) String() string {
 	var str bytes.Buffer
 
 	str.WriteString(ls.TokenLiteral() + " ")
-	str.WriteString(ls.Name.String() + " = ")
+	str.WriteString(ls.Name.String())
+	if ls.Type != nil {
+		str.WriteString(": " + ls.Type.String())
+	}
+	str.WriteString(" = ")
 
 	if ls.Value != nil {
 		str.WriteString(ls.Value.String())
@@ -195,11 +238,13 @@ func (ie *IfExpression) TokenLiteral() string { return ie.Token.Value }
 func (ie *IfExpression) String() string {
 	var str bytes.Buffer
 
-	str.WriteString("if ")
+	str.WriteString("if (")
+	str.WriteString(ie.Condition.String())
+	str.WriteString(") ")
 	str.WriteString(ie.Consequence.String())
 
 	if ie.Alternative != nil {
-		str.WriteString("else ")
+		str.WriteString(" else ")
 		str.WriteString(ie.Alternative.String())
 	}
 
@@ -215,19 +260,45 @@ func (bs *BlockStatement) statementNode()       {}
 func (bs *BlockStatement) expressionNode()      {}
 func (bs *BlockStatement) TokenLiteral() string { return bs.Token.Value }
 func (bs *BlockStatement) String() string {
-	var str bytes.Buffer
-
-	for _, s := range bs.Statements {
-		str.WriteString(s.String())
+	if len(bs.Statements) == 0 {
+		return "{}"
 	}
-
-	return str.String()
-}
-
+	return "{ " + statementsString(bs.Statements) + " }"
+}
+
+// FunctionLiteral parameters are *Identifier values or destructuring
+// patterns applied to the corresponding argument. Defaults runs parallel to
+// Parameters and holds nil for parameters without a default value; Rest, if
+// set, collects any arguments beyond the named parameters into an array.
+//
+// ParameterTypes also runs parallel to Parameters, holding each parameter's
+// annotation or nil; RestType and ReturnType annotate the rest parameter and
+// the result.
+//
+// Locals and Free are filled in by the resolver: Locals with the name of
+// each slot of the function's frame, Free with the bindings of the functions
+// and match arms around the literal that it refers to, which its closures
+// capture. Free is nil until then.
 type FunctionLiteral struct {
-	Token      token.Token
-	Parameters []*Identifier
-	Body       *BlockStatement
+	Token          token.Token
+	Parameters     []Pattern
+	ParameterTypes []TypeExpression
+	Defaults       []Expression
+	Rest           *Identifier
+	RestType       TypeExpression
+	ReturnType     TypeExpression
+	Body           *BlockStatement
+	Locals         []string
+	Free           []FreeVariable
+}
+
+// FreeVariable is a binding a function literal captures: the binding Slot
+// of the scope Depth scopes out from where the literal is evaluated, as for
+// a LocalScope identifier.
+type FreeVariable struct {
+	Name  string
+	Depth int
+	Slot  int
 }
 
 func (fl *FunctionLiteral) statementNode()       {}
@@ -235,19 +306,49 @@ func (fl *FunctionLiteral) expressionNode()      {}
 func (fl *FunctionLiteral) TokenLiteral() string { return fl.Token.Value }
 func (fl *FunctionLiteral) String() string {
 	var str bytes.Buffer
-	str.WriteString(fl.TokenLiteral() + " (")
+	str.WriteString(fl.TokenLiteral() + "(")
 
-	parameters := []string{}
-	for _, p := range fl.Parameters {
-		parameters = append(parameters, p.String())
+	str.WriteString(ParametersString(fl.Parameters, fl.ParameterTypes, fl.Defaults, fl.Rest, fl.RestType))
+	str.WriteString(")")
+	if fl.ReturnType != nil {
+		str.WriteString(": " + fl.ReturnType.String())
 	}
-	str.WriteString(strings.Join(parameters, ", "))
-	str.WriteString(") ")
+	str.WriteString(" ")
 	str.WriteString(fl.Body.String())
 
 	return str.String()
 }
 
+// ParametersString renders a parameter list, without the surrounding
+// parentheses, for function literals and function objects.
+func ParametersString(
+	parameters []Pattern,
+	types []TypeExpression,
+	defaults []Expression,
+	rest *Identifier,
+	restType TypeExpression,
+) string {
+	params := []string{}
+	for i, p := range parameters {
+		param := p.String()
+		if i < len(types) && types[i] != nil {
+			param += ": " + types[i].String()
+		}
+		if i < len(defaults) && defaults[i] != nil {
+			param += " = " + defaults[i].String()
+		}
+		params = append(params, param)
+	}
+	if rest != nil {
+		param := "..." + rest.String()
+		if restType != nil {
+			param += ": " + restType.String()
+		}
+		params = append(params, param)
+	}
+	return strings.Join(params, ", ")
+}
+
 type CallExpression struct {
 	Token     token.Token
 	Function  Expression
@@ -279,7 +380,7 @@ type StringLiteral struct {
 
 func (sl *StringLiteral) expressionNode()      {}
 func (sl *StringLiteral) TokenLiteral() string { return sl.Token.Value }
-func (sl *StringLiteral) String() string       { return sl.Token.Value }
+func (sl *StringLiteral) String() string       { return `"` + sl.Value + `"` }
 
 type ArrayLiteral struct {
 	Token    token.Token
@@ -315,10 +416,191 @@ func (ie *IndexExpression) TokenLiteral() string { return ie.Token.Value }
 func (ie *IndexExpression) String() string {
 	var str bytes.Buffer
 
+	str.WriteString("(")
 	str.WriteString(ie.Left.String())
 	str.WriteString("[")
 	str.WriteString(ie.Index.String())
-	str.WriteString("]")
+	str.WriteString("])")
+
+	return str.String()
+}
+
+type HashPair struct {
+	Key   Expression
+	Value Expression
+}
+
+type HashLiteral struct {
+	Token token.Token
+	Pairs []HashPair
+}
+
+func (hl *HashLiteral) expressionNode()      {}
+func (hl *HashLiteral) TokenLiteral() string { return hl.Token.Value }
+func (hl *HashLiteral) String() string {
+	var str bytes.Buffer
+
+	pairs := []string{}
+	for _, pair := range hl.Pairs {
+		pairs = append(pairs, pair.Key.String()+": "+pair.Value.String())
+	}
+
+	str.WriteString("{")
+	str.WriteString(strings.Join(pairs, ", "))
+	str.WriteString("}")
+
+	return str.String()
+}
+
+type AssignExpression struct {
+	Token token.Token
+	Name  *Identifier
+	Value Expression
+}
+
+func (ae *AssignExpression) expressionNode()      {}
+func (ae *AssignExpression) TokenLiteral() string { return ae.Token.Value }
+func (ae *AssignExpression) String() string {
+	return "(" + ae.Name.String() + " = " + ae.Value.String() + ")"
+}
+
+type WhileStatement struct {
+	Token     token.Token
+	Condition Expression
+	Body      *BlockStatement
+}
+
+func (ws *WhileStatement) statementNode()       {}
+func (ws *WhileStatement) TokenLiteral() string { return ws.Token.Value }
+func (ws *WhileStatement) String() string {
+	var str bytes.Buffer
+
+	str.WriteString("while (")
+	str.WriteString(ws.Condition.String())
+	str.WriteString(") ")
+	str.WriteString(ws.Body.String())
+
+	return str.String()
+}
+
+// ForStatement iterates over an array, string, hash or range. Key is only
+// set for the two-variable form `for (key, value in iterable)`.
+type ForStatement struct {
+	Token    token.Token
+	Key      *Identifier
+	Value    *Identifier
+	Iterable Expression
+	Body     *BlockStatement
+}
+
+func (fs *ForStatement) statementNode()       {}
+func (fs *ForStatement) TokenLiteral() string { return fs.Token.Value }
+func (fs *ForStatement) String() string {
+	var str bytes.Buffer
+
+	str.WriteString("for (")
+	if fs.Key != nil {
+		str.WriteString(fs.Key.String() + ", ")
+	}
+	str.WriteString(fs.Value.String())
+	str.WriteString(" in ")
+	str.WriteString(fs.Iterable.String())
+	str.WriteString(") ")
+	str.WriteString(fs.Body.String())
+
+	return str.String()
+}
+
+type BreakStatement struct {
+	Token token.Token
+}
+
+func (bs *BreakStatement) statementNode()       {}
+func (bs *BreakStatement) TokenLiteral() string { return bs.Token.Value }
+func (bs *BreakStatement) String() string       { return bs.Token.Value + ";" }
+
+type ContinueStatement struct {
+	Token token.Token
+}
+
+func (cs *ContinueStatement) statementNode()       {}
+func (cs *ContinueStatement) TokenLiteral() string { return cs.Token.Value }
+func (cs *ContinueStatement) String() string       { return cs.Token.Value + ";" }
+
+// SpreadExpression expands an array into the surrounding argument list or
+// array literal: f(...args), [...xs, 1].
+type SpreadExpression struct {
+	Token token.Token
+	Value Expression
+}
+
+func (se *SpreadExpression) expressionNode()      {}
+func (se *SpreadExpression) TokenLiteral() string { return se.Token.Value }
+func (se *SpreadExpression) String() string       { return "..." + se.Value.String() }
+
+// ImportStatement loads the module at Path and binds its exports to Name,
+// which defaults to the last element of the path.
+type ImportStatement struct {
+	Token token.Token
+	Path  string
+	Name  *Identifier
+}
+
+func (is *ImportStatement) statementNode()       {}
+func (is *ImportStatement) TokenLiteral() string { return is.Token.Value }
+func (is *ImportStatement) String() string {
+	return is.TokenLiteral() + " \"" + is.Path + "\" as " + is.Name.String() + ";"
+}
+
+// ExportStatement is a let statement whose bindings are visible to modules
+// that import the current one.
+type ExportStatement struct {
+	Token     token.Token
+	Statement *LetStatement
+}
+
+func (es *ExportStatement) statementNode()       {}
+func (es *ExportStatement) TokenLiteral() string { return es.Token.Value }
+func (es *ExportStatement) String() string {
+	return es.TokenLiteral() + " " + es.Statement.String()
+}
+
+// MemberExpression reads a named member of a module or a string key of a
+// hash: mod.name.
+type MemberExpression struct {
+	Token    token.Token
+	Object   Expression
+	Property *Identifier
+}
+
+func (me *MemberExpression) expressionNode()      {}
+func (me *MemberExpression) TokenLiteral() string { return me.Token.Value }
+func (me *MemberExpression) String() string {
+	return "(" + me.Object.String() + "." + me.Property.String() + ")"
+}
+
+// MacroLiteral is a function over unevaluated AST. Macros are bound with a
+// top-level let and expanded before the program runs. Locals and Free are as
+// for FunctionLiteral.
+type MacroLiteral struct {
+	Token      token.Token
+	Parameters []Pattern
+	Defaults   []Expression
+	Rest       *Identifier
+	Body       *BlockStatement
+	Locals     []string
+	Free       []FreeVariable
+}
+
+func (ml *MacroLiteral) expressionNode()      {}
+func (ml *MacroLiteral) TokenLiteral() string { return ml.Token.Value }
+func (ml *MacroLiteral) String() string {
+	var str bytes.Buffer
+
+	str.WriteString(ml.TokenLiteral() + "(")
+	str.WriteString(ParametersString(ml.Parameters, nil, ml.Defaults, ml.Rest, nil))
+	str.WriteString(") ")
+	str.WriteString(ml.Body.String())
 
 	return str.String()
 }
@@ -0,0 +1,247 @@
+package ast
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"monkey/token"
+	"reflect"
+	"unicode"
+	"unicode/utf8"
+)
+
+// nodeTypes maps the "kind" of an encoded node to its Go type.
+var nodeTypes = map[string]reflect.Type{}
+
+func init() {
+	nodes := []Node{
+		&Program{}, &Identifier{}, &LetStatement{}, &ReturnStatement{},
+		&ExpressionStatement{}, &BlockStatement{}, &ImportStatement{},
+		&ExportStatement{}, &WhileStatement{}, &ForStatement{},
+		&BreakStatement{}, &ContinueStatement{}, &IntegerLiteral{},
+		&StringLiteral{}, &Boolean{}, &PrefixExpression{}, &InfixExpression{},
+		&AssignExpression{}, &IndexExpression{}, &MemberExpression{},
+		&IfExpression{}, &FunctionLiteral{}, &MacroLiteral{}, &CallExpression{},
+		&ArrayLiteral{}, &HashLiteral{}, &SpreadExpression{},
+		&MatchExpression{}, &WildcardPattern{}, &LiteralPattern{},
+		&ArrayPattern{}, &HashPattern{}, &NamedType{}, &ArrayType{},
+		&FunctionType{},
+	}
+	for _, node := range nodes {
+		t := reflect.TypeOf(node).Elem()
+		nodeTypes[t.Name()] = t
+	}
+}
+
+var (
+	nodeInterface = reflect.TypeOf((*Node)(nil)).Elem()
+	tokenType     = reflect.TypeOf(token.Token{})
+)
+
+// EncodeJSON encodes node and everything below it as JSON. Every node
+// becomes an object with its "kind", its "token" including the source
+// position, and one key per field, so that DecodeJSON can rebuild the exact
+// same tree.
+func EncodeJSON(node Node) ([]byte, error) {
+	encoded, err := encodeValue(reflect.ValueOf(&node).Elem())
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(encoded)
+}
+
+// DecodeJSON rebuilds a node encoded by EncodeJSON.
+func DecodeJSON(data []byte) (Node, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var decoded interface{}
+	if err := decoder.Decode(&decoded); err != nil {
+		return nil, err
+	}
+
+	value, err := decodeValue(decoded, nodeInterface)
+	if err != nil {
+		return nil, err
+	}
+
+	node, _ := value.Interface().(Node)
+	return node, nil
+}
+
+func encodeValue(v reflect.Value) (interface{}, error) {
+	switch v.Kind() {
+	case reflect.Interface, reflect.Ptr:
+		if v.IsNil() {
+			return nil, nil
+		}
+		encoded, err := encodeValue(v.Elem())
+		if err != nil {
+			return nil, err
+		}
+		if object, ok := encoded.(map[string]interface{}); ok && v.Kind() == reflect.Ptr && v.Type().Implements(nodeInterface) {
+			object["kind"] = v.Elem().Type().Name()
+		}
+		return encoded, nil
+
+	case reflect.Struct:
+		if v.Type() == tokenType {
+			return v.Interface(), nil
+		}
+		object := map[string]interface{}{}
+		for i := 0; i < v.NumField(); i++ {
+			encoded, err := encodeValue(v.Field(i))
+			if err != nil {
+				return nil, err
+			}
+			object[fieldKey(v.Type().Field(i).Name)] = encoded
+		}
+		return object, nil
+
+	case reflect.Slice:
+		if v.IsNil() {
+			return nil, nil
+		}
+		elements := make([]interface{}, v.Len())
+		for i := range elements {
+			encoded, err := encodeValue(v.Index(i))
+			if err != nil {
+				return nil, err
+			}
+			elements[i] = encoded
+		}
+		return elements, nil
+
+	case reflect.Int:
+		return v.Int(), nil
+
+	case reflect.String, reflect.Int64, reflect.Bool:
+		return v.Interface(), nil
+	}
+
+	return nil, fmt.Errorf("cannot encode %s", v.Type())
+}
+
+func decodeValue(data interface{}, t reflect.Type) (reflect.Value, error) {
+	if data == nil {
+		return reflect.Zero(t), nil
+	}
+
+	switch t.Kind() {
+	case reflect.Interface:
+		object, ok := data.(map[string]interface{})
+		if !ok {
+			return reflect.Value{}, fmt.Errorf("expected a node, got %v", data)
+		}
+		kind, _ := object["kind"].(string)
+		nodeType, ok := nodeTypes[kind]
+		if !ok {
+			return reflect.Value{}, fmt.Errorf("unknown node kind %q", kind)
+		}
+		if !reflect.PtrTo(nodeType).Implements(t) {
+			return reflect.Value{}, fmt.Errorf("a %s cannot be used as %s", kind, t.Name())
+		}
+		node, err := decodeValue(data, reflect.PtrTo(nodeType))
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		value := reflect.New(t).Elem()
+		value.Set(node)
+		return value, nil
+
+	case reflect.Ptr:
+		if t.Implements(nodeInterface) {
+			object, _ := data.(map[string]interface{})
+			if kind, _ := object["kind"].(string); kind != t.Elem().Name() {
+				return reflect.Value{}, fmt.Errorf("expected a %s, got %q", t.Elem().Name(), kind)
+			}
+		}
+		elem, err := decodeValue(data, t.Elem())
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		ptr := reflect.New(t.Elem())
+		ptr.Elem().Set(elem)
+		return ptr, nil
+
+	case reflect.Struct:
+		if t == tokenType {
+			return decodeToken(data)
+		}
+		object, ok := data.(map[string]interface{})
+		if !ok {
+			return reflect.Value{}, fmt.Errorf("expected an object for %s, got %v", t.Name(), data)
+		}
+		value := reflect.New(t).Elem()
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			decoded, err := decodeValue(object[fieldKey(field.Name)], field.Type)
+			if err != nil {
+				return reflect.Value{}, fmt.Errorf("%s.%s: %w", t.Name(), field.Name, err)
+			}
+			value.Field(i).Set(decoded)
+		}
+		return value, nil
+
+	case reflect.Slice:
+		elements, ok := data.([]interface{})
+		if !ok {
+			return reflect.Value{}, fmt.Errorf("expected an array, got %v", data)
+		}
+		slice := reflect.MakeSlice(t, len(elements), len(elements))
+		for i, element := range elements {
+			decoded, err := decodeValue(element, t.Elem())
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			slice.Index(i).Set(decoded)
+		}
+		return slice, nil
+
+	case reflect.String:
+		s, ok := data.(string)
+		if !ok {
+			return reflect.Value{}, fmt.Errorf("expected a string, got %v", data)
+		}
+		return reflect.ValueOf(s).Convert(t), nil
+
+	case reflect.Int, reflect.Int64:
+		number, ok := data.(json.Number)
+		if !ok {
+			return reflect.Value{}, fmt.Errorf("expected an integer, got %v", data)
+		}
+		n, err := number.Int64()
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		return reflect.ValueOf(n).Convert(t), nil
+
+	case reflect.Bool:
+		b, ok := data.(bool)
+		if !ok {
+			return reflect.Value{}, fmt.Errorf("expected a boolean, got %v", data)
+		}
+		return reflect.ValueOf(b), nil
+	}
+
+	return reflect.Value{}, fmt.Errorf("cannot decode %s", t)
+}
+
+func decodeToken(data interface{}) (reflect.Value, error) {
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return reflect.Value{}, err
+	}
+
+	var tok token.Token
+	if err := json.Unmarshal(encoded, &tok); err != nil {
+		return reflect.Value{}, fmt.Errorf("invalid token: %w", err)
+	}
+	return reflect.ValueOf(tok), nil
+}
+
+// fieldKey is the JSON key of a struct field: its name starting lower case.
+func fieldKey(name string) string {
+	r, size := utf8.DecodeRuneInString(name)
+	return string(unicode.ToLower(r)) + name[size:]
+}
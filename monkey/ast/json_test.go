@@ -0,0 +1,129 @@
+package ast_test
+
+import (
+	"encoding/json"
+	"monkey/ast"
+	"monkey/lexer"
+	"monkey/token"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestJSONRoundTrip(t *testing.T) {
+	inputs := []string{
+		everySyntax,
+		`let s = "multi
+line"; -9223372036854775807 - 1`,
+		`function() {}`,
+		`if (x) { y }`,
+		`let {"a": [b, ...c], "d": _} = h;`,
+	}
+
+	for _, input := range inputs {
+		program := parse(t, input)
+
+		encoded, err := ast.EncodeJSON(program)
+		if err != nil {
+			t.Fatalf("could not encode %q: %s", input, err)
+		}
+
+		decoded, err := ast.DecodeJSON(encoded)
+		if err != nil {
+			t.Fatalf("could not decode %q: %s", input, err)
+		}
+
+		if !reflect.DeepEqual(decoded, ast.Node(program)) {
+			t.Errorf("round trip of %q changed the program:\n%s\n%s", input, program.String(), decoded.String())
+		}
+	}
+}
+
+func TestJSONEncoding(t *testing.T) {
+	encoded, err := ast.EncodeJSON(parse(t, `x;`))
+	if err != nil {
+		t.Fatalf("could not encode: %s", err)
+	}
+
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(encoded, &decoded); err != nil {
+		t.Fatalf("invalid JSON: %s", err)
+	}
+
+	statement := decoded["statements"].([]interface{})[0].(map[string]interface{})
+	identifier := statement["expression"].(map[string]interface{})
+
+	expected := map[string]interface{}{
+		"kind": "Identifier",
+		"token": map[string]interface{}{
+			"type":   "IDENT",
+			"value":  "x",
+			"line":   float64(1),
+			"column": float64(1),
+		},
+		"value": "x",
+		"scope": float64(ast.Unresolved),
+		"depth": float64(0),
+		"slot":  float64(0),
+	}
+
+	if !reflect.DeepEqual(identifier, expected) {
+		t.Errorf("expected %v, got %v", expected, identifier)
+	}
+}
+
+func TestJSONDecodingErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`{"kind": "Nope"}`, `unknown node kind "Nope"`},
+		{`[]`, "expected a node"},
+		{
+			`{"kind": "ExpressionStatement", "expression": {"kind": "LetStatement"}}`,
+			"a LetStatement cannot be used as Expression",
+		},
+		{
+			`{"kind": "IntegerLiteral", "value": "one"}`,
+			"expected an integer",
+		},
+		{
+			`{"kind": "ForStatement", "value": {"kind": "IntegerLiteral"}}`,
+			`expected a Identifier, got "IntegerLiteral"`,
+		},
+	}
+
+	for _, tt := range tests {
+		_, err := ast.DecodeJSON([]byte(tt.input))
+		if err == nil {
+			t.Errorf("expected an error decoding %s", tt.input)
+			continue
+		}
+
+		if !strings.Contains(err.Error(), tt.expected) {
+			t.Errorf("expected error containing %q, got %q", tt.expected, err.Error())
+		}
+	}
+}
+
+func TestTokenStreamJSONRoundTrip(t *testing.T) {
+	tokens := lexer.Tokens(everySyntax)
+
+	encoded, err := json.Marshal(tokens)
+	if err != nil {
+		t.Fatalf("could not encode tokens: %s", err)
+	}
+
+	decoded := []token.Token{}
+	if err := json.Unmarshal(encoded, &decoded); err != nil {
+		t.Fatalf("could not decode tokens: %s", err)
+	}
+
+	if !reflect.DeepEqual(decoded, tokens) {
+		t.Errorf("round trip changed the token stream")
+	}
+
+	if last := decoded[len(decoded)-1]; last.Type != token.EOF {
+		t.Errorf("expected the stream to end with EOF, got %q", last.Type)
+	}
+}
@@ -0,0 +1,228 @@
+package ast
+
+type ModifierFunc func(Node) Node
+
+// Modify rebuilds node bottom-up, replacing every node with the result of
+// calling modifier on it after its children have been modified. The input
+// tree is left untouched: composite nodes are copied, and leaves such as
+// identifiers and literals are handed to modifier as they are.
+//
+// The property name of a MemberExpression is not visited, since it is a
+// name rather than an expression, and neither are type annotations, which
+// are kept as they are.
+func Modify(node Node, modifier ModifierFunc) Node {
+	switch node := node.(type) {
+
+	case *Program:
+		copied := *node
+		copied.Statements = modifyStatements(node.Statements, modifier)
+		return modifier(&copied)
+
+	case *BlockStatement:
+		if node == nil {
+			return node
+		}
+		copied := *node
+		copied.Statements = modifyStatements(node.Statements, modifier)
+		return modifier(&copied)
+
+	case *ExpressionStatement:
+		copied := *node
+		copied.Expression, _ = Modify(node.Expression, modifier).(Expression)
+		return modifier(&copied)
+
+	case *LetStatement:
+		copied := *node
+		copied.Name, _ = Modify(node.Name, modifier).(Pattern)
+		copied.Value, _ = Modify(node.Value, modifier).(Expression)
+		return modifier(&copied)
+
+	case *ReturnStatement:
+		copied := *node
+		copied.ReturnValue, _ = Modify(node.ReturnValue, modifier).(Expression)
+		return modifier(&copied)
+
+	case *ExportStatement:
+		copied := *node
+		copied.Statement, _ = Modify(node.Statement, modifier).(*LetStatement)
+		return modifier(&copied)
+
+	case *WhileStatement:
+		copied := *node
+		copied.Condition, _ = Modify(node.Condition, modifier).(Expression)
+		copied.Body, _ = Modify(node.Body, modifier).(*BlockStatement)
+		return modifier(&copied)
+
+	case *ForStatement:
+		copied := *node
+		if node.Key != nil {
+			copied.Key, _ = Modify(node.Key, modifier).(*Identifier)
+		}
+		copied.Value, _ = Modify(node.Value, modifier).(*Identifier)
+		copied.Iterable, _ = Modify(node.Iterable, modifier).(Expression)
+		copied.Body, _ = Modify(node.Body, modifier).(*BlockStatement)
+		return modifier(&copied)
+
+	case *PrefixExpression:
+		copied := *node
+		copied.Right, _ = Modify(node.Right, modifier).(Expression)
+		return modifier(&copied)
+
+	case *InfixExpression:
+		copied := *node
+		copied.Left, _ = Modify(node.Left, modifier).(Expression)
+		copied.Right, _ = Modify(node.Right, modifier).(Expression)
+		return modifier(&copied)
+
+	case *AssignExpression:
+		copied := *node
+		copied.Name, _ = Modify(node.Name, modifier).(*Identifier)
+		copied.Value, _ = Modify(node.Value, modifier).(Expression)
+		return modifier(&copied)
+
+	case *IndexExpression:
+		copied := *node
+		copied.Left, _ = Modify(node.Left, modifier).(Expression)
+		copied.Index, _ = Modify(node.Index, modifier).(Expression)
+		return modifier(&copied)
+
+	case *MemberExpression:
+		copied := *node
+		copied.Object, _ = Modify(node.Object, modifier).(Expression)
+		return modifier(&copied)
+
+	case *IfExpression:
+		copied := *node
+		copied.Condition, _ = Modify(node.Condition, modifier).(Expression)
+		copied.Consequence, _ = Modify(node.Consequence, modifier).(*BlockStatement)
+		if node.Alternative != nil {
+			copied.Alternative, _ = Modify(node.Alternative, modifier).(*BlockStatement)
+		}
+		return modifier(&copied)
+
+	case *FunctionLiteral:
+		copied := *node
+		copied.Parameters, copied.Defaults, copied.Rest = modifyParameters(node.Parameters, node.Defaults, node.Rest, modifier)
+		copied.Body, _ = Modify(node.Body, modifier).(*BlockStatement)
+		return modifier(&copied)
+
+	case *MacroLiteral:
+		copied := *node
+		copied.Parameters, copied.Defaults, copied.Rest = modifyParameters(node.Parameters, node.Defaults, node.Rest, modifier)
+		copied.Body, _ = Modify(node.Body, modifier).(*BlockStatement)
+		return modifier(&copied)
+
+	case *CallExpression:
+		copied := *node
+		copied.Function, _ = Modify(node.Function, modifier).(Expression)
+		copied.Arguments = modifyExpressions(node.Arguments, modifier)
+		return modifier(&copied)
+
+	case *ArrayLiteral:
+		copied := *node
+		copied.Elements = modifyExpressions(node.Elements, modifier)
+		return modifier(&copied)
+
+	case *HashLiteral:
+		copied := *node
+		copied.Pairs = make([]HashPair, len(node.Pairs))
+		for i, pair := range node.Pairs {
+			copied.Pairs[i].Key, _ = Modify(pair.Key, modifier).(Expression)
+			copied.Pairs[i].Value, _ = Modify(pair.Value, modifier).(Expression)
+		}
+		return modifier(&copied)
+
+	case *SpreadExpression:
+		copied := *node
+		copied.Value, _ = Modify(node.Value, modifier).(Expression)
+		return modifier(&copied)
+
+	case *MatchExpression:
+		copied := *node
+		copied.Subject, _ = Modify(node.Subject, modifier).(Expression)
+		copied.Arms = make([]*MatchArm, len(node.Arms))
+		for i, arm := range node.Arms {
+			armCopy := &MatchArm{}
+			armCopy.Pattern, _ = Modify(arm.Pattern, modifier).(Pattern)
+			if arm.Guard != nil {
+				armCopy.Guard, _ = Modify(arm.Guard, modifier).(Expression)
+			}
+			armCopy.Body, _ = Modify(arm.Body, modifier).(*BlockStatement)
+			copied.Arms[i] = armCopy
+		}
+		return modifier(&copied)
+
+	case *LiteralPattern:
+		copied := *node
+		copied.Value, _ = Modify(node.Value, modifier).(Expression)
+		return modifier(&copied)
+
+	case *ArrayPattern:
+		copied := *node
+		copied.Elements = make([]Pattern, len(node.Elements))
+		for i, el := range node.Elements {
+			copied.Elements[i], _ = Modify(el, modifier).(Pattern)
+		}
+		if node.Rest != nil {
+			copied.Rest, _ = Modify(node.Rest, modifier).(*Identifier)
+		}
+		return modifier(&copied)
+
+	case *HashPattern:
+		copied := *node
+		copied.Pairs = make([]HashPatternPair, len(node.Pairs))
+		for i, pair := range node.Pairs {
+			copied.Pairs[i].Key, _ = Modify(pair.Key, modifier).(Expression)
+			copied.Pairs[i].Value, _ = Modify(pair.Value, modifier).(Pattern)
+		}
+		return modifier(&copied)
+
+	case nil:
+		return nil
+	}
+
+	return modifier(node)
+}
+
+func modifyStatements(statements []Statement, modifier ModifierFunc) []Statement {
+	modified := make([]Statement, 0, len(statements))
+	for _, stmt := range statements {
+		if stmt, ok := Modify(stmt, modifier).(Statement); ok {
+			modified = append(modified, stmt)
+		}
+	}
+	return modified
+}
+
+func modifyExpressions(expressions []Expression, modifier ModifierFunc) []Expression {
+	modified := make([]Expression, len(expressions))
+	for i, expr := range expressions {
+		modified[i], _ = Modify(expr, modifier).(Expression)
+	}
+	return modified
+}
+
+func modifyParameters(
+	parameters []Pattern,
+	defaults []Expression,
+	rest *Identifier,
+	modifier ModifierFunc,
+) ([]Pattern, []Expression, *Identifier) {
+	modifiedParameters := make([]Pattern, len(parameters))
+	for i, param := range parameters {
+		modifiedParameters[i], _ = Modify(param, modifier).(Pattern)
+	}
+
+	modifiedDefaults := make([]Expression, len(defaults))
+	for i, value := range defaults {
+		if value != nil {
+			modifiedDefaults[i], _ = Modify(value, modifier).(Expression)
+		}
+	}
+
+	if rest != nil {
+		rest, _ = Modify(rest, modifier).(*Identifier)
+	}
+
+	return modifiedParameters, modifiedDefaults, rest
+}
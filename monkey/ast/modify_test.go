@@ -0,0 +1,144 @@
+package ast
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestModify(t *testing.T) {
+	one := func() Expression { return &IntegerLiteral{Value: 1} }
+	two := func() Expression { return &IntegerLiteral{Value: 2} }
+	ident := func(name string) *Identifier { return &Identifier{Value: name} }
+	block := func(expr Expression) *BlockStatement {
+		return &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: expr}}}
+	}
+
+	turnOneIntoTwo := func(node Node) Node {
+		integer, ok := node.(*IntegerLiteral)
+		if !ok || integer.Value != 1 {
+			return node
+		}
+		return &IntegerLiteral{Value: 2}
+	}
+
+	tests := []struct {
+		input    Node
+		expected Node
+	}{
+		{one(), two()},
+		{
+			&Program{Statements: []Statement{&ExpressionStatement{Expression: one()}}},
+			&Program{Statements: []Statement{&ExpressionStatement{Expression: two()}}},
+		},
+		{
+			&InfixExpression{Left: one(), Operator: "+", Right: two()},
+			&InfixExpression{Left: two(), Operator: "+", Right: two()},
+		},
+		{
+			&PrefixExpression{Operator: "-", Right: one()},
+			&PrefixExpression{Operator: "-", Right: two()},
+		},
+		{
+			&IndexExpression{Left: one(), Index: one()},
+			&IndexExpression{Left: two(), Index: two()},
+		},
+		{
+			&IfExpression{Condition: one(), Consequence: block(one()), Alternative: block(one())},
+			&IfExpression{Condition: two(), Consequence: block(two()), Alternative: block(two())},
+		},
+		{
+			&ReturnStatement{ReturnValue: one()},
+			&ReturnStatement{ReturnValue: two()},
+		},
+		{
+			&LetStatement{Name: ident("x"), Value: one()},
+			&LetStatement{Name: ident("x"), Value: two()},
+		},
+		{
+			&FunctionLiteral{
+				Parameters: []Pattern{ident("x"), ident("y")},
+				Defaults:   []Expression{nil, one()},
+				Body:       block(one()),
+			},
+			&FunctionLiteral{
+				Parameters: []Pattern{ident("x"), ident("y")},
+				Defaults:   []Expression{nil, two()},
+				Body:       block(two()),
+			},
+		},
+		{
+			&MacroLiteral{Parameters: []Pattern{}, Defaults: []Expression{}, Body: block(one())},
+			&MacroLiteral{Parameters: []Pattern{}, Defaults: []Expression{}, Body: block(two())},
+		},
+		{
+			&CallExpression{Function: ident("f"), Arguments: []Expression{one(), &SpreadExpression{Value: one()}}},
+			&CallExpression{Function: ident("f"), Arguments: []Expression{two(), &SpreadExpression{Value: two()}}},
+		},
+		{
+			&ArrayLiteral{Elements: []Expression{one(), one()}},
+			&ArrayLiteral{Elements: []Expression{two(), two()}},
+		},
+		{
+			&HashLiteral{Pairs: []HashPair{{Key: one(), Value: one()}}},
+			&HashLiteral{Pairs: []HashPair{{Key: two(), Value: two()}}},
+		},
+		{
+			&AssignExpression{Name: ident("x"), Value: one()},
+			&AssignExpression{Name: ident("x"), Value: two()},
+		},
+		{
+			&WhileStatement{Condition: one(), Body: block(one())},
+			&WhileStatement{Condition: two(), Body: block(two())},
+		},
+		{
+			&ForStatement{Value: ident("x"), Iterable: one(), Body: block(one())},
+			&ForStatement{Value: ident("x"), Iterable: two(), Body: block(two())},
+		},
+		{
+			&MemberExpression{Object: one(), Property: ident("x")},
+			&MemberExpression{Object: two(), Property: ident("x")},
+		},
+		{
+			&ExportStatement{Statement: &LetStatement{Name: ident("x"), Value: one()}},
+			&ExportStatement{Statement: &LetStatement{Name: ident("x"), Value: two()}},
+		},
+		{
+			&MatchExpression{
+				Subject: one(),
+				Arms: []*MatchArm{{
+					Pattern: &ArrayPattern{Elements: []Pattern{&LiteralPattern{Value: one()}}},
+					Guard:   one(),
+					Body:    block(one()),
+				}, {
+					Pattern: &HashPattern{Pairs: []HashPatternPair{{Key: one(), Value: &LiteralPattern{Value: one()}}}},
+					Body:    block(one()),
+				}},
+			},
+			&MatchExpression{
+				Subject: two(),
+				Arms: []*MatchArm{{
+					Pattern: &ArrayPattern{Elements: []Pattern{&LiteralPattern{Value: two()}}},
+					Guard:   two(),
+					Body:    block(two()),
+				}, {
+					Pattern: &HashPattern{Pairs: []HashPatternPair{{Key: two(), Value: &LiteralPattern{Value: two()}}}},
+					Body:    block(two()),
+				}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		before := tt.input.String()
+
+		modified := Modify(tt.input, turnOneIntoTwo)
+
+		if !reflect.DeepEqual(modified, tt.expected) {
+			t.Errorf("expected %#v, got %#v", tt.expected, modified)
+		}
+
+		if tt.input.String() != before {
+			t.Errorf("Modify changed its input: expected %q, got %q", before, tt.input.String())
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package ast
+
+import (
+	"bytes"
+	"monkey/token"
+	"strings"
+)
+
+// Pattern is the left-hand side of a match arm. A value is tested against a
+// pattern and, if it fits, the identifiers in the pattern are bound.
+type Pattern interface {
+	Node
+	patternNode()
+}
+
+// An Identifier used as a pattern matches any value and binds it.
+func (i *Identifier) patternNode() {}
+
+type WildcardPattern struct {
+	Token token.Token
+}
+
+func (wp *WildcardPattern) patternNode()         {}
+func (wp *WildcardPattern) TokenLiteral() string { return wp.Token.Value }
+func (wp *WildcardPattern) String() string       { return "_" }
+
+// LiteralPattern matches values equal to an integer, string or boolean
+// literal.
+type LiteralPattern struct {
+	Token token.Token
+	Value Expression
+}
+
+func (lp *LiteralPattern) patternNode()         {}
+func (lp *LiteralPattern) TokenLiteral() string { return lp.Token.Value }
+func (lp *LiteralPattern) String() string       { return lp.Value.String() }
+
+// ArrayPattern matches arrays element by element. Without a rest element the
+// array must have exactly len(Elements) elements; with one, the remaining
+// elements are collected into a new array bound to Rest.
+type ArrayPattern struct {
+	Token    token.Token
+	Elements []Pattern
+	Rest     *Identifier
+}
+
+func (ap *ArrayPattern) patternNode()         {}
+func (ap *ArrayPattern) TokenLiteral() string { return ap.Token.Value }
+func (ap *ArrayPattern) String() string {
+	var str bytes.Buffer
+
+	elements := []string{}
+	for _, el := range ap.Elements {
+		elements = append(elements, el.String())
+	}
+	if ap.Rest != nil {
+		elements = append(elements, "..."+ap.Rest.String())
+	}
+
+	str.WriteString("[")
+	str.WriteString(strings.Join(elements, ", "))
+	str.WriteString("]")
+
+	return str.String()
+}
+
+type HashPatternPair struct {
+	Key   Expression
+	Value Pattern
+}
+
+// HashPattern matches hashes that contain every listed key, testing each
+// value against its pattern. Keys not listed in the pattern are ignored.
+type HashPattern struct {
+	Token token.Token
+	Pairs []HashPatternPair
+}
+
+func (hp *HashPattern) patternNode()         {}
+func (hp *HashPattern) TokenLiteral() string { return hp.Token.Value }
+func (hp *HashPattern) String() string {
+	var str bytes.Buffer
+
+	pairs := []string{}
+	for _, pair := range hp.Pairs {
+		pairs = append(pairs, pair.Key.String()+": "+pair.Value.String())
+	}
+
+	str.WriteString("{")
+	str.WriteString(strings.Join(pairs, ", "))
+	str.WriteString("}")
+
+	return str.String()
+}
+
+// PatternNames returns the names a pattern binds, in source order.
+func PatternNames(pattern Pattern) []string {
+	names := []string{}
+	for _, ident := range PatternIdentifiers(pattern) {
+		names = append(names, ident.Value)
+	}
+	return names
+}
+
+// PatternIdentifiers returns the identifiers a pattern binds, in source
+// order. The `_` rest of an array pattern binds nothing.
+func PatternIdentifiers(pattern Pattern) []*Identifier {
+	idents := []*Identifier{}
+
+	switch pattern := pattern.(type) {
+	case *Identifier:
+		idents = append(idents, pattern)
+	case *ArrayPattern:
+		for _, el := range pattern.Elements {
+			idents = append(idents, PatternIdentifiers(el)...)
+		}
+		if pattern.Rest != nil && pattern.Rest.Value != "_" {
+			idents = append(idents, pattern.Rest)
+		}
+	case *HashPattern:
+		for _, pair := range pattern.Pairs {
+			idents = append(idents, PatternIdentifiers(pair.Value)...)
+		}
+	}
+
+	return idents
+}
+
+// MatchArm is one arm of a match expression. Locals is filled in by the
+// resolver with the name of each slot of the arm's frame.
+type MatchArm struct {
+	Pattern Pattern
+	Guard   Expression
+	Body    *BlockStatement
+	Locals  []string
+}
+
+func (ma *MatchArm) String() string {
+	var str bytes.Buffer
+
+	str.WriteString(ma.Pattern.String())
+	if ma.Guard != nil {
+		str.WriteString(" if " + ma.Guard.String())
+	}
+	str.WriteString(" => ")
+	str.WriteString(ma.Body.String())
+
+	return str.String()
+}
+
+type MatchExpression struct {
+	Token   token.Token
+	Subject Expression
+	Arms    []*MatchArm
+}
+
+func (me *MatchExpression) expressionNode()      {}
+func (me *MatchExpression) TokenLiteral() string { return me.Token.Value }
+func (me *MatchExpression) String() string {
+	var str bytes.Buffer
+
+	arms := []string{}
+	for _, arm := range me.Arms {
+		arms = append(arms, arm.String())
+	}
+
+	str.WriteString("match (")
+	str.WriteString(me.Subject.String())
+	str.WriteString(") { ")
+	str.WriteString(strings.Join(arms, ", "))
+	str.WriteString(" }")
+
+	return str.String()
+}
@@ -0,0 +1,124 @@
+package ast
+
+import "monkey/token"
+
+// TokenOf returns the token a node was parsed from. Program has none, and
+// nodes built outside the parser may carry a token without a position.
+func TokenOf(node Node) token.Token {
+	switch n := node.(type) {
+	case *Identifier:
+		return n.Token
+	case *LetStatement:
+		return n.Token
+	case *ReturnStatement:
+		return n.Token
+	case *ExpressionStatement:
+		return n.Token
+	case *BlockStatement:
+		return n.Token
+	case *ImportStatement:
+		return n.Token
+	case *ExportStatement:
+		return n.Token
+	case *WhileStatement:
+		return n.Token
+	case *ForStatement:
+		return n.Token
+	case *BreakStatement:
+		return n.Token
+	case *ContinueStatement:
+		return n.Token
+	case *IntegerLiteral:
+		return n.Token
+	case *StringLiteral:
+		return n.Token
+	case *Boolean:
+		return n.Token
+	case *PrefixExpression:
+		return n.Token
+	case *InfixExpression:
+		return n.Token
+	case *AssignExpression:
+		return n.Token
+	case *IndexExpression:
+		return n.Token
+	case *MemberExpression:
+		return n.Token
+	case *IfExpression:
+		return n.Token
+	case *FunctionLiteral:
+		return n.Token
+	case *MacroLiteral:
+		return n.Token
+	case *CallExpression:
+		return n.Token
+	case *ArrayLiteral:
+		return n.Token
+	case *HashLiteral:
+		return n.Token
+	case *SpreadExpression:
+		return n.Token
+	case *MatchExpression:
+		return n.Token
+	case *WildcardPattern:
+		return n.Token
+	case *LiteralPattern:
+		return n.Token
+	case *ArrayPattern:
+		return n.Token
+	case *HashPattern:
+		return n.Token
+	case *NamedType:
+		return n.Token
+	case *ArrayType:
+		return n.Token
+	case *FunctionType:
+		return n.Token
+	}
+	return token.Token{}
+}
+
+// Pos returns the position of the first token of node: for `a + b` that is
+// the position of `a`, not of the operator.
+func Pos(node Node) token.Position {
+	var start token.Position
+
+	Inspect(node, func(n Node) bool {
+		if n == nil {
+			return false
+		}
+		pos := TokenOf(n).Position
+		if pos.IsValid() && (!start.IsValid() || pos.Before(start)) {
+			start = pos
+		}
+		return true
+	})
+
+	return start
+}
+
+// NodeAt returns the innermost node under root whose token covers pos,
+// together with its ancestors from root down to its parent. It returns nil
+// if no token covers pos.
+func NodeAt(root Node, pos token.Position) (Node, []Node) {
+	var found Node
+	var path, stack []Node
+
+	Inspect(root, func(n Node) bool {
+		if n == nil {
+			stack = stack[:len(stack)-1]
+			return false
+		}
+
+		tok := TokenOf(n)
+		if tok.Position.IsValid() && !pos.Before(tok.Position) && pos.Before(tok.End()) {
+			found = n
+			path = append([]Node{}, stack...)
+		}
+
+		stack = append(stack, n)
+		return true
+	})
+
+	return found, path
+}
@@ -0,0 +1,213 @@
+package ast_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"monkey/ast"
+	"monkey/lexer"
+	"monkey/parser"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var stringCorpus = []string{
+	everySyntax,
+	`let s = "hello world"; puts(s + "!");`,
+	`let fib = function(n) { if (n < 2) { return n; } fib(n - 1) + fib(n - 2) }; fib(10);`,
+	`let f = function() {}; f()`,
+	`if (a) { b } else { if (c) { d } }`,
+	`[1, "two", [3], {"four": 4}][0]`,
+	`let counter = 0; while (counter < 10) { counter = counter + 1; if (counter == 5) { break; } }`,
+	`for (k, v in {"a": 1}) { puts(k, v); }`,
+	`f; (x)`,
+	`-a * b; !(true == false); a - -b`,
+	`a && b || !c; x & y | z ^ w << 1 >> 2 % 3`,
+	`function(x) { x }(1)(2)`,
+	`let [first, ...others] = list; let {"name": name} = person;`,
+	`match (x) { [a, b] if a > b => { a }, {"k": _} => "hash", "s" => 1, true => 2, _ => { let y = 1; y } }`,
+	`let m = macro(a, ...b) { quote(unquote(a)) };`,
+	`import "lib/math" as math; export let pi = math.pi;`,
+	`f(...args, 1); [...xs, 2]`,
+	`let g = function(a, b = a * 2, ...rest) { return [a, b, rest]; };`,
+	`let n: int = 1; let h = function(x: [int], y: any = null, ...z: [string]): function(): hash { function() { {} } };`,
+	`let [a, b]: [bool] = [true, false]; function(): null {}`,
+}
+
+// structure encodes node as JSON with every token removed, so that two
+// trees can be compared independently of how they were written.
+func structure(t *testing.T, node ast.Node) interface{} {
+	t.Helper()
+
+	encoded, err := ast.EncodeJSON(node)
+	if err != nil {
+		t.Fatalf("could not encode: %s", err)
+	}
+
+	var decoded interface{}
+	if err := json.Unmarshal(encoded, &decoded); err != nil {
+		t.Fatalf("could not decode: %s", err)
+	}
+	return withoutTokens(decoded)
+}
+
+func withoutTokens(value interface{}) interface{} {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		delete(value, "token")
+		for key, v := range value {
+			value[key] = withoutTokens(v)
+		}
+	case []interface{}:
+		for i, v := range value {
+			value[i] = withoutTokens(v)
+		}
+	}
+	return value
+}
+
+func parseOrReport(input string) (*ast.Program, []string) {
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	return program, p.Errors()
+}
+
+func testStringRoundTrip(t *testing.T, input string) {
+	t.Helper()
+
+	program, errs := parseOrReport(input)
+	if len(errs) != 0 {
+		t.Fatalf("could not parse %q: %v", input, errs)
+	}
+
+	printed := program.String()
+	reparsed, errs := parseOrReport(printed)
+	if len(errs) != 0 {
+		t.Fatalf("could not parse the String() of %q, %q: %v", input, printed, errs)
+	}
+
+	if !reflect.DeepEqual(structure(t, reparsed), structure(t, program)) {
+		t.Fatalf("String() of %q changed its meaning: %q parses as %q", input, printed, reparsed.String())
+	}
+
+	if reparsed.String() != printed {
+		t.Fatalf("String() is not stable for %q: %q, then %q", input, printed, reparsed.String())
+	}
+}
+
+func TestStringRoundTrip(t *testing.T) {
+	for _, input := range stringCorpus {
+		testStringRoundTrip(t, input)
+	}
+}
+
+func TestStringRoundTripGenerated(t *testing.T) {
+	for seed := int64(0); seed < 300; seed++ {
+		g := &generator{rand: rand.New(rand.NewSource(seed))}
+		testStringRoundTrip(t, g.program())
+	}
+}
+
+// generator writes random, syntactically valid programs.
+type generator struct {
+	rand *rand.Rand
+}
+
+var (
+	generatedNames     = []string{"a", "b", "foo", "bar_baz"}
+	generatedOperators = []string{
+		"+", "-", "*", "/", "%", "==", "!=", "<", ">", "<=", ">=",
+		"&&", "||", "&", "|", "^", "<<", ">>",
+	}
+)
+
+func (g *generator) pick(choices []string) string {
+	return choices[g.rand.Intn(len(choices))]
+}
+
+func (g *generator) program() string {
+	statements := []string{}
+	for i := g.rand.Intn(4) + 1; i > 0; i-- {
+		statements = append(statements, g.statement(3, false))
+	}
+	return strings.Join(statements, "\n")
+}
+
+func (g *generator) block(depth int, inLoop bool) string {
+	statements := []string{}
+	for i := g.rand.Intn(3); i > 0; i-- {
+		statements = append(statements, g.statement(depth, inLoop))
+	}
+	return "{ " + strings.Join(statements, " ") + " }"
+}
+
+func (g *generator) statement(depth int, inLoop bool) string {
+	switch g.rand.Intn(8) {
+	case 0:
+		return "let " + g.pick(generatedNames) + " = " + g.expression(depth) + ";"
+	case 1:
+		return "let [" + g.pick(generatedNames) + ", ..." + g.pick(generatedNames) + "] = " + g.expression(depth) + ";"
+	case 2:
+		return "return " + g.expression(depth) + ";"
+	case 3:
+		return "while (" + g.expression(depth) + ") " + g.block(depth-1, true)
+	case 4:
+		return "for (" + g.pick(generatedNames) + " in " + g.expression(depth) + ") " + g.block(depth-1, true)
+	case 5:
+		if inLoop {
+			return g.pick([]string{"break;", "continue;"})
+		}
+	}
+	return g.expression(depth) + ";"
+}
+
+func (g *generator) expression(depth int) string {
+	if depth <= 0 {
+		return g.atom()
+	}
+
+	e := func() string { return g.expression(depth - 1) }
+
+	switch g.rand.Intn(14) {
+	case 0:
+		return g.pick([]string{"-", "!"}) + e()
+	case 1, 2:
+		return e() + " " + g.pick(generatedOperators) + " " + e()
+	case 3:
+		return g.pick(generatedNames) + "(" + e() + ", ..." + e() + ")"
+	case 4:
+		return g.atom() + "[" + e() + "]"
+	case 5:
+		return "[" + e() + ", " + e() + "]"
+	case 6:
+		return `{"key": ` + e() + ", " + g.atom() + ": " + e() + "}"
+	case 7:
+		return fmt.Sprintf("function(%s, %s = %s) %s", g.pick(generatedNames), "z", e(), g.block(depth-1, false))
+	case 8:
+		return "if (" + e() + ") " + g.block(depth-1, false) + " else " + g.block(depth-1, false)
+	case 9:
+		return g.pick(generatedNames) + "." + g.pick(generatedNames)
+	case 10:
+		return "match (" + e() + ") { 1 => " + g.block(depth-1, false) +
+			", [x, ...rest] if " + e() + " => " + g.block(depth-1, false) +
+			`, {"k": v} => ` + g.block(depth-1, false) + ", _ => " + g.block(depth-1, false) + " }"
+	case 11:
+		return "(" + e() + ")"
+	case 12:
+		return "(" + g.pick(generatedNames) + " = " + e() + ")"
+	}
+	return g.atom()
+}
+
+func (g *generator) atom() string {
+	switch g.rand.Intn(4) {
+	case 0:
+		return fmt.Sprint(g.rand.Intn(1000))
+	case 1:
+		return `"` + g.pick(generatedNames) + ` and more"`
+	case 2:
+		return g.pick([]string{"true", "false"})
+	}
+	return g.pick(generatedNames)
+}
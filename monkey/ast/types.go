@@ -0,0 +1,66 @@
+package ast
+
+import (
+	"bytes"
+	"monkey/token"
+	"strings"
+)
+
+// TypeExpression is a type written in an annotation, such as the `int` in
+// `let x: int = 1`.
+type TypeExpression interface {
+	Node
+	typeExpressionNode()
+}
+
+// NamedType is one of the builtin types: int, string, bool, null, hash,
+// range, or any, which every value fits.
+type NamedType struct {
+	Token token.Token
+	Name  string
+}
+
+func (nt *NamedType) typeExpressionNode()  {}
+func (nt *NamedType) TokenLiteral() string { return nt.Token.Value }
+func (nt *NamedType) String() string       { return nt.Name }
+
+// ArrayType is `[T]`, the type of arrays whose elements all have type T.
+type ArrayType struct {
+	Token   token.Token
+	Element TypeExpression
+}
+
+func (at *ArrayType) typeExpressionNode()  {}
+func (at *ArrayType) TokenLiteral() string { return at.Token.Value }
+func (at *ArrayType) String() string       { return "[" + at.Element.String() + "]" }
+
+// FunctionType is `function(T, U): R`.
+type FunctionType struct {
+	Token      token.Token
+	Parameters []TypeExpression
+	Return     TypeExpression
+}
+
+func (ft *FunctionType) typeExpressionNode()  {}
+func (ft *FunctionType) TokenLiteral() string { return ft.Token.Value }
+func (ft *FunctionType) String() string {
+	var str bytes.Buffer
+
+	params := []string{}
+	for _, p := range ft.Parameters {
+		params = append(params, p.String())
+	}
+
+	str.WriteString(ft.TokenLiteral() + "(")
+	str.WriteString(strings.Join(params, ", "))
+	str.WriteString("): ")
+	str.WriteString(ft.Return.String())
+
+	return str.String()
+}
+
+// TypeNames lists the names a NamedType may have.
+var TypeNames = map[string]bool{
+	"int": true, "string": true, "bool": true, "null": true,
+	"hash": true, "range": true, "any": true,
+}
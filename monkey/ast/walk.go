@@ -0,0 +1,285 @@
+package ast
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// A Visitor's Visit method is called by Walk for every node. If it returns a
+// non-nil Visitor w, Walk visits the children of node with w and then calls
+// w.Visit(nil).
+type Visitor interface {
+	Visit(node Node) (w Visitor)
+}
+
+// Walk traverses the tree rooted at node depth-first, in source order.
+func Walk(v Visitor, node Node) {
+	if v = v.Visit(node); v == nil {
+		return
+	}
+
+	eachChild(node, func(child Node, _ func(Node)) {
+		Walk(v, child)
+	})
+
+	v.Visit(nil)
+}
+
+type inspector func(Node) bool
+
+func (f inspector) Visit(node Node) Visitor {
+	if f(node) {
+		return f
+	}
+	return nil
+}
+
+// Inspect traverses the tree rooted at node depth-first, calling f for each
+// node and then f(nil) once its children are done. When f returns false the
+// children of that node are skipped.
+func Inspect(node Node, f func(Node) bool) {
+	Walk(inspector(f), node)
+}
+
+// Rewrite traverses the tree rooted at node bottom-up and replaces each node
+// with the result of f, which receives the node and its parent (nil for the
+// root). Unlike Modify, Rewrite works in place: parents are kept and only
+// the replaced field changes, so pointers into the tree stay valid. It
+// returns the new root.
+//
+// The replacement must fit the field it is stored in; returning, say, a
+// statement where an expression is expected panics.
+func Rewrite(node Node, f func(node, parent Node) Node) Node {
+	return rewrite(node, nil, f)
+}
+
+func rewrite(node, parent Node, f func(node, parent Node) Node) Node {
+	eachChild(node, func(child Node, replace func(Node)) {
+		if replaced := rewrite(child, node, f); replaced != child {
+			replace(replaced)
+		}
+	})
+	return f(node, parent)
+}
+
+// Complete reports whether the tree rooted at node has all the parts its
+// node types require. After a syntax error the parser may leave nodes with
+// parts missing, such as the right operand of "1 +", which cannot be
+// printed or walked.
+func Complete(node Node) bool {
+	if isNil(node) {
+		return false
+	}
+
+	complete := true
+	eachChild(node, func(child Node, _ func(Node)) {
+		complete = complete && Complete(child)
+	})
+	return complete
+}
+
+// isNil reports whether node is nil or a nil pointer.
+func isNil(node Node) bool {
+	if node == nil {
+		return true
+	}
+	v := reflect.ValueOf(node)
+	return v.Kind() == reflect.Ptr && v.IsNil()
+}
+
+// eachChild calls fn for every direct child of node, in source order, along
+// with a function that replaces that child inside node. Optional children
+// that are nil are skipped, while required ones are passed on even if
+// missing, which is how Complete finds them. Every node type must be listed
+// here; walking an unknown one panics so that missing cases are caught by
+// the tests.
+func eachChild(node Node, fn func(child Node, replace func(Node))) {
+	switch n := node.(type) {
+	case *Program:
+		for i := range n.Statements {
+			i := i
+			fn(n.Statements[i], func(c Node) { n.Statements[i] = c.(Statement) })
+		}
+
+	case *BlockStatement:
+		for i := range n.Statements {
+			i := i
+			fn(n.Statements[i], func(c Node) { n.Statements[i] = c.(Statement) })
+		}
+
+	case *ExpressionStatement:
+		if n.Expression != nil {
+			fn(n.Expression, func(c Node) { n.Expression = c.(Expression) })
+		}
+
+	case *LetStatement:
+		fn(n.Name, func(c Node) { n.Name = c.(Pattern) })
+		if n.Type != nil {
+			fn(n.Type, func(c Node) { n.Type = c.(TypeExpression) })
+		}
+		if n.Value != nil {
+			fn(n.Value, func(c Node) { n.Value = c.(Expression) })
+		}
+
+	case *ReturnStatement:
+		if n.ReturnValue != nil {
+			fn(n.ReturnValue, func(c Node) { n.ReturnValue = c.(Expression) })
+		}
+
+	case *ImportStatement:
+		if n.Name != nil {
+			fn(n.Name, func(c Node) { n.Name = c.(*Identifier) })
+		}
+
+	case *ExportStatement:
+		fn(n.Statement, func(c Node) { n.Statement = c.(*LetStatement) })
+
+	case *WhileStatement:
+		fn(n.Condition, func(c Node) { n.Condition = c.(Expression) })
+		fn(n.Body, func(c Node) { n.Body = c.(*BlockStatement) })
+
+	case *ForStatement:
+		if n.Key != nil {
+			fn(n.Key, func(c Node) { n.Key = c.(*Identifier) })
+		}
+		fn(n.Value, func(c Node) { n.Value = c.(*Identifier) })
+		fn(n.Iterable, func(c Node) { n.Iterable = c.(Expression) })
+		fn(n.Body, func(c Node) { n.Body = c.(*BlockStatement) })
+
+	case *PrefixExpression:
+		fn(n.Right, func(c Node) { n.Right = c.(Expression) })
+
+	case *InfixExpression:
+		fn(n.Left, func(c Node) { n.Left = c.(Expression) })
+		fn(n.Right, func(c Node) { n.Right = c.(Expression) })
+
+	case *AssignExpression:
+		fn(n.Name, func(c Node) { n.Name = c.(*Identifier) })
+		fn(n.Value, func(c Node) { n.Value = c.(Expression) })
+
+	case *IndexExpression:
+		fn(n.Left, func(c Node) { n.Left = c.(Expression) })
+		fn(n.Index, func(c Node) { n.Index = c.(Expression) })
+
+	case *MemberExpression:
+		fn(n.Object, func(c Node) { n.Object = c.(Expression) })
+		fn(n.Property, func(c Node) { n.Property = c.(*Identifier) })
+
+	case *IfExpression:
+		fn(n.Condition, func(c Node) { n.Condition = c.(Expression) })
+		fn(n.Consequence, func(c Node) { n.Consequence = c.(*BlockStatement) })
+		if n.Alternative != nil {
+			fn(n.Alternative, func(c Node) { n.Alternative = c.(*BlockStatement) })
+		}
+
+	case *FunctionLiteral:
+		eachParameter(n.Parameters, n.ParameterTypes, n.Defaults, &n.Rest, &n.RestType, fn)
+		if n.ReturnType != nil {
+			fn(n.ReturnType, func(c Node) { n.ReturnType = c.(TypeExpression) })
+		}
+		fn(n.Body, func(c Node) { n.Body = c.(*BlockStatement) })
+
+	case *MacroLiteral:
+		eachParameter(n.Parameters, nil, n.Defaults, &n.Rest, nil, fn)
+		fn(n.Body, func(c Node) { n.Body = c.(*BlockStatement) })
+
+	case *CallExpression:
+		fn(n.Function, func(c Node) { n.Function = c.(Expression) })
+		eachExpression(n.Arguments, fn)
+
+	case *ArrayLiteral:
+		eachExpression(n.Elements, fn)
+
+	case *HashLiteral:
+		for i := range n.Pairs {
+			pair := &n.Pairs[i]
+			fn(pair.Key, func(c Node) { pair.Key = c.(Expression) })
+			fn(pair.Value, func(c Node) { pair.Value = c.(Expression) })
+		}
+
+	case *SpreadExpression:
+		fn(n.Value, func(c Node) { n.Value = c.(Expression) })
+
+	case *MatchExpression:
+		fn(n.Subject, func(c Node) { n.Subject = c.(Expression) })
+		for _, arm := range n.Arms {
+			arm := arm
+			fn(arm.Pattern, func(c Node) { arm.Pattern = c.(Pattern) })
+			if arm.Guard != nil {
+				fn(arm.Guard, func(c Node) { arm.Guard = c.(Expression) })
+			}
+			fn(arm.Body, func(c Node) { arm.Body = c.(*BlockStatement) })
+		}
+
+	case *LiteralPattern:
+		fn(n.Value, func(c Node) { n.Value = c.(Expression) })
+
+	case *ArrayPattern:
+		for i := range n.Elements {
+			i := i
+			fn(n.Elements[i], func(c Node) { n.Elements[i] = c.(Pattern) })
+		}
+		if n.Rest != nil {
+			fn(n.Rest, func(c Node) { n.Rest = c.(*Identifier) })
+		}
+
+	case *HashPattern:
+		for i := range n.Pairs {
+			pair := &n.Pairs[i]
+			fn(pair.Key, func(c Node) { pair.Key = c.(Expression) })
+			fn(pair.Value, func(c Node) { pair.Value = c.(Pattern) })
+		}
+
+	case *ArrayType:
+		fn(n.Element, func(c Node) { n.Element = c.(TypeExpression) })
+
+	case *FunctionType:
+		for i := range n.Parameters {
+			i := i
+			fn(n.Parameters[i], func(c Node) { n.Parameters[i] = c.(TypeExpression) })
+		}
+		fn(n.Return, func(c Node) { n.Return = c.(TypeExpression) })
+
+	case *Identifier, *IntegerLiteral, *Boolean, *StringLiteral,
+		*BreakStatement, *ContinueStatement, *WildcardPattern, *NamedType:
+		// leaves
+
+	default:
+		panic(fmt.Sprintf("ast: unexpected node type %T", node))
+	}
+}
+
+func eachExpression(expressions []Expression, fn func(child Node, replace func(Node))) {
+	for i := range expressions {
+		i := i
+		fn(expressions[i], func(c Node) { expressions[i] = c.(Expression) })
+	}
+}
+
+// eachParameter visits a parameter list. types and restType may be nil for
+// lists that take no annotations.
+func eachParameter(
+	parameters []Pattern,
+	types []TypeExpression,
+	defaults []Expression,
+	rest **Identifier,
+	restType *TypeExpression,
+	fn func(child Node, replace func(Node)),
+) {
+	for i := range parameters {
+		i := i
+		fn(parameters[i], func(c Node) { parameters[i] = c.(Pattern) })
+		if i < len(types) && types[i] != nil {
+			fn(types[i], func(c Node) { types[i] = c.(TypeExpression) })
+		}
+		if i < len(defaults) && defaults[i] != nil {
+			fn(defaults[i], func(c Node) { defaults[i] = c.(Expression) })
+		}
+	}
+	if *rest != nil {
+		fn(*rest, func(c Node) { *rest = c.(*Identifier) })
+	}
+	if restType != nil && *restType != nil {
+		fn(*restType, func(c Node) { *restType = c.(TypeExpression) })
+	}
+}
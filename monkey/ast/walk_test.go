@@ -0,0 +1,314 @@
+package ast_test
+
+import (
+	"fmt"
+	goast "go/ast"
+	goparser "go/parser"
+	gotoken "go/token"
+	"monkey/ast"
+	"monkey/lexer"
+	"monkey/parser"
+	"monkey/token"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// everySyntax uses every construct of the language, so that walking it
+// reaches every node type.
+const everySyntax = `
+import "lib" as lib;
+export let answer = 42;
+let [a, b, ...rest] = [1, 2, 3];
+let {"k": k} = {"k": "v"};
+let f = function(x, y = 1, ...more) { return x + y; };
+let typed: function([int], string): bool = function(xs: [int], s: string): bool { true };
+let m = macro(q) { quote(unquote(q)); };
+f(...rest);
+a = -a;
+lib.member;
+rest[0];
+if (true) { 1 } else { 2 };
+while (false) { break; }
+for (i, v in rest) { continue; }
+match (a) {
+	1 => "one",
+	[x, _] if x > 0 => x,
+	{"k": v} => v,
+	_ => null,
+};
+`
+
+func parse(t *testing.T, input string) *ast.Program {
+	t.Helper()
+
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+	return program
+}
+
+// declaredNodeTypes lists the node types declared in the ast package by
+// looking for TokenLiteral methods in its source.
+func declaredNodeTypes(t *testing.T) []string {
+	t.Helper()
+
+	fset := gotoken.NewFileSet()
+	packages, err := goparser.ParseDir(fset, ".", nil, 0)
+	if err != nil {
+		t.Fatalf("could not parse the ast package: %s", err)
+	}
+
+	types := []string{}
+	for _, file := range packages["ast"].Files {
+		for _, decl := range file.Decls {
+			fn, ok := decl.(*goast.FuncDecl)
+			if !ok || fn.Recv == nil || fn.Name.Name != "TokenLiteral" {
+				continue
+			}
+			receiver := fn.Recv.List[0].Type.(*goast.StarExpr).X.(*goast.Ident)
+			types = append(types, "*ast."+receiver.Name)
+		}
+	}
+	sort.Strings(types)
+	return types
+}
+
+func TestWalkCoversEveryNodeType(t *testing.T) {
+	program := parse(t, everySyntax)
+
+	visited := map[string]bool{}
+	ast.Inspect(program, func(node ast.Node) bool {
+		if node != nil {
+			visited[fmt.Sprintf("%T", node)] = true
+		}
+		return true
+	})
+
+	for _, name := range declaredNodeTypes(t) {
+		if !visited[name] {
+			t.Errorf("walking the program never reached a %s; add it to the walker and to everySyntax", name)
+		}
+	}
+}
+
+func TestEveryNodeHasAPosition(t *testing.T) {
+	program := parse(t, everySyntax)
+
+	ast.Inspect(program, func(node ast.Node) bool {
+		if node == nil {
+			return false
+		}
+		if _, ok := node.(*ast.Program); ok {
+			return true
+		}
+		if !ast.TokenOf(node).Position.IsValid() {
+			t.Errorf("%T %q has no position", node, node.String())
+		}
+		return true
+	})
+}
+
+type recorder struct {
+	visits *[]string
+}
+
+func (r recorder) Visit(node ast.Node) ast.Visitor {
+	if node == nil {
+		*r.visits = append(*r.visits, "end")
+		return nil
+	}
+	*r.visits = append(*r.visits, fmt.Sprintf("%T", node))
+	return r
+}
+
+func TestWalkOrder(t *testing.T) {
+	program := parse(t, `f(1 + x);`)
+
+	visits := []string{}
+	ast.Walk(recorder{&visits}, program)
+
+	expected := []string{
+		"*ast.Program",
+		"*ast.ExpressionStatement",
+		"*ast.CallExpression",
+		"*ast.Identifier", "end",
+		"*ast.InfixExpression",
+		"*ast.IntegerLiteral", "end",
+		"*ast.Identifier", "end",
+		"end",
+		"end",
+		"end",
+		"end",
+	}
+
+	if !reflect.DeepEqual(visits, expected) {
+		t.Errorf("expected visits %v, got %v", expected, visits)
+	}
+}
+
+func TestInspectSkipsChildren(t *testing.T) {
+	program := parse(t, `let f = function(x) { x }; y;`)
+
+	identifiers := []string{}
+	ast.Inspect(program, func(node ast.Node) bool {
+		if _, ok := node.(*ast.FunctionLiteral); ok {
+			return false
+		}
+		if ident, ok := node.(*ast.Identifier); ok {
+			identifiers = append(identifiers, ident.Value)
+		}
+		return true
+	})
+
+	expected := []string{"f", "y"}
+	if !reflect.DeepEqual(identifiers, expected) {
+		t.Errorf("expected identifiers %v, got %v", expected, identifiers)
+	}
+}
+
+func TestComplete(t *testing.T) {
+	if !ast.Complete(parse(t, everySyntax)) {
+		t.Errorf("expected a program without errors to be complete")
+	}
+
+	// Missing optional parts, such as the value of a return, are fine.
+	tests := []struct {
+		input    string
+		complete bool
+	}{
+		{`return;`, true},
+		{`let a = ;`, true},
+		{`1 + ;`, false},
+		{`-;`, false},
+		{`a = ;`, false},
+		{`function() { 1 + };`, false},
+		{`match (x) { 1 => };`, true},
+	}
+
+	for _, tt := range tests {
+		program := parser.New(lexer.New(tt.input)).ParseProgram()
+		if len(program.Statements) == 0 {
+			t.Fatalf("%s: expected a statement", tt.input)
+		}
+		if got := ast.Complete(program.Statements[0]); got != tt.complete {
+			t.Errorf("%s: expected Complete to be %v, got %v", tt.input, tt.complete, got)
+		}
+	}
+
+	if ast.Complete(&ast.WhileStatement{Condition: &ast.Boolean{Value: true}}) {
+		t.Errorf("expected a loop without a body to be incomplete")
+	}
+}
+
+func TestRewrite(t *testing.T) {
+	program := parse(t, `let f = function(x) { x + 1 }; [1, f(1)];`)
+
+	let := program.Statements[0].(*ast.LetStatement)
+	function := let.Value.(*ast.FunctionLiteral)
+	body := function.Body.Statements[0].(*ast.ExpressionStatement)
+
+	parents := map[string]bool{}
+	rewritten := ast.Rewrite(program, func(node, parent ast.Node) ast.Node {
+		integer, ok := node.(*ast.IntegerLiteral)
+		if !ok || integer.Value != 1 {
+			return node
+		}
+		parents[fmt.Sprintf("%T", parent)] = true
+		return &ast.IntegerLiteral{Token: token.Token{Type: token.INT, Value: "2"}, Value: 2}
+	})
+
+	if rewritten != ast.Node(program) {
+		t.Fatalf("expected the root to be kept")
+	}
+
+	expected := "let f = function(x) { (x + 2) }; [2, f(2)]"
+	if program.String() != expected {
+		t.Errorf("expected %q, got %q", expected, program.String())
+	}
+
+	// Parents are updated in place rather than copied.
+	if program.Statements[0] != let || let.Value != function || function.Body.Statements[0] != body {
+		t.Errorf("expected parents to be preserved")
+	}
+
+	for _, parent := range []string{"*ast.InfixExpression", "*ast.ArrayLiteral", "*ast.CallExpression"} {
+		if !parents[parent] {
+			t.Errorf("expected a replacement under %s", parent)
+		}
+	}
+}
+
+func TestRewriteRoot(t *testing.T) {
+	program := parse(t, `1`)
+	statement := program.Statements[0]
+
+	replaced := ast.Rewrite(statement, func(node, parent ast.Node) ast.Node {
+		if parent != nil {
+			return node
+		}
+		return &ast.ReturnStatement{Token: token.Token{Type: token.RETURN, Value: "return"}}
+	})
+
+	if _, ok := replaced.(*ast.ReturnStatement); !ok {
+		t.Errorf("expected the root to be replaced, got %T", replaced)
+	}
+}
+
+func TestNodeAt(t *testing.T) {
+	input := "let add = function(a, b) {\n  a + b\n};\nadd(1, \"two\");"
+	program := parse(t, input)
+
+	tests := []struct {
+		line, column int
+		expected     string
+		parent       string
+	}{
+		{1, 5, "add", "*ast.LetStatement"},
+		{1, 7, "add", "*ast.LetStatement"},
+		{1, 20, "a", "*ast.FunctionLiteral"},
+		{2, 3, "a", "*ast.InfixExpression"},
+		{2, 5, "(a + b)", "*ast.ExpressionStatement"},
+		{4, 1, "add", "*ast.CallExpression"},
+		{4, 8, `"two"`, "*ast.CallExpression"},
+		{4, 12, `"two"`, "*ast.CallExpression"},
+	}
+
+	for _, tt := range tests {
+		pos := token.Position{Line: tt.line, Column: tt.column}
+		node, path := ast.NodeAt(program, pos)
+		if node == nil {
+			t.Errorf("%s: expected %q, got nothing", pos, tt.expected)
+			continue
+		}
+
+		if node.String() != tt.expected {
+			t.Errorf("%s: expected %q, got %q", pos, tt.expected, node.String())
+		}
+
+		if _, ok := path[0].(*ast.Program); !ok {
+			t.Errorf("%s: expected the path to start at the program, got %T", pos, path[0])
+		}
+
+		if parent := fmt.Sprintf("%T", path[len(path)-1]); parent != tt.parent {
+			t.Errorf("%s: expected parent %s, got %s", pos, tt.parent, parent)
+		}
+	}
+
+	if node, _ := ast.NodeAt(program, token.Position{Line: 1, Column: 4}); node != nil {
+		t.Errorf("expected no node between tokens, got %T", node)
+	}
+}
+
+func TestPos(t *testing.T) {
+	program := parse(t, "let x =\n  y * 2;")
+
+	let := program.Statements[0].(*ast.LetStatement)
+
+	expected := token.Position{Line: 2, Column: 3}
+	if pos := ast.Pos(let.Value); pos != expected {
+		t.Errorf("expected %s, got %s", expected, pos)
+	}
+}
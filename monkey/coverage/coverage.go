@@ -0,0 +1,243 @@
+// Package coverage records which statements of Monkey files run, and which
+// arms of their if expressions, and reports it as text, HTML or LCOV.
+//
+// Coverage is kept by file and by source position rather than by syntax
+// tree, so profiles from different runs, of programs or of test suites,
+// can be saved, read back and merged.
+package coverage
+
+import (
+	"encoding/json"
+	"io"
+	"monkey/ast"
+	"monkey/evaluator"
+	"monkey/object"
+	"sort"
+)
+
+// Profile is the coverage of a set of files.
+type Profile struct {
+	Files map[string]*File `json:"files"`
+}
+
+// File is the coverage of one file. Statements and Branches are ordered by
+// position.
+type File struct {
+	Path       string       `json:"path"`
+	Statements []*Statement `json:"statements"`
+	Branches   []*Branch    `json:"branches"`
+}
+
+// Statement counts the runs of the statement that starts at a position.
+type Statement struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+	Count  int `json:"count"`
+}
+
+// Branch counts how often each arm of the if expression at a position was
+// taken. An if without else takes its else arm when the condition is false.
+type Branch struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+	Then   int `json:"then"`
+	Else   int `json:"else"`
+}
+
+// NewProfile returns an empty profile.
+func NewProfile() *Profile {
+	return &Profile{Files: make(map[string]*File)}
+}
+
+// Record makes in count what it runs into p. Only code from files counts,
+// so not that of the REPL, for instance. Record several interpreters into
+// one profile to add up their coverage.
+func (p *Profile) Record(in *evaluator.Interpreter) {
+	in.AddHook(&recorder{
+		profile:      p,
+		in:           in,
+		statements:   make(map[ast.Statement]*Statement),
+		ifs:          make(map[*ast.IfExpression]*Branch),
+		consequences: make(map[*ast.BlockStatement]*Branch),
+		alternatives: make(map[*ast.BlockStatement]*Branch),
+	})
+}
+
+// Sorted returns the files of p ordered by path.
+func (p *Profile) Sorted() []*File {
+	files := make([]*File, 0, len(p.Files))
+	for _, f := range p.Files {
+		files = append(files, f)
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+	return files
+}
+
+// Merge adds the counts of other to p.
+func (p *Profile) Merge(other *Profile) {
+	for _, theirs := range other.Sorted() {
+		ours := p.file(theirs.Path)
+		for _, s := range theirs.Statements {
+			ours.statement(s.Line, s.Column).Count += s.Count
+		}
+		for _, b := range theirs.Branches {
+			branch := ours.branch(b.Line, b.Column)
+			branch.Then += b.Then
+			branch.Else += b.Else
+		}
+	}
+}
+
+// Write saves p as JSON, to be read back with Read.
+func (p *Profile) Write(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(p)
+}
+
+// Read reads a profile saved by Write.
+func Read(r io.Reader) (*Profile, error) {
+	p := NewProfile()
+	if err := json.NewDecoder(r).Decode(p); err != nil {
+		return nil, err
+	}
+	if p.Files == nil {
+		p.Files = make(map[string]*File)
+	}
+	return p, nil
+}
+
+func (p *Profile) file(path string) *File {
+	f, ok := p.Files[path]
+	if !ok {
+		f = &File{Path: path, Statements: []*Statement{}, Branches: []*Branch{}}
+		p.Files[path] = f
+	}
+	return f
+}
+
+// statement returns the statement at line and column, adding it if it is
+// new.
+func (f *File) statement(line, column int) *Statement {
+	i := sort.Search(len(f.Statements), func(i int) bool {
+		s := f.Statements[i]
+		return s.Line > line || s.Line == line && s.Column >= column
+	})
+	if i < len(f.Statements) && f.Statements[i].Line == line && f.Statements[i].Column == column {
+		return f.Statements[i]
+	}
+
+	s := &Statement{Line: line, Column: column}
+	f.Statements = append(f.Statements, nil)
+	copy(f.Statements[i+1:], f.Statements[i:])
+	f.Statements[i] = s
+	return s
+}
+
+// branch returns the branch at line and column, adding it if it is new.
+func (f *File) branch(line, column int) *Branch {
+	i := sort.Search(len(f.Branches), func(i int) bool {
+		b := f.Branches[i]
+		return b.Line > line || b.Line == line && b.Column >= column
+	})
+	if i < len(f.Branches) && f.Branches[i].Line == line && f.Branches[i].Column == column {
+		return f.Branches[i]
+	}
+
+	b := &Branch{Line: line, Column: column}
+	f.Branches = append(f.Branches, nil)
+	copy(f.Branches[i+1:], f.Branches[i:])
+	f.Branches[i] = b
+	return b
+}
+
+// recorder is the hook behind Record. It learns the statements and ifs of
+// each file as the interpreter starts on the file's program, and counts
+// them as they run.
+type recorder struct {
+	evaluator.NoHook
+
+	profile *Profile
+	in      *evaluator.Interpreter
+
+	statements   map[ast.Statement]*Statement
+	ifs          map[*ast.IfExpression]*Branch
+	consequences map[*ast.BlockStatement]*Branch
+	alternatives map[*ast.BlockStatement]*Branch
+
+	// taken says, for each if being evaluated, whether an arm was entered.
+	taken []bool
+}
+
+func (r *recorder) EnterNode(node ast.Node, env *object.Environment) {
+	switch node := node.(type) {
+	case *ast.Program:
+		if path := r.in.File(); path != "" {
+			r.register(r.profile.file(path), node)
+		}
+	case *ast.IfExpression:
+		if _, ok := r.ifs[node]; ok {
+			r.taken = append(r.taken, false)
+		}
+	case *ast.BlockStatement:
+		if b, ok := r.consequences[node]; ok {
+			b.Then++
+			r.taken[len(r.taken)-1] = true
+		} else if b, ok := r.alternatives[node]; ok {
+			b.Else++
+			r.taken[len(r.taken)-1] = true
+		}
+	case ast.Statement:
+		if s, ok := r.statements[node]; ok {
+			s.Count++
+		}
+	}
+}
+
+func (r *recorder) ExitNode(node ast.Node, env *object.Environment, result object.Object) {
+	ie, ok := node.(*ast.IfExpression)
+	if !ok {
+		return
+	}
+	b, ok := r.ifs[ie]
+	if !ok {
+		return
+	}
+
+	taken := r.taken[len(r.taken)-1]
+	r.taken = r.taken[:len(r.taken)-1]
+	// Without an arm taken, the condition was false or failed.
+	if _, failed := result.(*object.Error); !taken && !failed {
+		b.Else++
+	}
+}
+
+// register learns the statements of program, those its programs and blocks
+// list, and its if expressions. Many expressions are statements too as far
+// as the ast package is concerned, but only listed statements count.
+func (r *recorder) register(f *File, program *ast.Program) {
+	ast.Inspect(program, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.Program:
+			r.registerStatements(f, node.Statements)
+		case *ast.BlockStatement:
+			r.registerStatements(f, node.Statements)
+		case *ast.IfExpression:
+			pos := ast.TokenOf(node).Position
+			b := f.branch(pos.Line, pos.Column)
+			r.ifs[node] = b
+			r.consequences[node.Consequence] = b
+			if node.Alternative != nil {
+				r.alternatives[node.Alternative] = b
+			}
+		}
+		return node != nil
+	})
+}
+
+func (r *recorder) registerStatements(f *File, statements []ast.Statement) {
+	for _, stmt := range statements {
+		pos := ast.TokenOf(stmt).Position
+		r.statements[stmt] = f.statement(pos.Line, pos.Column)
+	}
+}
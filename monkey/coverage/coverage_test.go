@@ -0,0 +1,184 @@
+package coverage
+
+import (
+	"bytes"
+	"monkey/evaluator"
+	"monkey/object"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const lib = `export let sign = function(x) {
+  if (x < 0) {
+    return -1;
+  } else {
+    if (x == 0) { return 0; }
+  }
+  1
+};
+export let unused = function() {
+  puts("never");
+};
+export let check = function(x) { if (x) { 1 } };
+`
+
+// record runs main in dir, beside lib, recording its coverage into p, and
+// returns the coverage of lib.
+func record(t *testing.T, dir string, p *Profile, main string) *File {
+	t.Helper()
+	files := map[string]string{"lib.monkey": lib, "main.monkey": main}
+	for name, source := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(source), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	in := evaluator.New()
+	in.Output = &bytes.Buffer{}
+	p.Record(in)
+	in.EvalFile(filepath.Join(dir, "main.monkey"), object.NewEnvironment())
+
+	f := p.Files[filepath.Join(dir, "lib.monkey")]
+	if f == nil {
+		t.Fatalf("no coverage for lib.monkey. got %v", p.Files)
+	}
+	return f
+}
+
+func TestRecord(t *testing.T) {
+	f := record(t, t.TempDir(), NewProfile(), `import "lib"; lib.sign(-1); lib.sign(0); lib.check(1 < 0);`)
+
+	counts := map[int]int{}
+	for _, s := range f.Statements {
+		counts[s.Line] += s.Count
+	}
+	expected := map[int]int{1: 1, 2: 2, 3: 1, 5: 2, 7: 0, 9: 1, 10: 0, 12: 2}
+	if !reflect.DeepEqual(counts, expected) {
+		t.Errorf("wrong statement counts.\nexpected %v\n     got %v", expected, counts)
+	}
+
+	branches := []Branch{}
+	for _, b := range f.Branches {
+		branches = append(branches, *b)
+	}
+	expectedBranches := []Branch{
+		{Line: 2, Column: 3, Then: 1, Else: 1},
+		{Line: 5, Column: 5, Then: 1, Else: 0},
+		{Line: 12, Column: 34, Then: 0, Else: 1},
+	}
+	if !reflect.DeepEqual(branches, expectedBranches) {
+		t.Errorf("wrong branches.\nexpected %+v\n     got %+v", expectedBranches, branches)
+	}
+}
+
+func TestRecordFailingCondition(t *testing.T) {
+	f := record(t, t.TempDir(), NewProfile(), `import "lib"; lib.sign("a");`)
+
+	if b := f.Branches[0]; b.Then != 0 || b.Else != 0 {
+		t.Errorf("a failed condition took a branch: %+v", b)
+	}
+}
+
+func TestMergeAndPersist(t *testing.T) {
+	dir := t.TempDir()
+	negative := NewProfile()
+	f := record(t, dir, negative, `import "lib"; lib.sign(-1);`)
+	positive := NewProfile()
+	record(t, dir, positive, `import "lib"; lib.sign(1); lib.sign(0);`)
+
+	var saved bytes.Buffer
+	if err := positive.Write(&saved); err != nil {
+		t.Fatal(err)
+	}
+	read, err := Read(&saved)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	merged := NewProfile()
+	merged.Merge(negative)
+	merged.Merge(read)
+
+	f = merged.Files[f.Path]
+	if s := f.Summary(); s != (Summary{Lines: 8, LinesHit: 7, Branches: 6, BranchesHit: 4}) {
+		t.Errorf("wrong summary: %+v", s)
+	}
+	if b := f.Branches[1]; b.Then != 1 || b.Else != 1 {
+		t.Errorf("wrong merged branch: %+v", b)
+	}
+}
+
+func TestReports(t *testing.T) {
+	p := NewProfile()
+	f := record(t, t.TempDir(), p, `import "lib"; lib.sign(-1); lib.sign(0);`)
+	delete(p.Files, filepath.Join(filepath.Dir(f.Path), "main.monkey"))
+	delete(p.Files, f.Path)
+	f.Path = "lib.monkey"
+	p.Files[f.Path] = f
+
+	var text bytes.Buffer
+	if err := p.WriteText(&text); err != nil {
+		t.Fatal(err)
+	}
+	expectedText := `lib.monkey  lines  75.0% (6/8)  branches  50.0% (3/6)
+    not run: 7, 10
+    not taken: 5:5 else
+total       lines  75.0% (6/8)  branches  50.0% (3/6)
+`
+	if text.String() != expectedText {
+		t.Errorf("wrong text report.\nexpected:\n%s\ngot:\n%s", expectedText, text.String())
+	}
+
+	var lcov bytes.Buffer
+	if err := p.WriteLCOV(&lcov); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{
+		"SF:lib.monkey", "BRDA:2,0,0,1", "BRDA:5,1,1,0", "BRDA:12,2,0,-",
+		"BRF:6", "BRH:3", "DA:5,1", "DA:10,0", "LF:8", "LH:6", "end_of_record",
+	} {
+		if !strings.Contains(lcov.String(), line+"\n") {
+			t.Errorf("LCOV report misses %q:\n%s", line, lcov.String())
+		}
+	}
+}
+
+func TestHTMLReport(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "lib.monkey")
+	if err := os.WriteFile(path, []byte(lib), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	p := NewProfile()
+	f := p.file(path)
+	f.statement(2, 3).Count = 1
+	f.statement(10, 3).Count = 0
+	f.branch(2, 3).Then = 1
+
+	var html bytes.Buffer
+	if err := p.WriteHTML(&html); err != nil {
+		t.Fatal(err)
+	}
+	for _, row := range []string{
+		`<tr class="partial"><td class="number">2</td><td class="count">1</td><td class="source">  if (x &lt; 0) {</td></tr>`,
+		`<tr class="missed"><td class="number">10</td><td class="count">0</td><td class="source">  puts(&#34;never&#34;);</td></tr>`,
+		`<tr class=""><td class="number">3</td><td class="count"></td>`,
+	} {
+		if !strings.Contains(html.String(), row) {
+			t.Errorf("HTML report misses %s", row)
+		}
+	}
+
+	p.file(filepath.Join(dir, "missing.monkey"))
+	html.Reset()
+	if err := p.WriteHTML(&html); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(html.String(), "Source unavailable") {
+		t.Errorf("HTML report does not flag a missing source")
+	}
+}
@@ -0,0 +1,285 @@
+package coverage
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"strings"
+)
+
+// Line is the coverage of a source line on which statements start. Count is
+// the most runs of any of them. A line run is Partial when one of its
+// statements did not run, or one of its if expressions left an arm untaken.
+type Line struct {
+	Number  int
+	Count   int
+	Partial bool
+}
+
+// Summary counts the lines of a file that ran, and the arms of its if
+// expressions that were taken.
+type Summary struct {
+	Lines, LinesHit       int
+	Branches, BranchesHit int
+}
+
+// Lines returns the lines of f with statements, in order.
+func (f *File) Lines() []Line {
+	lines := []Line{}
+	byNumber := make(map[int]int)
+	for _, s := range f.Statements {
+		i, ok := byNumber[s.Line]
+		if !ok {
+			i = len(lines)
+			byNumber[s.Line] = i
+			lines = append(lines, Line{Number: s.Line, Count: s.Count})
+			continue
+		}
+		if (s.Count == 0) != (lines[i].Count == 0) {
+			lines[i].Partial = true
+		}
+		if s.Count > lines[i].Count {
+			lines[i].Count = s.Count
+		}
+	}
+	for _, b := range f.Branches {
+		if i, ok := byNumber[b.Line]; ok && (b.Then == 0 || b.Else == 0) {
+			lines[i].Partial = true
+		}
+	}
+	for i := range lines {
+		lines[i].Partial = lines[i].Partial && lines[i].Count > 0
+	}
+	return lines
+}
+
+// Summary sums up the coverage of f.
+func (f *File) Summary() Summary {
+	var s Summary
+	for _, line := range f.Lines() {
+		s.Lines++
+		if line.Count > 0 {
+			s.LinesHit++
+		}
+	}
+	for _, b := range f.Branches {
+		s.Branches += 2
+		if b.Then > 0 {
+			s.BranchesHit++
+		}
+		if b.Else > 0 {
+			s.BranchesHit++
+		}
+	}
+	return s
+}
+
+func (s *Summary) add(other Summary) {
+	s.Lines += other.Lines
+	s.LinesHit += other.LinesHit
+	s.Branches += other.Branches
+	s.BranchesHit += other.BranchesHit
+}
+
+// WriteText writes, for each file and in total, the share of lines that ran
+// and of branches taken, and for each file the lines that did not run and
+// the branches that were not taken.
+func (p *Profile) WriteText(w io.Writer) error {
+	width := len("total")
+	for path := range p.Files {
+		if len(path) > width {
+			width = len(path)
+		}
+	}
+
+	var total Summary
+	for _, f := range p.Sorted() {
+		s := f.Summary()
+		total.add(s)
+		fmt.Fprintf(w, "%-*s  lines %s  branches %s\n", width, f.Path,
+			ratio(s.LinesHit, s.Lines), ratio(s.BranchesHit, s.Branches))
+
+		if missed := missedLines(f); missed != "" {
+			fmt.Fprintf(w, "    not run: %s\n", missed)
+		}
+		if untaken := untakenBranches(f); untaken != "" {
+			fmt.Fprintf(w, "    not taken: %s\n", untaken)
+		}
+	}
+
+	_, err := fmt.Fprintf(w, "%-*s  lines %s  branches %s\n", width, "total",
+		ratio(total.LinesHit, total.Lines), ratio(total.BranchesHit, total.Branches))
+	return err
+}
+
+func ratio(hit, all int) string {
+	if all == 0 {
+		return fmt.Sprintf("%6s (0/0)", "-")
+	}
+	return fmt.Sprintf("%5.1f%% (%d/%d)", 100*float64(hit)/float64(all), hit, all)
+}
+
+// missedLines lists the lines of f that did not run, joining runs of them
+// into ranges such as 7-9.
+func missedLines(f *File) string {
+	ranges := []string{}
+	lines := f.Lines()
+	for i := 0; i < len(lines); i++ {
+		if lines[i].Count > 0 {
+			continue
+		}
+		j := i
+		for j+1 < len(lines) && lines[j+1].Count == 0 {
+			j++
+		}
+		if i == j {
+			ranges = append(ranges, fmt.Sprintf("%d", lines[i].Number))
+		} else {
+			ranges = append(ranges, fmt.Sprintf("%d-%d", lines[i].Number, lines[j].Number))
+		}
+		i = j
+	}
+	return strings.Join(ranges, ", ")
+}
+
+// untakenBranches lists the arms of the if expressions of f that ran but
+// did not take them.
+func untakenBranches(f *File) string {
+	arms := []string{}
+	for _, b := range f.Branches {
+		if b.Then+b.Else == 0 {
+			continue
+		}
+		if b.Then == 0 {
+			arms = append(arms, fmt.Sprintf("%d:%d then", b.Line, b.Column))
+		}
+		if b.Else == 0 {
+			arms = append(arms, fmt.Sprintf("%d:%d else", b.Line, b.Column))
+		}
+	}
+	return strings.Join(arms, ", ")
+}
+
+// WriteLCOV writes p in the LCOV tracefile format that coverage services
+// and genhtml read. Each if expression is a block of two branches, then
+// and else.
+func (p *Profile) WriteLCOV(w io.Writer) error {
+	for _, f := range p.Sorted() {
+		s := f.Summary()
+		fmt.Fprintf(w, "TN:\nSF:%s\n", f.Path)
+		for i, b := range f.Branches {
+			then, els := "-", "-"
+			if b.Then+b.Else > 0 {
+				then, els = fmt.Sprint(b.Then), fmt.Sprint(b.Else)
+			}
+			fmt.Fprintf(w, "BRDA:%d,%d,0,%s\n", b.Line, i, then)
+			fmt.Fprintf(w, "BRDA:%d,%d,1,%s\n", b.Line, i, els)
+		}
+		fmt.Fprintf(w, "BRF:%d\nBRH:%d\n", s.Branches, s.BranchesHit)
+		for _, line := range f.Lines() {
+			fmt.Fprintf(w, "DA:%d,%d\n", line.Number, line.Count)
+		}
+		_, err := fmt.Fprintf(w, "LF:%d\nLH:%d\nend_of_record\n", s.Lines, s.LinesHit)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type htmlFile struct {
+	Path    string
+	Summary string
+	Error   string
+	Lines   []htmlLine
+}
+
+type htmlLine struct {
+	Number int
+	Count  string
+	Class  string
+	Source string
+}
+
+// WriteHTML writes a page showing the source of each file of p, read from
+// disk, with the lines that ran, ran in part, or did not run highlighted
+// and annotated with their counts.
+func (p *Profile) WriteHTML(w io.Writer) error {
+	files := []htmlFile{}
+	for _, f := range p.Sorted() {
+		s := f.Summary()
+		file := htmlFile{
+			Path:    f.Path,
+			Summary: fmt.Sprintf("lines %s, branches %s", ratio(s.LinesHit, s.Lines), ratio(s.BranchesHit, s.Branches)),
+		}
+
+		source, err := os.ReadFile(f.Path)
+		if err != nil {
+			file.Error = err.Error()
+			files = append(files, file)
+			continue
+		}
+
+		covered := make(map[int]Line)
+		for _, line := range f.Lines() {
+			covered[line.Number] = line
+		}
+		for i, text := range strings.Split(strings.TrimSuffix(string(source), "\n"), "\n") {
+			line := htmlLine{Number: i + 1, Source: text}
+			if c, ok := covered[i+1]; ok {
+				line.Count = fmt.Sprint(c.Count)
+				switch {
+				case c.Count == 0:
+					line.Class = "missed"
+				case c.Partial:
+					line.Class = "partial"
+				default:
+					line.Class = "covered"
+				}
+			}
+			file.Lines = append(file.Lines, line)
+		}
+		files = append(files, file)
+	}
+
+	return htmlReport.Execute(w, files)
+}
+
+var htmlReport = template.Must(template.New("coverage").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Monkey coverage</title>
+<style>
+body { font-family: sans-serif; }
+table { border-collapse: collapse; font-family: monospace; }
+td { padding: 0 0.5em; white-space: pre; }
+td.number, td.count { text-align: right; color: #888; }
+tr.covered td.source { background: #dfd; }
+tr.partial td.source { background: #ffd; }
+tr.missed td.source { background: #fdd; }
+</style>
+</head>
+<body>
+<h1>Coverage</h1>
+<ul>
+{{- range $i, $f := .}}
+<li><a href="#file{{$i}}">{{$f.Path}}</a>: {{$f.Summary}}</li>
+{{- end}}
+</ul>
+{{- range $i, $f := .}}
+<h2 id="file{{$i}}">{{$f.Path}}</h2>
+{{- if $f.Error}}
+<p>Source unavailable: {{$f.Error}}</p>
+{{- else}}
+<table>
+{{- range $f.Lines}}
+<tr class="{{.Class}}"><td class="number">{{.Number}}</td><td class="count">{{.Count}}</td><td class="source">{{.Source}}</td></tr>
+{{- end}}
+</table>
+{{- end}}
+{{- end}}
+</body>
+</html>
+`))
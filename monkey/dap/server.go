@@ -0,0 +1,590 @@
+// Package dap implements a Debug Adapter Protocol server for Monkey.
+//
+// The server reads requests from one stream and writes responses and events
+// to another, usually stdin and stdout. It launches one program, evaluated
+// on a goroutine of its own under an evaluator.Debugger, and reports it as
+// a single thread. While the program is stopped, the client can walk its
+// stack frames, the scopes of each frame and the variables in them, and
+// evaluate expressions in a frame.
+package dap
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"monkey/ast"
+	"monkey/evaluator"
+	"monkey/framing"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// threadID identifies the program's only thread.
+const threadID = 1
+
+type Server struct {
+	in *bufio.Reader
+
+	// writeMu serialises messages, which the program's goroutine sends too.
+	writeMu sync.Mutex
+	out     io.Writer
+	seq     int
+
+	// The client may count lines and columns from 0 instead of 1.
+	lineOffset, columnOffset int
+
+	debugger   *evaluator.Debugger
+	program    string
+	launched   bool
+	configured bool
+	started    bool
+	breakpoint int
+
+	// capabilities and seed are what the launch request asked for.
+	capabilities evaluator.Capability
+	seed         *int64
+
+	// after runs once the response to the current request is written.
+	after func()
+
+	// mu guards the state shared with the program's goroutine.
+	mu          sync.Mutex
+	stopped     bool
+	terminating bool
+	handles     []interface{}
+
+	resume chan evaluator.Action
+	done   chan struct{}
+}
+
+// NewServer returns a server reading requests from in and writing to out.
+func NewServer(in io.Reader, out io.Writer) *Server {
+	s := &Server{
+		in:     bufio.NewReader(in),
+		out:    out,
+		resume: make(chan evaluator.Action),
+		done:   make(chan struct{}),
+	}
+	s.debugger = evaluator.NewDebugger(s)
+	return s
+}
+
+// Serve handles requests until the client disconnects or closes the input,
+// and abandons the program if it is still running. It returns an error if
+// the input cannot be read or the output written.
+func (s *Server) Serve() error {
+	for {
+		body, err := framing.ReadMessage(s.in)
+		if err == io.EOF {
+			s.terminate()
+			if s.after != nil {
+				s.after()
+			}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		var req request
+		if err := json.Unmarshal(body, &req); err != nil {
+			return err
+		}
+		if req.Type != "request" {
+			continue
+		}
+
+		result, err := s.handle(&req)
+		resp := response{Type: "response", RequestSeq: req.Seq, Command: req.Command, Success: err == nil, Body: result}
+		if err != nil {
+			resp.Message = err.Error()
+		}
+		if err := s.send(&resp); err != nil {
+			return err
+		}
+
+		if s.after != nil {
+			s.after()
+			s.after = nil
+		}
+		if req.Command == "disconnect" {
+			if s.started {
+				<-s.done
+			}
+			return nil
+		}
+	}
+}
+
+// send writes a response or an event with the next sequence number.
+func (s *Server) send(message interface{}) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	s.seq++
+	switch message := message.(type) {
+	case *response:
+		message.Seq = s.seq
+	case *event:
+		message.Seq = s.seq
+	}
+	return framing.WriteMessage(s.out, message)
+}
+
+func (s *Server) event(name string, body interface{}) error {
+	return s.send(&event{Type: "event", Event: name, Body: body})
+}
+
+var (
+	errNotStopped = errors.New("the program is not stopped")
+	errNotStarted = errors.New("the program has not started")
+)
+
+// handle runs the handler of req and returns the body of its response. An
+// error fails the request with its message.
+func (s *Server) handle(req *request) (interface{}, error) {
+	switch req.Command {
+	case "initialize":
+		var args InitializeRequestArguments
+		if err := decode(req, &args); err != nil {
+			return nil, err
+		}
+		if args.LinesStartAt1 != nil && !*args.LinesStartAt1 {
+			s.lineOffset = 1
+		}
+		if args.ColumnsStartAt1 != nil && !*args.ColumnsStartAt1 {
+			s.columnOffset = 1
+		}
+		s.after = func() { s.event("initialized", nil) }
+		return Capabilities{
+			SupportsConfigurationDoneRequest: true,
+			SupportsEvaluateForHovers:        true,
+			SupportsTerminateRequest:         true,
+		}, nil
+
+	case "launch":
+		var args LaunchRequestArguments
+		if err := decode(req, &args); err != nil {
+			return nil, err
+		}
+		if s.launched {
+			return nil, errors.New("a program is already launched")
+		}
+		if args.Program == "" {
+			return nil, errors.New("launch needs a program")
+		}
+		program, err := filepath.Abs(args.Program)
+		if err == nil {
+			_, err = os.Stat(program)
+		}
+		if err != nil {
+			return nil, err
+		}
+		capabilities, err := evaluator.ParseCapabilities(args.Allow)
+		if err != nil {
+			return nil, err
+		}
+
+		s.program = program
+		s.capabilities = capabilities
+		s.seed = args.Seed
+		s.launched = true
+		s.debugger.StopOnEntry = args.StopOnEntry
+		if s.configured {
+			s.after = s.start
+		}
+		return nil, nil
+
+	case "setBreakpoints":
+		var args SetBreakpointsArguments
+		if err := decode(req, &args); err != nil {
+			return nil, err
+		}
+		return s.setBreakpoints(args), nil
+
+	case "configurationDone":
+		s.configured = true
+		if s.launched && !s.started {
+			s.after = s.start
+		}
+		return nil, nil
+
+	case "threads":
+		return ThreadsResponse{Threads: []Thread{{ID: threadID, Name: "main"}}}, nil
+
+	case "stackTrace":
+		var args StackTraceArguments
+		if err := decode(req, &args); err != nil {
+			return nil, err
+		}
+		if !s.isStopped() {
+			return nil, errNotStopped
+		}
+		return s.stackTrace(args), nil
+
+	case "scopes":
+		var args ScopesArguments
+		if err := decode(req, &args); err != nil {
+			return nil, err
+		}
+		if !s.isStopped() {
+			return nil, errNotStopped
+		}
+		scopes := []Scope{}
+		for _, scope := range s.debugger.Scopes(args.FrameID - 1) {
+			hint := ""
+			if scope.Name == "locals" {
+				hint = "locals"
+			}
+			scopes = append(scopes, Scope{
+				Name:               strings.ToUpper(scope.Name[:1]) + scope.Name[1:],
+				PresentationHint:   hint,
+				VariablesReference: s.reference(scope.Bindings),
+			})
+		}
+		return ScopesResponse{Scopes: scopes}, nil
+
+	case "variables":
+		var args VariablesArguments
+		if err := decode(req, &args); err != nil {
+			return nil, err
+		}
+		if !s.isStopped() {
+			return nil, errNotStopped
+		}
+		return VariablesResponse{Variables: s.variables(args.VariablesReference)}, nil
+
+	case "evaluate":
+		var args EvaluateArguments
+		if err := decode(req, &args); err != nil {
+			return nil, err
+		}
+		if !s.isStopped() {
+			return nil, errNotStopped
+		}
+		frame := 0
+		if args.FrameID != nil {
+			frame = *args.FrameID - 1
+		}
+		result := s.debugger.Evaluate(frame, args.Expression)
+		if err, ok := result.(*object.Error); ok {
+			return nil, errors.New(err.Message)
+		}
+		return EvaluateResponse{
+			Result:             display(result),
+			Type:               string(result.Type()),
+			VariablesReference: s.reference(result),
+		}, nil
+
+	case "continue":
+		if err := s.resumeWith(evaluator.Continue); err != nil {
+			return nil, err
+		}
+		return ContinueResponse{AllThreadsContinued: true}, nil
+	case "next":
+		return nil, s.resumeWith(evaluator.StepOver)
+	case "stepIn":
+		return nil, s.resumeWith(evaluator.StepInto)
+	case "stepOut":
+		return nil, s.resumeWith(evaluator.StepOut)
+
+	case "pause":
+		if !s.started {
+			return nil, errNotStarted
+		}
+		if !s.isStopped() {
+			s.debugger.Pause()
+		}
+		return nil, nil
+
+	case "terminate", "disconnect":
+		s.terminate()
+		return nil, nil
+	}
+
+	return nil, errors.New("unsupported request: " + req.Command)
+}
+
+func decode(req *request, args interface{}) error {
+	if len(req.Arguments) == 0 {
+		return nil
+	}
+	return json.Unmarshal(req.Arguments, args)
+}
+
+// start evaluates the program on a goroutine of its own, which reports how
+// it ended.
+func (s *Server) start() {
+	s.started = true
+
+	in := evaluator.New()
+	in.Output = &output{s: s, category: "stdout"}
+	in.Debug(s.debugger)
+	in.Grant(s.capabilities)
+	if s.seed != nil {
+		in.Deterministic(*s.seed)
+	}
+
+	go func() {
+		defer close(s.done)
+
+		result := in.EvalFile(s.program, object.NewEnvironment())
+		code := 0
+		if err, ok := result.(*object.Error); ok {
+			code = 1
+			if !s.isTerminating() {
+				s.event("output", OutputEvent{Category: "stderr", Output: err.Inspect() + "\n"})
+			}
+		}
+		s.event("exited", ExitedEvent{ExitCode: code})
+		s.event("terminated", nil)
+	}()
+}
+
+// output turns what the program prints into output events.
+type output struct {
+	s        *Server
+	category string
+}
+
+func (o *output) Write(p []byte) (int, error) {
+	if err := o.s.event("output", OutputEvent{Category: o.category, Output: string(p)}); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Stopped reports a stop to the client and waits for it to resume the
+// program.
+func (s *Server) Stopped(d *evaluator.Debugger, reason evaluator.StopReason) evaluator.Action {
+	s.mu.Lock()
+	if s.terminating {
+		s.mu.Unlock()
+		return evaluator.Quit
+	}
+	s.stopped = true
+	s.handles = nil
+	s.mu.Unlock()
+
+	s.event("stopped", StoppedEvent{Reason: string(reason), ThreadID: threadID, AllThreadsStopped: true})
+	return <-s.resume
+}
+
+func (s *Server) isStopped() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stopped
+}
+
+func (s *Server) isTerminating() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.terminating
+}
+
+// resumeWith resumes the stopped program with action once the response is
+// written, so that the client sees it before any later stop.
+func (s *Server) resumeWith(action evaluator.Action) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.stopped {
+		return errNotStopped
+	}
+	s.stopped = false
+	s.after = func() { s.resume <- action }
+	return nil
+}
+
+// terminate abandons the program: a stopped program is resumed to quit, and
+// a running one quits at its next statement.
+func (s *Server) terminate() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.terminating || !s.started {
+		s.terminating = true
+		return
+	}
+	s.terminating = true
+	if s.stopped {
+		s.stopped = false
+		s.after = func() { s.resume <- evaluator.Quit }
+	} else {
+		s.debugger.Pause()
+	}
+}
+
+// setBreakpoints replaces the breakpoints of a source. A line without a
+// statement gets the breakpoint of the next line that has one.
+func (s *Server) setBreakpoints(args SetBreakpointsArguments) SetBreakpointsResponse {
+	lines := args.Lines
+	if args.Breakpoints != nil {
+		lines = nil
+		for _, bp := range args.Breakpoints {
+			lines = append(lines, bp.Line)
+		}
+	}
+
+	path, err := filepath.Abs(args.Source.Path)
+	if err != nil {
+		path = args.Source.Path
+	}
+	source := &Source{Name: filepath.Base(path), Path: path}
+	statements, err := statementLines(path)
+
+	s.debugger.ClearBreakpoints(path)
+	breakpoints := []Breakpoint{}
+	for _, line := range lines {
+		s.breakpoint++
+		bp := Breakpoint{ID: s.breakpoint, Source: source, Line: line}
+
+		requested := line + s.lineOffset
+		i := sort.SearchInts(statements, requested)
+		switch {
+		case err != nil:
+			bp.Message = err.Error()
+		case i == len(statements):
+			bp.Message = "no statement on or after this line"
+		default:
+			s.debugger.SetBreakpoint(path, statements[i])
+			bp.Verified = true
+			bp.Line = statements[i] - s.lineOffset
+		}
+		breakpoints = append(breakpoints, bp)
+	}
+	return SetBreakpointsResponse{Breakpoints: breakpoints}
+}
+
+// statementLines returns the sorted lines of the file at path on which a
+// statement starts.
+func statementLines(path string) ([]int, error) {
+	source, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	p := parser.New(lexer.New(string(source)))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return nil, errors.New("could not parse " + filepath.Base(path) + ": " + p.Errors()[0])
+	}
+
+	seen := map[int]bool{}
+	lines := []int{}
+	ast.Inspect(program, func(node ast.Node) bool {
+		if stmt, ok := node.(ast.Statement); ok {
+			if line := ast.TokenOf(stmt).Position.Line; !seen[line] {
+				seen[line] = true
+				lines = append(lines, line)
+			}
+		}
+		return node != nil
+	})
+	sort.Ints(lines)
+	return lines, nil
+}
+
+func (s *Server) stackTrace(args StackTraceArguments) StackTraceResponse {
+	stack := s.debugger.Stack()
+	frames := []StackFrame{}
+	for i := args.StartFrame; i < len(stack); i++ {
+		if args.Levels > 0 && len(frames) == args.Levels {
+			break
+		}
+		frame := stack[i]
+		sf := StackFrame{
+			ID:     i + 1,
+			Name:   frame.Name,
+			Line:   frame.Position.Line - s.lineOffset,
+			Column: frame.Position.Column - s.columnOffset,
+		}
+		if frame.File != "" {
+			sf.Source = &Source{Name: filepath.Base(frame.File), Path: frame.File}
+		}
+		frames = append(frames, sf)
+	}
+	return StackTraceResponse{StackFrames: frames, TotalFrames: len(stack)}
+}
+
+// reference returns the variables reference of a scope's bindings or of a
+// value with members, or 0 for a value without. References last until the
+// program resumes.
+func (s *Server) reference(v interface{}) int {
+	switch v := v.(type) {
+	case *object.Array:
+		if len(v.Elements) == 0 {
+			return 0
+		}
+	case *object.Hash:
+		if len(v.Keys) == 0 {
+			return 0
+		}
+	case *object.Module, []object.Binding:
+	default:
+		return 0
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handles = append(s.handles, v)
+	return len(s.handles)
+}
+
+func (s *Server) variables(reference int) []Variable {
+	s.mu.Lock()
+	var v interface{}
+	if reference > 0 && reference <= len(s.handles) {
+		v = s.handles[reference-1]
+	}
+	s.mu.Unlock()
+
+	variables := []Variable{}
+	add := func(name string, value object.Object) {
+		variables = append(variables, Variable{
+			Name:               name,
+			Value:              display(value),
+			Type:               string(value.Type()),
+			VariablesReference: s.reference(value),
+		})
+	}
+
+	switch v := v.(type) {
+	case []object.Binding:
+		for _, b := range v {
+			add(b.Name, b.Value)
+		}
+	case *object.Array:
+		for i, element := range v.Elements {
+			add("["+strconv.Itoa(i)+"]", element)
+		}
+	case *object.Hash:
+		for _, key := range v.Keys {
+			pair := v.Pairs[key]
+			add(display(pair.Key), pair.Value)
+		}
+	case *object.Module:
+		for _, name := range v.Exports {
+			if value, ok := v.Member(name); ok {
+				add(name, value)
+			}
+		}
+	}
+	return variables
+}
+
+// display shows a value on one line, with strings quoted.
+func display(value object.Object) string {
+	if str, ok := value.(*object.String); ok {
+		return strconv.Quote(str.Value)
+	}
+	return strings.Join(strings.Fields(value.Inspect()), " ")
+}
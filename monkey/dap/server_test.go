@@ -0,0 +1,430 @@
+package dap
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"monkey/framing"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// message is any message from the server, with the body left encoded.
+type message struct {
+	Type       string          `json:"type"`
+	Seq        int             `json:"seq"`
+	Command    string          `json:"command"`
+	Event      string          `json:"event"`
+	RequestSeq int             `json:"request_seq"`
+	Success    bool            `json:"success"`
+	Message    string          `json:"message"`
+	Body       json.RawMessage `json:"body"`
+}
+
+// session drives a server through pipes the way a client would. Events
+// that arrive while it waits for a response are kept for expectEvent.
+type session struct {
+	t        *testing.T
+	in       *io.PipeWriter
+	messages chan message
+	pending  []message
+	seq      int
+	served   chan error
+}
+
+func newSession(t *testing.T) *session {
+	clientIn, serverOut := io.Pipe()
+	serverIn, clientOut := io.Pipe()
+
+	s := &session{t: t, in: clientOut, messages: make(chan message, 100), served: make(chan error, 1)}
+	go func() {
+		s.served <- NewServer(serverIn, serverOut).Serve()
+		serverOut.Close()
+	}()
+	go func() {
+		r := bufio.NewReader(clientIn)
+		for {
+			body, err := framing.ReadMessage(r)
+			if err != nil {
+				close(s.messages)
+				return
+			}
+			var m message
+			if err := json.Unmarshal(body, &m); err != nil {
+				t.Errorf("invalid message %s: %s", body, err)
+			}
+			s.messages <- m
+		}
+	}()
+	t.Cleanup(func() { clientOut.Close() })
+	return s
+}
+
+func (s *session) next() message {
+	s.t.Helper()
+	select {
+	case m, ok := <-s.messages:
+		if !ok {
+			s.t.Fatal("the server closed its output")
+		}
+		return m
+	case <-time.After(5 * time.Second):
+		s.t.Fatal("timed out waiting for the server")
+	}
+	return message{}
+}
+
+// request sends a request and returns its response, decoding the body into
+// result if it is not nil.
+func (s *session) request(command string, args interface{}, result interface{}) message {
+	s.t.Helper()
+	s.seq++
+	if err := framing.WriteMessage(s.in, map[string]interface{}{
+		"seq": s.seq, "type": "request", "command": command, "arguments": args,
+	}); err != nil {
+		s.t.Fatal(err)
+	}
+
+	for {
+		m := s.next()
+		if m.Type != "response" {
+			s.pending = append(s.pending, m)
+			continue
+		}
+		if m.RequestSeq != s.seq || m.Command != command {
+			s.t.Fatalf("expected the response to %s #%d, got %+v", command, s.seq, m)
+		}
+		if result != nil && m.Success {
+			if err := json.Unmarshal(m.Body, result); err != nil {
+				s.t.Fatal(err)
+			}
+		}
+		return m
+	}
+}
+
+// succeed is request for requests that must succeed.
+func (s *session) succeed(command string, args interface{}, result interface{}) {
+	s.t.Helper()
+	if m := s.request(command, args, result); !m.Success {
+		s.t.Fatalf("%s failed: %s", command, m.Message)
+	}
+}
+
+// expectEvent waits for the named event, skipping output, and decodes its
+// body into body if it is not nil.
+func (s *session) expectEvent(name string, body interface{}) {
+	s.t.Helper()
+	for {
+		var m message
+		if len(s.pending) > 0 {
+			m, s.pending = s.pending[0], s.pending[1:]
+		} else {
+			m = s.next()
+		}
+		if m.Type == "event" && m.Event == "output" && name != "output" {
+			continue
+		}
+		if m.Type != "event" || m.Event != name {
+			s.t.Fatalf("expected %s event, got %+v", name, m)
+		}
+		if body != nil {
+			if err := json.Unmarshal(m.Body, body); err != nil {
+				s.t.Fatal(err)
+			}
+		}
+		return
+	}
+}
+
+func (s *session) expectStop(reason string) {
+	s.t.Helper()
+	var stopped StoppedEvent
+	s.expectEvent("stopped", &stopped)
+	if stopped.Reason != reason || stopped.ThreadID != threadID {
+		s.t.Fatalf("expected a stop for %s, got %+v", reason, stopped)
+	}
+}
+
+func (s *session) expectExit(code int) {
+	s.t.Helper()
+	var exited ExitedEvent
+	s.expectEvent("exited", &exited)
+	if exited.ExitCode != code {
+		s.t.Errorf("expected exit code %d, got %d", code, exited.ExitCode)
+	}
+	s.expectEvent("terminated", nil)
+}
+
+func (s *session) disconnect() {
+	s.t.Helper()
+	s.succeed("disconnect", nil, nil)
+	select {
+	case err := <-s.served:
+		if err != nil {
+			s.t.Errorf("Serve returned %s", err)
+		}
+	case <-time.After(5 * time.Second):
+		s.t.Fatal("the server did not stop after disconnect")
+	}
+}
+
+// launch starts the session for source, written to a file, with lines
+// as breakpoints, and returns the file's path.
+func (s *session) launch(source string, stopOnEntry bool, lines ...int) string {
+	s.t.Helper()
+	path := s.initialize(source, stopOnEntry)
+	if len(lines) > 0 {
+		s.succeed("setBreakpoints", map[string]interface{}{"source": Source{Path: path}, "lines": lines}, nil)
+	}
+	s.succeed("configurationDone", nil, nil)
+	return path
+}
+
+// initialize launches source but leaves the configuration to the test.
+func (s *session) initialize(source string, stopOnEntry bool) string {
+	s.t.Helper()
+	path := filepath.Join(s.t.TempDir(), "main.monkey")
+	if err := os.WriteFile(path, []byte(source), 0o644); err != nil {
+		s.t.Fatal(err)
+	}
+
+	var capabilities Capabilities
+	s.succeed("initialize", map[string]interface{}{"adapterID": "monkey"}, &capabilities)
+	if !capabilities.SupportsConfigurationDoneRequest {
+		s.t.Errorf("configurationDone is not supported: %+v", capabilities)
+	}
+	s.expectEvent("initialized", nil)
+	s.succeed("launch", LaunchRequestArguments{Program: path, StopOnEntry: stopOnEntry}, nil)
+	return path
+}
+
+func (s *session) stackTrace() []StackFrame {
+	s.t.Helper()
+	var trace StackTraceResponse
+	s.succeed("stackTrace", StackTraceArguments{ThreadID: threadID}, &trace)
+	return trace.StackFrames
+}
+
+func (s *session) variables(reference int) map[string]string {
+	s.t.Helper()
+	var vars VariablesResponse
+	s.succeed("variables", VariablesArguments{VariablesReference: reference}, &vars)
+	values := map[string]string{}
+	for _, v := range vars.Variables {
+		values[v.Name] = v.Value
+	}
+	return values
+}
+
+const program = `let add = function(a, b) {
+  let sum = a + b;
+
+  sum
+};
+let total = add(1, 2);
+puts(total);`
+
+func TestBreakpointsAndInspection(t *testing.T) {
+	s := newSession(t)
+	path := s.initialize(program, false)
+
+	var set SetBreakpointsResponse
+	s.succeed("setBreakpoints", SetBreakpointsArguments{
+		Source:      Source{Path: path},
+		Breakpoints: []SourceBreakpoint{{Line: 3}, {Line: 20}},
+	}, &set)
+	if len(set.Breakpoints) != 2 {
+		t.Fatalf("expected 2 breakpoints, got %+v", set.Breakpoints)
+	}
+	if bp := set.Breakpoints[0]; !bp.Verified || bp.Line != 4 {
+		t.Errorf("a breakpoint on a blank line should move to the next statement, got %+v", bp)
+	}
+	if bp := set.Breakpoints[1]; bp.Verified || bp.Message == "" {
+		t.Errorf("a breakpoint past the last statement should not be verified, got %+v", bp)
+	}
+	s.succeed("configurationDone", nil, nil)
+
+	s.expectStop("breakpoint")
+
+	var threads ThreadsResponse
+	s.succeed("threads", nil, &threads)
+	if !reflect.DeepEqual(threads.Threads, []Thread{{ID: threadID, Name: "main"}}) {
+		t.Errorf("wrong threads: %+v", threads.Threads)
+	}
+
+	frames := s.stackTrace()
+	if len(frames) != 2 {
+		t.Fatalf("expected 2 frames, got %+v", frames)
+	}
+	if f := frames[0]; f.Name != "add" || f.Line != 4 || f.Column != 3 || f.Source.Path != path {
+		t.Errorf("wrong innermost frame: %+v", f)
+	}
+	if f := frames[1]; f.Name != "<program>" || f.Line != 6 {
+		t.Errorf("wrong outer frame: %+v", f)
+	}
+
+	var scopes ScopesResponse
+	s.succeed("scopes", ScopesArguments{FrameID: frames[0].ID}, &scopes)
+	if len(scopes.Scopes) != 2 || scopes.Scopes[0].Name != "Locals" || scopes.Scopes[1].Name != "Globals" {
+		t.Fatalf("wrong scopes: %+v", scopes.Scopes)
+	}
+	locals := s.variables(scopes.Scopes[0].VariablesReference)
+	if want := map[string]string{"a": "1", "b": "2", "sum": "3"}; !reflect.DeepEqual(locals, want) {
+		t.Errorf("wrong locals. want=%v, got=%v", want, locals)
+	}
+
+	var evaluated EvaluateResponse
+	s.succeed("evaluate", EvaluateArguments{Expression: "sum * 10", FrameID: &frames[0].ID}, &evaluated)
+	if evaluated.Result != "30" || evaluated.Type != "INTEGER" {
+		t.Errorf("wrong evaluation: %+v", evaluated)
+	}
+	if m := s.request("evaluate", EvaluateArguments{Expression: "sum", FrameID: &frames[1].ID}, nil); m.Success {
+		t.Errorf("sum is not visible in the outer frame, got %s", m.Body)
+	}
+
+	var cont ContinueResponse
+	s.succeed("continue", ThreadArguments{ThreadID: threadID}, &cont)
+	if !cont.AllThreadsContinued {
+		t.Errorf("expected all threads to continue")
+	}
+
+	var printed OutputEvent
+	s.expectEvent("output", &printed)
+	if printed.Category != "stdout" || printed.Output != "3\n" {
+		t.Errorf("wrong output: %+v", printed)
+	}
+	s.expectExit(0)
+	s.disconnect()
+}
+
+func TestStepping(t *testing.T) {
+	s := newSession(t)
+	s.launch(program, true)
+
+	steps := []struct {
+		command string
+		line    int
+		depth   int
+	}{
+		{"next", 6, 1},
+		{"stepIn", 2, 2},
+		{"next", 4, 2},
+		{"stepOut", 7, 1},
+	}
+
+	s.expectStop("entry")
+	for _, step := range steps {
+		s.succeed(step.command, ThreadArguments{ThreadID: threadID}, nil)
+		s.expectStop("step")
+		frames := s.stackTrace()
+		if len(frames) != step.depth || frames[0].Line != step.line {
+			t.Fatalf("after %s, expected %d frames stopped on line %d, got %+v",
+				step.command, step.depth, step.line, frames)
+		}
+	}
+
+	s.succeed("continue", nil, nil)
+	s.expectExit(0)
+	s.disconnect()
+}
+
+func TestPause(t *testing.T) {
+	s := newSession(t)
+	s.launch("let i = 0;\nwhile (true) {\n  i = i + 1;\n}", false)
+
+	if m := s.request("stackTrace", StackTraceArguments{ThreadID: threadID}, nil); m.Success {
+		t.Errorf("a running program has no stack trace")
+	}
+
+	s.succeed("pause", ThreadArguments{ThreadID: threadID}, nil)
+	s.expectStop("pause")
+
+	var evaluated EvaluateResponse
+	s.succeed("evaluate", EvaluateArguments{Expression: "i > 0"}, &evaluated)
+	if evaluated.Result != "true" {
+		t.Errorf("expected the loop to have run, got %+v", evaluated)
+	}
+
+	s.disconnect()
+}
+
+func TestStructuredVariables(t *testing.T) {
+	s := newSession(t)
+	s.launch(`let xs = [1, "two", [3]];
+let h = {"k": [4]};
+let done = true;`, false, 3)
+	s.expectStop("breakpoint")
+
+	var scopes ScopesResponse
+	s.succeed("scopes", ScopesArguments{FrameID: s.stackTrace()[0].ID}, &scopes)
+
+	var vars VariablesResponse
+	s.succeed("variables", VariablesArguments{VariablesReference: scopes.Scopes[0].VariablesReference}, &vars)
+	references := map[string]int{}
+	for _, v := range vars.Variables {
+		references[v.Name] = v.VariablesReference
+	}
+
+	xs := s.variables(references["xs"])
+	if want := map[string]string{"[0]": "1", "[1]": `"two"`, "[2]": "[3]"}; !reflect.DeepEqual(xs, want) {
+		t.Errorf("wrong elements. want=%v, got=%v", want, xs)
+	}
+	h := s.variables(references["h"])
+	if want := map[string]string{`"k"`: "[4]"}; !reflect.DeepEqual(h, want) {
+		t.Errorf("wrong pairs. want=%v, got=%v", want, h)
+	}
+
+	s.succeed("continue", nil, nil)
+	s.expectExit(0)
+	s.disconnect()
+}
+
+func TestFailures(t *testing.T) {
+	s := newSession(t)
+	if m := s.request("launch", LaunchRequestArguments{Program: "missing.monkey"}, nil); m.Success {
+		t.Errorf("launching a missing program should fail")
+	}
+	if m := s.request("frobnicate", nil, nil); m.Success || m.Message != "unsupported request: frobnicate" {
+		t.Errorf("wrong response to an unknown request: %+v", m)
+	}
+
+	s.launch("let x = 1;\nx + true;", false)
+	var printed OutputEvent
+	s.expectEvent("output", &printed)
+	if printed.Category != "stderr" || !strings.Contains(printed.Output, "type mismatch: INTEGER + BOOLEAN") {
+		t.Errorf("wrong error output: %+v", printed)
+	}
+	s.expectExit(1)
+	s.disconnect()
+}
+
+func TestLaunchCapabilities(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "main.monkey")
+	if err := os.WriteFile(path, []byte("puts(now());"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	s := newSession(t)
+	if m := s.request("launch", LaunchRequestArguments{Program: path, Allow: "clocks"}, nil); m.Success {
+		t.Errorf("launching with an unknown capability should fail")
+	}
+
+	seed := int64(1)
+	s.succeed("initialize", map[string]interface{}{"adapterID": "monkey"}, nil)
+	s.expectEvent("initialized", nil)
+	s.succeed("launch", LaunchRequestArguments{Program: path, Allow: "clock", Seed: &seed}, nil)
+	s.succeed("configurationDone", nil, nil)
+
+	var printed OutputEvent
+	s.expectEvent("output", &printed)
+	if printed.Category != "stdout" || printed.Output != "946684800000\n" {
+		t.Errorf("wrong output: %+v", printed)
+	}
+	s.expectExit(0)
+	s.disconnect()
+}
@@ -0,0 +1,319 @@
+// Package debugger implements the gdb-like prompt of `monkey debug`.
+//
+// The program starts stopped before its first statement. At the prompt,
+// breakpoints can be set on lines, execution resumed or stepped, the call
+// stack and the variables of its frames inspected, and expressions
+// evaluated in a frame.
+package debugger
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"monkey/evaluator"
+	"monkey/object"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const PROMPT = "(monkey) "
+
+const help = `breakpoints:
+  break, b [file:]line   stop at a line
+  delete, d [file:]line  remove a breakpoint
+  info breakpoints       list the breakpoints
+execution:
+  continue, c            run to the next breakpoint
+  step, s                run to the next line, entering calls
+  next, n                run to the next line, stepping over calls
+  finish                 run until the current function returns
+  quit, q                abandon the program
+inspection:
+  backtrace, bt          print the call stack
+  frame, f n             select frame n of the stack
+  up, down               select the caller or the callee frame
+  locals, info locals    print the variables the frame can see
+  print, p expr          evaluate expr in the frame
+  list, l                print the source around the frame's line
+An empty line repeats the previous command.
+`
+
+// Run debugs the program in the file at path, reading commands from in and
+// writing to out, and returns the process exit code. The prepare functions
+// are called on the interpreter before it runs, to grant it capabilities for
+// instance.
+func Run(path string, in io.Reader, out io.Writer, prepare ...func(*evaluator.Interpreter)) int {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		fmt.Fprintln(out, err)
+		return 1
+	}
+
+	s := &session{
+		scanner: bufio.NewScanner(in),
+		out:     out,
+		dir:     filepath.Dir(abs),
+		sources: make(map[string][]string),
+	}
+
+	interpreter := evaluator.New()
+	interpreter.Output = out
+	interpreter.Warnings = out
+	for _, f := range prepare {
+		f(interpreter)
+	}
+	d := evaluator.NewDebugger(s)
+	d.StopOnEntry = true
+	interpreter.Debug(d)
+
+	evaluated := interpreter.EvalFile(abs, object.NewEnvironment())
+	if s.quit {
+		return 0
+	}
+	if err, ok := evaluated.(*object.Error); ok {
+		fmt.Fprintln(out, err.Inspect())
+		return 1
+	}
+	fmt.Fprintln(out, "program finished")
+	return 0
+}
+
+// session is the frontend behind the prompt.
+type session struct {
+	scanner *bufio.Scanner
+	out     io.Writer
+
+	dir     string
+	sources map[string][]string
+
+	d     *evaluator.Debugger
+	frame int
+	last  string
+	quit  bool
+}
+
+func (s *session) Stopped(d *evaluator.Debugger, reason evaluator.StopReason) evaluator.Action {
+	s.d = d
+	s.frame = 0
+
+	frame := d.Stack()[0]
+	if reason == evaluator.StopBreakpoint {
+		fmt.Fprintf(s.out, "breakpoint at %s\n", s.location(frame))
+	} else {
+		fmt.Fprintf(s.out, "stopped at %s\n", s.location(frame))
+	}
+	s.printLine(frame.File, frame.Position.Line)
+
+	for {
+		fmt.Fprint(s.out, PROMPT)
+		if !s.scanner.Scan() {
+			s.quit = true
+			return evaluator.Quit
+		}
+
+		line := strings.TrimSpace(s.scanner.Text())
+		if line == "" {
+			line = s.last
+		}
+		s.last = line
+		if line == "" {
+			continue
+		}
+
+		if action, resume := s.command(line); resume {
+			return action
+		}
+	}
+}
+
+// command runs one line of input. If the line resumes the program, it
+// returns how.
+func (s *session) command(line string) (evaluator.Action, bool) {
+	fields := strings.Fields(line)
+	name, arg := fields[0], strings.TrimSpace(strings.TrimPrefix(line, fields[0]))
+
+	switch name {
+	case "continue", "c":
+		return evaluator.Continue, true
+	case "step", "s":
+		return evaluator.StepInto, true
+	case "next", "n":
+		return evaluator.StepOver, true
+	case "finish":
+		return evaluator.StepOut, true
+	case "quit", "q":
+		s.quit = true
+		return evaluator.Quit, true
+
+	case "break", "b":
+		if file, line, ok := s.lineArg(arg); ok {
+			s.d.SetBreakpoint(file, line)
+			fmt.Fprintf(s.out, "breakpoint at %s:%d\n", s.display(file), line)
+		}
+	case "delete", "d", "clear":
+		if file, line, ok := s.lineArg(arg); ok {
+			if !s.d.ClearBreakpoint(file, line) {
+				fmt.Fprintf(s.out, "no breakpoint at %s:%d\n", s.display(file), line)
+			}
+		}
+	case "info":
+		switch arg {
+		case "breakpoints", "b":
+			s.printBreakpoints()
+		case "locals":
+			s.printScopes()
+		default:
+			fmt.Fprintln(s.out, "usage: info breakpoints|locals")
+		}
+
+	case "backtrace", "bt", "where":
+		for i, frame := range s.d.Stack() {
+			marker := " "
+			if i == s.frame {
+				marker = ">"
+			}
+			fmt.Fprintf(s.out, "%s #%d %s at %s\n", marker, i, frame.Name, s.location(frame))
+		}
+	case "frame", "f":
+		n := s.frame
+		if arg != "" {
+			var err error
+			if n, err = strconv.Atoi(arg); err != nil {
+				fmt.Fprintf(s.out, "not a frame number: %s\n", arg)
+				break
+			}
+		}
+		s.selectFrame(n)
+	case "up":
+		s.selectFrame(s.frame + 1)
+	case "down":
+		s.selectFrame(s.frame - 1)
+
+	case "locals":
+		s.printScopes()
+	case "print", "p":
+		if arg == "" {
+			fmt.Fprintln(s.out, "usage: print expr")
+			break
+		}
+		fmt.Fprintln(s.out, s.d.Evaluate(s.frame, arg).Inspect())
+	case "list", "l":
+		frame := s.d.Stack()[s.frame]
+		lines := s.source(frame.File)
+		for n := frame.Position.Line - 5; n <= frame.Position.Line+5; n++ {
+			if n < 1 || n > len(lines) {
+				continue
+			}
+			marker := "  "
+			if n == frame.Position.Line {
+				marker = "=>"
+			}
+			fmt.Fprintf(s.out, "%s %4d  %s\n", marker, n, lines[n-1])
+		}
+
+	case "help", "h":
+		fmt.Fprint(s.out, help)
+	default:
+		fmt.Fprintf(s.out, "unknown command %q, try help\n", name)
+	}
+	return 0, false
+}
+
+// lineArg parses [file:]line. Files are relative to the directory of the
+// program; without one, the line is in the file of the selected frame.
+func (s *session) lineArg(arg string) (string, int, bool) {
+	file := s.d.Stack()[s.frame].File
+	if i := strings.LastIndex(arg, ":"); i >= 0 {
+		file, arg = arg[:i], arg[i+1:]
+		if filepath.Ext(file) == "" {
+			file += evaluator.ModuleExtension
+		}
+		if !filepath.IsAbs(file) {
+			file = filepath.Join(s.dir, file)
+		}
+	}
+
+	line, err := strconv.Atoi(arg)
+	if err != nil || line < 1 {
+		fmt.Fprintln(s.out, "usage: break [file:]line")
+		return "", 0, false
+	}
+	return file, line, true
+}
+
+func (s *session) selectFrame(n int) {
+	stack := s.d.Stack()
+	if n < 0 || n >= len(stack) {
+		fmt.Fprintf(s.out, "no frame %d\n", n)
+		return
+	}
+	s.frame = n
+	fmt.Fprintf(s.out, "#%d %s at %s\n", n, stack[n].Name, s.location(stack[n]))
+	s.printLine(stack[n].File, stack[n].Position.Line)
+}
+
+func (s *session) printBreakpoints() {
+	breakpoints := s.d.Breakpoints()
+	if len(breakpoints) == 0 {
+		fmt.Fprintln(s.out, "no breakpoints")
+	}
+	for _, bp := range breakpoints {
+		fmt.Fprintf(s.out, "%s:%d\n", s.display(bp.File), bp.Line)
+	}
+}
+
+func (s *session) printScopes() {
+	for _, scope := range s.d.Scopes(s.frame) {
+		if len(scope.Bindings) == 0 {
+			continue
+		}
+		fmt.Fprintf(s.out, "%s:\n", scope.Name)
+		for _, b := range scope.Bindings {
+			fmt.Fprintf(s.out, "  %s = %s\n", b.Name, abbreviate(b.Value.Inspect()))
+		}
+	}
+}
+
+// abbreviate puts a value on one line and cuts it short if it is long, as
+// functions usually are.
+func abbreviate(value string) string {
+	value = strings.Join(strings.Fields(value), " ")
+	if len(value) > 60 {
+		value = value[:57] + "..."
+	}
+	return value
+}
+
+func (s *session) printLine(file string, n int) {
+	if lines := s.source(file); n >= 1 && n <= len(lines) {
+		fmt.Fprintf(s.out, "%d\t%s\n", n, lines[n-1])
+	}
+}
+
+// source returns the lines of file, reading it on first use.
+func (s *session) source(file string) []string {
+	if lines, ok := s.sources[file]; ok {
+		return lines
+	}
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return nil
+	}
+	lines := strings.Split(strings.TrimSuffix(string(content), "\n"), "\n")
+	s.sources[file] = lines
+	return lines
+}
+
+func (s *session) location(frame evaluator.Frame) string {
+	return fmt.Sprintf("%s:%d", s.display(frame.File), frame.Position.Line)
+}
+
+// display shortens file to a path relative to the program's directory.
+func (s *session) display(file string) string {
+	if rel, err := filepath.Rel(s.dir, file); err == nil && !strings.HasPrefix(rel, "..") {
+		return rel
+	}
+	return file
+}
@@ -0,0 +1,131 @@
+package debugger
+
+import (
+	"bytes"
+	"monkey/evaluator"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const program = `let add = function(a, b) {
+  let sum = a + b;
+  sum
+};
+let total = add(1, 2);
+puts(total);`
+
+func run(t *testing.T, commands ...string) (string, int) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "main.monkey")
+	if err := os.WriteFile(path, []byte(program), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	input := strings.NewReader(strings.Join(commands, "\n") + "\n")
+	code := Run(path, input, &out)
+	return out.String(), code
+}
+
+func expectOutput(t *testing.T, output string, expected ...string) {
+	t.Helper()
+	rest := output
+	for _, want := range expected {
+		i := strings.Index(rest, want)
+		if i < 0 {
+			t.Fatalf("expected %q in order in the output, got:\n%s", want, output)
+		}
+		rest = rest[i+len(want):]
+	}
+}
+
+func TestSession(t *testing.T) {
+	output, code := run(t,
+		"break 3",
+		"info breakpoints",
+		"continue",
+		"backtrace",
+		"locals",
+		"print sum * 10",
+		"up",
+		"print a",
+		"finish",
+		"next",
+		"",
+	)
+
+	expectOutput(t, output,
+		"stopped at main.monkey:1\n1\tlet add = function(a, b) {\n(monkey) ",
+		"breakpoint at main.monkey:3\n",
+		"main.monkey:3\n",
+		"breakpoint at main.monkey:3\n3\t  sum\n",
+		"> #0 add at main.monkey:3\n  #1 <program> at main.monkey:5\n",
+		"locals:\n  a = 1\n  b = 2\n  sum = 3\nglobals:\n  add = function(a, b) {",
+		"30\n",
+		"#1 <program> at main.monkey:5\n5\tlet total = add(1, 2);\n",
+		"identifier not found: a",
+		"stopped at main.monkey:6\n",
+		"program finished\n",
+	)
+	if code != 0 {
+		t.Errorf("expected exit code 0, got %d", code)
+	}
+}
+
+func TestStepIntoAndQuit(t *testing.T) {
+	output, code := run(t, "n", "s", "bt", "q")
+
+	expectOutput(t, output,
+		"stopped at main.monkey:5\n",
+		"stopped at main.monkey:2\n2\t  let sum = a + b;\n",
+		"#0 add at main.monkey:2",
+	)
+	if strings.Contains(output, "program finished") || code != 0 {
+		t.Errorf("expected the session to end quietly, got %d:\n%s", code, output)
+	}
+}
+
+func TestBadCommands(t *testing.T) {
+	output, _ := run(t, "frobnicate", "break x", "frame 7", "delete 4", "c")
+
+	expectOutput(t, output,
+		`unknown command "frobnicate"`,
+		"usage: break [file:]line",
+		"no frame 7",
+		"no breakpoint at main.monkey:4",
+		"program finished",
+	)
+}
+
+func TestErrors(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "main.monkey")
+	if err := os.WriteFile(path, []byte("let x = 1;\nx + true;"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	code := Run(path, strings.NewReader("c\n"), &out)
+	expectOutput(t, out.String(), "type mismatch: INTEGER + BOOLEAN")
+	if code != 1 {
+		t.Errorf("expected exit code 1, got %d", code)
+	}
+}
+
+func TestPrepare(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "main.monkey")
+	if err := os.WriteFile(path, []byte("puts(now());"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	code := Run(path, strings.NewReader("c\n"), &out, func(in *evaluator.Interpreter) {
+		in.Grant(evaluator.Clock)
+		in.Deterministic(1)
+	})
+	expectOutput(t, out.String(), "946684800000", "program finished")
+	if code != 0 {
+		t.Errorf("expected exit code 0, got %d", code)
+	}
+}
@@ -18,6 +18,46 @@ func NoPrefixParseError(t token.TokenType) string {
 	return fmt.Sprintf("No prefix parse function for %s found", t)
 }
 
+func OutsideOfLoop(keyword string) string {
+	return fmt.Sprintf("%s outside of loop", keyword)
+}
+
+func InvalidAssignmentTarget(target string) string {
+	return fmt.Sprintf("Cannot assign to %s", target)
+}
+
+func InvalidPattern(t token.TokenType) string {
+	return fmt.Sprintf("%s cannot be used as a pattern", t)
+}
+
+func UnreachableMatchArm(pattern string) string {
+	return fmt.Sprintf("unreachable match arm: %s", pattern)
+}
+
+func RequiredParameterAfterDefault(parameter string) string {
+	return fmt.Sprintf("required parameter %s follows a parameter with a default value", parameter)
+}
+
+func NotAtTopLevel(keyword string) string {
+	return fmt.Sprintf("%s is only allowed at the top level", keyword)
+}
+
+func InvalidModuleName(path string) string {
+	return fmt.Sprintf("cannot derive a module name from %q, use `as name`", path)
+}
+
+func UnknownType(name string) string {
+	return fmt.Sprintf("unknown type %s", name)
+}
+
+func InvalidType(t token.TokenType) string {
+	return fmt.Sprintf("%s cannot be used as a type", t)
+}
+
+func AnnotatedMacro() string {
+	return "macro parameters and results cannot have type annotations"
+}
+
 func NewError(format string, a ...interface{}) *object.Error {
 	return &object.Error{Message: fmt.Sprintf(format, a...)}
 }
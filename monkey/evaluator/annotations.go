@@ -0,0 +1,150 @@
+package evaluator
+
+import (
+	"fmt"
+	"monkey/ast"
+	"monkey/object"
+	"strings"
+)
+
+// checkAnnotation returns an error naming what was annotated when val does
+// not have the annotated type. A nil annotation accepts anything. For an
+// array the error names its first element that does not fit. Otherwise it
+// returns val, wrapped in a CheckedFunction when the annotation is a
+// function type, so that the calls of the function are checked too.
+func checkAnnotation(what string, annotation ast.TypeExpression, val object.Object) (object.Object, *object.Error) {
+	if annotation == nil {
+		return val, nil
+	}
+	if hasType(val, annotation) {
+		if t, ok := annotation.(*ast.FunctionType); ok {
+			// A function passed on under the same annotation, as from a
+			// recursive call, is checked once already.
+			if checked, ok := val.(*object.CheckedFunction); ok && checked.Annotation.String() == t.String() {
+				return val, nil
+			}
+			return &object.CheckedFunction{Function: val, Annotation: t, Name: what}, nil
+		}
+		return val, nil
+	}
+	if t, ok := annotation.(*ast.ArrayType); ok {
+		if array, ok := val.(*object.Array); ok {
+			for i, el := range array.Elements {
+				if _, err := checkAnnotation(fmt.Sprintf("%s, element %d", what, i), t.Element, el); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	return nil, newError("%s: expected %s, got %s", what, annotation.String(), typeName(val))
+}
+
+// hasType reports whether val fits t. Arrays are checked element by element.
+// For function types only the kind of value is checked, since the types of
+// a function's parameters are not known until it is called; checkAnnotation
+// has the calls checked, but not those of functions inside arrays.
+func hasType(val object.Object, t ast.TypeExpression) bool {
+	switch t := t.(type) {
+	case *ast.NamedType:
+		switch t.Name {
+		case "any":
+			return true
+		case "int":
+			return val.Type() == object.INTEGER_OBJECT
+		case "string":
+			return val.Type() == object.STRING_OBJECT
+		case "bool":
+			return val.Type() == object.BOOLEAN_OBJECT
+		case "null":
+			return val.Type() == object.NULL_OBJECT
+		case "hash":
+			return val.Type() == object.HASH_OBJECT
+		case "range":
+			return val.Type() == object.RANGE_OBJECT
+		}
+
+	case *ast.ArrayType:
+		array, ok := val.(*object.Array)
+		if !ok {
+			return false
+		}
+		for _, el := range array.Elements {
+			if !hasType(el, t.Element) {
+				return false
+			}
+		}
+		return true
+
+	case *ast.FunctionType:
+		return val.Type() == object.FUNCTION_OBJECT || val.Type() == object.BUILTIN_OBJECT
+	}
+
+	return false
+}
+
+// callChecked calls the function fn wraps, checking each argument the
+// annotation has a type for and the result.
+func (in *Interpreter) callChecked(fn *object.CheckedFunction, args []object.Object, call *ast.CallExpression) object.Object {
+	checkedArgs := make([]object.Object, len(args))
+	for i, arg := range args {
+		checkedArgs[i] = arg
+		if i >= len(fn.Annotation.Parameters) {
+			continue
+		}
+		checked, err := checkAnnotation(fmt.Sprintf("%s, argument %d", fn.Name, i+1), fn.Annotation.Parameters[i], arg)
+		if err != nil {
+			return err
+		}
+		checkedArgs[i] = checked
+	}
+
+	result := in.callFunction(fn.Function, checkedArgs, call)
+	if isError(result) {
+		return result
+	}
+	if result == nil {
+		result = NULL
+	}
+	checked, err := checkAnnotation(fn.Name+", return value", fn.Annotation.Return, result)
+	if err != nil {
+		return err
+	}
+	return checked
+}
+
+// typeName describes the type of val in the notation of annotations. An
+// array whose elements differ in type is described as [any].
+func typeName(val object.Object) string {
+	switch val := val.(type) {
+	case *object.Integer:
+		return "int"
+	case *object.String:
+		return "string"
+	case *object.Boolean:
+		return "bool"
+	case *object.Null:
+		return "null"
+	case *object.Hash:
+		return "hash"
+	case *object.Range:
+		return "range"
+	case *object.Function, *object.Builtin, *object.CheckedFunction:
+		return "function"
+	case *object.Array:
+		element := ""
+		for _, el := range val.Elements {
+			name := typeName(el)
+			if element != "" && element != name {
+				element = "any"
+				break
+			}
+			element = name
+		}
+		if element == "" {
+			element = "any"
+		}
+		return "[" + element + "]"
+	default:
+		return strings.ToLower(string(val.Type()))
+	}
+}
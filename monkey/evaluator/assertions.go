@@ -0,0 +1,121 @@
+package evaluator
+
+import (
+	"fmt"
+	"monkey/object"
+	"strconv"
+	"strings"
+)
+
+// assert fails unless its first argument is truthy. An optional second
+// argument is added to the failure message.
+func assert(args ...object.Object) object.Object {
+	if len(args) < 1 || len(args) > 2 {
+		return newError("wrong number of arguments to `assert`. Expects 1 to 2, got %d", len(args))
+	}
+
+	if isTruthy(args[0]) {
+		return NULL
+	}
+	if len(args) == 2 {
+		return newError("assertion failed: %s", describe(args[1]))
+	}
+	return newError("assertion failed")
+}
+
+// assertEq fails unless its arguments, the actual value and then the
+// expected one, are equal as == compares them. The failure shows both and
+// points at the first difference.
+func assertEq(args ...object.Object) object.Object {
+	if len(args) != 2 {
+		return newError("wrong number of arguments to `assertEq`. Expects 2, got %d", len(args))
+	}
+
+	actual, expected := args[0], args[1]
+	if object.Equals(actual, expected) {
+		return NULL
+	}
+
+	return newError("assertEq failed\n%s", diff(show(expected), show(actual)))
+}
+
+// assertThrows calls its first argument without arguments and fails unless
+// that produces an error. An optional second argument must then appear in
+// the error's message.
+func (in *Interpreter) assertThrows(args ...object.Object) object.Object {
+	if len(args) < 1 || len(args) > 2 {
+		return newError("wrong number of arguments to `assertThrows`. Expects 1 to 2, got %d", len(args))
+	}
+
+	result := in.applyFunction(args[0], nil)
+	err, ok := result.(*object.Error)
+	if !ok {
+		if result == nil {
+			result = NULL
+		}
+		return newError("assertThrows failed: expected an error, got %s", show(result))
+	}
+
+	if len(args) == 2 {
+		want, ok := args[1].(*object.String)
+		if !ok {
+			return newError("second argument to `assertThrows` must be STRING, got %s", args[1].Type())
+		}
+		if !strings.Contains(err.Message, want.Value) {
+			return newError("assertThrows failed: expected an error containing %q, got %q", want.Value, err.Message)
+		}
+	}
+
+	return NULL
+}
+
+// test runs a named test function. The test runner picks top-level calls to
+// test out of a file and runs each in isolation; anywhere else the function
+// simply runs, and its error stops the program.
+func (in *Interpreter) test(args ...object.Object) object.Object {
+	if len(args) != 2 {
+		return newError("wrong number of arguments to `test`. Expects 2, got %d", len(args))
+	}
+
+	name, ok := args[0].(*object.String)
+	if !ok {
+		return newError("first argument to `test` must be STRING, got %s", args[0].Type())
+	}
+
+	if err, ok := in.applyFunction(args[1], nil).(*object.Error); ok {
+		err.Message = fmt.Sprintf("test %q: %s", name.Value, err.Message)
+		return err
+	}
+	return NULL
+}
+
+// show renders a value for a failure message. Strings are quoted so that
+// they cannot be mistaken for other values.
+func show(obj object.Object) string {
+	if s, ok := obj.(*object.String); ok {
+		return strconv.Quote(s.Value)
+	}
+	return obj.Inspect()
+}
+
+func describe(obj object.Object) string {
+	if s, ok := obj.(*object.String); ok {
+		return s.Value
+	}
+	return obj.Inspect()
+}
+
+// diff lays out an expected and an actual rendering one above the other,
+// with a caret under the first byte where they differ.
+func diff(expected, actual string) string {
+	at := 0
+	for at < len(expected) && at < len(actual) && expected[at] == actual[at] {
+		at++
+	}
+
+	var str strings.Builder
+	str.WriteString("  expected: " + expected + "\n")
+	str.WriteString("       got: " + actual + "\n")
+	str.WriteString("            " + strings.Repeat(" ", at) + "^")
+	return str.String()
+}
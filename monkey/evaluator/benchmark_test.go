@@ -0,0 +1,57 @@
+package evaluator
+
+import (
+	"monkey/object"
+	"testing"
+)
+
+const fibonacciProgram = `
+let fibonacci = function(n) {
+	if (n < 2) { return n; }
+	fibonacci(n - 1) + fibonacci(n - 2)
+};
+fibonacci(20);
+`
+
+const closuresProgram = `
+let compose = function(f, g) { function(x) { f(g(x)) } };
+let adder = function(n) { function(x) { x + n } };
+let counter = function() {
+	let count = 0;
+	function() { count = count + 1; count }
+};
+let run = function(n) {
+	let next = counter();
+	let total = 0;
+	while (next() < n) {
+		let f = compose(adder(1), adder(total % 7));
+		total = total + f(1);
+	}
+	total
+};
+run(3000);
+`
+
+// benchmarkProgram evaluates input with slot-resolved locals and, for
+// comparison, with every identifier looked up by name.
+func benchmarkProgram(b *testing.B, input string) {
+	b.Run("slots", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			New().Eval(parse(input), object.NewEnvironment())
+		}
+	})
+
+	b.Run("names", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			New().evalProgram(parse(input), object.NewEnvironment())
+		}
+	})
+}
+
+func BenchmarkFibonacci(b *testing.B) {
+	benchmarkProgram(b, fibonacciProgram)
+}
+
+func BenchmarkClosures(b *testing.B) {
+	benchmarkProgram(b, closuresProgram)
+}
@@ -1,6 +1,41 @@
 package evaluator
 
-import "monkey/object"
+import (
+	"fmt"
+	"monkey/object"
+	"sort"
+)
+
+// BuiltinNames returns the names of the builtin functions, sorted.
+func BuiltinNames() []string {
+	names := make([]string, 0, len(builtins)+len(boundBuiltins)+len(sandboxedBuiltins))
+	for name := range builtins {
+		names = append(names, name)
+	}
+	for name := range boundBuiltins {
+		names = append(names, name)
+	}
+	for name := range sandboxedBuiltins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (in *Interpreter) puts(args ...object.Object) object.Object {
+	for _, arg := range args {
+		fmt.Fprintln(in.Output, arg.Inspect())
+	}
+	return NULL
+}
+
+// boundBuiltins are builtins that call back into the interpreter. Each
+// Interpreter gets its own, bound to it.
+var boundBuiltins = map[string]func(in *Interpreter) object.BuiltinFunction{
+	"assertThrows": func(in *Interpreter) object.BuiltinFunction { return in.assertThrows },
+	"puts":         func(in *Interpreter) object.BuiltinFunction { return in.puts },
+	"test":         func(in *Interpreter) object.BuiltinFunction { return in.test },
+}
 
 var builtins = map[string]*object.Builtin{
 	"len": {
@@ -14,9 +49,52 @@ var builtins = map[string]*object.Builtin{
 				return &object.Integer{
 					Value: int64(len(arg.Value)),
 				}
+			case *object.Array:
+				return &object.Integer{Value: int64(len(arg.Elements))}
+			case *object.Hash:
+				return &object.Integer{Value: int64(len(arg.Keys))}
+			case *object.Range:
+				return &object.Integer{Value: arg.Len()}
 			default:
 				return newError("argument to `len` not supported, got %s", arg.Type())
 			}
 		},
 	},
+	"assert":   {Function: assert},
+	"assertEq": {Function: assertEq},
+	"range": {
+		Function: func(args ...object.Object) object.Object {
+			if len(args) < 1 || len(args) > 3 {
+				return newError("wrong number of arguments to `range`. Expects 1 to 3, got %d", len(args))
+			}
+
+			bounds := []int64{}
+			for _, arg := range args {
+				integer, ok := arg.(*object.Integer)
+				if !ok {
+					return newError("argument to `range` must be INTEGER, got %s", arg.Type())
+				}
+				bounds = append(bounds, integer.Value)
+			}
+
+			r := &object.Range{Step: 1}
+			switch len(bounds) {
+			case 1:
+				r.End = bounds[0]
+			case 2:
+				r.Start, r.End = bounds[0], bounds[1]
+			case 3:
+				r.Start, r.End, r.Step = bounds[0], bounds[1], bounds[2]
+			}
+
+			if r.Step == 0 {
+				return newError("`range` step cannot be zero")
+			}
+			if r.Len() < 0 {
+				return newError("`range` has too many elements")
+			}
+
+			return r
+		},
+	},
 }
@@ -0,0 +1,330 @@
+package evaluator
+
+import (
+	"monkey/ast"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"monkey/token"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// StopReason says why a debugged program stopped.
+type StopReason string
+
+const (
+	StopEntry      StopReason = "entry"
+	StopBreakpoint StopReason = "breakpoint"
+	StopStep       StopReason = "step"
+	StopPause      StopReason = "pause"
+)
+
+// Action tells a stopped program how to go on.
+type Action int
+
+const (
+	// Continue runs until the next breakpoint.
+	Continue Action = iota
+	// StepInto stops at the next line, entering any function it calls.
+	StepInto
+	// StepOver stops at the next line of the current function or of one
+	// that it returns to.
+	StepOver
+	// StepOut stops once the current function has returned.
+	StepOut
+	// Quit abandons the program, which then evaluates to an error.
+	Quit
+)
+
+// Frontend controls a Debugger. Stopped is called whenever the program
+// stops; while it runs, the frontend may inspect the program through the
+// Debugger, and the action it returns resumes it.
+type Frontend interface {
+	Stopped(d *Debugger, reason StopReason) Action
+}
+
+// Frame is one function call in progress, or the program itself at the
+// bottom of the stack.
+type Frame struct {
+	Name string
+	File string
+
+	// Position is the statement being evaluated, or for a frame that has
+	// called another, the call.
+	Position token.Position
+	Env      *object.Environment
+}
+
+// Breakpoint is a line of a file where the program stops.
+type Breakpoint struct {
+	File string
+	Line int
+}
+
+// Scope is one environment of a frame's chain, named "locals" for the
+// frame's own, "closure" for those of enclosing functions and "globals".
+type Scope struct {
+	Name     string
+	Bindings []object.Binding
+}
+
+// Debugger stops a program at breakpoints and after steps. Attach it to an
+// Interpreter with Debug before evaluating. Breakpoints and Pause are safe
+// to use while the program runs on another goroutine; everything else is
+// meant for the frontend while the program is stopped.
+type Debugger struct {
+	// StopOnEntry makes the program stop before its first statement.
+	StopOnEntry bool
+
+	frontend Frontend
+
+	mu          sync.Mutex
+	breakpoints map[Breakpoint]bool
+	pause       bool
+
+	in     *Interpreter
+	files  map[ast.Statement]string
+	frames []*Frame
+	lines  []int
+
+	action  Action
+	depth   int
+	stopped bool
+	quit    bool
+
+	// evaluating is set while the frontend evaluates an expression, which
+	// must not stop.
+	evaluating bool
+}
+
+// NewDebugger returns a debugger controlled by frontend.
+func NewDebugger(frontend Frontend) *Debugger {
+	return &Debugger{frontend: frontend, breakpoints: make(map[Breakpoint]bool), action: Continue}
+}
+
+// Debug attaches d to the interpreter, which then reports every statement
+// and call to it.
+func (in *Interpreter) Debug(d *Debugger) {
+	in.debugger = d
+	d.in = in
+	d.files = make(map[ast.Statement]string)
+}
+
+// SetBreakpoint makes the program stop when it reaches line of file.
+func (d *Debugger) SetBreakpoint(file string, line int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.breakpoints[Breakpoint{File: absolute(file), Line: line}] = true
+}
+
+// ClearBreakpoint removes a breakpoint and reports whether there was one.
+func (d *Debugger) ClearBreakpoint(file string, line int) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	bp := Breakpoint{File: absolute(file), Line: line}
+	if !d.breakpoints[bp] {
+		return false
+	}
+	delete(d.breakpoints, bp)
+	return true
+}
+
+// ClearBreakpoints removes every breakpoint of file.
+func (d *Debugger) ClearBreakpoints(file string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	file = absolute(file)
+	for bp := range d.breakpoints {
+		if bp.File == file {
+			delete(d.breakpoints, bp)
+		}
+	}
+}
+
+// Breakpoints returns the breakpoints, ordered by file and line.
+func (d *Debugger) Breakpoints() []Breakpoint {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	bps := make([]Breakpoint, 0, len(d.breakpoints))
+	for bp := range d.breakpoints {
+		bps = append(bps, bp)
+	}
+	sort.Slice(bps, func(i, j int) bool {
+		if bps[i].File != bps[j].File {
+			return bps[i].File < bps[j].File
+		}
+		return bps[i].Line < bps[j].Line
+	})
+	return bps
+}
+
+// Pause stops the running program at its next statement.
+func (d *Debugger) Pause() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.pause = true
+}
+
+func absolute(file string) string {
+	if abs, err := filepath.Abs(file); err == nil {
+		return abs
+	}
+	return file
+}
+
+// Stack returns the frames of the stopped program, innermost first.
+func (d *Debugger) Stack() []Frame {
+	stack := make([]Frame, len(d.frames))
+	for i, f := range d.frames {
+		stack[len(d.frames)-1-i] = *f
+	}
+	return stack
+}
+
+// Scopes returns the environments that frame, an index into Stack, can see,
+// innermost first.
+func (d *Debugger) Scopes(frame int) []Scope {
+	stack := d.Stack()
+	if frame < 0 || frame >= len(stack) {
+		return nil
+	}
+
+	scopes := []Scope{}
+	for env := stack[frame].Env; env != nil; env = env.Outer() {
+		name := "closure"
+		switch {
+		case env.Outer() == nil:
+			name = "globals"
+		case len(scopes) == 0:
+			name = "locals"
+		}
+		scopes = append(scopes, Scope{Name: name, Bindings: env.Bindings()})
+	}
+	return scopes
+}
+
+// Evaluate evaluates source in the environment of frame, an index into
+// Stack. Breakpoints do not apply while it runs.
+func (d *Debugger) Evaluate(frame int, source string) object.Object {
+	stack := d.Stack()
+	if frame < 0 || frame >= len(stack) || stack[frame].Env == nil {
+		return newError("no frame %d", frame)
+	}
+
+	p := parser.New(lexer.New(source))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return newError("could not parse %q: %s", source, strings.Join(p.Errors(), "; "))
+	}
+
+	d.evaluating = true
+	defer func() { d.evaluating = false }()
+
+	// Left unresolved, the names find the frame's slots.
+	result := d.in.evalProgram(program, stack[frame].Env)
+	if result == nil {
+		return NULL
+	}
+	return result
+}
+
+// addSource records that the statements of program come from file.
+func (d *Debugger) addSource(file string, program *ast.Program) {
+	ast.Inspect(program, func(node ast.Node) bool {
+		if stmt, ok := node.(ast.Statement); ok {
+			d.files[stmt] = file
+		}
+		return node != nil
+	})
+}
+
+// enter and leave bracket a call to a Monkey function or the evaluation of
+// an imported module. call is the call expression, if there is one.
+func (d *Debugger) enter(name string, call *ast.CallExpression) {
+	file := ""
+	if n := len(d.frames); n > 0 {
+		file = d.frames[n-1].File
+		if call != nil {
+			d.frames[n-1].Position = ast.TokenOf(call).Position
+		}
+	}
+	d.frames = append(d.frames, &Frame{Name: name, File: file})
+	d.lines = append(d.lines, 0)
+}
+
+func (d *Debugger) leave() {
+	d.frames = d.frames[:len(d.frames)-1]
+	d.lines = d.lines[:len(d.lines)-1]
+}
+
+const errQuit = "program stopped by the debugger"
+
+// statement is called before stmt is evaluated in env. It stops the
+// program if it should, and returns an error once the frontend quits.
+func (d *Debugger) statement(stmt ast.Statement, env *object.Environment) *object.Error {
+	if d.quit {
+		return newError(errQuit)
+	}
+	if d.evaluating {
+		return nil
+	}
+
+	if len(d.frames) == 0 {
+		d.frames = append(d.frames, &Frame{Name: "<program>"})
+		d.lines = append(d.lines, 0)
+	}
+	top := len(d.frames) - 1
+	frame := d.frames[top]
+
+	file, ok := d.files[stmt]
+	if !ok {
+		file = frame.File
+	}
+	pos := ast.TokenOf(stmt).Position
+	newLine := pos.Line != d.lines[top] || file != frame.File
+
+	frame.File = file
+	frame.Position = pos
+	frame.Env = env
+	d.lines[top] = pos.Line
+
+	d.mu.Lock()
+	pause := d.pause
+	d.pause = false
+	breakpoint := d.breakpoints[Breakpoint{File: file, Line: pos.Line}]
+	d.mu.Unlock()
+
+	var reason StopReason
+	switch {
+	case pause:
+		reason = StopPause
+	case newLine && d.StopOnEntry && !d.stopped:
+		reason = StopEntry
+	case newLine && breakpoint:
+		reason = StopBreakpoint
+	case newLine && d.action == StepInto:
+		reason = StopStep
+	case newLine && d.action == StepOver && len(d.frames) <= d.depth:
+		reason = StopStep
+	case d.action == StepOut && len(d.frames) < d.depth:
+		reason = StopStep
+	default:
+		return nil
+	}
+
+	d.stopped = true
+	d.action = d.frontend.Stopped(d, reason)
+	d.depth = len(d.frames)
+
+	if d.action == Quit {
+		d.quit = true
+		return newError(errQuit)
+	}
+	return nil
+}
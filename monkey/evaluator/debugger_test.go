@@ -0,0 +1,175 @@
+package evaluator
+
+import (
+	"fmt"
+	"monkey/object"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// scriptedFrontend answers stops with the next of its actions, recording
+// where each stop happened, and lets a test inspect the stopped program.
+type scriptedFrontend struct {
+	actions []Action
+	inspect func(d *Debugger)
+	stops   []string
+}
+
+func (f *scriptedFrontend) Stopped(d *Debugger, reason StopReason) Action {
+	names := []string{}
+	for _, frame := range d.Stack() {
+		names = append(names, frame.Name)
+	}
+	top := d.Stack()[0]
+	f.stops = append(f.stops, fmt.Sprintf("%s %s:%d %s",
+		reason, filepath.Base(top.File), top.Position.Line, strings.Join(names, "<")))
+
+	if f.inspect != nil {
+		f.inspect(d)
+	}
+	if len(f.stops) > len(f.actions) {
+		return Quit
+	}
+	return f.actions[len(f.stops)-1]
+}
+
+const debuggedProgram = `let add = function(a, b) {
+  let sum = a + b;
+  sum
+};
+let total = add(1, 2);
+let twice = add(total, total);
+twice`
+
+func debug(t *testing.T, frontend *scriptedFrontend, stopOnEntry bool, breakpoints ...int) object.Object {
+	t.Helper()
+	dir := writeModules(t, map[string]string{"main.monkey": debuggedProgram})
+	path := filepath.Join(dir, "main.monkey")
+
+	in := New()
+	d := NewDebugger(frontend)
+	d.StopOnEntry = stopOnEntry
+	for _, line := range breakpoints {
+		d.SetBreakpoint(path, line)
+	}
+	in.Debug(d)
+	return in.EvalFile(path, object.NewEnvironment())
+}
+
+func TestDebuggerStepping(t *testing.T) {
+	tests := []struct {
+		name    string
+		actions []Action
+		stops   []string
+	}{
+		{
+			"step into",
+			[]Action{StepInto, StepInto, StepInto, StepInto, Continue},
+			[]string{
+				"entry main.monkey:1 <program>",
+				"step main.monkey:5 <program>",
+				"step main.monkey:2 add<<program>",
+				"step main.monkey:3 add<<program>",
+				"step main.monkey:6 <program>",
+			},
+		},
+		{
+			"step over",
+			[]Action{StepOver, StepOver, StepOver, StepOver},
+			[]string{
+				"entry main.monkey:1 <program>",
+				"step main.monkey:5 <program>",
+				"step main.monkey:6 <program>",
+				"step main.monkey:7 <program>",
+			},
+		},
+		{
+			"step out",
+			[]Action{StepOver, StepInto, StepOut, Continue},
+			[]string{
+				"entry main.monkey:1 <program>",
+				"step main.monkey:5 <program>",
+				"step main.monkey:2 add<<program>",
+				"step main.monkey:6 <program>",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		frontend := &scriptedFrontend{actions: tt.actions}
+		evaluated := debug(t, frontend, true)
+		if !reflect.DeepEqual(frontend.stops, tt.stops) {
+			t.Errorf("%s: wrong stops.\nwant=%q\ngot= %q", tt.name, tt.stops, frontend.stops)
+		}
+		testIntegerObject(t, evaluated, 6)
+	}
+}
+
+func TestDebuggerBreakpoints(t *testing.T) {
+	frontend := &scriptedFrontend{actions: []Action{Continue, Continue}}
+	evaluated := debug(t, frontend, false, 3)
+
+	expected := []string{
+		"breakpoint main.monkey:3 add<<program>",
+		"breakpoint main.monkey:3 add<<program>",
+	}
+	if !reflect.DeepEqual(frontend.stops, expected) {
+		t.Errorf("wrong stops.\nwant=%q\ngot= %q", expected, frontend.stops)
+	}
+	testIntegerObject(t, evaluated, 6)
+}
+
+func TestDebuggerInspection(t *testing.T) {
+	var scopes []Scope
+	var sum, caller object.Object
+	var stack []Frame
+
+	frontend := &scriptedFrontend{
+		actions: []Action{Continue, Continue},
+		inspect: func(d *Debugger) {
+			if stack != nil {
+				return
+			}
+			stack = d.Stack()
+			scopes = d.Scopes(0)
+			sum = d.Evaluate(0, "sum * 10")
+			caller = d.Evaluate(1, "total")
+		},
+	}
+	debug(t, frontend, false, 3)
+
+	if len(stack) != 2 || stack[1].Position.Line != 5 {
+		t.Fatalf("the caller should be stopped at the call on line 5, got %+v", stack)
+	}
+
+	if len(scopes) != 2 || scopes[0].Name != "locals" || scopes[1].Name != "globals" {
+		t.Fatalf("wrong scopes: %+v", scopes)
+	}
+	locals := map[string]string{}
+	for _, b := range scopes[0].Bindings {
+		locals[b.Name] = b.Value.Inspect()
+	}
+	if want := map[string]string{"a": "1", "b": "2", "sum": "3"}; !reflect.DeepEqual(locals, want) {
+		t.Errorf("wrong locals. want=%v, got=%v", want, locals)
+	}
+
+	testIntegerObject(t, sum, 30)
+	if _, ok := caller.(*object.Error); !ok {
+		t.Errorf("total is not bound yet when add is first called, got %s", caller.Inspect())
+	}
+}
+
+func TestDebuggerQuit(t *testing.T) {
+	frontend := &scriptedFrontend{actions: []Action{Quit}}
+	evaluated := debug(t, frontend, true)
+
+	err, ok := evaluated.(*object.Error)
+	if !ok || err.Message != errQuit {
+		t.Errorf("expected the program to stop, got %s", evaluated.Inspect())
+	}
+	if len(frontend.stops) != 1 {
+		t.Errorf("expected one stop, got %q", frontend.stops)
+	}
+}
@@ -4,39 +4,61 @@ import (
 	"fmt"
 	"monkey/ast"
 	"monkey/object"
+	"monkey/resolver"
 )
 
 var (
-	TRUE  = &object.Boolean{Value: true}
-	FALSE = &object.Boolean{Value: false}
-	NULL  = &object.Null{}
+	TRUE     = &object.Boolean{Value: true}
+	FALSE    = &object.Boolean{Value: false}
+	NULL     = &object.Null{}
+	BREAK    = &object.Break{}
+	CONTINUE = &object.Continue{}
 )
 
-func Eval(node ast.Node, env *object.Environment) object.Object {
+// Eval evaluates node in env and returns its value, telling the hooks of
+// the interpreter, if there are any.
+func (in *Interpreter) Eval(node ast.Node, env *object.Environment) object.Object {
+	if !in.evaluating {
+		return in.evaluation(env, nil, func() object.Object { return in.Eval(node, env) })
+	}
+	if in.hooks != nil {
+		return in.evalHooked(node, env)
+	}
+	return in.eval(node, env)
+}
+
+func (in *Interpreter) eval(node ast.Node, env *object.Environment) object.Object {
 	switch node := node.(type) {
 
 	case *ast.Program:
-		return evalProgram(node, env)
+		resolver.New(in.builtinNames()).Resolve(node)
+		return in.evalProgram(node, env)
 
 	case *ast.BlockStatement:
-		return evalBlockStatement(node, env)
+		return in.evalBlockStatement(node, env)
 
 	case *ast.ExpressionStatement:
-		return Eval(node.Expression, env)
+		return in.Eval(node.Expression, env)
 
 	case *ast.ReturnStatement:
-		val := Eval(node.ReturnValue, env)
-		if isError(val) {
+		val := in.Eval(node.ReturnValue, env)
+		if isAbrupt(val) {
 			return val
 		}
 		return &object.ReturnValue{Value: val}
 
 	case *ast.LetStatement:
-		val := Eval(node.Value, env)
-		if isError(val) {
+		val := in.Eval(node.Value, env)
+		if isAbrupt(val) {
 			return val
 		}
-		env.Set(node.Name.Value, val)
+		val, err := checkAnnotation("let "+node.Name.String(), node.Type, val)
+		if err != nil {
+			return err
+		}
+		if err := in.bindPattern(node.Name, val, env); err != nil {
+			return err
+		}
 
 	case *ast.IntegerLiteral:
 		return &object.Integer{Value: node.Value}
@@ -45,77 +67,177 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		return nativeBoolToBooleanObject(node.Value)
 
 	case *ast.PrefixExpression:
-		right := Eval(node.Right, env)
-		if isError(right) {
+		right := in.Eval(node.Right, env)
+		if isAbrupt(right) {
 			return right
 		}
 		return evalPrefixExpression(node.Operator, right)
 
 	case *ast.InfixExpression:
-		left := Eval(node.Left, env)
-		if isError(left) {
+		if node.Operator == "&&" || node.Operator == "||" {
+			return in.evalLogicalExpression(node, env)
+		}
+
+		left := in.Eval(node.Left, env)
+		if isAbrupt(left) {
 			return left
 		}
 
-		right := Eval(node.Right, env)
-		if isError(right) {
+		mark := in.hold(left)
+		right := in.Eval(node.Right, env)
+		if isAbrupt(right) {
+			in.release(mark)
 			return right
 		}
 
-		return evalInfixExpression(node.Operator, left, right)
+		in.hold(right)
+		if err := in.reserveConcatenation(node.Operator, left, right); err != nil {
+			in.release(mark)
+			return err
+		}
+		result := evalInfixExpression(node.Operator, left, right)
+		if _, ok := result.(*object.String); ok {
+			result = in.charge(result)
+		}
+		in.release(mark)
+		return result
 
 	case *ast.IfExpression:
-		return evalIfExpression(node, env)
+		return in.evalIfExpression(node, env)
 
 	case *ast.Identifier:
-		return evalIdentifier(node, env)
+		return in.evalIdentifier(node, env)
 
 	case *ast.FunctionLiteral:
-		params := node.Parameters
-		body := node.Body
-		return &object.Function{Parameters: params, Env: env, Body: body}
+		closure := object.NewClosure(env, node.Free)
+		if len(node.Free) > 0 {
+			if err := in.allocateEnv(closure); err != nil {
+				return err
+			}
+		}
+		return in.charge(&object.Function{
+			Parameters:     node.Parameters,
+			ParameterTypes: node.ParameterTypes,
+			Defaults:       node.Defaults,
+			Rest:           node.Rest,
+			RestType:       node.RestType,
+			ReturnType:     node.ReturnType,
+			Env:            closure,
+			Body:           node.Body,
+			Locals:         node.Locals,
+		})
+	case *ast.MacroLiteral:
+		return &object.Macro{
+			Parameters: node.Parameters,
+			Defaults:   node.Defaults,
+			Rest:       node.Rest,
+			Env:        object.NewClosure(env, node.Free),
+			Body:       node.Body,
+			Locals:     node.Locals,
+		}
 
 	case *ast.CallExpression:
-		function := Eval(node.Function, env)
-		if isError(function) {
+		if isCallTo(node, "quote") {
+			return in.quote(node, env)
+		}
+		if isCallTo(node, "unquote") {
+			return newError("unquote is only allowed inside quote")
+		}
+
+		function := in.Eval(node.Function, env)
+		if isAbrupt(function) {
 			return function
 		}
 
-		args := evalExpressions(node.Arguments, env)
-		if len(args) == 1 && isError(args[0]) {
+		mark := in.hold(function)
+		args := in.evalExpressions(node.Arguments, env)
+		if len(args) == 1 && isAbrupt(args[0]) {
+			in.release(mark)
 			return args[0]
 		}
 
-		return applyFunction(function, args)
+		result := in.callFunction(function, args, node)
+		in.release(mark)
+		if err, ok := result.(*object.Error); ok && !err.Position.IsValid() {
+			// Builtins do not know where they were called from.
+			if _, ok := function.(*object.Builtin); ok {
+				err.Position = ast.Pos(node)
+			}
+		}
+		return result
 	case *ast.StringLiteral:
-		return &object.String{Value: node.Value}
+		return in.charge(&object.String{Value: node.Value})
 	case *ast.ArrayLiteral:
-		elements := evalExpressions(node.Elements, env)
-		if len(node.Elements) == 1 && isError(elements[0]) {
+		mark := len(in.held)
+		elements := in.evalExpressions(node.Elements, env)
+		if len(elements) == 1 && isAbrupt(elements[0]) {
+			in.release(mark)
 			return elements[0]
 		}
-		return &object.Array{Elements: elements}
+		result := in.charge(&object.Array{Elements: elements})
+		in.release(mark)
+		return result
 	case *ast.IndexExpression:
-		left := Eval(node.Index, env)
-		if isError(left) {
+		left := in.Eval(node.Left, env)
+		if isAbrupt(left) {
 			return left
 		}
-		index := Eval(node.Index, env)
-		if isError(index) {
+		mark := in.hold(left)
+		index := in.Eval(node.Index, env)
+		in.release(mark)
+		if isAbrupt(index) {
 			return index
 		}
 		return evalIndexExpression(left, index)
+	case *ast.HashLiteral:
+		return in.evalHashLiteral(node, env)
+	case *ast.AssignExpression:
+		val := in.Eval(node.Value, env)
+		if isAbrupt(val) {
+			return val
+		}
+		if !assign(node.Name, val, env) {
+			return newError("identifier not found: " + node.Name.Value)
+		}
+		return val
+	case *ast.WhileStatement:
+		return in.evalWhileStatement(node, env)
+	case *ast.ForStatement:
+		return in.evalForStatement(node, env)
+	case *ast.MatchExpression:
+		return in.evalMatchExpression(node, env)
+	case *ast.ImportStatement:
+		return in.evalImportStatement(node, env)
+	case *ast.ExportStatement:
+		return in.evalExportStatement(node, env)
+	case *ast.MemberExpression:
+		obj := in.Eval(node.Object, env)
+		if isAbrupt(obj) {
+			return obj
+		}
+		return evalMemberExpression(obj, node.Property.Value)
+	case *ast.SpreadExpression:
+		return newError("spread is only allowed in call arguments and array literals")
+	case *ast.BreakStatement:
+		return BREAK
+	case *ast.ContinueStatement:
+		return CONTINUE
 
 	}
 
 	return nil
 }
 
-func evalProgram(program *ast.Program, env *object.Environment) object.Object {
+func (in *Interpreter) evalProgram(program *ast.Program, env *object.Environment) object.Object {
 	var result object.Object
 
 	for _, statement := range program.Statements {
-		result = Eval(statement, env)
+		if in.debugger != nil {
+			if err := in.debugger.statement(statement, env); err != nil {
+				return err
+			}
+		}
+		result = in.Eval(statement, env)
 
 		switch result := result.(type) {
 		case *object.ReturnValue:
@@ -128,18 +250,24 @@ func evalProgram(program *ast.Program, env *object.Environment) object.Object {
 	return result
 }
 
-func evalBlockStatement(
+func (in *Interpreter) evalBlockStatement(
 	block *ast.BlockStatement,
 	env *object.Environment,
 ) object.Object {
 	var result object.Object
 
 	for _, statement := range block.Statements {
-		result = Eval(statement, env)
+		if in.debugger != nil {
+			if err := in.debugger.statement(statement, env); err != nil {
+				return err
+			}
+		}
+		result = in.Eval(statement, env)
 
 		if result != nil {
-			rt := result.Type()
-			if rt == object.RETURN_VALUE_OBJECT || rt == object.ERROR_OBJECT {
+			switch result.Type() {
+			case object.RETURN_VALUE_OBJECT, object.ERROR_OBJECT,
+				object.BREAK_OBJECT, object.CONTINUE_OBJECT:
 				return result
 			}
 		}
@@ -176,9 +304,11 @@ func evalInfixExpression(
 	case left.Type() == object.STRING_OBJECT && right.Type() == object.STRING_OBJECT:
 		return evalStringInfixExpression(operator, left, right)
 	case operator == "==":
-		return nativeBoolToBooleanObject(left == right)
+		return nativeBoolToBooleanObject(object.Equals(left, right))
 	case operator == "!=":
-		return nativeBoolToBooleanObject(left != right)
+		return nativeBoolToBooleanObject(!object.Equals(left, right))
+	case left.Type() == object.ARRAY_OBJECT && right.Type() == object.ARRAY_OBJECT && isOrdering(operator):
+		return evalOrderingExpression(operator, left, right)
 	case left.Type() != right.Type():
 		return newError("type mismatch: %s %s %s",
 			left.Type(), operator, right.Type())
@@ -188,15 +318,93 @@ func evalInfixExpression(
 	}
 }
 
-func evalStringInfixExpression(operator string, left object.Object, right object.Object) object.Object {
-	if operator != "+" {
-		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+// evalLogicalExpression evaluates && and ||. The right operand is only
+// evaluated when the left one does not already decide the result.
+func (in *Interpreter) evalLogicalExpression(node *ast.InfixExpression, env *object.Environment) object.Object {
+	left := in.Eval(node.Left, env)
+	if isAbrupt(left) {
+		return left
 	}
 
+	if node.Operator == "&&" && !isTruthy(left) {
+		return FALSE
+	}
+	if node.Operator == "||" && isTruthy(left) {
+		return TRUE
+	}
+
+	right := in.Eval(node.Right, env)
+	if isAbrupt(right) {
+		return right
+	}
+
+	return nativeBoolToBooleanObject(isTruthy(right))
+}
+
+func evalStringInfixExpression(operator string, left object.Object, right object.Object) object.Object {
 	l := left.(*object.String).Value
 	r := right.(*object.String).Value
 
-	return &object.String{Value: l + r}
+	switch {
+	case operator == "+":
+		return &object.String{Value: l + r}
+	case operator == "==":
+		return nativeBoolToBooleanObject(l == r)
+	case operator == "!=":
+		return nativeBoolToBooleanObject(l != r)
+	case isOrdering(operator):
+		return evalOrderingExpression(operator, left, right)
+	default:
+		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+func isOrdering(operator string) bool {
+	return operator == "<" || operator == ">" || operator == "<=" || operator == ">="
+}
+
+// evalOrderingExpression evaluates <, >, <= and >= on strings and arrays,
+// in the order object.Compare puts them in.
+func evalOrderingExpression(operator string, left, right object.Object) object.Object {
+	c, ok := object.Compare(left, right)
+	if !ok {
+		return incomparable(operator, left, right, "")
+	}
+
+	switch operator {
+	case "<":
+		return nativeBoolToBooleanObject(c < 0)
+	case ">":
+		return nativeBoolToBooleanObject(c > 0)
+	case "<=":
+		return nativeBoolToBooleanObject(c <= 0)
+	default:
+		return nativeBoolToBooleanObject(c >= 0)
+	}
+}
+
+// incomparable describes why left and right cannot be ordered. For arrays,
+// it names the first pair of elements that cannot be, by their types and
+// where they are; at is where left and right themselves are.
+func incomparable(operator string, left, right object.Object, at string) *object.Error {
+	l, isArray := left.(*object.Array)
+	r, bothArrays := right.(*object.Array)
+	if isArray && bothArrays {
+		for i := 0; i < len(l.Elements) && i < len(r.Elements); i++ {
+			if _, ok := object.Compare(l.Elements[i], r.Elements[i]); !ok {
+				return incomparable(operator, l.Elements[i], r.Elements[i], fmt.Sprintf("%s[%d]", at, i))
+			}
+		}
+	}
+
+	where := ""
+	if at != "" {
+		where = " at " + at
+	}
+	if left.Type() != right.Type() {
+		return newError("type mismatch: %s %s %s%s", left.Type(), operator, right.Type(), where)
+	}
+	return newError("unknown operator: %s %s %s%s", left.Type(), operator, right.Type(), where)
 }
 
 func evalBangOperatorExpression(right object.Object) object.Object {
@@ -236,11 +444,37 @@ func evalIntegerInfixExpression(
 	case "*":
 		return &object.Integer{Value: leftVal * rightVal}
 	case "/":
+		if rightVal == 0 {
+			return newError("division by zero: %d / 0", leftVal)
+		}
 		return &object.Integer{Value: leftVal / rightVal}
+	case "%":
+		if rightVal == 0 {
+			return newError("division by zero: %d %% 0", leftVal)
+		}
+		return &object.Integer{Value: leftVal % rightVal}
+	case "&":
+		return &object.Integer{Value: leftVal & rightVal}
+	case "|":
+		return &object.Integer{Value: leftVal | rightVal}
+	case "^":
+		return &object.Integer{Value: leftVal ^ rightVal}
+	case "<<", ">>":
+		if rightVal < 0 {
+			return newError("negative shift count: %d %s %d", leftVal, operator, rightVal)
+		}
+		if operator == "<<" {
+			return &object.Integer{Value: leftVal << rightVal}
+		}
+		return &object.Integer{Value: leftVal >> rightVal}
 	case "<":
 		return nativeBoolToBooleanObject(leftVal < rightVal)
 	case ">":
 		return nativeBoolToBooleanObject(leftVal > rightVal)
+	case "<=":
+		return nativeBoolToBooleanObject(leftVal <= rightVal)
+	case ">=":
+		return nativeBoolToBooleanObject(leftVal >= rightVal)
 	case "==":
 		return nativeBoolToBooleanObject(leftVal == rightVal)
 	case "!=":
@@ -251,32 +485,45 @@ func evalIntegerInfixExpression(
 	}
 }
 
-func evalIfExpression(
+func (in *Interpreter) evalIfExpression(
 	ie *ast.IfExpression,
 	env *object.Environment,
 ) object.Object {
-	condition := Eval(ie.Condition, env)
-	if isError(condition) {
+	condition := in.Eval(ie.Condition, env)
+	if isAbrupt(condition) {
 		return condition
 	}
 
 	if isTruthy(condition) {
-		return Eval(ie.Consequence, env)
+		return in.Eval(ie.Consequence, env)
 	} else if ie.Alternative != nil {
-		return Eval(ie.Alternative, env)
+		return in.Eval(ie.Alternative, env)
 	} else {
 		return NULL
 	}
 }
 
-func evalIdentifier(
+func (in *Interpreter) evalIdentifier(
 	node *ast.Identifier,
 	env *object.Environment,
 ) object.Object {
-	if builtin, ok := builtins[node.Value]; ok {
+	if node.Scope == ast.LocalScope {
+		if val, ok := env.GetSlot(node.Depth, node.Slot); ok {
+			return val
+		}
+		return newError("identifier not found: " + node.Value)
+	}
+
+	if builtin, ok := in.builtins[node.Value]; ok {
 		return builtin
 	}
 
+	if node.Scope == ast.GlobalScope {
+		if val, ok := env.GetGlobal(node.Value); ok {
+			return val
+		}
+	}
+
 	val, ok := env.Get(node.Value)
 	if !ok {
 		return newError("identifier not found: " + node.Value)
@@ -285,6 +532,13 @@ func evalIdentifier(
 	return val
 }
 
+func assign(ident *ast.Identifier, val object.Object, env *object.Environment) bool {
+	if ident.Scope == ast.LocalScope {
+		return env.AssignSlot(ident.Depth, ident.Slot, val)
+	}
+	return env.Assign(ident.Value, val)
+}
+
 func isTruthy(obj object.Object) bool {
 	switch obj {
 	case NULL:
@@ -309,18 +563,53 @@ func isError(obj object.Object) bool {
 	return false
 }
 
-func evalExpressions(
+// isAbrupt reports whether obj ends the evaluation of the expression it was
+// produced in: an error, or a break or continue from a block used as a
+// value, which must reach the enclosing loop.
+func isAbrupt(obj object.Object) bool {
+	if obj != nil {
+		switch obj.Type() {
+		case object.ERROR_OBJECT, object.BREAK_OBJECT, object.CONTINUE_OBJECT:
+			return true
+		}
+	}
+	return false
+}
+
+func (in *Interpreter) evalExpressions(
 	exps []ast.Expression,
 	env *object.Environment,
 ) []object.Object {
 	var result []object.Object
 
 	for _, e := range exps {
-		evaluated := Eval(e, env)
-		if isError(evaluated) {
+		spread, isSpread := e.(*ast.SpreadExpression)
+		if isSpread {
+			e = spread.Value
+		}
+
+		evaluated := in.Eval(e, env)
+		if isAbrupt(evaluated) {
 			return []object.Object{evaluated}
 		}
-		result = append(result, evaluated)
+		// The values stay in use until the caller releases them.
+		in.hold(evaluated)
+
+		if !isSpread {
+			result = append(result, evaluated)
+			continue
+		}
+
+		array, ok := evaluated.(*object.Array)
+		if !ok {
+			return []object.Object{newError("cannot spread %s", evaluated.Type())}
+		}
+		// The elements may make an array, so what it would take up must
+		// fit before they are copied.
+		if err := in.reserve(object.ArraySize(len(result) + len(array.Elements))); err != nil {
+			return []object.Object{err}
+		}
+		result = append(result, array.Elements...)
 	}
 
 	return result
@@ -337,39 +626,197 @@ func evalArrayIndexExpression(array, index object.Object) object.Object {
 	return arr.Elements[idx]
 }
 
+func evalHashIndexExpression(hash, index object.Object) object.Object {
+	hashObject := hash.(*object.Hash)
+
+	key, ok := index.(object.Hashable)
+	if !ok {
+		return newError("unusable as hash key: %s", index.Type())
+	}
+
+	pair, ok := hashObject.Pairs[key.HashKey()]
+	if !ok {
+		return NULL
+	}
+
+	return pair.Value
+}
+
+func (in *Interpreter) evalHashLiteral(node *ast.HashLiteral, env *object.Environment) object.Object {
+	hash := object.NewHash()
+	defer in.release(in.hold(hash))
+
+	for _, pair := range node.Pairs {
+		key := in.Eval(pair.Key, env)
+		if isAbrupt(key) {
+			return key
+		}
+
+		hashKey, ok := key.(object.Hashable)
+		if !ok {
+			return newError("unusable as hash key: %s", key.Type())
+		}
+
+		value := in.Eval(pair.Value, env)
+		if isAbrupt(value) {
+			return value
+		}
+
+		hash.Set(hashKey.HashKey(), object.HashPair{Key: key, Value: value})
+	}
+
+	return in.charge(hash)
+}
+
 func evalIndexExpression(left, index object.Object) object.Object {
 	switch {
 	case left.Type() == object.ARRAY_OBJECT && index.Type() == object.INTEGER_OBJECT:
 		return evalArrayIndexExpression(left, index)
+	case left.Type() == object.HASH_OBJECT:
+		return evalHashIndexExpression(left, index)
 	default:
 		return newError("index operator not supported for type %s", left.Type())
 	}
 }
 
-func applyFunction(fn object.Object, args []object.Object) object.Object {
+func (in *Interpreter) applyFunction(fn object.Object, args []object.Object) object.Object {
+	return in.callFunction(fn, args, nil)
+}
+
+// callFunction applies fn to args for call, which is nil when the call does
+// not come from the program itself.
+func (in *Interpreter) callFunction(fn object.Object, args []object.Object, call *ast.CallExpression) object.Object {
 	switch fn := fn.(type) {
 	case *object.Function:
-		extendedEnv := extendFunctionEnv(fn, args)
-		evaluated := Eval(fn.Body, extendedEnv)
-		return unwrapReturnValue(evaluated)
+		if d := in.debugger; d != nil {
+			d.enter(CallName(call), call)
+			defer d.leave()
+		}
+		defer in.leave(len(in.scopes))
+		extendedEnv, err := in.extendFunctionEnv(fn, args)
+		if err != nil {
+			return err
+		}
+		for _, h := range in.hooks {
+			h.Call(fn, args, call, extendedEnv)
+		}
+		evaluated := in.evalFunctionBody(fn, extendedEnv)
+		for _, h := range in.hooks {
+			h.Return(fn, call, evaluated)
+		}
+		return evaluated
+	case *object.CheckedFunction:
+		return in.callChecked(fn, args, call)
 	case *object.Builtin:
-		return fn.Function(args...)
+		for _, h := range in.hooks {
+			h.Call(fn, args, call, nil)
+		}
+		result := in.charge(fn.Function(args...))
+		for _, h := range in.hooks {
+			h.Return(fn, call, result)
+		}
+		return result
 	default:
 		return newError("not a function: %s", fn.Type())
 	}
 }
 
-func extendFunctionEnv(
+func (in *Interpreter) evalFunctionBody(fn *object.Function, env *object.Environment) object.Object {
+	evaluated := unwrapReturnValue(in.Eval(fn.Body, env))
+	if fn.ReturnType != nil && !isError(evaluated) {
+		if evaluated == nil {
+			evaluated = NULL
+		}
+		checked, err := checkAnnotation("return value", fn.ReturnType, evaluated)
+		if err != nil {
+			return err
+		}
+		evaluated = checked
+	}
+	return evaluated
+}
+
+func (in *Interpreter) extendFunctionEnv(
 	fn *object.Function,
 	args []object.Object,
-) *object.Environment {
-	env := object.NewEnclosedEnvironment(fn.Env)
+) (*object.Environment, *object.Error) {
+	if err := checkArity(fn, len(args)); err != nil {
+		return nil, err
+	}
+
+	env := object.NewFrame(fn.Env, fn.Locals)
+	if err := in.allocateEnv(env); err != nil {
+		return nil, err
+	}
+	// The frame stays in use until callFunction is done with it.
+	in.enter(env)
 
 	for paramIdx, param := range fn.Parameters {
-		env.Set(param.Value, args[paramIdx])
+		var arg object.Object
+		if paramIdx < len(args) {
+			arg = args[paramIdx]
+		} else {
+			// Defaults are evaluated on every call, in the new environment,
+			// so they can refer to the parameters before them.
+			arg = in.Eval(fn.Defaults[paramIdx], env)
+			if err, ok := arg.(*object.Error); ok {
+				return nil, err
+			}
+		}
+
+		if paramIdx < len(fn.ParameterTypes) {
+			checked, err := checkAnnotation("parameter "+param.String(), fn.ParameterTypes[paramIdx], arg)
+			if err != nil {
+				return nil, err
+			}
+			arg = checked
+		}
+
+		if err := in.bindPattern(param, arg, env); err != nil {
+			return nil, err
+		}
+	}
+
+	if fn.Rest != nil {
+		rest := []object.Object{}
+		if len(args) > len(fn.Parameters) {
+			if err := in.reserve(object.ArraySize(len(args) - len(fn.Parameters))); err != nil {
+				return nil, err
+			}
+			rest = append(rest, args[len(fn.Parameters):]...)
+		}
+		restArray := &object.Array{Elements: rest}
+		if err := in.allocateValue(restArray); err != nil {
+			return nil, err
+		}
+		if _, err := checkAnnotation("parameter ..."+fn.Rest.Value, fn.RestType, restArray); err != nil {
+			return nil, err
+		}
+		bind(fn.Rest, restArray, env)
 	}
 
-	return env
+	return env, nil
+}
+
+func checkArity(fn *object.Function, got int) *object.Error {
+	required := 0
+	for paramIdx := range fn.Parameters {
+		if paramIdx >= len(fn.Defaults) || fn.Defaults[paramIdx] == nil {
+			required = paramIdx + 1
+		}
+	}
+	max := len(fn.Parameters)
+
+	switch {
+	case got >= required && (got <= max || fn.Rest != nil):
+		return nil
+	case fn.Rest != nil:
+		return newError("wrong number of arguments. Expects at least %d, got %d", required, got)
+	case required == max:
+		return newError("wrong number of arguments. Expects %d, got %d", max, got)
+	default:
+		return newError("wrong number of arguments. Expects %d to %d, got %d", required, max, got)
+	}
 }
 
 func unwrapReturnValue(obj object.Object) object.Object {
@@ -1,6 +1,8 @@
 package evaluator
 
 import (
+	"bytes"
+	"monkey/ast"
 	"monkey/lexer"
 	"monkey/object"
 	"monkey/parser"
@@ -359,7 +361,7 @@ func TestFunctionObject(t *testing.T) {
 		t.Fatalf("parameter is not 'x'. got=%q", function.Parameters[0])
 	}
 
-	expectedBody := "(x + 2)"
+	expectedBody := "{ (x + 2) }"
 
 	if function.Body.String() != expectedBody {
 		t.Fatalf("body is not %q. got=%q", expectedBody, function.Body.String())
@@ -402,12 +404,15 @@ ourFunction(20) + first + second;`
 }
 
 func testEval(input string) object.Object {
-	l := lexer.New(input)
-	p := parser.New(l)
-	program := p.ParseProgram()
 	env := object.NewEnvironment()
 
-	return Eval(program, env)
+	return Eval(parse(input), env)
+}
+
+func parse(input string) *ast.Program {
+	l := lexer.New(input)
+	p := parser.New(l)
+	return p.ParseProgram()
 }
 
 func testIntegerObject(t *testing.T, obj object.Object, expected int64) bool {
@@ -446,3 +451,740 @@ func testNullObject(t *testing.T, obj object.Object) bool {
 	}
 	return true
 }
+
+func TestHashLiterals(t *testing.T) {
+	input := `let two = "two";
+	{
+		"one": 10 - 9,
+		two: 1 + 1,
+		"thr" + "ee": 6 / 2,
+		4: 4,
+		true: 5,
+		false: 6
+	}`
+
+	evaluated := testEval(input)
+	result, ok := evaluated.(*object.Hash)
+	if !ok {
+		t.Fatalf("Eval didn't return Hash, got %T (%+v)", evaluated, evaluated)
+	}
+
+	expected := map[object.HashKey]int64{
+		(&object.String{Value: "one"}).HashKey():   1,
+		(&object.String{Value: "two"}).HashKey():   2,
+		(&object.String{Value: "three"}).HashKey(): 3,
+		(&object.Integer{Value: 4}).HashKey():      4,
+		TRUE.HashKey():                             5,
+		FALSE.HashKey():                            6,
+	}
+
+	if len(result.Pairs) != len(expected) {
+		t.Fatalf("Hash has wrong number of pairs, got %d", len(result.Pairs))
+	}
+
+	for expectedKey, expectedValue := range expected {
+		pair, ok := result.Pairs[expectedKey]
+		if !ok {
+			t.Errorf("no pair for given key in Pairs")
+		}
+		testIntegerObject(t, pair.Value, expectedValue)
+	}
+
+	if result.Inspect() != "{one: 1, two: 2, three: 3, 4: 4, true: 5, false: 6}" {
+		t.Errorf("hash does not keep insertion order, got %s", result.Inspect())
+	}
+}
+
+func TestHashIndexExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`{"foo": 5}["foo"]`, 5},
+		{`{"foo": 5}["bar"]`, nil},
+		{`let key = "foo"; {"foo": 5}[key]`, 5},
+		{`{}["foo"]`, nil},
+		{`{5: 5}[5]`, 5},
+		{`{true: 5}[true]`, 5},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if integer, ok := tt.expected.(int); ok {
+			testIntegerObject(t, evaluated, int64(integer))
+		} else {
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestAssignExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let a = 1; a = 2; a", 2},
+		{"let a = 1; let b = 1; a = b = 3; a + b", 6},
+		{"let a = 1; let f = function() { a = a + 1 }; f(); f(); a", 3},
+		{"let counter = function() { let c = 0; function() { c = c + 1 } }; let next = counter(); next(); next()", 2},
+		{"b = 1", "identifier not found: b"},
+	}
+
+	for _, tt := range tests {
+		testExpectedObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestWhileStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let i = 0; while (i < 10) { i = i + 1; } i", 10},
+		{"let i = 0; while (false) { i = i + 1; } i", 0},
+		{"let i = 0; while (true) { i = i + 1; if (i > 4) { break; } } i", 5},
+		{"let i = 0; let n = 0; while (i < 10) { i = i + 1; if (i > 3) { continue; } n = n + 1; } n", 3},
+		{"let f = function() { let i = 0; while (true) { i = i + 1; if (i == 7) { return i; } } }; f()", 7},
+		{"while (1 + true) { 1 }", "type mismatch: INTEGER + BOOLEAN"},
+		{"while (true) { x }", "identifier not found: x"},
+		{"while (false) { 1 }", nil},
+	}
+
+	for _, tt := range tests {
+		testExpectedObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestForStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let sum = 0; for (x in [1, 2, 3]) { sum = sum + x; } sum", 6},
+		{"let sum = 0; for (i, x in [10, 20, 30]) { sum = sum + i; } sum", 3},
+		{`let s = ""; for (c in "abc") { s = c + s; } s`, "cba"},
+		{`let s = ""; for (i, c in "héllo") { s = s + c; if (i == 1) { s = s + "|"; } } s`, "hé|llo"},
+		{`let keys = []; for (i, c in "héllo") { keys = [...keys, i]; } keys == [0, 1, 2, 3, 4]`, true},
+		{`let s = ""; for (k in {"a": 1, "b": 2}) { s = s + k; } s`, "ab"},
+		{`let sum = 0; for (k, v in {"a": 1, "b": 2}) { sum = sum + v; } sum`, 3},
+		{"let sum = 0; for (x in range(5)) { sum = sum + x; } sum", 10},
+		{"let sum = 0; for (x in range(2, 5)) { sum = sum + x; } sum", 9},
+		{"let sum = 0; for (x in range(10, 0, -3)) { sum = sum + x; } sum", 22},
+		{"let sum = 0; for (x in range(100)) { if (x == 4) { break; } sum = sum + x; } sum", 6},
+		{"let sum = 0; for (x in range(6)) { if (x - x / 2 * 2 == 1) { continue; } sum = sum + x; } sum", 6},
+		{"let find = function(xs) { for (x in xs) { if (x > 1) { return x; } } }; find([1, 2, 3])", 2},
+		{"for (x in []) { x }", nil},
+		{"for (x in 5) { x }", "cannot iterate over INTEGER"},
+		{"for (x in [1]) { x + true }", "type mismatch: INTEGER + BOOLEAN"},
+		{"range(1, 2, 0)", "`range` step cannot be zero"},
+		{"len(range(0, 10, 3))", 4},
+		{"len(range(10, 0, -3))", 4},
+		{"len(range(-9223372036854775807, 9223372036854775807, 4611686018427387904))", 4},
+		{"len(range(9223372036854775807, -9223372036854775807, -4611686018427387904))", 4},
+		{"range(-9223372036854775807, 9223372036854775807)", "`range` has too many elements"},
+		{"range(9223372036854775807, -9223372036854775807, -1)", "`range` has too many elements"},
+		{"let n = 0; for (x in range(-9223372036854775807, 9223372036854775807, 4611686018427387904)) { n = n + 1; } n", 4},
+		{"len([1, 2, 3])", 3},
+	}
+
+	for _, tt := range tests {
+		testExpectedObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestNestedLoops(t *testing.T) {
+	input := `
+let count = 0;
+for (i in range(3)) {
+  for (j in range(3)) {
+    if (j == 1) { break; }
+    count = count + 1;
+  }
+}
+count`
+
+	testIntegerObject(t, testEval(input), 3)
+}
+
+func TestLoopSignalsInValuePositions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+		output   string
+	}{
+		{`let i = 0; while (i < 3) { i = i + 1; let x = if (true) { break; }; puts("after", x); } i`, 1, ""},
+		{`for (x in [1, 2]) { puts(if (true) { continue; } else { 1 }) }`, nil, ""},
+		{"let n = 0; for (x in range(5)) { n = n + if (x > 2) { break; } else { x }; } n", 3, ""},
+		{"let xs = []; for (x in range(3)) { xs = [x, match (x) { 1 => { continue; }, _ => x }]; } xs[0]", 2, ""},
+		{`for (x in [1]) { puts("in"); let h = {"k": if (true) { break; }}; puts("after"); }`, nil, "in\n"},
+	}
+
+	for _, tt := range tests {
+		var out bytes.Buffer
+		in := New()
+		in.Output = &out
+		testExpectedObject(t, in.Eval(parse(tt.input), object.NewEnvironment()), tt.expected)
+		if out.String() != tt.output {
+			t.Errorf("%s: wrong output. got=%q, want=%q", tt.input, out.String(), tt.output)
+		}
+	}
+}
+
+func TestAssertions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`assert(1 < 2)`, nil},
+		{`assert(1 > 2)`, "assertion failed"},
+		{`assert(false, "it broke")`, "assertion failed: it broke"},
+		{`assert()`, "wrong number of arguments to `assert`. Expects 1 to 2, got 0"},
+		{`assertEq([1, 2], [1, 2])`, nil},
+		{`assertEq({"a": 1}, {"a": 1})`, nil},
+		{`assertEq({"a": 1, "b": [2]}, {"b": [2], "a": 1})`, nil},
+		{`assertEq(1, "1")`, "assertEq failed\n  expected: \"1\"\n       got: 1\n            ^"},
+		{`assertEq([1, 2, 3], [1, 5, 3])`, "assertEq failed\n  expected: [1, 5, 3]\n       got: [1, 2, 3]\n                ^"},
+		{`assertThrows(function() { 1 + true })`, nil},
+		{`assertThrows(function() { 1 + true }, "type mismatch")`, nil},
+		{`assertThrows(function() { 1 })`, "assertThrows failed: expected an error, got 1"},
+		{`assertThrows(function() { 1 + true }, "unknown")`, `assertThrows failed: expected an error containing "unknown", got "type mismatch: INTEGER + BOOLEAN"`},
+		{`test("passes", function() { assert(true) })`, nil},
+		{`test("fails", function() { assertEq(1, 1); assert(false) })`, `test "fails": assertion failed`},
+		{`test(1, function() { 1 })`, "first argument to `test` must be STRING, got INTEGER"},
+	}
+
+	for _, tt := range tests {
+		testExpectedObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestBuiltinErrorsHaveCallPosition(t *testing.T) {
+	evaluated := testEval("let x = 1;\n  assert(x > 1);")
+
+	err, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+	}
+	if err.Position.Line != 2 || err.Position.Column != 3 {
+		t.Errorf("wrong position. expected 2:3, got %s", err.Position)
+	}
+}
+
+func testExpectedObject(t *testing.T, obj object.Object, expected interface{}) bool {
+	switch expected := expected.(type) {
+	case int:
+		return testIntegerObject(t, obj, int64(expected))
+	case bool:
+		return testBooleanObject(t, obj, expected)
+	case nil:
+		return testNullObject(t, obj)
+	case string:
+		switch obj := obj.(type) {
+		case *object.String:
+			if obj.Value != expected {
+				t.Errorf("String has wrong value. got=%q, want=%q", obj.Value, expected)
+				return false
+			}
+		case *object.Error:
+			if obj.Message != expected {
+				t.Errorf("wrong error message. expected=%q, got=%q", expected, obj.Message)
+				return false
+			}
+		default:
+			t.Errorf("object is not String or Error. got=%T (%+v)", obj, obj)
+			return false
+		}
+	}
+	return true
+}
+
+func TestIntegerOperators(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"7 % 3", 1},
+		{"-7 % 3", -1},
+		{"6 % 3 + 1", 1},
+		{"6 & 3", 2},
+		{"6 | 3", 7},
+		{"6 ^ 3", 5},
+		{"1 << 4", 16},
+		{"256 >> 4", 16},
+		{"1 << 2 + 1", 8},
+		{"3 <= 3", true},
+		{"3 <= 2", false},
+		{"3 >= 3", true},
+		{"2 >= 3", false},
+		{"10 / 0", "division by zero: 10 / 0"},
+		{"10 % 0", "division by zero: 10 % 0"},
+		{"let f = function(x) { 1 / x }; f(0)", "division by zero: 1 / 0"},
+		{"1 << -1", "negative shift count: 1 << -1"},
+		{"true % false", "unknown operator: BOOLEAN % BOOLEAN"},
+	}
+
+	for _, tt := range tests {
+		testExpectedObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestStructuralComparison(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`"a" + "b" == "ab"`, true},
+		{`"a" != "a"`, false},
+		{`[1, [2, "x"]] == [1, [2, "x"]]`, true},
+		{`[1, 2] == [1, 2, 3]`, false},
+		{`[1, 2] != [2, 1]`, true},
+		{`[1] == ["1"]`, false},
+		{`{"a": 1, "b": [2]} == {"b": [2], "a": 1}`, true},
+		{`{"a": 1} == {"a": 2}`, false},
+		{`{1: true} == {"1": true}`, false},
+		{`let n = if (false) { 1 }; [n, true] == [n, true]`, true},
+		{`range(3) == range(0, 3)`, true},
+		{`let f = function() { 1 }; [f] == [f]`, true},
+		{`[function() { 1 }] == [function() { 1 }]`, false},
+		{`1 == "1"`, false},
+		{`"abc" < "abd"`, true},
+		{`"ab" < "abc"`, true},
+		{`"b" > "abc"`, true},
+		{`"a" <= "a"`, true},
+		{`"a" >= "b"`, false},
+		{`[1, 2] < [1, 3]`, true},
+		{`[1, 2] < [1, 2, 0]`, true},
+		{`[[2]] > [[1, 5]]`, true},
+		{`["b"] >= ["a", "z"]`, true},
+		{`[] <= []`, true},
+		{`[1] < ["a"]`, "type mismatch: INTEGER < STRING at [0]"},
+		{`[{}] < [{}]`, "unknown operator: HASH < HASH at [0]"},
+		{`[0, [1, 2]] > [0, [1, "b"]]`, "type mismatch: INTEGER > STRING at [1][1]"},
+		{`[1, {}] < [2, "x"]`, true},
+		{`"a" < 1`, "type mismatch: STRING < INTEGER"},
+		{`[1] - [1]`, "unknown operator: ARRAY - ARRAY"},
+		{`{} < {}`, "unknown operator: HASH < HASH"},
+		{`match ("a") { "a" => 1, _ => 2 }`, 1},
+	}
+
+	for _, tt := range tests {
+		testExpectedObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestLogicalOperators(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"true && true", true},
+		{"true && false", false},
+		{"false && true", false},
+		{"false || true", true},
+		{"false || false", false},
+		{"1 < 2 && 2 < 3", true},
+		{"1 && 0", true},
+		{"if (false) { 1 } || 2", true},
+		{"let x = 5; x >= 1 && x <= 10", true},
+		{"let x = 11; x >= 1 && x <= 10", false},
+		// The right operand must not be evaluated when the left decides.
+		{"false && missing", false},
+		{"true || missing", true},
+		{"false && 1 / 0", false},
+		{"true && missing", "identifier not found: missing"},
+		{"let n = 0; let bump = function() { n = n + 1; true }; false && bump(); true || bump(); n", 0},
+	}
+
+	for _, tt := range tests {
+		testExpectedObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestMatchExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`match (1) { 1 => "one", 2 => "two", _ => "many" }`, "one"},
+		{`match (2) { 1 => "one", 2 => "two", _ => "many" }`, "two"},
+		{`match (7) { 1 => "one", 2 => "two", _ => "many" }`, "many"},
+		{`match (-1) { -1 => "minus one", _ => "other" }`, "minus one"},
+		{`match ("b") { "a" => 1, "b" => 2 }`, 2},
+		{`match (true) { false => 0, true => 1 }`, 1},
+		{`match (5) { n => n * 2 }`, 10},
+		{`match (5) { n if n > 10 => "big", n if n > 1 => "medium", _ => "small" }`, "medium"},
+		{`match ([]) { [] => "empty", [x] => "one", _ => "more" }`, "empty"},
+		{`match ([4]) { [] => "empty", [x] => x, _ => "more" }`, 4},
+		{`match ([1, 2, 3]) { [head, ...tail] => head + len(tail) }`, 3},
+		{`match ([1, 2, 3]) { [a, b, c, ...rest] => len(rest) }`, 0},
+		{`match ([1, 2, 3]) { [1, _, x] => x, _ => 0 }`, 3},
+		{`match ([1, [2, 3]]) { [a, [b, c]] => a + b + c }`, 6},
+		{`match ([1, 2]) { [a, b, c] => 0, [a, ..._] => a }`, 1},
+		{`match ({"name": "ada", "age": 36}) { {"name": "bob"} => 0, {"age": age} => age }`, 36},
+		{`match ({"name": "ada"}) { {name} => name }`, "ada"},
+		{`match ({"point": [1, 2]}) { {point: [x, y]} => x + y }`, 3},
+		{`match ({"a": 1}) { {"b": b} => b, _ => 0 }`, 0},
+		{`match ([1, 2]) { {"a": a} => a, [x, y] => y }`, 2},
+		{`match (3) { x => { let y = x * 2; y + 1 } }`, 7},
+		{`let x = 1; match (5) { x if x > 10 => 0, _ => x }`, 1},
+		{`match (3) { 1 => 1, 2 => 2 }`, "no match arm matches 3"},
+		{`match (missing) { _ => 1 }`, "identifier not found: missing"},
+		{`match (1) { x if x + true => 1 }`, "type mismatch: INTEGER + BOOLEAN"},
+		{`let f = function(xs) { match (xs) { [] => 0, [x, ...rest] => x + f(rest) } }; f([1, 2, 3, 4])`, 10},
+		{`let f = function(x) { match (x) { 1 => { return "early"; }, _ => 0 }; "late" }; f(1)`, "early"},
+	}
+
+	for _, tt := range tests {
+		testExpectedObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestDestructuringLetStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let [a, b] = [1, 2]; a + b", 3},
+		{"let [a, b, ...rest] = [1, 2, 3, 4]; len(rest) * 10 + rest[1]", 24},
+		{"let [a, ...rest] = [1]; len(rest)", 0},
+		{"let [a, [b, c]] = [1, [2, 3]]; a + b + c", 6},
+		{"let [_, x] = [1, 2]; x", 2},
+		{`let {name, age} = {"name": "ada", "age": 36}; age`, 36},
+		{`let {name, age} = {"name": "ada", "age": 36}; name`, "ada"},
+		{`let {"pos": [x, y]} = {"pos": [3, 4]}; x * y`, 12},
+		{`let {pos: {x}} = {"pos": {"x": 7}}; x`, 7},
+		{"let [a, b] = [1]; a", "cannot destructure [1] with [a, b]: expected 2 elements, got 1"},
+		{"let [a, b] = [1, 2, 3]; a", "cannot destructure [1, 2, 3] with [a, b]: expected 2 elements, got 3"},
+		{"let [a, b, ...c] = [1]; a", "cannot destructure [1] with [a, b, ...c]: expected at least 2 elements, got 1"},
+		{"let [a] = 5; a", "cannot destructure 5 with [a]: expected ARRAY, got INTEGER"},
+		{`let {name} = [1]; name`, "cannot destructure [1] with {\"name\": name}: expected HASH, got ARRAY"},
+		{`let {name} = {"age": 1}; name`, "cannot destructure {age: 1} with {\"name\": name}: missing key name"},
+		{"let [a, [b]] = [1, 2]; a", "cannot destructure [1, 2] with [a, [b]]: expected ARRAY, got INTEGER"},
+	}
+
+	for _, tt := range tests {
+		testExpectedObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestDestructuringFunctionParameters(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let f = function([a, b]) { a * b }; f([3, 4])", 12},
+		{"let f = function(x, [head, ...tail]) { x + head + len(tail) }; f(1, [2, 3, 4])", 5},
+		{`let greet = function({name}) { "hi " + name }; greet({"name": "ada"})`, "hi ada"},
+		{"let sum = function([x, ...xs]) { if (len(xs) == 0) { x } else { x + sum(xs) } }; sum([1, 2, 3])", 6},
+		{"let f = function([a, b]) { a }; f(5)", "cannot destructure 5 with [a, b]: expected ARRAY, got INTEGER"},
+		{`let f = function({name}) { name }; f({})`, "cannot destructure {} with {\"name\": name}: missing key name"},
+	}
+
+	for _, tt := range tests {
+		testExpectedObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestFunctionArity(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let f = function(x, y) { x + y }; f(1)", "wrong number of arguments. Expects 2, got 1"},
+		{"let f = function(x, y) { x + y }; f(1, 2, 3)", "wrong number of arguments. Expects 2, got 3"},
+		{"let f = function() { 1 }; f(1)", "wrong number of arguments. Expects 0, got 1"},
+		{"let f = function(x, y = 1) { x + y }; f()", "wrong number of arguments. Expects 1 to 2, got 0"},
+		{"let f = function(x, y = 1) { x + y }; f(1, 2, 3)", "wrong number of arguments. Expects 1 to 2, got 3"},
+		{"let f = function(x, ...rest) { x }; f()", "wrong number of arguments. Expects at least 1, got 0"},
+		{"function(x) { x }(1, 2)", "wrong number of arguments. Expects 1, got 2"},
+	}
+
+	for _, tt := range tests {
+		testExpectedObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestDefaultParameters(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let f = function(x, y = 10) { x + y }; f(1)", 11},
+		{"let f = function(x, y = 10) { x + y }; f(1, 2)", 3},
+		{"let f = function(x = 1, y = x * 2) { x + y }; f()", 3},
+		{"let f = function(x = 1, y = x * 2) { x + y }; f(5)", 15},
+		{"let n = 0; let f = function(x = n) { x }; n = 4; f()", 4},
+		{"let f = function([a, b] = [1, 2]) { a + b }; f()", 3},
+		{"let f = function(x = missing) { x }; f()", "identifier not found: missing"},
+		{"let f = function(x = missing) { x }; f(1)", 1},
+	}
+
+	for _, tt := range tests {
+		testExpectedObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestRestParametersAndSpread(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let f = function(first, ...rest) { len(rest) }; f(1, 2, 3)", 2},
+		{"let f = function(first, ...rest) { len(rest) }; f(1)", 0},
+		{"let f = function(...xs) { xs[1] }; f(4, 5, 6)", 5},
+		{"let f = function(x, y = 2, ...rest) { x + y + len(rest) }; f(1, 1, 1, 1)", 4},
+		{"let add = function(x, y) { x + y }; let args = [1, 2]; add(...args)", 3},
+		{"let add = function(x, y, z) { x + y + z }; add(1, ...[2, 3])", 6},
+		{"let f = function(...xs) { len(xs) }; f(...[1, 2], 3, ...[], ...[4])", 4},
+		{"len(...[[1, 2]])", 2},
+		{"let xs = [2, 3]; len([1, ...xs, 4])", 4},
+		{"let xs = [2, 3]; [1, ...xs, 4][2]", 3},
+		{"len([...[]])", 0},
+		{"let add = function(x, y) { x + y }; add(...[1])", "wrong number of arguments. Expects 2, got 1"},
+		{"let f = function(...xs) { xs }; f(...5)", "cannot spread INTEGER"},
+		{"...[1]", "spread is only allowed in call arguments and array literals"},
+		{"let sum = function(...xs) { let total = 0; for (x in xs) { total = total + x; } total }; sum(...range(5))", "cannot spread RANGE"},
+	}
+
+	for _, tt := range tests {
+		testExpectedObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestTypeAnnotations(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let f = function(x: int, y: int): int { x + y }; f(1, 2)", 3},
+		{"let f = function(x: int) { x }; f(\"a\")", "parameter x: expected int, got string"},
+		{"let f = function(x: int, y: string) { y }; f(1, 2)", "parameter y: expected string, got int"},
+		{"let f = function([a, b]: [int]) { a }; f([1, true])", "parameter [a, b], element 1: expected int, got bool"},
+		{"let f = function(x: [string]) { len(x) }; f([])", 0},
+		{"let f = function(x: bool = 1) { x }; f()", "parameter x: expected bool, got int"},
+		{"let f = function(...xs: [int]) { len(xs) }; f(1, 2)", 2},
+		{"let f = function(...xs: [int]) { len(xs) }; f(1, \"a\")", "parameter ...xs, element 1: expected int, got string"},
+		{"let f = function(g: function(int): int) { g(1) }; f(function(x) { x + 1 })", 2},
+		{"let f = function(g: function(int): int) { g(1) }; f(len)", "argument to `len` not supported, got INTEGER"},
+		{"let f = function(g: function(int): int) { g(1) }; f(1)", "parameter g: expected function(int): int, got int"},
+		{"let f = function(g: function(int): int) { g(1) }; f(function(x) { \"s\" })", "parameter g, return value: expected int, got string"},
+		{"let f = function(g: function(int): int) { g(\"a\") }; f(function(x) { 1 })", "parameter g, argument 1: expected int, got string"},
+		{"let f = function(g: function(int): int) { g }; f(function(x) { \"s\" })(1)", "parameter g, return value: expected int, got string"},
+		{"let f = function(g: function(int): int) { let h = g; h == g }; f(len)", true},
+		{"let f = function(g: function(function(int): int): int) { g(function(x) { x }) }; f(function(h) { h(true) })", "parameter g, argument 1, argument 1: expected int, got bool"},
+		{"let g: function(int): int = function(x) { [x] }; g(1)", "let g, return value: expected int, got [int]"},
+		{"let f = function(): function(int): int { function(x) { x } }; f()(\"a\")", "return value, argument 1: expected int, got string"},
+		{"let f = function(x: any) { x }; f([1, \"a\"])[1]", "a"},
+		{"let f = function(x): bool { x > 1 }; f(2)", true},
+		{"let f = function(x): bool { x }; f(2)", "return value: expected bool, got int"},
+		{"let f = function(x): string { if (x) { return 1; } \"a\" }; f(true)", "return value: expected string, got int"},
+		{"let f = function(): null { let x = 1; }; f()", nil},
+		{"let x: int = 1; x", 1},
+		{"let x: int = \"one\"; x", "let x: expected int, got string"},
+		{"let [a, b]: [string] = [\"a\", 1]; a", "let [a, b], element 1: expected string, got int"},
+		{"let x: [[int]] = [[1], [2, \"a\"]]; x", "let x, element 1, element 1: expected int, got string"},
+		{"let r: range = range(3); len(r)", 3},
+		{"let h: hash = [1]; h", "let h: expected hash, got [int]"},
+	}
+
+	for _, tt := range tests {
+		testExpectedObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestCheckedFunctionsAreNotWrappedTwice(t *testing.T) {
+	input := `
+let f = function(g: function(int): int, n) { if (n == 0) { g } else { f(g, n - 1) } };
+f(function(x) { x }, 3)`
+
+	result := testEval(input)
+	checked, ok := result.(*object.CheckedFunction)
+	if !ok {
+		t.Fatalf("expected a checked function, got %T (%+v)", result, result)
+	}
+	if _, ok := checked.Function.(*object.Function); !ok {
+		t.Errorf("expected one wrapper around the function, got one around %T", checked.Function)
+	}
+
+	// Under another annotation, the checks of both apply.
+	input = `
+let f = function(g: function(int): int) { g };
+let h = function(g: function(any): any) { g };
+h(f(function(x) { x }))("a")`
+	testExpectedObject(t, testEval(input), "parameter g, argument 1: expected int, got string")
+}
+
+func TestFunctionObjectInspect(t *testing.T) {
+	evaluated := testEval("function(x, [a, b], y = 1, ...rest) { x }")
+	expected := "function(x, [a, b], y = 1, ...rest) { x }"
+
+	if evaluated.Inspect() != expected {
+		t.Errorf("Inspect() wrong. expected=%q, got=%q", expected, evaluated.Inspect())
+	}
+}
+
+func TestFunctionObjectInspectParsesBack(t *testing.T) {
+	inputs := []string{
+		`function(x) { let y = "two"; if (x > 1) { return x; } else { y } }`,
+		`function({"name": name}, ...rest) { match (name) { "a" => 1, _ => { 2 } } }`,
+		`function() {}`,
+		`function(x: int, xs: [string] = [], ...f: [function(int): any]): bool { true }`,
+	}
+
+	for _, input := range inputs {
+		inspected := testEval(input).Inspect()
+
+		p := parser.New(lexer.New(inspected))
+		program := p.ParseProgram()
+		if len(p.Errors()) != 0 {
+			t.Errorf("could not parse %q: %v", inspected, p.Errors())
+			continue
+		}
+
+		evaluated := Eval(program, object.NewEnvironment())
+		if evaluated.Inspect() != inspected {
+			t.Errorf("expected %q to evaluate to itself, got %q", inspected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestResolvedLocals(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		// Closures keep reading and writing the frame they were created in.
+		{`
+		let counter = function() {
+			let count = 0;
+			function() { count = count + 1; count }
+		};
+		let c = counter(); c(); c(); c()`, 3},
+		{`
+		let make = function(x) { function(y) { function(z) { x + y + z } } };
+		make(1)(2)(3)`, 6},
+		// Local functions may call each other whatever their order.
+		{`
+		let f = function(n) {
+			let even = function(n) { if (n == 0) { true } else { odd(n - 1) } };
+			let odd = function(n) { if (n == 0) { false } else { even(n - 1) } };
+			even(n)
+		};
+		f(10)`, true},
+		// A local is unbound until its let runs.
+		{`let f = function() { let y = x; let x = 1; y }; f()`, "identifier not found: x"},
+		{`let f = function() { x = 1; let x = 2; x }; f()`, "identifier not found: x"},
+		// Before its let, a name still refers to the outer binding.
+		{`let x = 1; let f = function() { let x = x + 1; x }; f() + x`, 3},
+		// Match arms get their own frame, nested in the function's.
+		{`
+		let f = function(v) {
+			let base = 10;
+			match (v) { [a, b] => { let s = a + b; s + base }, _ => base }
+		};
+		f([1, 2]) + f(0)`, 23},
+		// Loops assign to the frame they run in.
+		{`let f = function() { let sum = 0; for (x in [1, 2, 3]) { sum = sum + x }; sum + x }; f()`, 9},
+		{`let g = 5; let f = function() { g = g + 1 }; f(); g`, 6},
+	}
+
+	for _, tt := range tests {
+		testExpectedObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestUnresolvedCodeSeesResolvedLocals(t *testing.T) {
+	env := object.NewEnvironment()
+	frame := object.NewFrame(env, []string{"a", "b"})
+	frame.SetSlot(0, &object.Integer{Value: 40})
+	frame.SetSlot(1, &object.Integer{Value: 2})
+
+	// Expressions evaluated outside the resolver, as a debugger would,
+	// find slot locals by name.
+	program := parse("a = a + b; a")
+	evaluated := New().evalProgram(program, frame)
+
+	testIntegerObject(t, evaluated, 42)
+}
+
+func TestClosuresCaptureBindings(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		// Closures of the same frame share what they capture.
+		{`
+		let make = function() {
+			let n = 0;
+			[function() { n = n + 1; n }, function() { n }]
+		};
+		let p = make(); p[0](); p[0](); p[1]()`, 2},
+		// Each call captures bindings of its own.
+		{`
+		let make = function() { let n = 0; function() { n = n + 1; n } };
+		let a = make(); let b = make(); a(); a(); b()`, 1},
+		// Assignments after the closure is made are seen on both sides.
+		{`let f = function() { let x = 1; let g = function() { x }; x = 5; g() }; f()`, 5},
+		{`let f = function() { let x = 1; let g = function() { x = 7 }; g(); x }; f()`, 7},
+		{`
+		let f = function() {
+			let x = 1;
+			let g = function() { let h = function() { x = x + 10 }; h(); x };
+			g() * 100 + x
+		};
+		f()`, 1111},
+		// A closure may capture a binding whose let has not run yet.
+		{`let f = function() { let g = function() { h() }; let h = function() { 3 }; g() }; f()`, 3},
+		{`
+		let f = function() {
+			let fact = function(n) { if (n < 2) { 1 } else { n * fact(n - 1) } };
+			fact(5)
+		};
+		f()`, 120},
+		// Bindings of match arms and defaults of parameters are captured too.
+		{`
+		let f = function(a, y) { match (a) { [x] => function() { function() { x + y } }, _ => 0 } };
+		f([2], 3)()()`, 5},
+		{`let f = function(x) { let g = function(y = x) { y }; g() }; f(4)`, 4},
+		// A loop rebinds its variable in the frame, which closures share.
+		{`
+		let f = function() {
+			let fs = [];
+			for (i in [1, 2, 3]) { fs = [...fs, function() { i }] }
+			fs[0]()
+		};
+		f()`, 3},
+	}
+
+	for _, tt := range tests {
+		testExpectedObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestClosureEnvironments(t *testing.T) {
+	input := `
+let g = 1;
+let f = function(a, b) {
+	let unused = [1, 2, 3];
+	[function() { a + g }, function() { g }]
+};
+f(10, 20)`
+	arr, ok := testEval(input).(*object.Array)
+	if !ok || len(arr.Elements) != 2 {
+		t.Fatalf("expected an array of two functions, got %s", arr.Inspect())
+	}
+
+	capturing := arr.Elements[0].(*object.Function)
+	bindings := capturing.Env.Bindings()
+	if len(bindings) != 1 || bindings[0].Name != "a" || bindings[0].Value.Inspect() != "10" {
+		t.Errorf("wrong bindings captured: %v", bindings)
+	}
+	if capturing.Env.Outer() == nil || capturing.Env.Outer().Outer() != nil {
+		t.Errorf("closure environment not enclosed in the global one")
+	}
+
+	global := arr.Elements[1].(*object.Function)
+	if global.Env.Outer() != nil {
+		t.Errorf("function without free variables kept a frame: %v", global.Env.Bindings())
+	}
+}
@@ -0,0 +1,77 @@
+package evaluator
+
+import (
+	"monkey/ast"
+	"monkey/object"
+)
+
+// Hook observes evaluation. An Interpreter calls its hooks, in the order they
+// were added, as it enters and leaves every node, as it calls functions and
+// builtins and returns from them, and when an error is created: that is,
+// when a node evaluates to an error that none of its children did.
+//
+// Call gets the environment of the call, which is nil for a builtin, and
+// the call expression, which is nil when the function is not called by the
+// program, as when a builtin calls it back. Embed NoHook to implement only
+// some of the methods.
+type Hook interface {
+	EnterNode(node ast.Node, env *object.Environment)
+	ExitNode(node ast.Node, env *object.Environment, result object.Object)
+	Call(fn object.Object, args []object.Object, call *ast.CallExpression, env *object.Environment)
+	Return(fn object.Object, call *ast.CallExpression, result object.Object)
+	Error(err *object.Error, node ast.Node, env *object.Environment)
+}
+
+// NoHook implements Hook with methods that do nothing.
+type NoHook struct{}
+
+func (NoHook) EnterNode(ast.Node, *object.Environment)                                       {}
+func (NoHook) ExitNode(ast.Node, *object.Environment, object.Object)                         {}
+func (NoHook) Call(object.Object, []object.Object, *ast.CallExpression, *object.Environment) {}
+func (NoHook) Return(object.Object, *ast.CallExpression, object.Object)                      {}
+func (NoHook) Error(*object.Error, ast.Node, *object.Environment)                            {}
+
+// AddHook makes the interpreter report its evaluation to h.
+func (in *Interpreter) AddHook(h Hook) {
+	in.hooks = append(in.hooks, h)
+}
+
+func (in *Interpreter) evalHooked(node ast.Node, env *object.Environment) object.Object {
+	for _, h := range in.hooks {
+		h.EnterNode(node, env)
+	}
+
+	result := in.eval(node, env)
+
+	if err, ok := result.(*object.Error); ok && err != in.lastError {
+		in.lastError = err
+		for _, h := range in.hooks {
+			h.Error(err, node, env)
+		}
+	}
+	for _, h := range in.hooks {
+		h.ExitNode(node, env, result)
+	}
+	return result
+}
+
+// CallName names the function a call calls after the expression it is
+// called through: an identifier, or a member of a module or hash.
+// Functions called in other ways, or not by a call expression at all, are
+// "<function>".
+func CallName(call *ast.CallExpression) string {
+	if call == nil {
+		return "<function>"
+	}
+	return calleeName(call.Function)
+}
+
+func calleeName(function ast.Expression) string {
+	switch function := function.(type) {
+	case *ast.Identifier:
+		return function.Value
+	case *ast.MemberExpression:
+		return calleeName(function.Object) + "." + function.Property.Value
+	}
+	return "<function>"
+}
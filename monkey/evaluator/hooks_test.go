@@ -0,0 +1,110 @@
+package evaluator
+
+import (
+	"fmt"
+	"monkey/ast"
+	"monkey/object"
+	"reflect"
+	"testing"
+)
+
+// recordingHook records what it hears as strings.
+type recordingHook struct {
+	events []string
+	depth  int
+}
+
+func (h *recordingHook) EnterNode(node ast.Node, env *object.Environment) {
+	h.depth++
+}
+
+func (h *recordingHook) ExitNode(node ast.Node, env *object.Environment, result object.Object) {
+	h.depth--
+	if _, ok := node.(*ast.Program); ok {
+		h.events = append(h.events, fmt.Sprintf("program = %s", result.Inspect()))
+	}
+}
+
+func (h *recordingHook) Call(fn object.Object, args []object.Object, call *ast.CallExpression, env *object.Environment) {
+	event := fmt.Sprintf("call %s/%d", CallName(call), len(args))
+	if env != nil {
+		if x, ok := env.Get("x"); ok {
+			event += " x=" + x.Inspect()
+		}
+	}
+	h.events = append(h.events, event)
+}
+
+func (h *recordingHook) Return(fn object.Object, call *ast.CallExpression, result object.Object) {
+	h.events = append(h.events, fmt.Sprintf("return %s = %s", CallName(call), result.Inspect()))
+}
+
+func (h *recordingHook) Error(err *object.Error, node ast.Node, env *object.Environment) {
+	h.events = append(h.events, fmt.Sprintf("error %s at %s", err.Message, node.String()))
+}
+
+func TestHooks(t *testing.T) {
+	tests := []struct {
+		input  string
+		events []string
+	}{
+		{
+			"let double = function(x) { x * 2 }; double(len([1, 2]))",
+			[]string{
+				"call len/1",
+				"return len = 2",
+				"call double/1 x=2",
+				"return double = 4",
+				"program = 4",
+			},
+		},
+		{
+			"let lib = {\"f\": function(x) { x + true }}; let g = function() { lib.f(1) }; g(); 1",
+			[]string{
+				"call g/0",
+				"call lib.f/1 x=1",
+				"error type mismatch: INTEGER + BOOLEAN at (x + true)",
+				"return lib.f = Uncaught syntax error!: type mismatch: INTEGER + BOOLEAN",
+				"return g = Uncaught syntax error!: type mismatch: INTEGER + BOOLEAN",
+				"program = Uncaught syntax error!: type mismatch: INTEGER + BOOLEAN",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		hook := &recordingHook{}
+		in := New()
+		in.AddHook(hook)
+		in.Eval(parse(tt.input), object.NewEnvironment())
+
+		if !reflect.DeepEqual(hook.events, tt.events) {
+			t.Errorf("wrong events for %q.\nwant=%q\ngot= %q", tt.input, tt.events, hook.events)
+		}
+		if hook.depth != 0 {
+			t.Errorf("entered and left nodes do not balance: %d", hook.depth)
+		}
+	}
+}
+
+func TestCallName(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"f()", "f"},
+		{"math.square(2)", "math.square"},
+		{"a.b.c()", "a.b.c"},
+		{"function() {}()", "<function>"},
+		{"f()()", "<function>"},
+	}
+
+	for _, tt := range tests {
+		stmt := parse(tt.input).Statements[0].(*ast.ExpressionStatement)
+		if name := CallName(stmt.Expression.(*ast.CallExpression)); name != tt.expected {
+			t.Errorf("wrong name for %s. want=%q, got=%q", tt.input, tt.expected, name)
+		}
+	}
+	if name := CallName(nil); name != "<function>" {
+		t.Errorf("wrong name without a call: %q", name)
+	}
+}
@@ -0,0 +1,112 @@
+package evaluator
+
+import (
+	"io"
+	"math/rand"
+	"monkey/ast"
+	"monkey/object"
+	"os"
+	"time"
+)
+
+// Interpreter holds the state shared by everything evaluated in one run:
+// the cache of loaded modules, the builtins, the capabilities granted to
+// them and the counter behind macro hygiene.
+type Interpreter struct {
+	// Dir is the directory relative imports resolve from when the code being
+	// evaluated does not come from a file, as in the REPL. Without the
+	// Filesystem capability it is also the only directory such code can
+	// import from, and if it is empty, such code cannot import at all.
+	Dir string
+
+	// Output is where puts writes, standard output unless set.
+	Output io.Writer
+
+	// Warnings is where the parser's warnings about the files evaluated
+	// are written, such as match arms that can never be reached. They are
+	// dropped if it is nil.
+	Warnings io.Writer
+
+	// MemoryLimit is how many bytes the values in use may take up during an
+	// evaluation before it fails with an out-of-memory error, or 0 for no
+	// limit. See MemoryStats for what counts.
+	MemoryLimit int64
+
+	// Args is what the argv builtin returns, and Exit what exit calls,
+	// os.Exit unless set.
+	Args []string
+	Exit func(code int)
+
+	evaluating             bool
+	allocated, inUse, peak int64
+	// unmeasured is what was allocated since inUse was last measured.
+	unmeasured int64
+	// scopes and held are the environments and values in use besides those
+	// reachable from them.
+	scopes []*object.Environment
+	held   []object.Object
+
+	capabilities Capability
+	now          func() time.Time
+	random       *rand.Rand
+
+	modules  map[string]*object.Module
+	loading  []*object.Module
+	builtins map[string]*object.Builtin
+	gensym   int
+	debugger *Debugger
+
+	hooks []Hook
+	// lastError is the error the hooks last heard of, so that they hear of
+	// each error once, where it is created, and not as it propagates.
+	lastError *object.Error
+}
+
+func New() *Interpreter {
+	in := &Interpreter{
+		Output:   os.Stdout,
+		Exit:     os.Exit,
+		now:      time.Now,
+		modules:  make(map[string]*object.Module),
+		builtins: make(map[string]*object.Builtin),
+	}
+	for name, builtin := range builtins {
+		in.builtins[name] = builtin
+	}
+	for name, bind := range boundBuiltins {
+		in.builtins[name] = &object.Builtin{Function: bind(in)}
+	}
+	for name, sandboxed := range sandboxedBuiltins {
+		in.builtins[name] = &object.Builtin{Function: in.guard(name, sandboxed.capability, sandboxed.bind(in))}
+	}
+	return in
+}
+
+func (in *Interpreter) builtinNames() []string {
+	names := make([]string, 0, len(in.builtins))
+	for name := range in.builtins {
+		names = append(names, name)
+	}
+	return names
+}
+
+// File returns the path of the file being evaluated, the innermost module
+// being loaded, or "" when the code does not come from a file.
+func (in *Interpreter) File() string {
+	if n := len(in.loading); n > 0 {
+		return in.loading[n-1].Path
+	}
+	return ""
+}
+
+// Call applies fn, a function or builtin, to args and returns the result.
+func (in *Interpreter) Call(fn object.Object, args ...object.Object) object.Object {
+	roots := append([]object.Object{fn}, args...)
+	return in.evaluation(nil, roots, func() object.Object { return in.applyFunction(fn, args) })
+}
+
+// Eval evaluates node with a fresh Interpreter. Use New to share modules
+// between evaluations.
+func Eval(node ast.Node, env *object.Environment) object.Object {
+	return New().Eval(node, env)
+}
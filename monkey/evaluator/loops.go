@@ -0,0 +1,127 @@
+package evaluator
+
+import (
+	"monkey/ast"
+	"monkey/object"
+)
+
+// loopSignal inspects the result of a loop body. It reports whether the loop
+// should stop and, if the result must propagate out of the loop (a return
+// value or an error), that result.
+func loopSignal(result object.Object) (bool, object.Object) {
+	if result == nil {
+		return false, nil
+	}
+
+	switch result.Type() {
+	case object.BREAK_OBJECT:
+		return true, nil
+	case object.RETURN_VALUE_OBJECT, object.ERROR_OBJECT:
+		return true, result
+	}
+
+	return false, nil
+}
+
+func (in *Interpreter) evalWhileStatement(ws *ast.WhileStatement, env *object.Environment) object.Object {
+	for {
+		condition := in.Eval(ws.Condition, env)
+		if isAbrupt(condition) {
+			return condition
+		}
+
+		if !isTruthy(condition) {
+			return NULL
+		}
+
+		if stop, result := loopSignal(in.Eval(ws.Body, env)); stop {
+			if result != nil {
+				return result
+			}
+			return NULL
+		}
+	}
+}
+
+func (in *Interpreter) evalForStatement(fs *ast.ForStatement, env *object.Environment) object.Object {
+	iterable := in.Eval(fs.Iterable, env)
+	if isAbrupt(iterable) {
+		return iterable
+	}
+	defer in.release(in.hold(iterable))
+
+	_, isHash := iterable.(*object.Hash)
+	_, isString := iterable.(*object.String)
+
+	var result object.Object
+	err := iterate(iterable, func(key, value object.Object) bool {
+		// Iterating over a string makes a string of each character.
+		if isString {
+			if err := in.allocateValue(value); err != nil {
+				result = err
+				return false
+			}
+		}
+		if fs.Key != nil {
+			bind(fs.Key, key, env)
+		} else if isHash {
+			value = key
+		}
+		bind(fs.Value, value, env)
+
+		var stop bool
+		stop, result = loopSignal(in.Eval(fs.Body, env))
+		return !stop
+	})
+	if err != nil {
+		return err
+	}
+
+	if result != nil {
+		return result
+	}
+	return NULL
+}
+
+// iterate calls yield with every key/value pair of an iterable object until
+// yield returns false. Arrays yield (index, element), strings yield
+// (index, rune), counting runes rather than bytes, hashes yield (key, value)
+// and ranges yield (index, integer). When a for loop names a single variable
+// it receives the key of a hash and the value of every other iterable.
+func iterate(iterable object.Object, yield func(key, value object.Object) bool) *object.Error {
+	switch iterable := iterable.(type) {
+	case *object.Array:
+		for i, el := range iterable.Elements {
+			if !yield(&object.Integer{Value: int64(i)}, el) {
+				return nil
+			}
+		}
+	case *object.String:
+		i := int64(0)
+		for _, r := range iterable.Value {
+			if !yield(&object.Integer{Value: i}, &object.String{Value: string(r)}) {
+				return nil
+			}
+			i++
+		}
+	case *object.Hash:
+		for _, key := range iterable.Keys {
+			pair := iterable.Pairs[key]
+			if !yield(pair.Key, pair.Value) {
+				return nil
+			}
+		}
+	case *object.Range:
+		n := iterable.Len()
+		for i := int64(0); i < n; i++ {
+			value := &object.Integer{Value: iterable.Start + i*iterable.Step}
+			if !yield(&object.Integer{Value: i}, value) {
+				return nil
+			}
+		}
+	default:
+		return newError("cannot iterate over %s", iterable.Type())
+	}
+
+	return nil
+}
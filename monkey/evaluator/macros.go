@@ -0,0 +1,329 @@
+package evaluator
+
+import (
+	"fmt"
+	"monkey/ast"
+	"monkey/object"
+	"monkey/token"
+	"strconv"
+)
+
+// Expand defines the macros of program in macroEnv and returns program with
+// every macro call expanded. It runs before evaluation.
+func (in *Interpreter) Expand(program *ast.Program, macroEnv *object.Environment) (*ast.Program, *object.Error) {
+	in.DefineMacros(program, macroEnv)
+	return in.ExpandMacros(program, macroEnv)
+}
+
+// DefineMacros binds every top-level `let name = macro(...) { ... }` of
+// program in env and removes those statements from the program.
+func (in *Interpreter) DefineMacros(program *ast.Program, env *object.Environment) {
+	statements := program.Statements[:0]
+
+	for _, stmt := range program.Statements {
+		name, literal, ok := macroDefinition(stmt)
+		if !ok {
+			statements = append(statements, stmt)
+			continue
+		}
+
+		env.Set(name.Value, &object.Macro{
+			Parameters: literal.Parameters,
+			Defaults:   literal.Defaults,
+			Rest:       literal.Rest,
+			Body:       literal.Body,
+			Locals:     literal.Locals,
+			Env:        env,
+		})
+	}
+
+	program.Statements = statements
+}
+
+func macroDefinition(stmt ast.Statement) (*ast.Identifier, *ast.MacroLiteral, bool) {
+	letStatement, ok := stmt.(*ast.LetStatement)
+	if !ok {
+		return nil, nil, false
+	}
+
+	name, ok := letStatement.Name.(*ast.Identifier)
+	if !ok {
+		return nil, nil, false
+	}
+
+	literal, ok := letStatement.Value.(*ast.MacroLiteral)
+	if !ok {
+		return nil, nil, false
+	}
+
+	return name, literal, true
+}
+
+// ExpandMacros returns a copy of program in which every call to a macro bound
+// in env has been replaced by the AST the macro returns.
+func (in *Interpreter) ExpandMacros(program *ast.Program, env *object.Environment) (*ast.Program, *object.Error) {
+	var err *object.Error
+
+	expanded := ast.Modify(program, func(node ast.Node) ast.Node {
+		if err != nil {
+			return node
+		}
+
+		call, ok := node.(*ast.CallExpression)
+		if !ok {
+			return node
+		}
+
+		ident, ok := call.Function.(*ast.Identifier)
+		if !ok {
+			return node
+		}
+
+		obj, ok := env.Get(ident.Value)
+		if !ok {
+			return node
+		}
+
+		macro, ok := obj.(*object.Macro)
+		if !ok {
+			return node
+		}
+
+		var result ast.Node
+		result, err = in.expandMacroCall(ident.Value, macro, call.Arguments)
+		if err != nil {
+			return node
+		}
+		return result
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return expanded.(*ast.Program), nil
+}
+
+func (in *Interpreter) expandMacroCall(name string, macro *object.Macro, arguments []ast.Expression) (ast.Node, *object.Error) {
+	args := make([]object.Object, len(arguments))
+	nodes := make([]ast.Node, len(arguments))
+	for i, arg := range arguments {
+		args[i] = &object.Quote{Node: arg}
+		nodes[i] = arg
+	}
+
+	fn := &object.Function{
+		Parameters: macro.Parameters,
+		Defaults:   macro.Defaults,
+		Rest:       macro.Rest,
+		Body:       macro.Body,
+		Locals:     macro.Locals,
+		Env:        macro.Env,
+	}
+	env, err := in.extendFunctionEnv(fn, args)
+	if err != nil {
+		return nil, newError("in macro %s: %s", name, err.Message)
+	}
+
+	evaluated := unwrapReturnValue(in.Eval(macro.Body, env))
+	if err, ok := evaluated.(*object.Error); ok {
+		return nil, newError("in macro %s: %s", name, err.Message)
+	}
+
+	quote, ok := evaluated.(*object.Quote)
+	if !ok {
+		if evaluated == nil {
+			evaluated = NULL
+		}
+		return nil, newError("macro %s must return a quote, got %s", name, evaluated.Type())
+	}
+
+	return copyIdentifiers(in.renameBindings(quote.Node, nodes)), nil
+}
+
+// copyIdentifiers gives every identifier in expanded a node of its own. An
+// argument unquoted twice, or a template expanded at several calls, would
+// otherwise put the same identifier in several scopes, and the resolver
+// annotates each use with where its binding is.
+func copyIdentifiers(expanded ast.Node) ast.Node {
+	return ast.Modify(expanded, func(node ast.Node) ast.Node {
+		ident, ok := node.(*ast.Identifier)
+		if !ok {
+			return node
+		}
+		copied := *ident
+		return &copied
+	})
+}
+
+// renameBindings gives every binding the macro itself introduced in expanded
+// a fresh name, so that it cannot capture variables of the code passed to the
+// macro in args. Identifiers that came from args keep their names.
+//
+// Generated names contain a `$`, which the lexer never produces, so they
+// cannot clash with anything written in source.
+func (in *Interpreter) renameBindings(expanded ast.Node, args []ast.Node) ast.Node {
+	fromArgs := map[*ast.Identifier]bool{}
+	for _, arg := range args {
+		ast.Inspect(arg, func(node ast.Node) bool {
+			if ident, ok := node.(*ast.Identifier); ok {
+				fromArgs[ident] = true
+			}
+			return true
+		})
+	}
+
+	renames := map[string]string{}
+	ast.Inspect(expanded, func(node ast.Node) bool {
+		for _, ident := range bindingIdentifiers(node) {
+			if fromArgs[ident] || ident.Value == "_" {
+				continue
+			}
+			if _, ok := renames[ident.Value]; !ok {
+				in.gensym++
+				renames[ident.Value] = fmt.Sprintf("%s$%d", ident.Value, in.gensym)
+			}
+		}
+		return true
+	})
+
+	if len(renames) == 0 {
+		return expanded
+	}
+
+	return ast.Modify(expanded, func(node ast.Node) ast.Node {
+		ident, ok := node.(*ast.Identifier)
+		if !ok || fromArgs[ident] {
+			return node
+		}
+
+		name, ok := renames[ident.Value]
+		if !ok {
+			return node
+		}
+
+		return &ast.Identifier{Token: token.Token{Type: token.IDENT, Value: name}, Value: name}
+	})
+}
+
+// bindingIdentifiers returns the identifiers node binds in a new scope.
+func bindingIdentifiers(node ast.Node) []*ast.Identifier {
+	switch node := node.(type) {
+	case *ast.LetStatement:
+		return ast.PatternIdentifiers(node.Name)
+	case *ast.FunctionLiteral:
+		return parameterIdentifiers(node.Parameters, node.Rest)
+	case *ast.MacroLiteral:
+		return parameterIdentifiers(node.Parameters, node.Rest)
+	case *ast.ForStatement:
+		if node.Key != nil {
+			return []*ast.Identifier{node.Key, node.Value}
+		}
+		return []*ast.Identifier{node.Value}
+	case *ast.MatchExpression:
+		idents := []*ast.Identifier{}
+		for _, arm := range node.Arms {
+			idents = append(idents, ast.PatternIdentifiers(arm.Pattern)...)
+		}
+		return idents
+	}
+
+	return nil
+}
+
+func parameterIdentifiers(parameters []ast.Pattern, rest *ast.Identifier) []*ast.Identifier {
+	idents := []*ast.Identifier{}
+	for _, param := range parameters {
+		idents = append(idents, ast.PatternIdentifiers(param)...)
+	}
+	if rest != nil {
+		idents = append(idents, rest)
+	}
+	return idents
+}
+
+func isCallTo(call *ast.CallExpression, name string) bool {
+	ident, ok := call.Function.(*ast.Identifier)
+	return ok && ident.Value == name
+}
+
+// quote returns node unevaluated, except for the `unquote(...)` calls in it,
+// which are evaluated in env and spliced back in as AST.
+func (in *Interpreter) quote(call *ast.CallExpression, env *object.Environment) object.Object {
+	if len(call.Arguments) != 1 {
+		return newError("wrong number of arguments to quote. Expects 1, got %d", len(call.Arguments))
+	}
+
+	var err *object.Error
+
+	node := ast.Modify(call.Arguments[0], func(node ast.Node) ast.Node {
+		if err != nil {
+			return node
+		}
+
+		call, ok := node.(*ast.CallExpression)
+		if !ok || !isCallTo(call, "unquote") {
+			return node
+		}
+
+		if len(call.Arguments) != 1 {
+			err = newError("wrong number of arguments to unquote. Expects 1, got %d", len(call.Arguments))
+			return node
+		}
+
+		unquoted := in.Eval(call.Arguments[0], env)
+		if unquotedErr, ok := unquoted.(*object.Error); ok {
+			err = unquotedErr
+			return node
+		}
+
+		var converted ast.Node
+		converted, err = objectToNode(unquoted)
+		if err != nil {
+			return node
+		}
+		return converted
+	})
+
+	if err != nil {
+		return err
+	}
+
+	return &object.Quote{Node: node}
+}
+
+// objectToNode turns an unquoted value back into AST.
+func objectToNode(obj object.Object) (ast.Node, *object.Error) {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		value := strconv.FormatInt(obj.Value, 10)
+		return &ast.IntegerLiteral{Token: token.Token{Type: token.INT, Value: value}, Value: obj.Value}, nil
+	case *object.Boolean:
+		if obj.Value {
+			return &ast.Boolean{Token: token.Token{Type: token.TRUE, Value: "true"}, Value: true}, nil
+		}
+		return &ast.Boolean{Token: token.Token{Type: token.FALSE, Value: "false"}, Value: false}, nil
+	case *object.String:
+		return &ast.StringLiteral{Token: token.Token{Type: token.STRING, Value: obj.Value}, Value: obj.Value}, nil
+	case *object.Array:
+		elements := make([]ast.Expression, len(obj.Elements))
+		for i, el := range obj.Elements {
+			node, err := objectToNode(el)
+			if err != nil {
+				return nil, err
+			}
+			expr, ok := node.(ast.Expression)
+			if !ok {
+				return nil, newError("cannot unquote %s into an array", node.String())
+			}
+			elements[i] = expr
+		}
+		return &ast.ArrayLiteral{Token: token.Token{Type: token.LBRACKET, Value: "["}, Elements: elements}, nil
+	case *object.Quote:
+		return obj.Node, nil
+	case nil:
+		return nil, newError("cannot unquote %s", object.NULL_OBJECT)
+	default:
+		return nil, newError("cannot unquote %s", obj.Type())
+	}
+}
@@ -0,0 +1,333 @@
+package evaluator
+
+import (
+	"monkey/object"
+	"testing"
+)
+
+func TestQuote(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`quote(5)`, `5`},
+		{`quote(5 + 8)`, `(5 + 8)`},
+		{`quote(foobar)`, `foobar`},
+		{`quote(foobar + barfoo)`, `(foobar + barfoo)`},
+	}
+
+	for _, tt := range tests {
+		testQuoteObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestQuoteUnquote(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`quote(unquote(4))`, `4`},
+		{`quote(unquote(4 + 4))`, `8`},
+		{`quote(8 + unquote(4 + 4))`, `(8 + 8)`},
+		{`quote(unquote(4 + 4) + 8)`, `(8 + 8)`},
+		{`let foobar = 8; quote(foobar)`, `foobar`},
+		{`let foobar = 8; quote(unquote(foobar))`, `8`},
+		{`quote(unquote(true))`, `true`},
+		{`quote(unquote(true == false))`, `false`},
+		{`quote(unquote("hi"))`, `"hi"`},
+		{`quote(unquote([1, 2]))`, `[1, 2]`},
+		{`quote(unquote(quote(4 + 4)))`, `(4 + 4)`},
+		{`let quoted = quote(4 + 4); quote(unquote(4 + 4) + unquote(quoted))`, `(8 + (4 + 4))`},
+	}
+
+	for _, tt := range tests {
+		testQuoteObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestQuoteErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`quote(1, 2)`, "wrong number of arguments to quote. Expects 1, got 2"},
+		{`quote(unquote(nope))`, "identifier not found: nope"},
+		{`quote(unquote(function(x) { x }))`, "cannot unquote FUNCTION"},
+		{`unquote(1)`, "unquote is only allowed inside quote"},
+	}
+
+	for _, tt := range tests {
+		testExpectedObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func testQuoteObject(t *testing.T, obj object.Object, expected string) {
+	t.Helper()
+
+	quote, ok := obj.(*object.Quote)
+	if !ok {
+		t.Fatalf("expected *object.Quote, got %T (%+v)", obj, obj)
+	}
+
+	if quote.Node == nil {
+		t.Fatalf("quote.Node is nil")
+	}
+
+	if quote.Node.String() != expected {
+		t.Errorf("expected %q, got %q", expected, quote.Node.String())
+	}
+}
+
+func TestDefineMacros(t *testing.T) {
+	input := `
+	let number = 1;
+	let fn = function(x, y) { x + y };
+	let mymacro = macro(x, y) { x + y; };
+	`
+
+	env := object.NewEnvironment()
+	program := parse(input)
+
+	New().DefineMacros(program, env)
+
+	if len(program.Statements) != 2 {
+		t.Fatalf("expected 2 statements, got %d", len(program.Statements))
+	}
+
+	if _, ok := env.Get("number"); ok {
+		t.Fatalf("number should not be defined")
+	}
+	if _, ok := env.Get("fn"); ok {
+		t.Fatalf("fn should not be defined")
+	}
+
+	obj, ok := env.Get("mymacro")
+	if !ok {
+		t.Fatalf("macro not in environment")
+	}
+
+	macro, ok := obj.(*object.Macro)
+	if !ok {
+		t.Fatalf("expected *object.Macro, got %T (%+v)", obj, obj)
+	}
+
+	if len(macro.Parameters) != 2 {
+		t.Fatalf("expected 2 macro parameters, got %d", len(macro.Parameters))
+	}
+
+	expectedBody := "{ (x + y) }"
+	if macro.Body.String() != expectedBody {
+		t.Fatalf("expected body %q, got %q", expectedBody, macro.Body.String())
+	}
+}
+
+func TestExpandMacros(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			`
+			let infixExpression = macro() { quote(1 + 2); };
+			infixExpression();
+			`,
+			`(1 + 2)`,
+		},
+		{
+			`
+			let reverse = macro(a, b) { quote(unquote(b) - unquote(a)); };
+			reverse(2 + 2, 10 - 5);
+			`,
+			`(10 - 5) - (2 + 2)`,
+		},
+		{
+			`
+			let unless = macro(condition, consequence, alternative) {
+				quote(if (!(unquote(condition))) {
+					unquote(consequence);
+				} else {
+					unquote(alternative);
+				});
+			};
+			unless(10 > 5, puts("not greater"), puts("greater"));
+			`,
+			`if (!(10 > 5)) { puts("not greater") } else { puts("greater") }`,
+		},
+		{
+			`
+			let twice = macro(expr) { quote([unquote(expr), unquote(expr)]) };
+			twice(1); twice(2);
+			`,
+			`[1, 1]; [2, 2]`,
+		},
+	}
+
+	for _, tt := range tests {
+		expected := parse(tt.expected)
+
+		expanded, err := New().Expand(parse(tt.input), object.NewEnvironment())
+		if err != nil {
+			t.Fatalf("unexpected expansion error: %s", err.Message)
+		}
+
+		if expanded.String() != expected.String() {
+			t.Errorf("expected %q, got %q", expected.String(), expanded.String())
+		}
+	}
+}
+
+func TestExpandMacrosLeavesDefinitionIntact(t *testing.T) {
+	input := `
+	let add = macro(a) { quote(unquote(a) + 1) };
+	add(1) + add(2);
+	`
+
+	expanded, err := New().Expand(parse(input), object.NewEnvironment())
+	if err != nil {
+		t.Fatalf("unexpected expansion error: %s", err.Message)
+	}
+
+	expected := "((1 + 1) + (2 + 1))"
+	if expanded.String() != expected {
+		t.Errorf("expected %q, got %q", expected, expanded.String())
+	}
+}
+
+func TestMacroErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let m = macro() { 1 }; m();`, "macro m must return a quote, got INTEGER"},
+		{`let m = macro() { }; m();`, "macro m must return a quote, got NULL"},
+		{`let m = macro(a) { quote(unquote(a)) }; m();`, "in macro m: wrong number of arguments. Expects 1, got 0"},
+		{`let m = macro() { quote(unquote(nope)) }; m();`, "in macro m: identifier not found: nope"},
+	}
+
+	for _, tt := range tests {
+		_, err := New().Expand(parse(tt.input), object.NewEnvironment())
+		if err == nil {
+			t.Errorf("expected error %q for %q, got none", tt.expected, tt.input)
+			continue
+		}
+
+		if err.Message != tt.expected {
+			t.Errorf("expected error %q, got %q", tt.expected, err.Message)
+		}
+	}
+}
+
+func TestMacroHygiene(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		// The macro's tmp must not capture the caller's tmp.
+		{
+			`
+			let swapSum = macro(a, b) {
+				quote(function() { let tmp = unquote(a); tmp * 10 + unquote(b) }());
+			};
+			let tmp = 1;
+			swapSum(2, tmp);
+			`,
+			21,
+		},
+		// Parameters and rest parameters are renamed too.
+		{
+			`
+			let apply = macro(f, x) {
+				quote(function(x, ...rest) { unquote(f)(x) }(unquote(x) + 1));
+			};
+			let x = 100;
+			apply(function(y) { y + x }, 1);
+			`,
+			102,
+		},
+		// Free identifiers in the template still refer to the caller's scope.
+		{
+			`
+			let incr = macro() { quote(counter + 1) };
+			let counter = 41;
+			incr();
+			`,
+			42,
+		},
+		// Member property names are not renamed.
+		{
+			`
+			let get = macro(h) { quote(function() { let value = unquote(h); value.value }()) };
+			let value = {"value": 7};
+			get(value);
+			`,
+			7,
+		},
+	}
+
+	for _, tt := range tests {
+		testExpectedObject(t, testEvalExpanded(t, tt.input), tt.expected)
+	}
+}
+
+func TestMacroHygieneRenamesBindings(t *testing.T) {
+	input := `
+	let adder = macro(value) { quote(function(tmp) { tmp + unquote(value) }) };
+	adder(tmp);
+	adder(tmp);
+	`
+
+	expanded, err := New().Expand(parse(input), object.NewEnvironment())
+	if err != nil {
+		t.Fatalf("unexpected expansion error: %s", err.Message)
+	}
+
+	expected := "function(tmp$1) { (tmp$1 + tmp) }; function(tmp$2) { (tmp$2 + tmp) }"
+	if expanded.String() != expected {
+		t.Errorf("expected %q, got %q", expected, expanded.String())
+	}
+}
+
+func testEvalExpanded(t *testing.T, input string) object.Object {
+	t.Helper()
+
+	in := New()
+	program, err := in.Expand(parse(input), object.NewEnvironment())
+	if err != nil {
+		t.Fatalf("unexpected expansion error: %s", err.Message)
+	}
+
+	return in.Eval(program, object.NewEnvironment())
+}
+
+func TestMacroExpansionsResolvePerUse(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		// An argument unquoted twice is used from two scopes.
+		{
+			`
+			let twice = macro(e) { quote([function() { unquote(e) }(), unquote(e)]) };
+			let g = function(a, b) { twice(b) };
+			g(1, 2);
+			`,
+			"[2, 2]",
+		},
+		// Every expansion of a template is used from the scope it lands in.
+		{
+			`
+			let incr = macro() { quote(counter + 1) };
+			let f = function(counter) { incr() };
+			let g = function(a, counter) { incr() };
+			[f(1), g(0, 10)];
+			`,
+			"[2, 11]",
+		},
+	}
+
+	for _, tt := range tests {
+		if result := testEvalExpanded(t, tt.input); result.Inspect() != tt.expected {
+			t.Errorf("expected %s, got %s", tt.expected, result.Inspect())
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package evaluator
+
+import "monkey/object"
+
+// MemoryStats reports how much memory the values of evaluations took up: the
+// strings, arrays, hashes, closures and environments they created, in the
+// approximate sizes object.Size and Environment.Size give them.
+//
+// Allocated is what the current evaluation, or the last one, created, in use
+// or not. Peak is the most that the values in use took up at once, over all
+// the evaluations of the interpreter. Values are in use while they can be
+// reached from the environment being evaluated in, the frames of the calls
+// under way and the values the interpreter holds on to while it evaluates an
+// expression, such as the left operand of an operator while it evaluates the
+// right one.
+//
+// Finding what is in use takes a walk over it, so the interpreter only walks
+// when what it created since the last walk could take the values in use an
+// eighth and 64 kilobytes past the peak, or past MemoryLimit, and at the end
+// of an evaluation. Values that come and go between walks can make the true
+// peak up to that much higher than Peak.
+//
+// A value is checked against MemoryLimit before it is made, so what is in
+// use never goes past it. Near the limit the interpreter only walks again
+// once a sixty-fourth of the limit was created since the last walk; until
+// then it counts what it created as in use, so an evaluation whose values
+// come within that of the limit can fail though some of them were dropped.
+type MemoryStats struct {
+	Allocated int64
+	Peak      int64
+}
+
+// measureSlack is how far, in bytes, what is in use may grow past the peak
+// before the interpreter measures it, so that a program that uses little
+// memory is measured rarely.
+const measureSlack = 64 << 10
+
+// Memory returns how much memory the interpreter's evaluations took up.
+func (in *Interpreter) Memory() MemoryStats {
+	return MemoryStats{Allocated: in.allocated, Peak: in.peak}
+}
+
+// evaluation runs eval, evaluating in env or, if env is nil, on roots, as an
+// evaluation of its own whose values count against MemoryLimit, unless one
+// is already under way. Eval, EvalFile and Call start evaluations; what they
+// evaluate in turn belongs to them.
+func (in *Interpreter) evaluation(env *object.Environment, roots []object.Object, eval func() object.Object) object.Object {
+	if in.evaluating {
+		return eval()
+	}
+
+	in.evaluating = true
+	in.allocated = 0
+	in.scopes, in.held = nil, nil
+	defer func() {
+		in.evaluating = false
+		in.scopes, in.held = nil, nil
+	}()
+
+	if env != nil {
+		in.scopes = append(in.scopes, env)
+	}
+	in.held = append(in.held, roots...)
+	result := eval()
+
+	if in.inUse > in.peak {
+		in.hold(result)
+		in.measure()
+	}
+	return result
+}
+
+// allocate charges size bytes of new values to the current evaluation,
+// failing instead if reserve does.
+func (in *Interpreter) allocate(size int64) *object.Error {
+	if err := in.reserve(size); err != nil {
+		return err
+	}
+	in.allocated += size
+	in.inUse += size
+	in.unmeasured += size
+
+	if in.inUse > in.peak+in.peak/8+measureSlack {
+		in.measure()
+	}
+	return nil
+}
+
+// reserve fails if making size bytes of new values would take what is in
+// use past MemoryLimit. It is called before making a value whose size is
+// known, so that the value is never made, and by allocate for the others.
+func (in *Interpreter) reserve(size int64) *object.Error {
+	if in.MemoryLimit <= 0 || in.inUse+size <= in.MemoryLimit {
+		return nil
+	}
+	// Walking again so soon after the last walk could only find a little
+	// dropped, and walking on every allocation near the limit would take
+	// time quadratic in what is in use.
+	if in.unmeasured > in.MemoryLimit/64 {
+		in.measure()
+	}
+	if in.inUse+size > in.MemoryLimit {
+		return newError("out of memory: the evaluation's values would take up more than its limit of %d bytes", in.MemoryLimit)
+	}
+	return nil
+}
+
+// reserveConcatenation reserves the string that left operator right would
+// make, if it makes one.
+func (in *Interpreter) reserveConcatenation(operator string, left, right object.Object) *object.Error {
+	l, ok := left.(*object.String)
+	if !ok || operator != "+" {
+		return nil
+	}
+	r, ok := right.(*object.String)
+	if !ok {
+		return nil
+	}
+	return in.reserve(object.StringSize(len(l.Value) + len(r.Value)))
+}
+
+// charge allocates the size of obj, a value just created, and returns it,
+// or the out-of-memory error.
+func (in *Interpreter) charge(obj object.Object) object.Object {
+	if err := in.allocateValue(obj); err != nil {
+		return err
+	}
+	return obj
+}
+
+// allocateValue allocates the size of obj, a value just created.
+func (in *Interpreter) allocateValue(obj object.Object) *object.Error {
+	defer in.release(in.hold(obj))
+	return in.allocate(object.Size(obj))
+}
+
+// allocateEnv allocates the size of env, an environment just created.
+func (in *Interpreter) allocateEnv(env *object.Environment) *object.Error {
+	defer in.leave(in.enter(env))
+	return in.allocate(env.Size())
+}
+
+// measure finds how much the values in use take up.
+func (in *Interpreter) measure() {
+	envs := in.scopes
+	for _, module := range in.loading {
+		envs = append(envs[:len(envs):len(envs)], module.Env)
+	}
+	in.inUse = object.Footprint(envs, in.held)
+	in.unmeasured = 0
+	if in.inUse > in.peak {
+		in.peak = in.inUse
+	}
+}
+
+// hold keeps obj in use until release is called with the mark it returns.
+func (in *Interpreter) hold(obj object.Object) int {
+	mark := len(in.held)
+	in.held = append(in.held, obj)
+	return mark
+}
+
+func (in *Interpreter) release(mark int) {
+	for i := mark; i < len(in.held); i++ {
+		in.held[i] = nil
+	}
+	in.held = in.held[:mark]
+}
+
+// enter keeps what env binds in use until leave is called with the mark it
+// returns.
+func (in *Interpreter) enter(env *object.Environment) int {
+	mark := len(in.scopes)
+	in.scopes = append(in.scopes, env)
+	return mark
+}
+
+func (in *Interpreter) leave(mark int) {
+	for i := mark; i < len(in.scopes); i++ {
+		in.scopes[i] = nil
+	}
+	in.scopes = in.scopes[:mark]
+}
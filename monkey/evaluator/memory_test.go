@@ -0,0 +1,205 @@
+package evaluator
+
+import (
+	"monkey/object"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestMemoryAccounting(t *testing.T) {
+	tests := []struct {
+		input     string
+		allocated int64
+	}{
+		{`1 + 2`, 0},
+		{`"abc"`, 19},
+		{`"ab" + "c"`, 18 + 17 + 19},
+		{`[1, 2, 3]`, 24 + 3*16},
+		{`{"a": 1}`, 17 + 80 + 88},
+		{`function(x) { x }`, 160},
+		{`let f = function(x) { let y = x; y }; f(1)`, 160 + 80 + 2*16},
+		{`let f = function(...xs) { xs }; f(1, 2)`, 160 + 80 + 16 + 24 + 2*16},
+		{`let [a, ...b] = [1, 2, 3]`, 24 + 3*16 + 24 + 2*16},
+		{`for (c in "ab") { c }`, 18 + 2*17},
+		{`len("abc")`, 19},
+	}
+
+	for _, tt := range tests {
+		in := New()
+		result := in.Eval(parse(tt.input), object.NewEnvironment())
+		if isError(result) {
+			t.Errorf("%s: unexpected error %s", tt.input, result.Inspect())
+			continue
+		}
+		if got := in.Memory().Allocated; got != tt.allocated {
+			t.Errorf("%s: wrong allocation. expected %d, got %d", tt.input, tt.allocated, got)
+		}
+	}
+}
+
+func TestMemoryLimit(t *testing.T) {
+	input := `
+let a = [1];
+while (true) { a = [...a, ...a]; }
+`
+	in := New()
+	in.MemoryLimit = 1 << 20
+	result := in.Eval(parse(input), object.NewEnvironment())
+
+	err, ok := result.(*object.Error)
+	if !ok {
+		t.Fatalf("expected an out-of-memory error, got %s", result.Inspect())
+	}
+	expected := "out of memory: the evaluation's values would take up more than its limit of 1048576 bytes"
+	if err.Message != expected {
+		t.Errorf("wrong error. expected %q, got %q", expected, err.Message)
+	}
+
+	// The array that failed is never made: the peak is the last one that
+	// fit, with what was in use besides it.
+	if peak := in.Memory().Peak; peak > in.MemoryLimit || peak <= in.MemoryLimit/2 {
+		t.Errorf("wrong peak %d for a limit of %d", peak, in.MemoryLimit)
+	}
+}
+
+func TestMemoryInUse(t *testing.T) {
+	// Each array is dropped by the next iteration, so however many the loop
+	// makes, only one is in use at a time.
+	input := `
+let i = 0;
+while (i < 1000) { let a = [1, 2, 3, 4, 5, 6, 7, 8, 9, 10]; i = i + 1; }
+`
+	array := int64(24 + 10*16)
+
+	in := New()
+	in.MemoryLimit = 10 * array
+	if result := in.Eval(parse(input), object.NewEnvironment()); isError(result) {
+		t.Fatalf("dropped values counted against the limit: %s", result.Inspect())
+	}
+	stats := in.Memory()
+	if stats.Allocated != 1000*array {
+		t.Errorf("expected every array to be allocated, got %d", stats.Allocated)
+	}
+	if stats.Peak > 10*array {
+		t.Errorf("expected dropped values not to count, got a peak of %d", stats.Peak)
+	}
+
+	// Kept, they do.
+	kept := `
+let kept = [];
+let i = 0;
+while (i < 1000) { kept = [...kept, [1, 2, 3, 4, 5, 6, 7, 8, 9, 10]]; i = i + 1; }
+`
+	if result := in.Eval(parse(kept), object.NewEnvironment()); !isError(result) {
+		t.Errorf("expected an out-of-memory error, got %s", result.Inspect())
+	}
+}
+
+func TestMemoryHeldByTheEvaluation(t *testing.T) {
+	in := New()
+	in.MemoryLimit = 1500
+	long := `"` + strings.Repeat("x", 400) + `"`
+
+	// What frames and pending operands hold is in use until they are done
+	// with it, though nothing binds it.
+	tests := []string{
+		`let f = function(s) { s + s + s }; f(` + long + `)`,
+		`len(` + long + ` + (` + long + ` + ` + long + `))`,
+		`[` + long + `, ` + long + `, ` + long + `, ` + long + `]`,
+		`match (` + long + `) { s => { s + s + s } }`,
+	}
+	for _, input := range tests {
+		if result := in.Eval(parse(input), object.NewEnvironment()); !isError(result) {
+			t.Errorf("%s: expected an out-of-memory error, got %s", input, result.Inspect())
+		}
+	}
+}
+
+func TestMemoryCheckedBeforeMaking(t *testing.T) {
+	long := strings.Repeat("x", 400)
+	tests := []string{
+		`let s = "` + long + `"; s + s`,
+		`let a = [` + strings.Repeat("1, ", 30) + `1]; [...a, ...a]`,
+		`let f = function(...xs) { xs }; let a = [` + strings.Repeat("1, ", 30) + `1]; f(...a, ...a)`,
+	}
+
+	for _, input := range tests {
+		in := New()
+		in.MemoryLimit = 1000
+		result := in.Eval(parse(input), object.NewEnvironment())
+		if !isError(result) {
+			t.Errorf("%s: expected an out-of-memory error, got %s", input, result.Inspect())
+		}
+		// What would not fit is not made, so nothing over the limit is in
+		// use, nor allocated.
+		if stats := in.Memory(); stats.Peak > in.MemoryLimit || stats.Allocated > in.MemoryLimit {
+			t.Errorf("%s: memory over the limit was used: %+v", input, stats)
+		}
+	}
+}
+
+func TestMemoryPerEvaluation(t *testing.T) {
+	in := New()
+	in.MemoryLimit = 1000
+	env := object.NewEnvironment()
+
+	// What earlier evaluations left in env is still in use; what they
+	// dropped is not.
+	for i := 0; i < 5; i++ {
+		result := in.Eval(parse(`let s = "`+strings.Repeat("x", 400)+`"; 1`), env)
+		if isError(result) {
+			t.Fatalf("evaluation %d failed: %s", i, result.Inspect())
+		}
+	}
+	if stats := in.Memory(); stats.Allocated != 416 || stats.Peak != 80+48+416 {
+		t.Errorf("wrong stats after small evaluations: %+v", stats)
+	}
+
+	if result := in.Eval(parse(`let t = s + s + s`), env); !isError(result) {
+		t.Errorf("expected an out-of-memory error, got %s", result.Inspect())
+	}
+	if result := in.Eval(parse(`"small"`), env); isError(result) {
+		t.Errorf("values of the failed evaluation are still counted: %s", result.Inspect())
+	}
+	if stats := in.Memory(); stats.Allocated != 21 || stats.Peak != 80+48+416+21 {
+		t.Errorf("wrong stats: %+v", stats)
+	}
+
+	// Calls from outside are evaluations too.
+	fn, _ := env.Get("s")
+	if result := in.Call(in.builtins["len"], fn); isError(result) || in.Memory().Allocated != 0 {
+		t.Errorf("wrong call: %s, allocated %d", result.Inspect(), in.Memory().Allocated)
+	}
+}
+
+func TestClosuresReleaseUncapturedBindings(t *testing.T) {
+	// Each closure outlives a frame holding an array of 65536 elements, a
+	// megabyte, that it does not refer to.
+	input := `
+let make = function(n) {
+	let big = [n];
+	let i = 0;
+	while (i < 16) { big = [...big, ...big]; i = i + 1; }
+	function() { n }
+};
+let keep = [];
+let k = 0;
+while (k < 20) { keep = [...keep, make(k)]; k = k + 1; }
+keep[7]()`
+
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+
+	env := object.NewEnvironment()
+	testIntegerObject(t, New().Eval(parse(input), env), 7)
+
+	runtime.GC()
+	runtime.ReadMemStats(&after)
+	runtime.KeepAlive(env)
+
+	if grown := int64(after.HeapAlloc) - int64(before.HeapAlloc); grown > 4<<20 {
+		t.Errorf("closures kept %d bytes alive, expected the arrays to be released", grown)
+	}
+}
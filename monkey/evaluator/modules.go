@@ -0,0 +1,176 @@
+package evaluator
+
+import (
+	"monkey/ast"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const ModuleExtension = ".monkey"
+
+// EvalFile evaluates the program in the file at path in env. Imports in the
+// file resolve relative to its directory.
+func (in *Interpreter) EvalFile(path string, env *object.Environment) object.Object {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return newError("could not resolve %s: %s", path, err)
+	}
+
+	module := &object.Module{Name: moduleName(abs), Path: abs, Env: env}
+	return in.evaluation(env, nil, func() object.Object { return in.evalModule(module) })
+}
+
+func (in *Interpreter) evalImportStatement(is *ast.ImportStatement, env *object.Environment) object.Object {
+	module, err := in.importModule(is.Path)
+	if err != nil {
+		return err
+	}
+
+	bind(is.Name, module, env)
+	return nil
+}
+
+// importModule resolves path against the importing module and returns the
+// loaded module, evaluating it on first import only.
+func (in *Interpreter) importModule(path string) (*object.Module, *object.Error) {
+	if filepath.Ext(path) == "" {
+		path += ModuleExtension
+	}
+
+	abs, err := filepath.Abs(in.resolve(path))
+	if err != nil {
+		return nil, newError("could not resolve %s: %s", path, err)
+	}
+	if !in.Granted(Filesystem) && (filepath.Ext(abs) != ModuleExtension || !in.confined(abs)) {
+		return nil, newError("importing %s needs the %s capability, which was not granted", path, Filesystem)
+	}
+
+	if module, ok := in.modules[abs]; ok {
+		return module, nil
+	}
+
+	for i, loading := range in.loading {
+		if loading.Path == abs {
+			cycle := []string{}
+			for _, m := range in.loading[i:] {
+				cycle = append(cycle, m.Path)
+			}
+			cycle = append(cycle, abs)
+			return nil, newError("import cycle: %s", strings.Join(cycle, " -> "))
+		}
+	}
+
+	module := &object.Module{Name: moduleName(abs), Path: abs, Env: object.NewEnvironment()}
+	if result := in.evalModule(module); isError(result) {
+		return nil, result.(*object.Error)
+	}
+
+	in.modules[abs] = module
+	return module, nil
+}
+
+// confined reports whether the file at path, which is absolute, is in the
+// directory imports are confined to without the Filesystem capability: that
+// of the file the evaluation started from, or else Dir. Without either there
+// is no such directory, rather than the working directory of the process.
+// A link in the directory that leads out of it does not count.
+func (in *Interpreter) confined(path string) bool {
+	root := in.Dir
+	if len(in.loading) > 0 {
+		root = filepath.Dir(in.loading[0].Path)
+	}
+	if root == "" {
+		return false
+	}
+	root, err := filepath.Abs(root)
+	if err != nil || !within(root, path) {
+		return false
+	}
+
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		// There is nothing to read, which importing reports.
+		return true
+	}
+	if resolvedRoot, err := filepath.EvalSymlinks(root); err == nil {
+		root = resolvedRoot
+	}
+	return within(root, resolved)
+}
+
+func within(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+func (in *Interpreter) evalModule(module *object.Module) object.Object {
+	source, err := os.ReadFile(module.Path)
+	if err != nil {
+		return newError("could not read module %s: %s", module.Path, err)
+	}
+
+	p := parser.New(lexer.New(string(source)))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return newError("could not parse %s:\n\t%s", module.Path, strings.Join(p.Errors(), "\n\t"))
+	}
+	if in.Warnings != nil {
+		p.WriteWarnings(in.Warnings, module.Path)
+	}
+
+	in.loading = append(in.loading, module)
+	defer func() { in.loading = in.loading[:len(in.loading)-1] }()
+
+	// Macros are local to the file that defines them.
+	program, expandErr := in.Expand(program, object.NewEnvironment())
+	if expandErr != nil {
+		return expandErr
+	}
+
+	if d := in.debugger; d != nil {
+		d.addSource(module.Path, program)
+		// The main file is the bottom frame; imports get frames of their own.
+		if len(d.frames) > 0 {
+			d.enter("<module "+module.Name+">", nil)
+			defer d.leave()
+		}
+	}
+
+	return in.Eval(program, module.Env)
+}
+
+func (in *Interpreter) evalExportStatement(es *ast.ExportStatement, env *object.Environment) object.Object {
+	if result := in.Eval(es.Statement, env); isError(result) {
+		return result
+	}
+
+	if n := len(in.loading); n > 0 {
+		module := in.loading[n-1]
+		module.Exports = append(module.Exports, ast.PatternNames(es.Statement.Name)...)
+	}
+
+	return nil
+}
+
+func evalMemberExpression(container object.Object, property string) object.Object {
+	switch obj := container.(type) {
+	case *object.Module:
+		member, ok := obj.Member(property)
+		if !ok {
+			return newError("module %s does not export %s", obj.Name, property)
+		}
+		return member
+	case *object.Hash:
+		return evalHashIndexExpression(obj, &object.String{Value: property})
+	default:
+		return newError("cannot access member %s of %s", property, container.Type())
+	}
+}
+
+func moduleName(path string) string {
+	return strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+}
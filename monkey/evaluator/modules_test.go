@@ -0,0 +1,148 @@
+package evaluator
+
+import (
+	"monkey/object"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeModules(t *testing.T, files map[string]string) string {
+	dir := t.TempDir()
+	for name, source := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(source), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestImportExport(t *testing.T) {
+	dir := writeModules(t, map[string]string{
+		"main.monkey": `
+import "lib/math";
+import "lib/strings" as str;
+math.square(math.two) + str.size("abc")`,
+		"lib/math.monkey": `
+let helper = function(x) { x * x };
+export let square = function(x) { helper(x) };
+export let [two, three] = [2, 3];`,
+		"lib/strings.monkey": `
+import "math";
+export let size = function(s) { len(s) + math.three - 3 };`,
+	})
+
+	evaluated := New().EvalFile(filepath.Join(dir, "main.monkey"), object.NewEnvironment())
+	testIntegerObject(t, evaluated, 7)
+}
+
+func TestModulesAreEvaluatedOnce(t *testing.T) {
+	dir := writeModules(t, map[string]string{
+		"main.monkey": `
+import "a";
+import "b";
+a.counter.value == b.counter.value`,
+		"a.monkey":       `import "counter"; export let counter = counter;`,
+		"b.monkey":       `import "counter"; export let counter = counter;`,
+		"counter.monkey": `export let value = {"n": 1};`,
+	})
+
+	in := New()
+	evaluated := in.EvalFile(filepath.Join(dir, "main.monkey"), object.NewEnvironment())
+	testBooleanObject(t, evaluated, true)
+
+	if len(in.modules) != 3 {
+		t.Errorf("expected 3 cached modules, got %d", len(in.modules))
+	}
+}
+
+func TestModuleWarnings(t *testing.T) {
+	dir := writeModules(t, map[string]string{
+		"main.monkey": "import \"lib\";\nmatch (lib.x) { _ => 1, 2 => 2 }",
+		"lib.monkey":  "export let x = match (1) { 1 => 1, 1 => 2, _ => 3 };",
+	})
+
+	var warnings strings.Builder
+	in := New()
+	in.Warnings = &warnings
+	testIntegerObject(t, in.EvalFile(filepath.Join(dir, "main.monkey"), object.NewEnvironment()), 1)
+
+	expected := filepath.Join(dir, "main.monkey") + ":2:25: warning: unreachable match arm: 2\n" +
+		filepath.Join(dir, "lib.monkey") + ":1:36: warning: unreachable match arm: 1\n"
+	if warnings.String() != expected {
+		t.Errorf("wrong warnings.\nexpected %q\n     got %q", expected, warnings.String())
+	}
+}
+
+func TestImportErrors(t *testing.T) {
+	dir := writeModules(t, map[string]string{
+		"private.monkey": `
+import "lib";
+lib.hidden`,
+		"lib.monkey":     `let hidden = 1; export let shown = 2;`,
+		"missing.monkey": `import "nope"; 1`,
+		"cycle.monkey":   `import "other"; 1`,
+		"other.monkey":   `import "cycle"; 1`,
+		"broken.monkey":  `import "syntax"; 1`,
+		"syntax.monkey":  `let = 1;`,
+		"failing.monkey": `import "throws"; 1`,
+		"throws.monkey":  `1 + true;`,
+		"member.monkey":  `let x = 5; x.y`,
+	})
+
+	tests := []struct {
+		file     string
+		expected string
+	}{
+		{"private.monkey", "module lib does not export hidden"},
+		{"missing.monkey", "could not read module " + filepath.Join(dir, "nope.monkey")},
+		{"cycle.monkey", "import cycle: " + filepath.Join(dir, "cycle.monkey") + " -> " +
+			filepath.Join(dir, "other.monkey") + " -> " + filepath.Join(dir, "cycle.monkey")},
+		{"broken.monkey", "could not parse " + filepath.Join(dir, "syntax.monkey")},
+		{"failing.monkey", "type mismatch: INTEGER + BOOLEAN"},
+		{"member.monkey", "cannot access member y of INTEGER"},
+	}
+
+	for _, tt := range tests {
+		evaluated := New().EvalFile(filepath.Join(dir, tt.file), object.NewEnvironment())
+		err, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("%s: expected an error, got %T (%+v)", tt.file, evaluated, evaluated)
+			continue
+		}
+		if !strings.HasPrefix(err.Message, tt.expected) {
+			t.Errorf("%s: expected error starting with %q, got %q", tt.file, tt.expected, err.Message)
+		}
+	}
+}
+
+func TestImportFromInterpreterDir(t *testing.T) {
+	dir := writeModules(t, map[string]string{
+		"util.monkey": `export let answer = 42;`,
+	})
+
+	in := New()
+	in.Dir = dir
+	evaluated := in.Eval(parse(`import "util"; util.answer`), object.NewEnvironment())
+	testIntegerObject(t, evaluated, 42)
+}
+
+func TestHashMemberAccess(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`let person = {"name": "ada"}; person.name`, "ada"},
+		{`let person = {"name": "ada"}; person.age`, nil},
+		{`{"inner": {"x": 1}}.inner.x`, 1},
+	}
+
+	for _, tt := range tests {
+		testExpectedObject(t, testEval(tt.input), tt.expected)
+	}
+}
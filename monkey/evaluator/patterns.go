@@ -0,0 +1,187 @@
+package evaluator
+
+import (
+	"fmt"
+	"monkey/ast"
+	"monkey/object"
+)
+
+type binding struct {
+	ident *ast.Identifier
+	value object.Object
+}
+
+// bind binds ident to val in env: in its slot if the resolver gave it one,
+// by name otherwise.
+func bind(ident *ast.Identifier, val object.Object, env *object.Environment) {
+	if ident.Scope == ast.LocalScope {
+		env.SetSlot(ident.Slot, val)
+		return
+	}
+	env.Set(ident.Value, val)
+}
+
+func (in *Interpreter) evalMatchExpression(me *ast.MatchExpression, env *object.Environment) object.Object {
+	subject := in.Eval(me.Subject, env)
+	if isAbrupt(subject) {
+		return subject
+	}
+	defer in.release(in.hold(subject))
+	defer in.leave(len(in.scopes))
+
+	for _, arm := range me.Arms {
+		bindings, _, err := in.matchPattern(arm.Pattern, subject, env)
+		if err != nil {
+			return err
+		}
+		if bindings == nil {
+			continue
+		}
+
+		// Pattern variables are scoped to their arm so that a failed guard
+		// or a later arm never sees them.
+		armEnv := object.NewFrame(env, arm.Locals)
+		if err := in.allocateEnv(armEnv); err != nil {
+			return err
+		}
+		for _, b := range bindings {
+			bind(b.ident, b.value, armEnv)
+		}
+		mark := in.enter(armEnv)
+
+		if arm.Guard != nil {
+			guard := in.Eval(arm.Guard, armEnv)
+			if isAbrupt(guard) {
+				return guard
+			}
+			if !isTruthy(guard) {
+				in.leave(mark)
+				continue
+			}
+		}
+
+		return in.Eval(arm.Body, armEnv)
+	}
+
+	return newError("no match arm matches %s", subject.Inspect())
+}
+
+// bindPattern destructures value into env as a let statement or function
+// parameter does. Unlike a match arm, a value that does not fit the pattern
+// is an error.
+func (in *Interpreter) bindPattern(pattern ast.Pattern, value object.Object, env *object.Environment) *object.Error {
+	if ident, ok := pattern.(*ast.Identifier); ok {
+		bind(ident, value, env)
+		return nil
+	}
+
+	bindings, mismatch, err := in.matchPattern(pattern, value, env)
+	if err != nil {
+		return err
+	}
+	if bindings == nil {
+		return newError("cannot destructure %s with %s: %s", value.Inspect(), pattern.String(), mismatch)
+	}
+
+	for _, b := range bindings {
+		bind(b.ident, b.value, env)
+	}
+
+	return nil
+}
+
+// matchPattern tests value against pattern. On success it returns the
+// bindings the pattern introduces (possibly empty, but never nil). If the
+// value does not fit, the bindings are nil and mismatch says why.
+func (in *Interpreter) matchPattern(
+	pattern ast.Pattern,
+	value object.Object,
+	env *object.Environment,
+) ([]binding, string, *object.Error) {
+	switch pattern := pattern.(type) {
+	case *ast.WildcardPattern:
+		return []binding{}, "", nil
+
+	case *ast.Identifier:
+		return []binding{{ident: pattern, value: value}}, "", nil
+
+	case *ast.LiteralPattern:
+		literal := in.Eval(pattern.Value, env)
+		if err, ok := literal.(*object.Error); ok {
+			return nil, "", err
+		}
+		if !object.Equals(literal, value) {
+			return nil, fmt.Sprintf("expected %s, got %s", literal.Inspect(), value.Inspect()), nil
+		}
+		return []binding{}, "", nil
+
+	case *ast.ArrayPattern:
+		array, ok := value.(*object.Array)
+		if !ok {
+			return nil, fmt.Sprintf("expected %s, got %s", object.ARRAY_OBJECT, value.Type()), nil
+		}
+
+		n := len(pattern.Elements)
+		if pattern.Rest == nil && len(array.Elements) != n {
+			return nil, fmt.Sprintf("expected %d elements, got %d", n, len(array.Elements)), nil
+		}
+		if len(array.Elements) < n {
+			return nil, fmt.Sprintf("expected at least %d elements, got %d", n, len(array.Elements)), nil
+		}
+
+		bindings := []binding{}
+		for i, element := range pattern.Elements {
+			matched, mismatch, err := in.matchPattern(element, array.Elements[i], env)
+			if err != nil || matched == nil {
+				return nil, mismatch, err
+			}
+			bindings = append(bindings, matched...)
+		}
+
+		if pattern.Rest != nil && pattern.Rest.Value != "_" {
+			rest := make([]object.Object, len(array.Elements)-n)
+			copy(rest, array.Elements[n:])
+			restArray := &object.Array{Elements: rest}
+			if err := in.allocateValue(restArray); err != nil {
+				return nil, "", err
+			}
+			bindings = append(bindings, binding{ident: pattern.Rest, value: restArray})
+		}
+
+		return bindings, "", nil
+
+	case *ast.HashPattern:
+		hash, ok := value.(*object.Hash)
+		if !ok {
+			return nil, fmt.Sprintf("expected %s, got %s", object.HASH_OBJECT, value.Type()), nil
+		}
+
+		bindings := []binding{}
+		for _, pair := range pattern.Pairs {
+			key := in.Eval(pair.Key, env)
+			if err, ok := key.(*object.Error); ok {
+				return nil, "", err
+			}
+
+			hashKey, ok := key.(object.Hashable)
+			if !ok {
+				return nil, "", newError("unusable as hash key: %s", key.Type())
+			}
+
+			found, ok := hash.Pairs[hashKey.HashKey()]
+			if !ok {
+				return nil, fmt.Sprintf("missing key %s", key.Inspect()), nil
+			}
+
+			matched, mismatch, err := in.matchPattern(pair.Value, found.Value, env)
+			if err != nil || matched == nil {
+				return nil, mismatch, err
+			}
+			bindings = append(bindings, matched...)
+		}
+
+		return bindings, "", nil
+	}
+
+	return nil, "", newError("unknown pattern: %s", pattern.String())
+}
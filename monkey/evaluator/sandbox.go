@@ -0,0 +1,262 @@
+package evaluator
+
+import (
+	"fmt"
+	"math/rand"
+	"monkey/object"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Capability is a set of the kinds of access to the world outside the
+// interpreter that builtins can have. An Interpreter grants none until told
+// to with Grant; the builtins that need a capability it lacks fail when
+// called. Without Filesystem, imports are confined to .monkey files in the
+// directory of the program.
+type Capability uint
+
+const (
+	// Filesystem is for readFile and writeFile, and for imports from outside
+	// the directory of the file the evaluation started from, or Dir, and of
+	// files other than .monkey ones.
+	Filesystem Capability = 1 << iota
+	// Clock is for now.
+	Clock
+	// Random is for random.
+	Random
+	// Env is for getenv.
+	Env
+	// Process is for argv and exit.
+	Process
+
+	NoCapabilities  Capability = 0
+	AllCapabilities            = Filesystem | Clock | Random | Env | Process
+)
+
+var capabilityNames = []struct {
+	capability Capability
+	name       string
+}{
+	{Filesystem, "filesystem"},
+	{Clock, "clock"},
+	{Random, "random"},
+	{Env, "env"},
+	{Process, "process"},
+}
+
+// String returns the names of the capabilities in c, separated by commas,
+// or "none".
+func (c Capability) String() string {
+	names := []string{}
+	for _, cn := range capabilityNames {
+		if c&cn.capability != 0 {
+			names = append(names, cn.name)
+		}
+	}
+	if len(names) == 0 {
+		return "none"
+	}
+	return strings.Join(names, ",")
+}
+
+// ParseCapabilities parses a comma-separated list of capability names, as
+// String writes them; "all" stands for every capability and "none" or ""
+// for none.
+func ParseCapabilities(s string) (Capability, error) {
+	var c Capability
+	for _, name := range strings.Split(s, ",") {
+		name = strings.TrimSpace(name)
+		switch name {
+		case "", "none":
+			continue
+		case "all":
+			c |= AllCapabilities
+			continue
+		}
+
+		found := false
+		for _, cn := range capabilityNames {
+			if cn.name == name {
+				c |= cn.capability
+				found = true
+			}
+		}
+		if !found {
+			return 0, fmt.Errorf("unknown capability %q", name)
+		}
+	}
+	return c, nil
+}
+
+// Grant gives in the capabilities in c, on top of those it has.
+func (in *Interpreter) Grant(c Capability) {
+	in.capabilities |= c
+}
+
+// Revoke takes the capabilities in c away from in.
+func (in *Interpreter) Revoke(c Capability) {
+	in.capabilities &^= c
+}
+
+// Granted reports whether in has every capability in c.
+func (in *Interpreter) Granted(c Capability) bool {
+	return in.capabilities&c == c
+}
+
+// deterministicTime is the time now reports in deterministic mode.
+var deterministicTime = time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// Deterministic makes the clock and random builtins reproducible: now
+// always reports 2000-01-01T00:00:00Z, and random draws from a source
+// seeded with seed. Two runs of a program with the same seed and the same
+// inputs produce the same results. It grants no capability.
+func (in *Interpreter) Deterministic(seed int64) {
+	in.now = func() time.Time { return deterministicTime }
+	in.random = rand.New(rand.NewSource(seed))
+}
+
+// sandboxedBuiltins are bound builtins that need a capability.
+var sandboxedBuiltins = map[string]struct {
+	capability Capability
+	bind       func(in *Interpreter) object.BuiltinFunction
+}{
+	"readFile":  {Filesystem, func(in *Interpreter) object.BuiltinFunction { return in.readFile }},
+	"writeFile": {Filesystem, func(in *Interpreter) object.BuiltinFunction { return in.writeFile }},
+	"now":       {Clock, func(in *Interpreter) object.BuiltinFunction { return in.currentTime }},
+	"random":    {Random, func(in *Interpreter) object.BuiltinFunction { return in.randomInteger }},
+	"getenv":    {Env, func(in *Interpreter) object.BuiltinFunction { return in.getenv }},
+	"argv":      {Process, func(in *Interpreter) object.BuiltinFunction { return in.argv }},
+	"exit":      {Process, func(in *Interpreter) object.BuiltinFunction { return in.exit }},
+}
+
+// guard makes fn fail unless in holds capability when it is called, so
+// that grants made after New apply.
+func (in *Interpreter) guard(name string, capability Capability, fn object.BuiltinFunction) object.BuiltinFunction {
+	return func(args ...object.Object) object.Object {
+		if !in.Granted(capability) {
+			return newError("`%s` needs the %s capability, which was not granted", name, capability)
+		}
+		return fn(args...)
+	}
+}
+
+// resolve makes a path that is relative to the code being evaluated, as
+// imports are, absolute.
+func (in *Interpreter) resolve(path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	dir := in.Dir
+	if n := len(in.loading); n > 0 {
+		dir = filepath.Dir(in.loading[n-1].Path)
+	}
+	return filepath.Join(dir, path)
+}
+
+func (in *Interpreter) readFile(args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments to `readFile`. Expects 1, got %d", len(args))
+	}
+	path, ok := args[0].(*object.String)
+	if !ok {
+		return newError("argument to `readFile` must be STRING, got %s", args[0].Type())
+	}
+
+	content, err := os.ReadFile(in.resolve(path.Value))
+	if err != nil {
+		return newError("could not read %s: %s", path.Value, err)
+	}
+	return &object.String{Value: string(content)}
+}
+
+func (in *Interpreter) writeFile(args ...object.Object) object.Object {
+	if len(args) != 2 {
+		return newError("wrong number of arguments to `writeFile`. Expects 2, got %d", len(args))
+	}
+	path, ok := args[0].(*object.String)
+	if !ok {
+		return newError("first argument to `writeFile` must be STRING, got %s", args[0].Type())
+	}
+	content, ok := args[1].(*object.String)
+	if !ok {
+		return newError("second argument to `writeFile` must be STRING, got %s", args[1].Type())
+	}
+
+	if err := os.WriteFile(in.resolve(path.Value), []byte(content.Value), 0o644); err != nil {
+		return newError("could not write %s: %s", path.Value, err)
+	}
+	return NULL
+}
+
+// currentTime returns the milliseconds since the Unix epoch.
+func (in *Interpreter) currentTime(args ...object.Object) object.Object {
+	if len(args) != 0 {
+		return newError("wrong number of arguments to `now`. Expects 0, got %d", len(args))
+	}
+	return &object.Integer{Value: in.now().UnixNano() / int64(time.Millisecond)}
+}
+
+// randomInteger returns an integer from 0 up to, but not including, its
+// argument.
+func (in *Interpreter) randomInteger(args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments to `random`. Expects 1, got %d", len(args))
+	}
+	n, ok := args[0].(*object.Integer)
+	if !ok {
+		return newError("argument to `random` must be INTEGER, got %s", args[0].Type())
+	}
+	if n.Value <= 0 {
+		return newError("argument to `random` must be positive, got %d", n.Value)
+	}
+
+	if in.random == nil {
+		in.random = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+	return &object.Integer{Value: in.random.Int63n(n.Value)}
+}
+
+// getenv returns the value of an environment variable, or null when it is
+// not set.
+func (in *Interpreter) getenv(args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments to `getenv`. Expects 1, got %d", len(args))
+	}
+	name, ok := args[0].(*object.String)
+	if !ok {
+		return newError("argument to `getenv` must be STRING, got %s", args[0].Type())
+	}
+
+	value, ok := os.LookupEnv(name.Value)
+	if !ok {
+		return NULL
+	}
+	return &object.String{Value: value}
+}
+
+func (in *Interpreter) argv(args ...object.Object) object.Object {
+	if len(args) != 0 {
+		return newError("wrong number of arguments to `argv`. Expects 0, got %d", len(args))
+	}
+
+	elements := make([]object.Object, len(in.Args))
+	for i, arg := range in.Args {
+		elements[i] = &object.String{Value: arg}
+	}
+	return &object.Array{Elements: elements}
+}
+
+func (in *Interpreter) exit(args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments to `exit`. Expects 1, got %d", len(args))
+	}
+	code, ok := args[0].(*object.Integer)
+	if !ok {
+		return newError("argument to `exit` must be INTEGER, got %s", args[0].Type())
+	}
+
+	in.Exit(int(code.Value))
+	return NULL
+}
@@ -0,0 +1,205 @@
+package evaluator
+
+import (
+	"monkey/object"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCapabilitiesDeniedByDefault(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`readFile("x")`, "`readFile` needs the filesystem capability, which was not granted"},
+		{`writeFile("x", "")`, "`writeFile` needs the filesystem capability, which was not granted"},
+		{`now()`, "`now` needs the clock capability, which was not granted"},
+		{`random(10)`, "`random` needs the random capability, which was not granted"},
+		{`getenv("HOME")`, "`getenv` needs the env capability, which was not granted"},
+		{`argv()`, "`argv` needs the process capability, which was not granted"},
+		{`exit(1)`, "`exit` needs the process capability, which was not granted"},
+	}
+
+	for _, tt := range tests {
+		result := New().Eval(parse(tt.input), object.NewEnvironment())
+		err, ok := result.(*object.Error)
+		if !ok {
+			t.Errorf("%s: expected an error, got %s", tt.input, result.Inspect())
+			continue
+		}
+		if err.Message != tt.expected {
+			t.Errorf("%s: wrong error. expected %q, got %q", tt.input, tt.expected, err.Message)
+		}
+	}
+}
+
+func TestGrantAndRevoke(t *testing.T) {
+	in := New()
+	in.Args = []string{"a", "b"}
+	exited := -1
+	in.Exit = func(code int) { exited = code }
+
+	in.Grant(Process | Env)
+	if !in.Granted(Process) || in.Granted(Process|Clock) {
+		t.Fatalf("wrong capabilities granted: %s", in.capabilities)
+	}
+
+	t.Setenv("MONKEY_SANDBOX_TEST", "set")
+	result := in.Eval(parse(`[argv(), getenv("MONKEY_SANDBOX_TEST"), getenv("MONKEY_SANDBOX_UNSET"), exit(3)]`), object.NewEnvironment())
+	if result.Inspect() != "[[a, b], set, null, null]" {
+		t.Errorf("wrong result: %s", result.Inspect())
+	}
+	if exited != 3 {
+		t.Errorf("exit called with %d, expected 3", exited)
+	}
+
+	in.Revoke(Env)
+	if result := in.Eval(parse(`getenv("MONKEY_SANDBOX_TEST")`), object.NewEnvironment()); !isError(result) {
+		t.Errorf("revoked capability still granted: %s", result.Inspect())
+	}
+	if !in.Granted(Process) {
+		t.Errorf("revoking env revoked process")
+	}
+}
+
+func TestFilesystemBuiltins(t *testing.T) {
+	in := New()
+	in.Dir = t.TempDir()
+	in.Grant(Filesystem)
+
+	result := in.Eval(parse(`writeFile("out.txt", "hello"); readFile("out.txt")`), object.NewEnvironment())
+	if str, ok := result.(*object.String); !ok || str.Value != "hello" {
+		t.Errorf("wrong content read. expected hello, got %s", result.Inspect())
+	}
+
+	content, err := os.ReadFile(filepath.Join(in.Dir, "out.txt"))
+	if err != nil || string(content) != "hello" {
+		t.Errorf("file not written relative to Dir: %q, %v", content, err)
+	}
+
+	result = in.Eval(parse(`readFile("missing.txt")`), object.NewEnvironment())
+	if !isError(result) {
+		t.Errorf("expected an error reading a missing file, got %s", result.Inspect())
+	}
+}
+
+func TestDeterministic(t *testing.T) {
+	run := func(seed int64) string {
+		in := New()
+		in.Grant(Clock | Random)
+		in.Deterministic(seed)
+		input := `[now(), random(1000), random(1000), random(1000), now()]`
+		return in.Eval(parse(input), object.NewEnvironment()).Inspect()
+	}
+
+	first := run(42)
+	if again := run(42); again != first {
+		t.Errorf("runs with the same seed differ: %s and %s", first, again)
+	}
+	if other := run(43); other == first {
+		t.Errorf("runs with different seeds agree: %s", first)
+	}
+	if expected := "946684800000"; first[1:len(expected)+1] != expected {
+		t.Errorf("wrong fixed time in %s", first)
+	}
+}
+
+func TestParseCapabilities(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected Capability
+		name     string
+	}{
+		{"", NoCapabilities, "none"},
+		{"none", NoCapabilities, "none"},
+		{"clock", Clock, "clock"},
+		{"random, filesystem", Filesystem | Random, "filesystem,random"},
+		{"all", AllCapabilities, "filesystem,clock,random,env,process"},
+	}
+
+	for _, tt := range tests {
+		c, err := ParseCapabilities(tt.input)
+		if err != nil {
+			t.Errorf("%q: unexpected error %s", tt.input, err)
+			continue
+		}
+		if c != tt.expected || c.String() != tt.name {
+			t.Errorf("%q: expected %s, got %s", tt.input, tt.name, c)
+		}
+	}
+
+	if _, err := ParseCapabilities("clock,network"); err == nil {
+		t.Errorf("expected an error for an unknown capability")
+	}
+}
+
+func TestImportsConfinedWithoutFilesystem(t *testing.T) {
+	outside := writeModules(t, map[string]string{"secret.monkey": `export let value = "secret";`})
+	dir := writeModules(t, map[string]string{
+		"main.monkey":       `import "lib/inside"; inside.value`,
+		"lib/inside.monkey": `export let value = "inside";`,
+		"main.txt":          `export let value = "text";`,
+	})
+	secret := filepath.Join(outside, "secret.monkey")
+	if err := os.Symlink(secret, filepath.Join(dir, "link.monkey")); err != nil {
+		t.Fatal(err)
+	}
+
+	result := New().EvalFile(filepath.Join(dir, "main.monkey"), object.NewEnvironment())
+	if str, ok := result.(*object.String); !ok || str.Value != "inside" {
+		t.Errorf("import inside the program's directory failed: %s", result.Inspect())
+	}
+
+	// Whether the file exists or not, the error is the same.
+	denied := []string{secret, filepath.Join(outside, "missing"), "../" + filepath.Base(outside) + "/secret", "link"}
+	for _, path := range denied {
+		in := New()
+		in.Dir = dir
+		result := in.Eval(parse(`import "`+path+`" as m; m.value`), object.NewEnvironment())
+		expected := "importing " + strings.TrimSuffix(path, ModuleExtension) + ModuleExtension + " needs the filesystem capability, which was not granted"
+		if err, ok := result.(*object.Error); !ok || err.Message != expected {
+			t.Errorf("%s: expected %q, got %s", path, expected, result.Inspect())
+		}
+	}
+
+	// Files that are not modules are out of bounds even in the directory.
+	in := New()
+	in.Dir = dir
+	result = in.Eval(parse(`import "main.txt" as m; m.value`), object.NewEnvironment())
+	expected := "importing main.txt needs the filesystem capability, which was not granted"
+	if err, ok := result.(*object.Error); !ok || err.Message != expected {
+		t.Errorf("expected %q, got %s", expected, result.Inspect())
+	}
+
+	in = New()
+	in.Dir = dir
+	in.Grant(Filesystem)
+	result = in.Eval(parse(`import "`+secret+`" as m; m.value`), object.NewEnvironment())
+	if str, ok := result.(*object.String); !ok || str.Value != "secret" {
+		t.Errorf("import with the filesystem capability failed: %s", result.Inspect())
+	}
+}
+
+func TestImportsNeedFilesystemWithoutDirectory(t *testing.T) {
+	dir := writeModules(t, map[string]string{"sub/creds.monkey": `export let value = "secret";`})
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(cwd)
+
+	// An embedder's interpreter evaluates code that comes from no file and
+	// sets no Dir: the working directory of the process is not open to it.
+	for _, path := range []string{"sub/creds", "./sub/creds", filepath.Join(dir, "sub/creds")} {
+		result := New().Eval(parse(`import "`+path+`" as m; m.value`), object.NewEnvironment())
+		expected := "importing " + path + ModuleExtension + " needs the filesystem capability, which was not granted"
+		if err, ok := result.(*object.Error); !ok || err.Message != expected {
+			t.Errorf("%s: expected %q, got %s", path, expected, result.Inspect())
+		}
+	}
+}
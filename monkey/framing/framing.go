@@ -0,0 +1,54 @@
+// Package framing reads and writes messages framed as the Language Server
+// Protocol and the Debug Adapter Protocol both frame them: a Content-Length
+// header, a blank line, then the JSON body.
+package framing
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strconv"
+	"strings"
+)
+
+// MaxContentLength is the longest body, in bytes, that ReadMessage accepts,
+// so that a bad header cannot make it allocate an arbitrary amount of memory.
+const MaxContentLength = 64 << 20
+
+// ReadMessage reads the body of the next message from r.
+func ReadMessage(r *bufio.Reader) ([]byte, error) {
+	header, err := textproto.NewReader(r).ReadMIMEHeader()
+	if err != nil {
+		return nil, err
+	}
+
+	length, err := strconv.Atoi(strings.TrimSpace(header.Get("Content-Length")))
+	if err != nil || length < 0 {
+		return nil, fmt.Errorf("invalid Content-Length %q", header.Get("Content-Length"))
+	}
+	if length > MaxContentLength {
+		return nil, fmt.Errorf("Content-Length %d is over the limit of %d bytes", length, MaxContentLength)
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
+// WriteMessage writes v to w as one message.
+func WriteMessage(w io.Writer, v interface{}) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	if _, err := fmt.Fprintf(w, "Content-Length: %d\r\n\r\n", len(body)); err != nil {
+		return err
+	}
+	_, err = w.Write(body)
+	return err
+}
@@ -0,0 +1,51 @@
+package framing
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteMessage(&buf, map[string]int{"a": 1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteMessage(&buf, []string{"b"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := buf.String(); !strings.HasPrefix(got, "Content-Length: 7\r\n\r\n{\"a\":1}") {
+		t.Errorf("wrong framing: %q", got)
+	}
+
+	r := bufio.NewReader(&buf)
+	for _, expected := range []string{`{"a":1}`, `["b"]`} {
+		body, err := ReadMessage(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(body) != expected {
+			t.Errorf("wrong body. expected %s, got %s", expected, body)
+		}
+	}
+}
+
+func TestInvalidContentLength(t *testing.T) {
+	tests := []struct {
+		header   string
+		expected string
+	}{
+		{"Content-Length: x\r\n\r\n", `invalid Content-Length "x"`},
+		{"Content-Length: -1\r\n\r\n", `invalid Content-Length "-1"`},
+		{"Content-Type: text/plain\r\n\r\n", `invalid Content-Length ""`},
+		{"Content-Length: 1000000000000\r\n\r\n", "Content-Length 1000000000000 is over the limit of 67108864 bytes"},
+	}
+
+	for _, tt := range tests {
+		_, err := ReadMessage(bufio.NewReader(strings.NewReader(tt.header)))
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("%q: expected error %q, got %v", tt.header, tt.expected, err)
+		}
+	}
+}
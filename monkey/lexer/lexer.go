@@ -7,15 +7,26 @@ type Lexer struct {
 	currentIndex int
 	nextIndex    int
 	character    byte
+
+	// line and column locate character in the input.
+	line   int
+	column int
 }
 
 func New(input string) *Lexer {
-	l := &Lexer{input: input}
+	l := &Lexer{input: input, line: 1}
 	l.readCharacter()
 	return l
 }
 
 func (l *Lexer) readCharacter() {
+	if l.character == '\n' {
+		l.line++
+		l.column = 1
+	} else {
+		l.column++
+	}
+
 	if l.nextIndex >= len(l.input) {
 		l.character = 0
 	} else {
@@ -28,6 +39,7 @@ func (l *Lexer) readCharacter() {
 func (l *Lexer) NextToken() token.Token {
 	var tok token.Token
 	l.eatWhitespace()
+	position := token.Position{Line: l.line, Column: l.column}
 
 	switch l.character {
 	case '=':
@@ -36,9 +48,19 @@ func (l *Lexer) NextToken() token.Token {
 			l.readCharacter()
 			tok.Type = token.EQUAL
 			tok.Value = string(ch) + string(l.character)
+		} else if l.peakNextCharacter() == '>' {
+			tok = l.readTwoCharacterToken(token.ARROW)
 		} else {
 			tok = newToken(token.ASSIGN, l.character)
 		}
+	case '.':
+		if l.peakNextCharacter() == '.' && l.peakCharacterAt(2) == '.' {
+			l.readCharacter()
+			l.readCharacter()
+			tok = token.Token{Type: token.ELLIPSIS, Value: "..."}
+		} else {
+			tok = newToken(token.DOT, l.character)
+		}
 	case '+':
 		tok = newToken(token.PLUS, l.character)
 	case '(':
@@ -53,6 +75,8 @@ func (l *Lexer) NextToken() token.Token {
 		tok = newToken(token.SEMICOLON, l.character)
 	case ',':
 		tok = newToken(token.COMMA, l.character)
+	case ':':
+		tok = newToken(token.COLON, l.character)
 	case '!':
 		if l.peakNextCharacter() == '=' {
 			tok.Type = token.NOT_EQUAL
@@ -68,10 +92,40 @@ func (l *Lexer) NextToken() token.Token {
 		tok = newToken(token.SLASH, l.character)
 	case '*':
 		tok = newToken(token.ASTERISK, l.character)
+	case '%':
+		tok = newToken(token.PERCENT, l.character)
 	case '<':
-		tok = newToken(token.L_THAN, l.character)
+		switch l.peakNextCharacter() {
+		case '=':
+			tok = l.readTwoCharacterToken(token.L_THAN_EQUAL)
+		case '<':
+			tok = l.readTwoCharacterToken(token.L_SHIFT)
+		default:
+			tok = newToken(token.L_THAN, l.character)
+		}
 	case '>':
-		tok = newToken(token.G_THAN, l.character)
+		switch l.peakNextCharacter() {
+		case '=':
+			tok = l.readTwoCharacterToken(token.G_THAN_EQUAL)
+		case '>':
+			tok = l.readTwoCharacterToken(token.R_SHIFT)
+		default:
+			tok = newToken(token.G_THAN, l.character)
+		}
+	case '&':
+		if l.peakNextCharacter() == '&' {
+			tok = l.readTwoCharacterToken(token.AND)
+		} else {
+			tok = newToken(token.AMPERSAND, l.character)
+		}
+	case '|':
+		if l.peakNextCharacter() == '|' {
+			tok = l.readTwoCharacterToken(token.OR)
+		} else {
+			tok = newToken(token.PIPE, l.character)
+		}
+	case '^':
+		tok = newToken(token.CARET, l.character)
 	case 0:
 		tok = newToken(token.EOF, l.character)
 	case '"':
@@ -85,10 +139,12 @@ func (l *Lexer) NextToken() token.Token {
 		if isLetter(l.character) {
 			tok.Value = l.readIdentifier()
 			tok.Type = token.LookupIdentifier(tok.Value)
+			tok.Position = position
 			return tok
 		} else if isDigit(l.character) {
 			tok.Type = token.INT
 			tok.Value = l.readNumber()
+			tok.Position = position
 			return tok
 		} else {
 			print(l.character)
@@ -97,9 +153,16 @@ func (l *Lexer) NextToken() token.Token {
 	}
 
 	l.readCharacter()
+	tok.Position = position
 	return tok
 }
 
+func (l *Lexer) readTwoCharacterToken(tokenType token.TokenType) token.Token {
+	ch := l.character
+	l.readCharacter()
+	return token.Token{Type: tokenType, Value: string(ch) + string(l.character)}
+}
+
 func (l *Lexer) readString() string {
 	pos := l.nextIndex
 	for {
@@ -118,6 +181,15 @@ func (l *Lexer) peakNextCharacter() byte {
 	return 0
 }
 
+// peakCharacterAt looks offset characters ahead of the current one.
+func (l *Lexer) peakCharacterAt(offset int) byte {
+	index := l.currentIndex + offset
+	if index < len(l.input) {
+		return l.input[index]
+	}
+	return 0
+}
+
 func (l *Lexer) readNumber() string {
 	index := l.currentIndex
 	for isDigit(l.character) {
@@ -151,3 +223,17 @@ func isLetter(ch byte) bool {
 func newToken(tokenType token.TokenType, character byte) token.Token {
 	return token.Token{Type: tokenType, Value: string(character)}
 }
+
+// Tokens lexes the whole input, up to and including the EOF token.
+func Tokens(input string) []token.Token {
+	l := New(input)
+
+	tokens := []token.Token{}
+	for {
+		tok := l.NextToken()
+		tokens = append(tokens, tok)
+		if tok.Type == token.EOF {
+			return tokens
+		}
+	}
+}
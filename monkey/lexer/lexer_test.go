@@ -22,7 +22,12 @@ func TestNextToken(t *testing.T) {
 	10 != 9;
 	"foorbar"
 	"icheka ozuru"
-	[1, 2]`
+	[1, 2]
+	{"a": 1}
+	while for in break continue
+	a && b || c % 2 <= 3 >= 4 & 5 | 6 ^ 7 << 8 >> 9
+	match => ...
+	import export mod.name`
 
 	tests := []struct {
 		expectedType  token.TokenType
@@ -97,6 +102,46 @@ func TestNextToken(t *testing.T) {
 		{token.COMMA, ","},
 		{token.INT, "2"},
 		{token.RBRACKET, "]"},
+		{token.LBRACE, "{"},
+		{token.STRING, "a"},
+		{token.COLON, ":"},
+		{token.INT, "1"},
+		{token.RBRACE, "}"},
+		{token.WHILE, "while"},
+		{token.FOR, "for"},
+		{token.IN, "in"},
+		{token.BREAK, "break"},
+		{token.CONTINUE, "continue"},
+		{token.IDENT, "a"},
+		{token.AND, "&&"},
+		{token.IDENT, "b"},
+		{token.OR, "||"},
+		{token.IDENT, "c"},
+		{token.PERCENT, "%"},
+		{token.INT, "2"},
+		{token.L_THAN_EQUAL, "<="},
+		{token.INT, "3"},
+		{token.G_THAN_EQUAL, ">="},
+		{token.INT, "4"},
+		{token.AMPERSAND, "&"},
+		{token.INT, "5"},
+		{token.PIPE, "|"},
+		{token.INT, "6"},
+		{token.CARET, "^"},
+		{token.INT, "7"},
+		{token.L_SHIFT, "<<"},
+		{token.INT, "8"},
+		{token.R_SHIFT, ">>"},
+		{token.INT, "9"},
+		{token.MATCH, "match"},
+		{token.ARROW, "=>"},
+		{token.ELLIPSIS, "..."},
+		{token.IMPORT, "import"},
+		{token.EXPORT, "export"},
+		{token.IDENT, "mod"},
+		{token.DOT, "."},
+		{token.IDENT, "name"},
+		{token.EOF, ""},
 	}
 
 	// a new lexer instance
@@ -108,5 +153,56 @@ func TestNextToken(t *testing.T) {
 		if tok.Type != tt.expectedType {
 			t.Fatalf("tests[%d] - tokentype wrong. Expected=%q, %q. Got=%q, %q", i, tt.expectedType, tt.expectedValue, tok.Type, tok.Value)
 		}
+
+		if tt.expectedType != token.STRING && tok.Value != tt.expectedValue && tt.expectedType != token.EOF {
+			t.Fatalf("tests[%d] - value wrong. Expected=%q, got=%q", i, tt.expectedValue, tok.Value)
+		}
+	}
+}
+
+func TestTokenPositions(t *testing.T) {
+	input := "let x = 5;\n  puts(\"a\nb\", x >= 1);"
+
+	tests := []struct {
+		expectedValue string
+		line, column  int
+		endLine       int
+		endColumn     int
+	}{
+		{"let", 1, 1, 1, 4},
+		{"x", 1, 5, 1, 6},
+		{"=", 1, 7, 1, 8},
+		{"5", 1, 9, 1, 10},
+		{";", 1, 10, 1, 11},
+		{"puts", 2, 3, 2, 7},
+		{"(", 2, 7, 2, 8},
+		{"a\nb", 2, 8, 3, 3},
+		{",", 3, 3, 3, 4},
+		{"x", 3, 5, 3, 6},
+		{">=", 3, 7, 3, 9},
+		{"1", 3, 10, 3, 11},
+		{")", 3, 11, 3, 12},
+		{";", 3, 12, 3, 13},
+		{"", 3, 13, 3, 13},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != token.EOF && tok.Value != tt.expectedValue {
+			t.Fatalf("tests[%d] - value wrong. Expected=%q, got=%q", i, tt.expectedValue, tok.Value)
+		}
+
+		expected := token.Position{Line: tt.line, Column: tt.column}
+		if tok.Position != expected {
+			t.Errorf("tests[%d] - position of %q wrong. Expected=%s, got=%s", i, tok.Value, expected, tok.Position)
+		}
+
+		expectedEnd := token.Position{Line: tt.endLine, Column: tt.endColumn}
+		if tok.End() != expectedEnd {
+			t.Errorf("tests[%d] - end of %q wrong. Expected=%s, got=%s", i, tok.Value, expectedEnd, tok.End())
+		}
 	}
 }
@@ -0,0 +1,509 @@
+package lsp
+
+import (
+	"monkey/ast"
+	"monkey/evaluator"
+	"monkey/lexer"
+	"monkey/parser"
+	"monkey/resolver"
+	"monkey/token"
+	"monkey/types"
+	"sort"
+	"unicode/utf8"
+)
+
+// document is an open text document and what the server knows about it.
+// It is analysed once per version, and every request is answered from that
+// analysis.
+type document struct {
+	uri     string
+	version int
+	text    string
+
+	// lines holds the byte offset at which each line starts.
+	lines []int
+
+	program *ast.Program
+	tokens  []token.Token
+
+	// tokenIndex finds a token of tokens by its position.
+	tokenIndex map[token.Position]int
+
+	parsed      bool
+	diagnostics []Diagnostic
+
+	// definitions maps every bound identifier to the one that declared its
+	// binding; declarations describes each declaring identifier.
+	definitions  map[*ast.Identifier]*ast.Identifier
+	declarations map[*ast.Identifier]*declaration
+	scopes       []*scope
+}
+
+// declaration is a name introduced by a let, a parameter, a loop, an import
+// or a match pattern.
+type declaration struct {
+	ident *ast.Identifier
+	scope *scope
+
+	// kind is a CompletionItem kind, and header the source of the
+	// declaration without any bodies, as shown on hover.
+	kind        int
+	description string
+	header      string
+}
+
+// scope mirrors the scopes of the resolver: the program, function and macro
+// bodies, and match arms. start and end delimit it in the source.
+type scope struct {
+	outer        *scope
+	function     bool
+	start, end   token.Position
+	declarations []*declaration
+}
+
+func (s *scope) contains(pos token.Position) bool {
+	return !pos.Before(s.start) && !s.end.Before(pos)
+}
+
+func newDocument(uri string, version int, text string) *document {
+	d := &document{uri: uri, version: version, text: text, lines: []int{0}}
+	for i := 0; i < len(text); i++ {
+		if text[i] == '\n' {
+			d.lines = append(d.lines, i+1)
+		}
+	}
+
+	d.tokens = lexer.Tokens(text)
+	d.tokenIndex = make(map[token.Position]int, len(d.tokens))
+	for i, tok := range d.tokens {
+		d.tokenIndex[tok.Position] = i
+	}
+
+	d.analyse()
+	return d
+}
+
+func (d *document) analyse() {
+	d.diagnostics = []Diagnostic{}
+
+	p := parser.New(lexer.New(d.text))
+	d.program = p.ParseProgram()
+	d.parsed = len(p.Errors()) == 0
+	for i, msg := range p.Errors() {
+		d.report(p.ErrorPositions()[i], SeverityError, msg)
+	}
+	if !d.parsed {
+		// After an error the parser may keep statements with pieces
+		// missing, which cannot be printed or analysed.
+		statements := []ast.Statement{}
+		for _, stmt := range d.program.Statements {
+			if ast.Complete(stmt) {
+				statements = append(statements, stmt)
+			}
+		}
+		d.program.Statements = statements
+	}
+	for i, msg := range p.Warnings() {
+		d.report(p.WarningPositions()[i], SeverityWarning, msg)
+	}
+
+	r := resolver.New(evaluator.BuiltinNames())
+	r.Definitions = make(map[*ast.Identifier]*ast.Identifier)
+	for _, diagnostic := range r.Resolve(d.program) {
+		severity := SeverityError
+		if diagnostic.Severity == resolver.Warning {
+			severity = SeverityWarning
+		}
+		d.report(diagnostic.Position, severity, diagnostic.Message)
+	}
+	d.definitions = r.Definitions
+
+	// The checker sees the program before macro expansion, which only
+	// makes sense for programs without macros.
+	if d.parsed && !definesMacros(d.program) {
+		_, typeErrors := types.NewChecker().Check(d.program)
+		for _, e := range typeErrors {
+			d.report(e.Position, SeverityError, "type error: "+e.Message)
+		}
+	}
+
+	sort.SliceStable(d.diagnostics, func(i, j int) bool {
+		a, b := d.diagnostics[i].Range.Start, d.diagnostics[j].Range.Start
+		return a.Line < b.Line || a.Line == b.Line && a.Character < b.Character
+	})
+
+	d.declarations = make(map[*ast.Identifier]*declaration)
+	d.scopes = nil
+	program := d.newScope(nil, false, token.Position{Line: 1, Column: 1}, d.end())
+	d.collect(d.program, program)
+}
+
+func (d *document) report(pos token.Position, severity int, msg string) {
+	d.diagnostics = append(d.diagnostics, Diagnostic{
+		Range:    d.tokenRange(pos),
+		Severity: severity,
+		Source:   "monkey",
+		Message:  msg,
+	})
+}
+
+func definesMacros(program *ast.Program) bool {
+	found := false
+	ast.Inspect(program, func(node ast.Node) bool {
+		if _, ok := node.(*ast.MacroLiteral); ok {
+			found = true
+		}
+		return !found && node != nil
+	})
+	return found
+}
+
+func (d *document) newScope(outer *scope, function bool, start, end token.Position) *scope {
+	s := &scope{outer: outer, function: function, start: start, end: end}
+	d.scopes = append(d.scopes, s)
+	return s
+}
+
+// collect records the declarations of node, which lies in scope s, and the
+// scopes nested in it.
+func (d *document) collect(node ast.Node, s *scope) {
+	ast.Inspect(node, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case nil:
+			return false
+
+		case *ast.LetStatement:
+			d.collectLet(node, "", s)
+			return false
+
+		case *ast.ExportStatement:
+			d.collectLet(node.Statement, "export ", s)
+			return false
+
+		case *ast.ImportStatement:
+			d.declare(node.Name, s, CompletionModule, "import", node.String())
+			return false
+
+		case *ast.ForStatement:
+			header := "for (" + node.Value.String() + " in " + node.Iterable.String() + ")"
+			if node.Key != nil {
+				header = "for (" + node.Key.String() + ", " + node.Value.String() + " in " + node.Iterable.String() + ")"
+				d.declare(node.Key, s, CompletionVariable, "loop variable", header)
+			}
+			d.declare(node.Value, s, CompletionVariable, "loop variable", header)
+			d.collect(node.Iterable, s)
+			d.collect(node.Body, s)
+			return false
+
+		case *ast.FunctionLiteral:
+			d.collectFunction(node, node.Parameters, node.Defaults, node.Rest, node.Body, functionHeader(node), s)
+			return false
+
+		case *ast.MacroLiteral:
+			d.collectFunction(node, node.Parameters, node.Defaults, node.Rest, node.Body, macroHeader(node), s)
+			return false
+
+		case *ast.MatchExpression:
+			d.collect(node.Subject, s)
+			for _, arm := range node.Arms {
+				start, _ := d.extent(arm.Pattern)
+				_, end := d.extent(arm.Body)
+				inner := d.newScope(s, false, start, end)
+				for _, ident := range ast.PatternIdentifiers(arm.Pattern) {
+					d.declare(ident, inner, CompletionVariable, "match binding", arm.Pattern.String()+" =>")
+				}
+				d.collect(arm.Guard, inner)
+				d.collect(arm.Body, inner)
+			}
+			return false
+		}
+
+		return true
+	})
+}
+
+func (d *document) collectLet(let *ast.LetStatement, prefix string, s *scope) {
+	kind := CompletionVariable
+	value := ""
+	switch v := let.Value.(type) {
+	case *ast.FunctionLiteral:
+		kind = CompletionFunction
+		value = functionHeader(v)
+	case *ast.MacroLiteral:
+		kind = CompletionFunction
+		value = macroHeader(v)
+	case nil:
+	default:
+		value = abbreviate(v.String())
+	}
+
+	header := prefix + "let " + let.Name.String()
+	if let.Type != nil {
+		header += ": " + let.Type.String()
+	}
+	header += " = " + value
+
+	for _, ident := range ast.PatternIdentifiers(let.Name) {
+		d.declare(ident, s, kind, prefix+"let binding", header)
+	}
+	d.collect(let.Value, s)
+}
+
+func (d *document) collectFunction(
+	node ast.Node,
+	parameters []ast.Pattern,
+	defaults []ast.Expression,
+	rest *ast.Identifier,
+	body *ast.BlockStatement,
+	header string,
+	s *scope,
+) {
+	start, end := d.extent(node)
+	inner := d.newScope(s, true, start, end)
+
+	for i, param := range parameters {
+		for _, ident := range ast.PatternIdentifiers(param) {
+			d.declare(ident, inner, CompletionVariable, "parameter", header)
+		}
+		if i < len(defaults) {
+			d.collect(defaults[i], inner)
+		}
+	}
+	if rest != nil {
+		d.declare(rest, inner, CompletionVariable, "parameter", header)
+	}
+	d.collect(body, inner)
+}
+
+func (d *document) declare(ident *ast.Identifier, s *scope, kind int, description, header string) {
+	if ident == nil || ident.Value == "_" {
+		return
+	}
+
+	decl := &declaration{ident: ident, scope: s, kind: kind, description: description, header: header}
+	d.declarations[ident] = decl
+	s.declarations = append(s.declarations, decl)
+}
+
+// abbreviate shortens long values shown in a declaration's header.
+func abbreviate(s string) string {
+	const max = 60
+	if len(s) <= max {
+		return s
+	}
+	return s[:max] + "..."
+}
+
+func functionHeader(fl *ast.FunctionLiteral) string {
+	header := "function(" + ast.ParametersString(fl.Parameters, fl.ParameterTypes, fl.Defaults, fl.Rest, fl.RestType) + ")"
+	if fl.ReturnType != nil {
+		header += ": " + fl.ReturnType.String()
+	}
+	return header + " { ... }"
+}
+
+func macroHeader(ml *ast.MacroLiteral) string {
+	return "macro(" + ast.ParametersString(ml.Parameters, nil, ml.Defaults, ml.Rest, nil) + ") { ... }"
+}
+
+// identifierAt returns the identifier under pos, or the one that ends right
+// before it, where the cursor sits after typing a name.
+func (d *document) identifierAt(pos token.Position) *ast.Identifier {
+	for _, at := range []token.Position{pos, {Line: pos.Line, Column: pos.Column - 1}} {
+		if node, _ := ast.NodeAt(d.program, at); node != nil {
+			if ident, ok := node.(*ast.Identifier); ok {
+				return ident
+			}
+		}
+	}
+	return nil
+}
+
+// declarationOf returns the declaration ident refers to, or nil for
+// builtins and unresolved names.
+func (d *document) declarationOf(ident *ast.Identifier) *declaration {
+	if decl, ok := d.declarations[ident]; ok {
+		return decl
+	}
+	if def, ok := d.definitions[ident]; ok {
+		return d.declarations[def]
+	}
+	return nil
+}
+
+// references returns the identifiers bound to the same binding as ident,
+// in source order.
+func (d *document) references(ident *ast.Identifier) []*ast.Identifier {
+	def, ok := d.definitions[ident]
+	if !ok {
+		return nil
+	}
+
+	refs := []*ast.Identifier{}
+	for ref, other := range d.definitions {
+		if other == def {
+			refs = append(refs, ref)
+		}
+	}
+	sort.Slice(refs, func(i, j int) bool {
+		return refs[i].Token.Position.Before(refs[j].Token.Position)
+	})
+	return refs
+}
+
+// visible returns the declarations in scope at pos, innermost first, with
+// each name only once. Like the resolver, it only offers a declaration that
+// follows pos when pos is inside a function, which runs later.
+func (d *document) visible(pos token.Position) []*declaration {
+	// Scopes are listed outermost first, so the last one around pos is the
+	// innermost.
+	var innermost *scope
+	for _, s := range d.scopes {
+		if s.contains(pos) {
+			innermost = s
+		}
+	}
+
+	seen := map[string]bool{}
+	decls := []*declaration{}
+	deferred := false
+	for s := innermost; s != nil; s = s.outer {
+		for _, decl := range s.declarations {
+			if seen[decl.ident.Value] || !deferred && pos.Before(decl.ident.Token.End()) {
+				continue
+			}
+			seen[decl.ident.Value] = true
+			decls = append(decls, decl)
+		}
+		if s.function {
+			deferred = true
+		}
+	}
+	return decls
+}
+
+// extent returns where node starts and ends in the source, including the
+// closing brackets that its last token leaves open.
+func (d *document) extent(node ast.Node) (token.Position, token.Position) {
+	start := ast.Pos(node)
+	last := start
+	ast.Inspect(node, func(n ast.Node) bool {
+		if n == nil {
+			return false
+		}
+		if pos := ast.TokenOf(n).Position; pos.IsValid() && last.Before(pos) {
+			last = pos
+		}
+		return true
+	})
+
+	first, ok := d.tokenIndex[start]
+	end, ok2 := d.tokenIndex[last]
+	if !ok || !ok2 {
+		return start, start
+	}
+
+	depth := 0
+	for i := first; i <= end; i++ {
+		depth += bracketDepth(d.tokens[i].Type)
+	}
+	for depth > 0 && end+1 < len(d.tokens) && bracketDepth(d.tokens[end+1].Type) < 0 {
+		end++
+		depth--
+	}
+	return start, d.tokens[end].End()
+}
+
+func bracketDepth(t token.TokenType) int {
+	switch t {
+	case token.LPAREN, token.LBRACKET, token.LBRACE:
+		return 1
+	case token.RPAREN, token.RBRACKET, token.RBRACE:
+		return -1
+	}
+	return 0
+}
+
+// tokenRange returns the range of the token at pos, or an empty range at
+// pos if no token starts there.
+func (d *document) tokenRange(pos token.Position) Range {
+	if i, ok := d.tokenIndex[pos]; ok {
+		return Range{Start: d.position(pos), End: d.position(d.tokens[i].End())}
+	}
+	return Range{Start: d.position(pos), End: d.position(pos)}
+}
+
+func (d *document) nodeRange(node ast.Node) Range {
+	start, end := d.extent(node)
+	return Range{Start: d.position(start), End: d.position(end)}
+}
+
+// position converts a position in bytes to one in UTF-16 code units, which
+// is how the protocol counts characters.
+func (d *document) position(pos token.Position) Position {
+	if !pos.IsValid() {
+		return Position{}
+	}
+	line := pos.Line - 1
+	if line >= len(d.lines) {
+		return d.position(d.end())
+	}
+
+	text := d.lineText(line)
+	column := pos.Column - 1
+	if column > len(text) {
+		column = len(text)
+	}
+	return Position{Line: line, Character: utf16Length(text[:column])}
+}
+
+// tokenPosition converts a protocol position back to a position in bytes.
+// Positions outside the document, which a client may still send, are moved
+// to its nearest edge.
+func (d *document) tokenPosition(pos Position) token.Position {
+	if pos.Line < 0 {
+		pos.Line = 0
+	}
+	if pos.Character < 0 {
+		pos.Character = 0
+	}
+	if pos.Line >= len(d.lines) {
+		return d.end()
+	}
+
+	text := d.lineText(pos.Line)
+	column, units := 0, 0
+	for column < len(text) && units < pos.Character {
+		r, size := utf8.DecodeRuneInString(text[column:])
+		column += size
+		units++
+		if r >= 0x10000 {
+			units++
+		}
+	}
+	return token.Position{Line: pos.Line + 1, Column: column + 1}
+}
+
+func (d *document) end() token.Position {
+	last := len(d.lines) - 1
+	return token.Position{Line: last + 1, Column: len(d.lineText(last)) + 1}
+}
+
+func (d *document) lineText(line int) string {
+	start, end := d.lines[line], len(d.text)
+	if line+1 < len(d.lines) {
+		end = d.lines[line+1] - 1
+	}
+	return d.text[start:end]
+}
+
+func utf16Length(s string) int {
+	n := 0
+	for _, r := range s {
+		n++
+		if r >= 0x10000 {
+			n++
+		}
+	}
+	return n
+}
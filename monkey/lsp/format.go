@@ -0,0 +1,173 @@
+package lsp
+
+import (
+	"errors"
+	"monkey/ast"
+	"monkey/lexer"
+	"monkey/token"
+	"strings"
+)
+
+// format lays out the document, which must parse: it indents every line by
+// the brackets open before it and normalises the spaces between tokens. Line
+// breaks are kept, except that runs of blank lines become a single one. Only
+// whitespace changes, which format checks by lexing its result.
+func (d *document) format(options FormattingOptions) (string, error) {
+	indent := "\t"
+	if options.InsertSpaces {
+		size := options.TabSize
+		if size <= 0 {
+			size = 4
+		}
+		indent = strings.Repeat(" ", size)
+	}
+
+	// Braces are blocks unless they open a hash literal or pattern.
+	hashes := map[token.Position]bool{}
+	ast.Inspect(d.program, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.HashLiteral:
+			hashes[node.Token.Position] = true
+		case *ast.HashPattern:
+			hashes[node.Token.Position] = true
+		}
+		return node != nil
+	})
+
+	// In a document that stops inside a token, such as an unterminated
+	// string, the end of file lies past the end of the text.
+	tokens := d.tokens
+	offset := func(pos token.Position) int {
+		o := d.lines[pos.Line-1] + pos.Column - 1
+		if o > len(d.text) {
+			return len(d.text)
+		}
+		return o
+	}
+
+	var out strings.Builder
+
+	// open holds the brackets not yet closed. All the brackets opened on one
+	// line add a single level of indentation.
+	type bracket struct {
+		level, line int
+		block       bool
+	}
+	open := []bracket{}
+	lineLevel := 0
+
+	for i := 0; i+1 < len(tokens); i++ {
+		tok := tokens[i]
+		source := strings.TrimRight(d.text[offset(tok.Position):offset(tokens[i+1].Position)], " \t\r\n")
+
+		if i == 0 || tok.Line > tokens[i-1].End().Line {
+			if i > 0 {
+				out.WriteString("\n")
+				if tok.Line > tokens[i-1].End().Line+1 {
+					out.WriteString("\n")
+				}
+			}
+
+			closers := 0
+			for j := i; j+1 < len(tokens) && tokens[j].Line == tok.Line && bracketDepth(tokens[j].Type) < 0; j++ {
+				closers++
+			}
+			lineLevel = 0
+			if n := len(open) - closers; n > 0 {
+				lineLevel = open[n-1].level
+			}
+			out.WriteString(strings.Repeat(indent, lineLevel))
+		} else if spaced(tokens, i, hashes, len(open) > 0 && open[len(open)-1].block) {
+			out.WriteString(" ")
+		}
+		out.WriteString(source)
+
+		switch bracketDepth(tok.Type) {
+		case 1:
+			b := bracket{level: lineLevel + 1, line: tok.Line, block: tok.Type == token.LBRACE && !hashes[tok.Position]}
+			if n := len(open); n > 0 && open[n-1].line == tok.Line {
+				b.level = open[n-1].level
+			}
+			open = append(open, b)
+		case -1:
+			if len(open) > 0 {
+				open = open[:len(open)-1]
+			}
+		}
+	}
+	if out.Len() > 0 {
+		out.WriteString("\n")
+	}
+
+	formatted := out.String()
+	if !sameTokens(tokens, lexer.Tokens(formatted)) {
+		return "", errors.New("formatting would change the program")
+	}
+	return formatted, nil
+}
+
+// spaced reports whether a space separates tokens[i] from the token before
+// it on the same line. inBlock says whether the innermost open bracket is the
+// brace of a block.
+func spaced(tokens []token.Token, i int, hashes map[token.Position]bool, inBlock bool) bool {
+	prev, tok := tokens[i-1], tokens[i]
+
+	switch tok.Type {
+	case token.COMMA, token.SEMICOLON, token.COLON, token.DOT, token.RPAREN, token.RBRACKET:
+		return false
+	case token.RBRACE:
+		return prev.Type != token.LBRACE && inBlock
+	}
+
+	switch prev.Type {
+	case token.LPAREN, token.LBRACKET, token.DOT, token.ELLIPSIS:
+		return false
+	case token.LBRACE:
+		return !hashes[prev.Position]
+	}
+	if unary(tokens, i-1) {
+		return false
+	}
+
+	switch tok.Type {
+	case token.LPAREN:
+		return !endsOperand(prev) && prev.Type != token.FUNCTION && prev.Type != token.MACRO
+	case token.LBRACKET:
+		return !endsOperand(prev)
+	}
+	return true
+}
+
+// unary reports whether tokens[i] is a prefix operator.
+func unary(tokens []token.Token, i int) bool {
+	switch tokens[i].Type {
+	case token.BANG:
+		return true
+	case token.MINUS:
+		return i == 0 || !endsOperand(tokens[i-1])
+	}
+	return false
+}
+
+// endsOperand reports whether tok can end an operand, so that a following
+// minus is binary and a following bracket indexes or calls.
+func endsOperand(tok token.Token) bool {
+	switch tok.Type {
+	case token.IDENT, token.INT, token.STRING, token.TRUE, token.FALSE,
+		token.RPAREN, token.RBRACKET, token.RBRACE:
+		return true
+	}
+	return false
+}
+
+func sameTokens(a, b []token.Token) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Type != b[i].Type || a[i].Value != b[i].Value {
+			return false
+		}
+	}
+	return true
+}
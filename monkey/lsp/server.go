@@ -0,0 +1,386 @@
+// Package lsp implements a Language Server Protocol server for Monkey.
+//
+// The server reads JSON-RPC messages from one stream and writes to another,
+// usually stdin and stdout. Every open document is parsed and resolved on
+// each change; the server publishes its syntax, name and type errors and
+// answers requests for definitions, references, hover, completion, document
+// symbols and formatting from that analysis.
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"monkey/ast"
+	"monkey/evaluator"
+	"monkey/framing"
+	"monkey/token"
+)
+
+type Server struct {
+	in  *bufio.Reader
+	out io.Writer
+
+	documents map[string]*document
+	shutdown  bool
+}
+
+// NewServer returns a server reading messages from in and writing them to
+// out.
+func NewServer(in io.Reader, out io.Writer) *Server {
+	return &Server{
+		in:        bufio.NewReader(in),
+		out:       out,
+		documents: make(map[string]*document),
+	}
+}
+
+// Serve handles messages until the client sends exit or closes the input.
+// It returns an error if the input breaks off or cannot be framed, or if
+// the client exits without asking the server to shut down first.
+func (s *Server) Serve() error {
+	for {
+		body, err := framing.ReadMessage(s.in)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		var req request
+		if err := json.Unmarshal(body, &req); err != nil {
+			if err := s.replyError(nil, codeParseError, err.Error()); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if req.Method == "exit" {
+			if !s.shutdown {
+				return errExitWithoutShutdown
+			}
+			return nil
+		}
+
+		result, err := s.handle(&req)
+		rpcErr, failed := err.(*responseError)
+		if err != nil && !failed {
+			return err
+		}
+		if req.isNotification() {
+			continue
+		}
+
+		if failed {
+			err = s.replyError(req.ID, rpcErr.Code, rpcErr.Message)
+		} else {
+			err = framing.WriteMessage(s.out, response{JSONRPC: "2.0", ID: req.ID, Result: result})
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+var errExitWithoutShutdown = errors.New("lsp: exit before shutdown")
+
+func (s *Server) replyError(id *json.RawMessage, code int, message string) error {
+	return framing.WriteMessage(s.out, errorResponse{
+		JSONRPC: "2.0",
+		ID:      id,
+		Error:   &responseError{Code: code, Message: message},
+	})
+}
+
+func (s *Server) notify(method string, params interface{}) error {
+	return framing.WriteMessage(s.out, notification{JSONRPC: "2.0", Method: method, Params: params})
+}
+
+// handle runs the handler of req and returns its result. Errors to report to
+// the client are *responseError values; any other error means the output
+// failed.
+func (s *Server) handle(req *request) (interface{}, error) {
+	switch req.Method {
+	case "initialize":
+		return InitializeResult{
+			Capabilities: ServerCapabilities{
+				TextDocumentSync:           syncFull,
+				DefinitionProvider:         true,
+				ReferencesProvider:         true,
+				HoverProvider:              true,
+				CompletionProvider:         CompletionOptions{},
+				DocumentSymbolProvider:     true,
+				DocumentFormattingProvider: true,
+			},
+			ServerInfo: ServerInfo{Name: "monkey"},
+		}, nil
+
+	case "initialized":
+		return nil, nil
+
+	case "shutdown":
+		s.shutdown = true
+		return nil, nil
+
+	case "textDocument/didOpen":
+		var params DidOpenTextDocumentParams
+		if err := decode(req, &params); err != nil {
+			return nil, err
+		}
+		item := params.TextDocument
+		return nil, s.update(newDocument(item.URI, item.Version, item.Text))
+
+	case "textDocument/didChange":
+		var params DidChangeTextDocumentParams
+		if err := decode(req, &params); err != nil {
+			return nil, err
+		}
+		if len(params.ContentChanges) == 0 {
+			return nil, nil
+		}
+		text := params.ContentChanges[len(params.ContentChanges)-1].Text
+		return nil, s.update(newDocument(params.TextDocument.URI, params.TextDocument.Version, text))
+
+	case "textDocument/didClose":
+		var params DidCloseTextDocumentParams
+		if err := decode(req, &params); err != nil {
+			return nil, err
+		}
+		delete(s.documents, params.TextDocument.URI)
+		return nil, s.notify("textDocument/publishDiagnostics", PublishDiagnosticsParams{
+			URI:         params.TextDocument.URI,
+			Diagnostics: []Diagnostic{},
+		})
+
+	case "textDocument/definition":
+		return s.withPosition(req, s.definition)
+	case "textDocument/hover":
+		return s.withPosition(req, s.hover)
+	case "textDocument/completion":
+		return s.withPosition(req, s.completion)
+
+	case "textDocument/references":
+		var params ReferenceParams
+		if err := decode(req, &params); err != nil {
+			return nil, err
+		}
+		d, ok := s.documents[params.TextDocument.URI]
+		if !ok {
+			return nil, nil
+		}
+		return s.references(d, d.tokenPosition(params.Position), params.Context.IncludeDeclaration), nil
+
+	case "textDocument/documentSymbol":
+		var params DocumentSymbolParams
+		if err := decode(req, &params); err != nil {
+			return nil, err
+		}
+		d, ok := s.documents[params.TextDocument.URI]
+		if !ok {
+			return nil, nil
+		}
+		return d.symbols(d.program.Statements), nil
+
+	case "textDocument/formatting":
+		var params DocumentFormattingParams
+		if err := decode(req, &params); err != nil {
+			return nil, err
+		}
+		d, ok := s.documents[params.TextDocument.URI]
+		if !ok || !d.parsed {
+			return nil, nil
+		}
+		formatted, err := d.format(params.Options)
+		if err != nil || formatted == d.text {
+			return []TextEdit{}, nil
+		}
+		return []TextEdit{{
+			Range:   Range{Start: Position{}, End: d.position(d.end())},
+			NewText: formatted,
+		}}, nil
+	}
+
+	if req.isNotification() {
+		return nil, nil
+	}
+	return nil, &responseError{Code: codeMethodNotFound, Message: "method not found: " + req.Method}
+}
+
+func decode(req *request, params interface{}) error {
+	if err := json.Unmarshal(req.Params, params); err != nil {
+		return &responseError{Code: codeInvalidParams, Message: err.Error()}
+	}
+	return nil
+}
+
+// update replaces a document by a new version and publishes its
+// diagnostics.
+func (s *Server) update(d *document) error {
+	s.documents[d.uri] = d
+	return s.notify("textDocument/publishDiagnostics", PublishDiagnosticsParams{
+		URI:         d.uri,
+		Version:     d.version,
+		Diagnostics: d.diagnostics,
+	})
+}
+
+// withPosition decodes the parameters of a request about a position in a
+// document and passes them to handler. Requests about unknown documents get
+// a null result.
+func (s *Server) withPosition(
+	req *request,
+	handler func(d *document, pos token.Position) interface{},
+) (interface{}, error) {
+	var params TextDocumentPositionParams
+	if err := decode(req, &params); err != nil {
+		return nil, err
+	}
+	d, ok := s.documents[params.TextDocument.URI]
+	if !ok {
+		return nil, nil
+	}
+	return handler(d, d.tokenPosition(params.Position)), nil
+}
+
+func (s *Server) definition(d *document, pos token.Position) interface{} {
+	ident := d.identifierAt(pos)
+	if ident == nil {
+		return nil
+	}
+	decl := d.declarationOf(ident)
+	if decl == nil {
+		return nil
+	}
+	return Location{URI: d.uri, Range: d.tokenRange(decl.ident.Token.Position)}
+}
+
+func (s *Server) references(d *document, pos token.Position, includeDeclaration bool) []Location {
+	locations := []Location{}
+
+	ident := d.identifierAt(pos)
+	if ident == nil {
+		return locations
+	}
+	def := d.definitions[ident]
+	for _, ref := range d.references(ident) {
+		if ref == def && !includeDeclaration {
+			continue
+		}
+		locations = append(locations, Location{URI: d.uri, Range: d.tokenRange(ref.Token.Position)})
+	}
+	return locations
+}
+
+func (s *Server) hover(d *document, pos token.Position) interface{} {
+	ident := d.identifierAt(pos)
+	if ident == nil {
+		return nil
+	}
+
+	var value string
+	if decl := d.declarationOf(ident); decl != nil {
+		value = "```monkey\n" + decl.header + "\n```\n\n" + decl.description + " `" + decl.ident.Value + "`"
+	} else if ident.Scope == ast.BuiltinScope {
+		value = "builtin function `" + ident.Value + "`"
+	} else {
+		return nil
+	}
+
+	return Hover{
+		Contents: MarkupContent{Kind: "markdown", Value: value},
+		Range:    d.tokenRange(ident.Token.Position),
+	}
+}
+
+// completion offers the names in scope at pos, then the builtins, then the
+// keywords. Clients filter the list by what has been typed.
+func (s *Server) completion(d *document, pos token.Position) interface{} {
+	items := []CompletionItem{}
+	seen := map[string]bool{}
+
+	add := func(item CompletionItem) {
+		if !seen[item.Label] {
+			seen[item.Label] = true
+			items = append(items, item)
+		}
+	}
+
+	for _, decl := range d.visible(pos) {
+		add(CompletionItem{Label: decl.ident.Value, Kind: decl.kind, Detail: decl.header})
+	}
+	for _, name := range evaluator.BuiltinNames() {
+		add(CompletionItem{Label: name, Kind: CompletionFunction, Detail: "builtin function"})
+	}
+	for _, keyword := range token.Keywords() {
+		add(CompletionItem{Label: keyword, Kind: CompletionKeyword})
+	}
+	return items
+}
+
+// symbols lists the bindings declared by statements, with the lets of
+// function bodies nested under the function's name.
+func (d *document) symbols(statements []ast.Statement) []DocumentSymbol {
+	symbols := []DocumentSymbol{}
+
+	for _, stmt := range statements {
+		var let *ast.LetStatement
+		switch stmt := stmt.(type) {
+		case *ast.LetStatement:
+			let = stmt
+		case *ast.ExportStatement:
+			let = stmt.Statement
+		case *ast.ImportStatement:
+			// The path is not a node of its own, and the name is only in
+			// the source when it follows `as`.
+			start, end := d.extent(stmt)
+			if i, ok := d.tokenIndex[start]; ok && i+1 < len(d.tokens) {
+				end = d.tokens[i+1].End()
+			}
+			selection := Range{Start: d.position(start), End: d.position(end)}
+			if stmt.Name.Token.Position.IsValid() {
+				selection = d.tokenRange(stmt.Name.Token.Position)
+				end = stmt.Name.Token.End()
+			}
+
+			symbols = append(symbols, DocumentSymbol{
+				Name:           stmt.Name.Value,
+				Detail:         stmt.Path,
+				Kind:           SymbolModule,
+				Range:          Range{Start: d.position(start), End: d.position(end)},
+				SelectionRange: selection,
+			})
+			continue
+		default:
+			continue
+		}
+
+		kind := SymbolVariable
+		var children []DocumentSymbol
+		detail := ""
+		switch value := let.Value.(type) {
+		case *ast.FunctionLiteral:
+			kind = SymbolFunction
+			detail = functionHeader(value)
+			children = d.symbols(value.Body.Statements)
+		case *ast.MacroLiteral:
+			kind = SymbolFunction
+			detail = macroHeader(value)
+			children = d.symbols(value.Body.Statements)
+		}
+
+		for _, ident := range ast.PatternIdentifiers(let.Name) {
+			symbols = append(symbols, DocumentSymbol{
+				Name:           ident.Value,
+				Detail:         detail,
+				Kind:           kind,
+				Range:          d.nodeRange(stmt),
+				SelectionRange: d.tokenRange(ident.Token.Position),
+				Children:       children,
+			})
+		}
+	}
+
+	return symbols
+}
@@ -0,0 +1,415 @@
+package lsp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"monkey/ast"
+	"monkey/framing"
+	"monkey/token"
+	"reflect"
+	"testing"
+)
+
+const uri = "file:///main.monkey"
+
+// session runs a server on the given messages and returns what it wrote:
+// the responses by request id, and the notifications in order.
+func session(t *testing.T, messages ...interface{}) (map[int]json.RawMessage, []notification) {
+	t.Helper()
+
+	var in bytes.Buffer
+	for _, m := range messages {
+		if err := framing.WriteMessage(&in, m); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var out bytes.Buffer
+	if err := NewServer(&in, &out).Serve(); err != nil {
+		t.Fatalf("Serve: %v", err)
+	}
+
+	responses := map[int]json.RawMessage{}
+	notifications := []notification{}
+	r := bufio.NewReader(&out)
+	for {
+		body, err := framing.ReadMessage(r)
+		if err != nil {
+			break
+		}
+
+		var msg struct {
+			ID     *int            `json:"id"`
+			Method string          `json:"method"`
+			Params json.RawMessage `json:"params"`
+			Result json.RawMessage `json:"result"`
+			Error  json.RawMessage `json:"error"`
+		}
+		if err := json.Unmarshal(body, &msg); err != nil {
+			t.Fatalf("invalid message %s: %v", body, err)
+		}
+		switch {
+		case msg.ID == nil:
+			notifications = append(notifications, notification{Method: msg.Method, Params: msg.Params})
+		case msg.Error != nil:
+			responses[*msg.ID] = msg.Error
+		default:
+			responses[*msg.ID] = msg.Result
+		}
+	}
+	return responses, notifications
+}
+
+func call(id int, method string, params interface{}) interface{} {
+	return map[string]interface{}{"jsonrpc": "2.0", "id": id, "method": method, "params": params}
+}
+
+func notice(method string, params interface{}) interface{} {
+	return map[string]interface{}{"jsonrpc": "2.0", "method": method, "params": params}
+}
+
+func open(text string) interface{} {
+	return notice("textDocument/didOpen", map[string]interface{}{
+		"textDocument": TextDocumentItem{URI: uri, LanguageID: "monkey", Version: 1, Text: text},
+	})
+}
+
+func at(line, character int) map[string]interface{} {
+	return map[string]interface{}{
+		"textDocument": TextDocumentIdentifier{URI: uri},
+		"position":     Position{Line: line, Character: character},
+	}
+}
+
+// run opens text, sends one request and decodes its result into result.
+func run(t *testing.T, text, method string, params, result interface{}) {
+	t.Helper()
+
+	responses, _ := session(t, open(text), call(1, method, params))
+	if err := json.Unmarshal(responses[1], result); err != nil {
+		t.Fatalf("cannot decode %s: %v", responses[1], err)
+	}
+}
+
+func rng(startLine, startChar, endLine, endChar int) Range {
+	return Range{Start: Position{startLine, startChar}, End: Position{endLine, endChar}}
+}
+
+func TestLifecycle(t *testing.T) {
+	responses, _ := session(t,
+		call(1, "initialize", map[string]interface{}{}),
+		notice("initialized", map[string]interface{}{}),
+		call(2, "textDocument/unknown", map[string]interface{}{}),
+		call(3, "shutdown", nil),
+		notice("exit", nil),
+		call(4, "shutdown", nil),
+	)
+
+	var init InitializeResult
+	if err := json.Unmarshal(responses[1], &init); err != nil {
+		t.Fatal(err)
+	}
+	if c := init.Capabilities; c.TextDocumentSync != syncFull || !c.DefinitionProvider || !c.DocumentFormattingProvider {
+		t.Errorf("wrong capabilities: %+v", c)
+	}
+
+	var rpcErr responseError
+	if err := json.Unmarshal(responses[2], &rpcErr); err != nil || rpcErr.Code != codeMethodNotFound {
+		t.Errorf("expected a method not found error, got %s", responses[2])
+	}
+	if string(responses[3]) != "null" {
+		t.Errorf("expected a null shutdown result, got %s", responses[3])
+	}
+	if _, ok := responses[4]; ok {
+		t.Errorf("server kept running after exit")
+	}
+
+	var out bytes.Buffer
+	var in bytes.Buffer
+	framing.WriteMessage(&in, notice("exit", nil))
+	if err := NewServer(&in, &out).Serve(); err == nil {
+		t.Errorf("expected an error on exit without shutdown")
+	}
+}
+
+func TestDiagnostics(t *testing.T) {
+	change := notice("textDocument/didChange", map[string]interface{}{
+		"textDocument":   VersionedTextDocumentIdentifier{URI: uri, Version: 2},
+		"contentChanges": []TextDocumentContentChangeEvent{{Text: "let x = 1;\nx"}},
+	})
+	closed := notice("textDocument/didClose", map[string]interface{}{
+		"textDocument": TextDocumentIdentifier{URI: uri},
+	})
+
+	_, notifications := session(t, open("let x = 1 + \"a\";\nputs(y)\nlet f = function(a) { 1 };"), change, closed)
+
+	if len(notifications) != 3 {
+		t.Fatalf("expected 3 notifications, got %d", len(notifications))
+	}
+
+	var published PublishDiagnosticsParams
+	if err := json.Unmarshal(notifications[0].Params.(json.RawMessage), &published); err != nil {
+		t.Fatal(err)
+	}
+	expected := []Diagnostic{
+		{Range: rng(0, 12, 0, 15), Severity: SeverityError, Source: "monkey", Message: "type error: expected int, got string"},
+		{Range: rng(1, 5, 1, 6), Severity: SeverityError, Source: "monkey", Message: "undefined identifier y"},
+		{Range: rng(2, 17, 2, 18), Severity: SeverityWarning, Source: "monkey", Message: "parameter a is never used"},
+	}
+	if !reflect.DeepEqual(published.Diagnostics, expected) {
+		t.Errorf("wrong diagnostics.\nexpected %+v\n     got %+v", expected, published.Diagnostics)
+	}
+
+	for i, version := range []int{2, 0} {
+		if err := json.Unmarshal(notifications[i+1].Params.(json.RawMessage), &published); err != nil {
+			t.Fatal(err)
+		}
+		if published.Version != version || len(published.Diagnostics) != 0 {
+			t.Errorf("expected no diagnostics for version %d, got %+v", version, published)
+		}
+	}
+}
+
+func TestIncompleteProgram(t *testing.T) {
+	text := "let n = 1;\nlet f = function(x) { x + };\n"
+
+	var items []CompletionItem
+	run(t, text, "textDocument/completion", at(1, 25), &items)
+	if len(items) == 0 || items[0].Label != "n" {
+		t.Errorf("expected the complete statements to be offered, got %+v", items)
+	}
+}
+
+func TestParseErrorDiagnostics(t *testing.T) {
+	_, notifications := session(t, open("let f = function(x) { x };\nlet y = ;\nf(1)"))
+
+	var published PublishDiagnosticsParams
+	if err := json.Unmarshal(notifications[0].Params.(json.RawMessage), &published); err != nil {
+		t.Fatal(err)
+	}
+	expected := []Diagnostic{
+		{Range: rng(1, 8, 1, 9), Severity: SeverityError, Source: "monkey", Message: "No prefix parse function for ; found"},
+	}
+	if !reflect.DeepEqual(published.Diagnostics, expected) {
+		t.Errorf("wrong diagnostics.\nexpected %+v\n     got %+v", expected, published.Diagnostics)
+	}
+}
+
+const program = `let add = function(a, b) {
+  let sum = a + b;
+  sum
+};
+let total = add(1, 2);
+for (i in range(total)) {
+  puts(add(i, total))
+}
+`
+
+func TestDefinition(t *testing.T) {
+	tests := []struct {
+		line, character int
+		expected        *Range
+	}{
+		{4, 13, &Range{Start: Position{0, 4}, End: Position{0, 7}}},   // add
+		{4, 15, &Range{Start: Position{0, 4}, End: Position{0, 7}}},   // end of add
+		{2, 3, &Range{Start: Position{1, 6}, End: Position{1, 9}}},    // sum
+		{1, 12, &Range{Start: Position{0, 19}, End: Position{0, 20}}}, // a
+		{6, 11, &Range{Start: Position{5, 5}, End: Position{5, 6}}},   // i
+		{4, 4, &Range{Start: Position{4, 4}, End: Position{4, 9}}},    // total itself
+		{6, 2, nil}, // puts
+		{3, 0, nil},
+	}
+
+	for _, tt := range tests {
+		var location *Location
+		run(t, program, "textDocument/definition", at(tt.line, tt.character), &location)
+
+		switch {
+		case tt.expected == nil && location != nil:
+			t.Errorf("%d:%d: expected no definition, got %+v", tt.line, tt.character, location)
+		case tt.expected != nil && (location == nil || location.URI != uri || location.Range != *tt.expected):
+			t.Errorf("%d:%d: expected %+v, got %+v", tt.line, tt.character, tt.expected, location)
+		}
+	}
+}
+
+func TestReferences(t *testing.T) {
+	params := at(4, 5)
+	params["context"] = map[string]bool{"includeDeclaration": true}
+
+	var locations []Location
+	run(t, program, "textDocument/references", params, &locations)
+
+	expected := []Range{rng(4, 4, 4, 9), rng(5, 16, 5, 21), rng(6, 14, 6, 19)}
+	ranges := []Range{}
+	for _, l := range locations {
+		ranges = append(ranges, l.Range)
+	}
+	if !reflect.DeepEqual(ranges, expected) {
+		t.Errorf("wrong references.\nexpected %v\n     got %v", expected, ranges)
+	}
+
+	params["context"] = map[string]bool{"includeDeclaration": false}
+	run(t, program, "textDocument/references", params, &locations)
+	if len(locations) != 2 {
+		t.Errorf("expected the declaration to be left out, got %v", locations)
+	}
+}
+
+func TestHover(t *testing.T) {
+	tests := []struct {
+		line, character int
+		expected        string
+	}{
+		{4, 13, "```monkey\nlet add = function(a, b) { ... }\n```\n\nlet binding `add`"},
+		{2, 3, "```monkey\nlet sum = (a + b)\n```\n\nlet binding `sum`"},
+		{1, 12, "```monkey\nfunction(a, b) { ... }\n```\n\nparameter `a`"},
+		{6, 11, "```monkey\nfor (i in range(total))\n```\n\nloop variable `i`"},
+		{6, 3, "builtin function `puts`"},
+	}
+
+	for _, tt := range tests {
+		var hover Hover
+		run(t, program, "textDocument/hover", at(tt.line, tt.character), &hover)
+
+		if hover.Contents.Value != tt.expected {
+			t.Errorf("%d:%d: wrong hover.\nexpected %q\n     got %q", tt.line, tt.character, tt.expected, hover.Contents.Value)
+		}
+	}
+}
+
+func TestCompletion(t *testing.T) {
+	labels := func(line, character int) []string {
+		var items []CompletionItem
+		run(t, program, "textDocument/completion", at(line, character), &items)
+
+		names := []string{}
+		for _, item := range items {
+			if item.Kind == CompletionKeyword || item.Detail == "builtin function" {
+				continue
+			}
+			names = append(names, item.Label)
+		}
+		return names
+	}
+
+	// Inside the function, its locals come first; later globals are in
+	// scope because the body runs after they are defined.
+	if names, expected := labels(2, 2), []string{"a", "b", "sum", "add", "total", "i"}; !reflect.DeepEqual(names, expected) {
+		t.Errorf("wrong names in the function. expected %v, got %v", expected, names)
+	}
+	if names, expected := labels(4, 0), []string{"add"}; !reflect.DeepEqual(names, expected) {
+		t.Errorf("wrong names before total. expected %v, got %v", expected, names)
+	}
+	if names, expected := labels(6, 2), []string{"add", "total", "i"}; !reflect.DeepEqual(names, expected) {
+		t.Errorf("wrong names in the loop. expected %v, got %v", expected, names)
+	}
+
+	var items []CompletionItem
+	run(t, program, "textDocument/completion", at(0, 0), &items)
+	found := map[string]int{}
+	for _, item := range items {
+		found[item.Label] = item.Kind
+	}
+	if found["len"] != CompletionFunction || found["while"] != CompletionKeyword {
+		t.Errorf("expected builtins and keywords, got %v", found)
+	}
+}
+
+func TestDocumentSymbols(t *testing.T) {
+	var symbols []DocumentSymbol
+	run(t, program+"import \"lib\";\nimport \"lib\" as util;\n", "textDocument/documentSymbol", map[string]interface{}{
+		"textDocument": TextDocumentIdentifier{URI: uri},
+	}, &symbols)
+
+	expected := []DocumentSymbol{
+		{
+			Name: "add", Detail: "function(a, b) { ... }", Kind: SymbolFunction,
+			Range: rng(0, 0, 3, 1), SelectionRange: rng(0, 4, 0, 7),
+			Children: []DocumentSymbol{
+				{Name: "sum", Kind: SymbolVariable, Range: rng(1, 2, 1, 17), SelectionRange: rng(1, 6, 1, 9)},
+			},
+		},
+		{Name: "total", Kind: SymbolVariable, Range: rng(4, 0, 4, 21), SelectionRange: rng(4, 4, 4, 9)},
+		{Name: "lib", Detail: "lib", Kind: SymbolModule, Range: rng(8, 0, 8, 12), SelectionRange: rng(8, 0, 8, 12)},
+		{Name: "util", Detail: "lib", Kind: SymbolModule, Range: rng(9, 0, 9, 20), SelectionRange: rng(9, 16, 9, 20)},
+	}
+	if !reflect.DeepEqual(symbols, expected) {
+		t.Errorf("wrong symbols.\nexpected %+v\n     got %+v", expected, symbols)
+	}
+}
+
+func TestFormatting(t *testing.T) {
+	format := func(text string, options FormattingOptions) []TextEdit {
+		var edits []TextEdit
+		run(t, text, "textDocument/formatting", map[string]interface{}{
+			"textDocument": TextDocumentIdentifier{URI: uri},
+			"options":      options,
+		}, &edits)
+		return edits
+	}
+
+	input := "let  add=function(a,b){\nlet s=a+b;\n\n\n  s}\nlet h={\"a\":[1,-2]}\nif(!true){puts(h[\"a\"][0] - -1)}else{}\n"
+	edits := format(input, FormattingOptions{TabSize: 2, InsertSpaces: true})
+
+	expected := "let add = function(a, b) {\n  let s = a + b;\n\n  s }\nlet h = {\"a\": [1, -2]}\nif (!true) { puts(h[\"a\"][0] - -1) } else {}\n"
+	if len(edits) != 1 || edits[0].NewText != expected {
+		t.Fatalf("wrong formatting.\nexpected %q\n     got %+v", expected, edits)
+	}
+	if edits[0].Range != rng(0, 0, 7, 0) {
+		t.Errorf("edit does not replace the document: %+v", edits[0].Range)
+	}
+
+	if edits := format(expected, FormattingOptions{TabSize: 2, InsertSpaces: true}); len(edits) != 0 {
+		t.Errorf("formatting is not stable: %+v", edits)
+	}
+	if edits := format("f(function() {\n1\n})", FormattingOptions{}); len(edits) != 1 || edits[0].NewText != "f(function() {\n\t1\n})\n" {
+		t.Errorf("wrong formatting with tabs: %+v", edits)
+	}
+	if edits := format("let x = ;", FormattingOptions{}); edits != nil {
+		t.Errorf("expected no edits for a program that does not parse, got %+v", edits)
+	}
+	if edits := format(`let a = "x`, FormattingOptions{}); len(edits) != 0 {
+		t.Errorf("expected no edits for an unterminated string, got %+v", edits)
+	}
+}
+
+func TestPositionsCountUTF16(t *testing.T) {
+	d := newDocument(uri, 1, "let s = \"é😀\"; s")
+
+	pos := d.position(d.program.Statements[1].(*ast.ExpressionStatement).Token.Position)
+	if pos != (Position{Line: 0, Character: 15}) {
+		t.Errorf("wrong position: %+v", pos)
+	}
+	if back := d.tokenPosition(pos); back.Column != 19 {
+		t.Errorf("wrong column: %d", back.Column)
+	}
+}
+
+func TestPositionsOutOfRange(t *testing.T) {
+	d := newDocument(uri, 1, "let a = 1;\na")
+
+	tests := []struct {
+		pos      Position
+		expected token.Position
+	}{
+		{Position{Line: -1, Character: -5}, token.Position{Line: 1, Column: 1}},
+		{Position{Line: 1, Character: -1}, token.Position{Line: 2, Column: 1}},
+		{Position{Line: 0, Character: 99}, token.Position{Line: 1, Column: 11}},
+		{Position{Line: 9, Character: 0}, token.Position{Line: 2, Column: 2}},
+	}
+
+	for _, tt := range tests {
+		if got := d.tokenPosition(tt.pos); got.Line != tt.expected.Line || got.Column != tt.expected.Column {
+			t.Errorf("%+v: expected %d:%d, got %d:%d", tt.pos, tt.expected.Line, tt.expected.Column, got.Line, got.Column)
+		}
+	}
+
+	// A request at a negative position is answered, not a crash.
+	var location *Location
+	run(t, program, "textDocument/definition", at(-1, -1), &location)
+	if location != nil {
+		t.Errorf("expected no definition, got %+v", location)
+	}
+}
@@ -1,13 +1,134 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
+	"flag"
 	"fmt"
+	"io"
+	"monkey/ast"
+	"monkey/coverage"
+	"monkey/dap"
+	"monkey/debugger"
+	"monkey/evaluator"
+	"monkey/lexer"
+	"monkey/lsp"
+	"monkey/object"
+	"monkey/parser"
+	"monkey/profiler"
 	"monkey/repl"
+	"monkey/resolver"
+	"monkey/testrunner"
+	"monkey/tracer"
+	"monkey/types"
 	"os"
 	"os/user"
+	"regexp"
 )
 
+const usage = `usage: monkey [command] [arguments]
+
+Without a command, monkey starts an interactive session.
+
+commands:
+	run [flags] <file> [arguments]
+	              evaluate a Monkey source file, passing it arguments;
+	              flags: -allow capabilities (grant the builtins access to
+	              any of filesystem, clock, random, env, process, or all;
+	              imports from outside the file's directory, or of
+	              files other than .monkey ones, need filesystem),
+	              -seed n (make time and random numbers reproducible),
+	              -max-memory bytes (fail once the program's values in use
+	              take up more than this),
+	              -memstats (print the most memory the program's values
+	              took up at once),
+	              -profile (print where time and memory went), -sample
+	              interval (profile by sampling the call stack every
+	              interval, such as 1ms, instead of timing every call),
+	              -folded file (write the profile's call stacks in the
+	              folded format that flame graph tools such as
+	              flamegraph.pl and speedscope read; there is no pprof
+	              output), -cover file (write a coverage profile)
+	check <file>  report the type errors and warnings of a file without
+	              running it
+	debug [flags] <file>
+	              run a file under a debugger with a gdb-like prompt;
+	              flags: -allow, -seed (as for run)
+	ast <file>    print the syntax tree of a file as JSON
+	tokens <file> print the tokens of a file as JSON
+	lsp           start a language server on stdin and stdout
+	dap           start a debug adapter on stdin and stdout
+	trace [flags] <file>
+	              run a file, printing its calls to standard error;
+	              flags: -chrome file (write a trace_event file instead),
+	              -builtins, -allow, -seed (as for run)
+	test [flags] [paths]
+	              run the tests in the *_test.monkey files under paths
+	              (default .); flags: -run regexp, -junit file, -v,
+	              -cover file (write a coverage profile of the code the
+	              tests run), -allow, -seed (as for run; imports from
+	              outside a test file's directory need -allow filesystem)
+	cover [flags] <profiles>
+	              merge coverage profiles and print their line and branch
+	              coverage; flags: -html file (write annotated source),
+	              -lcov file (write an LCOV tracefile)
+`
+
 func main() {
+	if len(os.Args) < 2 {
+		startRepl()
+		return
+	}
+
+	command := os.Args[1]
+	if command == "run" {
+		os.Exit(runFile(os.Args[2:]))
+	}
+	if command == "test" {
+		os.Exit(runTests(os.Args[2:]))
+	}
+	if command == "trace" {
+		os.Exit(traceFile(os.Args[2:]))
+	}
+	if command == "debug" {
+		os.Exit(debugFile(os.Args[2:]))
+	}
+	if command == "cover" {
+		os.Exit(reportCoverage(os.Args[2:]))
+	}
+	if command == "lsp" && len(os.Args) == 2 {
+		if err := lsp.NewServer(os.Stdin, os.Stdout).Serve(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+	if command == "dap" && len(os.Args) == 2 {
+		if err := dap.NewServer(os.Stdin, os.Stdout).Serve(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+	if len(os.Args) != 3 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	switch command {
+	case "check":
+		os.Exit(checkFile(os.Args[2], os.Stdout, os.Stderr))
+	case "ast":
+		os.Exit(printAST(os.Args[2]))
+	case "tokens":
+		os.Exit(printTokens(os.Args[2]))
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+}
+
+func startRepl() {
 	user, err := user.Current()
 	if err != nil {
 		panic(err)
@@ -17,3 +138,443 @@ func main() {
 	fmt.Print("Feel free to enter any commands...\n")
 	repl.Start(os.Stdin, os.Stdout)
 }
+
+// runFile evaluates the file named by args, with the capabilities and
+// arguments they give it, profiling it or recording its coverage if asked
+// to, and returns the process exit code.
+func runFile(args []string) int {
+	flags := flag.NewFlagSet("run", flag.ContinueOnError)
+	profile := flags.Bool("profile", false, "print a profile of the run to standard error")
+	sample := flags.Duration("sample", 0, "profile by sampling the call stack every `interval`")
+	folded := flags.String("folded", "", "write the profile's call stacks to `file` in folded format, for flame graphs")
+	cover := flags.String("cover", "", "write a coverage profile of the run to `file`")
+	sandbox := sandboxFlags(flags)
+	maxMemory := flags.Int64("max-memory", 0, "fail once the program's values in use take up more than `bytes`")
+	memstats := flags.Bool("memstats", false, "print the most memory the program's values took up at once")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() < 1 {
+		fmt.Fprint(os.Stderr, usage)
+		return 2
+	}
+	prepare, err := sandbox()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	in := evaluator.New()
+	in.Warnings = os.Stderr
+	in.Args = flags.Args()[1:]
+	prepare(in)
+	in.MemoryLimit = *maxMemory
+	var p *profiler.Profiler
+	switch {
+	case (*profile || *folded != "") && *sample > 0:
+		p = profiler.NewSampling(in, *sample)
+	case *profile || *folded != "":
+		p = profiler.New(in)
+	}
+	var covered *coverage.Profile
+	if *cover != "" {
+		covered = coverage.NewProfile()
+		covered.Record(in)
+	}
+
+	code := 0
+	evaluated := in.EvalFile(flags.Arg(0), object.NewEnvironment())
+	if err, ok := evaluated.(*object.Error); ok {
+		fmt.Fprintln(os.Stderr, err.Inspect())
+		code = 1
+	}
+	if *memstats {
+		fmt.Fprintf(os.Stderr, "peak memory: %d bytes\n", in.Memory().Peak)
+	}
+	if covered != nil {
+		if err := writeFile(*cover, covered.Write); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	}
+	if p == nil {
+		return code
+	}
+
+	p.Stop()
+	if *profile {
+		fmt.Fprintln(os.Stderr)
+		p.WriteFlat(os.Stderr)
+		fmt.Fprintln(os.Stderr)
+		p.WriteCallGraph(os.Stderr)
+	}
+	if *folded != "" {
+		f, err := os.Create(*folded)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		err = p.WriteFolded(f)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	}
+	return code
+}
+
+// traceFile runs the file named by args under a tracer and returns the
+// process exit code.
+func traceFile(args []string) int {
+	flags := flag.NewFlagSet("trace", flag.ContinueOnError)
+	chrome := flags.String("chrome", "", "write a Chrome trace_event JSON `file` instead of a call trace")
+	builtins := flags.Bool("builtins", false, "trace calls of builtins too")
+	sandbox := sandboxFlags(flags)
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 {
+		fmt.Fprint(os.Stderr, usage)
+		return 2
+	}
+	prepare, err := sandbox()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	in := evaluator.New()
+	in.Warnings = os.Stderr
+	prepare(in)
+	var chromeTrace *tracer.ChromeTrace
+	if *chrome != "" {
+		chromeTrace = tracer.NewChromeTrace()
+		chromeTrace.Builtins = *builtins
+		in.AddHook(chromeTrace)
+	} else {
+		callTrace := tracer.NewCallTrace(os.Stderr)
+		callTrace.Builtins = *builtins
+		in.AddHook(callTrace)
+	}
+
+	code := 0
+	evaluated := in.EvalFile(flags.Arg(0), object.NewEnvironment())
+	if err, ok := evaluated.(*object.Error); ok {
+		fmt.Fprintln(os.Stderr, err.Inspect())
+		code = 1
+	}
+
+	if chromeTrace != nil {
+		f, err := os.Create(*chrome)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		err = chromeTrace.Write(f)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	}
+	return code
+}
+
+// debugFile runs the file named by args under the debugger's prompt and
+// returns the process exit code.
+func debugFile(args []string) int {
+	flags := flag.NewFlagSet("debug", flag.ContinueOnError)
+	sandbox := sandboxFlags(flags)
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 {
+		fmt.Fprint(os.Stderr, usage)
+		return 2
+	}
+	prepare, err := sandbox()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	return debugger.Run(flags.Arg(0), os.Stdin, os.Stdout, prepare)
+}
+
+// sandboxFlags adds the -allow and -seed flags to flags. Once they are
+// parsed, the function it returns gives what grants an interpreter the
+// capabilities they name and makes it deterministic if they ask for it, or
+// an error if -allow names no capability.
+func sandboxFlags(flags *flag.FlagSet) func() (func(*evaluator.Interpreter), error) {
+	allow := flags.String("allow", "", "grant the comma-separated `capabilities` to the builtins")
+	seed := flags.Int64("seed", 0, "run deterministically, drawing random numbers from `n`")
+
+	return func() (func(*evaluator.Interpreter), error) {
+		capabilities, err := evaluator.ParseCapabilities(*allow)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -allow: %s", err)
+		}
+		seeded := false
+		flags.Visit(func(f *flag.Flag) {
+			seeded = seeded || f.Name == "seed"
+		})
+
+		return func(in *evaluator.Interpreter) {
+			in.Grant(capabilities)
+			if seeded {
+				in.Deterministic(*seed)
+			}
+		}, nil
+	}
+}
+
+// checkFile prints the name and type errors of the file at path, with their
+// locations, and the parser's and the resolver's warnings about it to
+// stdout, and returns the process exit code, which warnings do not affect.
+// Errors that stop the check go to stderr.
+func checkFile(path string, stdout, stderr io.Writer) int {
+	source, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+
+	p := parser.New(lexer.New(string(source)))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		for _, msg := range p.Errors() {
+			fmt.Fprintf(stderr, "%s: %s\n", path, msg)
+		}
+		return 1
+	}
+	p.WriteWarnings(stdout, path)
+
+	expanded, expandErr := evaluator.New().Expand(program, object.NewEnvironment())
+	if expandErr != nil {
+		fmt.Fprintf(stderr, "%s: %s\n", path, expandErr.Inspect())
+		return 1
+	}
+
+	failed := false
+	for _, d := range resolver.New(evaluator.BuiltinNames()).Resolve(expanded) {
+		fmt.Fprintf(stdout, "%s:%s\n", path, d)
+		// Warnings are reported but do not fail the check.
+		if d.Severity == resolver.Error {
+			failed = true
+		}
+	}
+
+	_, typeErrors := types.NewChecker().Check(expanded)
+	for _, e := range typeErrors {
+		fmt.Fprintf(stdout, "%s:%s\n", path, e)
+		failed = true
+	}
+
+	if failed {
+		return 1
+	}
+	return 0
+}
+
+// runTests runs the Monkey tests selected by args, reports them, and returns
+// the process exit code.
+func runTests(args []string) int {
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	run := flags.String("run", "", "run only the tests whose names match `regexp`")
+	junit := flags.String("junit", "", "also write a JUnit XML report to `file`")
+	verbose := flags.Bool("v", false, "list the tests that pass too")
+	cover := flags.String("cover", "", "write a coverage profile of the tests to `file`")
+	sandbox := sandboxFlags(flags)
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	sandboxed, err := sandbox()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	var filter *regexp.Regexp
+	if *run != "" {
+		var err error
+		if filter, err = regexp.Compile(*run); err != nil {
+			fmt.Fprintf(os.Stderr, "invalid -run: %s\n", err)
+			return 2
+		}
+	}
+
+	paths := flags.Args()
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+	files, err := testrunner.Discover(paths...)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	prepare := []func(*evaluator.Interpreter){sandboxed}
+	covered := coverage.NewProfile()
+	if *cover != "" {
+		prepare = append(prepare, covered.Record)
+	}
+
+	failed := false
+	results := []testrunner.Result{}
+	for _, file := range files {
+		fileResults, err := testrunner.RunFile(file, filter, os.Stderr, prepare...)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			failed = true
+			continue
+		}
+		results = append(results, fileResults...)
+	}
+
+	testrunner.WriteText(os.Stdout, results, *verbose)
+
+	if *cover != "" {
+		if err := writeFile(*cover, covered.Write); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	}
+
+	if *junit != "" {
+		f, err := os.Create(*junit)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		err = testrunner.WriteJUnit(f, results)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	}
+
+	if _, failures := testrunner.Count(results); failed || failures > 0 {
+		return 1
+	}
+	return 0
+}
+
+// reportCoverage merges the coverage profiles named by args, reports them,
+// and returns the process exit code.
+func reportCoverage(args []string) int {
+	flags := flag.NewFlagSet("cover", flag.ContinueOnError)
+	html := flags.String("html", "", "write the source annotated with its coverage to `file`")
+	lcov := flags.String("lcov", "", "write an LCOV tracefile to `file`")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() == 0 {
+		fmt.Fprint(os.Stderr, usage)
+		return 2
+	}
+
+	merged := coverage.NewProfile()
+	for _, path := range flags.Args() {
+		f, err := os.Open(path)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		profile, err := coverage.Read(f)
+		f.Close()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", path, err)
+			return 1
+		}
+		merged.Merge(profile)
+	}
+
+	merged.WriteText(os.Stdout)
+	if *html != "" {
+		if err := writeFile(*html, merged.WriteHTML); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	}
+	if *lcov != "" {
+		if err := writeFile(*lcov, merged.WriteLCOV); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	}
+	return 0
+}
+
+// writeFile creates the file at path and writes it with write.
+func writeFile(path string, write func(io.Writer) error) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	err = write(f)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// printAST prints the JSON encoding of the program in the file at path.
+func printAST(path string) int {
+	source, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	p := parser.New(lexer.New(string(source)))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		for _, msg := range p.Errors() {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", path, msg)
+		}
+		return 1
+	}
+
+	encoded, err := ast.EncodeJSON(program)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return printJSON(encoded)
+}
+
+// printTokens prints the tokens of the file at path as a JSON array.
+func printTokens(path string) int {
+	source, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	encoded, err := json.Marshal(lexer.Tokens(string(source)))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return printJSON(encoded)
+}
+
+func printJSON(encoded []byte) int {
+	var indented bytes.Buffer
+	if err := json.Indent(&indented, encoded, "", "  "); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	indented.WriteString("\n")
+	indented.WriteTo(os.Stdout)
+	return 0
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckFile(t *testing.T) {
+	tests := []struct {
+		source string
+		code   int
+		output string
+	}{
+		{"let a = 1;\na + 1;\n", 0, ""},
+		{
+			"let f = function(x) { match (x) { _ => 1, 2 => 2 } };\nf(2);\n",
+			0,
+			"%s:1:43: warning: unreachable match arm: 2\n",
+		},
+		{
+			"let f = function(x) { match (x) { 1 => 1, 1 => 2, _ => 3 } };\nlet b = 1 + true;\n",
+			1,
+			"%s:1:43: warning: unreachable match arm: 1\n%s:2:13: type error: expected int, got bool\n",
+		},
+		{
+			"let f = function(x, y) { let z = x; x };\nlet g = function(len) { 1 };\nf(1, 2) + g(3);\n",
+			0,
+			"%s:1:21: warning: parameter y is never used\n%s:1:30: warning: z is declared but never used\n%s:2:18: warning: len can never be read: the builtin function len takes precedence\n",
+		},
+		{
+			"let f = function(x) { let z = 1; y };\nf(1);\n",
+			1,
+			"%s:1:18: warning: parameter x is never used\n%s:1:27: warning: z is declared but never used\n%s:1:34: error: undefined identifier y\n",
+		},
+	}
+
+	for _, tt := range tests {
+		path := filepath.Join(t.TempDir(), "main.monkey")
+		if err := os.WriteFile(path, []byte(tt.source), 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		var stdout, stderr bytes.Buffer
+		code := checkFile(path, &stdout, &stderr)
+		if code != tt.code || stderr.Len() != 0 {
+			t.Errorf("%q: expected exit code %d, got %d with %q", tt.source, tt.code, code, stderr.String())
+		}
+		expected := bytes.ReplaceAll([]byte(tt.output), []byte("%s"), []byte(path))
+		if stdout.String() != string(expected) {
+			t.Errorf("%q: wrong output.\nexpected %q\n     got %q", tt.source, expected, stdout.String())
+		}
+	}
+}
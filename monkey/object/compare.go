@@ -0,0 +1,107 @@
+package object
+
+import "strings"
+
+// Equals reports whether a and b are the same value, as == sees them.
+// Integers, booleans, strings and ranges are equal when their values are;
+// arrays when their elements are, in order; hashes when they have the same
+// keys with equal values, whatever the order the keys were added in. Null
+// only equals null. Functions, builtins and the other values are only equal
+// to themselves, with or without the checks of an annotation.
+func Equals(a, b Object) bool {
+	if c, ok := a.(*CheckedFunction); ok {
+		a = c.Function
+	}
+	if c, ok := b.(*CheckedFunction); ok {
+		b = c.Function
+	}
+	switch a := a.(type) {
+	case *Integer:
+		b, ok := b.(*Integer)
+		return ok && a.Value == b.Value
+	case *Boolean:
+		b, ok := b.(*Boolean)
+		return ok && a.Value == b.Value
+	case *Null:
+		_, ok := b.(*Null)
+		return ok
+	case *String:
+		b, ok := b.(*String)
+		return ok && a.Value == b.Value
+	case *Range:
+		b, ok := b.(*Range)
+		return ok && *a == *b
+	case *Array:
+		b, ok := b.(*Array)
+		if !ok || len(a.Elements) != len(b.Elements) {
+			return false
+		}
+		for i := range a.Elements {
+			if !Equals(a.Elements[i], b.Elements[i]) {
+				return false
+			}
+		}
+		return true
+	case *Hash:
+		b, ok := b.(*Hash)
+		if !ok || len(a.Pairs) != len(b.Pairs) {
+			return false
+		}
+		for key, pair := range a.Pairs {
+			other, ok := b.Pairs[key]
+			if !ok || !Equals(pair.Key, other.Key) || !Equals(pair.Value, other.Value) {
+				return false
+			}
+		}
+		return true
+	}
+	return a == b
+}
+
+// Compare orders a and b, as <, >, <= and >= see them, returning -1 if a
+// comes first, 1 if b does and 0 if they are equal. Integers are ordered by
+// value and strings byte by byte. Arrays are ordered lexicographically: by
+// their first elements that differ, or else by length.
+//
+// Only integers, strings and arrays of them are ordered, and only against
+// values of the same type. For any other pair Compare reports false.
+func Compare(a, b Object) (int, bool) {
+	switch a := a.(type) {
+	case *Integer:
+		b, ok := b.(*Integer)
+		if !ok {
+			return 0, false
+		}
+		switch {
+		case a.Value < b.Value:
+			return -1, true
+		case a.Value > b.Value:
+			return 1, true
+		}
+		return 0, true
+	case *String:
+		b, ok := b.(*String)
+		if !ok {
+			return 0, false
+		}
+		return strings.Compare(a.Value, b.Value), true
+	case *Array:
+		b, ok := b.(*Array)
+		if !ok {
+			return 0, false
+		}
+		for i := 0; i < len(a.Elements) && i < len(b.Elements); i++ {
+			if c, ok := Compare(a.Elements[i], b.Elements[i]); !ok || c != 0 {
+				return c, ok
+			}
+		}
+		switch {
+		case len(a.Elements) < len(b.Elements):
+			return -1, true
+		case len(a.Elements) > len(b.Elements):
+			return 1, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
@@ -0,0 +1,97 @@
+package object
+
+import "testing"
+
+func array(elements ...Object) *Array {
+	return &Array{Elements: elements}
+}
+
+func hash(pairs ...Object) *Hash {
+	h := &Hash{Pairs: make(map[HashKey]HashPair)}
+	for i := 0; i < len(pairs); i += 2 {
+		key := pairs[i].(Hashable)
+		h.Pairs[key.HashKey()] = HashPair{Key: pairs[i], Value: pairs[i+1]}
+	}
+	return h
+}
+
+func integer(v int64) *Integer { return &Integer{Value: v} }
+func str(v string) *String     { return &String{Value: v} }
+
+func TestEquals(t *testing.T) {
+	null := &Null{}
+	builtin := &Builtin{}
+
+	tests := []struct {
+		a, b     Object
+		expected bool
+	}{
+		{integer(1), integer(1), true},
+		{integer(1), str("1"), false},
+		{&Boolean{Value: true}, &Boolean{Value: true}, true},
+		{null, &Null{}, true},
+		{null, &Boolean{Value: false}, false},
+		{&Range{Start: 0, End: 3, Step: 1}, &Range{Start: 0, End: 3, Step: 1}, true},
+		{array(), array(), true},
+		{array(integer(1), str("a")), array(integer(1), str("a")), true},
+		{array(integer(1), str("a")), array(str("a"), integer(1)), false},
+		{array(integer(1)), array(integer(1), integer(1)), false},
+		{array(array(integer(1), array(str("x")))), array(array(integer(1), array(str("x")))), true},
+		{array(array(integer(1), array(str("x")))), array(array(integer(1), array(str("y")))), false},
+		{array(hash(str("a"), array(integer(1)))), array(hash(str("a"), array(integer(1)))), true},
+		{hash(str("a"), integer(1), str("b"), integer(2)), hash(str("b"), integer(2), str("a"), integer(1)), true},
+		{hash(str("a"), hash(integer(1), array(null))), hash(str("a"), hash(integer(1), array(null))), true},
+		{hash(str("a"), integer(1)), hash(str("a"), integer(1), str("b"), integer(2)), false},
+		{hash(integer(1), str("x")), hash(str("1"), str("x")), false},
+		{hash(str("a"), integer(1)), hash(str("a"), str("1")), false},
+		{array(builtin), array(builtin), true},
+		{array(&Builtin{}), array(&Builtin{}), false},
+	}
+
+	for _, tt := range tests {
+		if got := Equals(tt.a, tt.b); got != tt.expected {
+			t.Errorf("Equals(%s, %s): expected %t, got %t", tt.a.Inspect(), tt.b.Inspect(), tt.expected, got)
+		}
+		if got := Equals(tt.b, tt.a); got != tt.expected {
+			t.Errorf("Equals(%s, %s): expected %t, got %t", tt.b.Inspect(), tt.a.Inspect(), tt.expected, got)
+		}
+	}
+}
+
+func TestCompare(t *testing.T) {
+	tests := []struct {
+		a, b     Object
+		expected int
+		ok       bool
+	}{
+		{integer(1), integer(2), -1, true},
+		{integer(2), integer(2), 0, true},
+		{str("b"), str("abc"), 1, true},
+		{str("ab"), str("abc"), -1, true},
+		{array(), array(), 0, true},
+		{array(integer(1), integer(2)), array(integer(1), integer(3)), -1, true},
+		{array(integer(1), integer(2)), array(integer(1)), 1, true},
+		{array(array(integer(2))), array(array(integer(1), integer(5))), 1, true},
+		{array(array(str("a"), integer(1))), array(array(str("a"), integer(1))), 0, true},
+		// Elements after the first that differ are not compared, whatever
+		// their types.
+		{array(integer(1), hash()), array(integer(2), str("x")), -1, true},
+		{array(integer(1), str("a")), array(integer(1), integer(2)), 0, false},
+		{array(str("a"), integer(1)), array(integer(1), str("a")), 0, false},
+		{array(array(integer(1), str("b"))), array(array(integer(1), integer(2))), 0, false},
+		{array(hash()), array(hash()), 0, false},
+		{integer(1), str("1"), 0, false},
+		{hash(), hash(), 0, false},
+		{&Boolean{Value: false}, &Boolean{Value: true}, 0, false},
+	}
+
+	for _, tt := range tests {
+		got, ok := Compare(tt.a, tt.b)
+		if got != tt.expected || ok != tt.ok {
+			t.Errorf("Compare(%s, %s): expected %d, %t, got %d, %t", tt.a.Inspect(), tt.b.Inspect(), tt.expected, tt.ok, got, ok)
+		}
+		if reversed, ok := Compare(tt.b, tt.a); reversed != -tt.expected || ok != tt.ok {
+			t.Errorf("Compare(%s, %s): expected %d, %t, got %d, %t", tt.b.Inspect(), tt.a.Inspect(), -tt.expected, tt.ok, reversed, ok)
+		}
+	}
+}
@@ -1,30 +1,245 @@
 package object
 
+import (
+	"monkey/ast"
+	"sort"
+)
+
 func NewEnclosedEnvironment(outer *Environment) *Environment {
 	env := NewEnvironment()
 	env.outer = outer
+	env.global = outer.global
 	return env
 }
 
 func NewEnvironment() *Environment {
 	s := make(map[string]Object)
-	return &Environment{store: s, outer: nil}
+	env := &Environment{store: s, outer: nil}
+	env.global = env
+	return env
 }
 
+// NewFrame returns an environment for the locals of a function call or match
+// arm, stored in slots rather than by name. names gives the name of each
+// slot, as assigned by the resolver.
+func NewFrame(outer *Environment, names []string) *Environment {
+	env := &Environment{outer: outer, names: names, global: outer.global}
+	if len(names) > 0 {
+		env.slots = make([]Object, len(names))
+	}
+	return env
+}
+
+// NewClosure returns the environment of a function whose literal, evaluated
+// in env, captures the bindings free: an environment holding just them,
+// around which is the global environment. With no free bindings, that is the
+// global environment itself. A literal the resolver has not seen, with free
+// nil, keeps all of env.
+//
+// The closure shares each binding with the frame that binds it through a
+// cell, so that an assignment on either side is seen on the other.
+func NewClosure(env *Environment, free []ast.FreeVariable) *Environment {
+	if free == nil {
+		return env
+	}
+	if len(free) == 0 {
+		return env.global
+	}
+
+	closure := &Environment{
+		outer:  env.global,
+		global: env.global,
+		names:  make([]string, len(free)),
+		slots:  make([]Object, len(free)),
+	}
+	for i, v := range free {
+		closure.names[i] = v.Name
+		closure.slots[i] = env.frame(v.Depth).cell(v.Slot)
+	}
+	return closure
+}
+
+// A cell holds a binding that closures capture. The slot of the frame that
+// binds it and those of the closures' environments hold the cell in place
+// of the value, and every use of a slot goes through it.
+type cell struct {
+	value Object
+}
+
+func (c *cell) Type() ObjectType { return "CELL" }
+func (c *cell) Inspect() string {
+	if c.value == nil {
+		return "<unbound>"
+	}
+	return c.value.Inspect()
+}
+
+// cell returns the cell of slot, moving its value into a new one the first
+// time it is captured.
+func (e *Environment) cell(slot int) *cell {
+	e.grow(slot)
+	if c, ok := e.slots[slot].(*cell); ok {
+		return c
+	}
+	c := &cell{value: e.slots[slot]}
+	e.slots[slot] = c
+	return c
+}
+
+// An Environment binds names to values. Global environments, such as the one
+// of the REPL or of a module, keep their bindings in a map. Frames keep
+// resolved locals in slots; code the resolver has not seen still falls back
+// to names. The environments of closures keep the bindings they capture in
+// slots too.
 type Environment struct {
-	store map[string]Object
-	outer *Environment
+	store  map[string]Object
+	slots  []Object
+	names  []string
+	outer  *Environment
+	global *Environment
 }
 
 func (e *Environment) Get(name string) (Object, bool) {
-	obj, ok := e.store[name]
-	if !ok && e.outer != nil {
-		obj, ok = e.outer.Get(name)
+	if obj, ok := e.store[name]; ok {
+		return obj, true
 	}
-	return obj, ok
+	for i, slotName := range e.names {
+		if slotName == name {
+			if obj := e.value(i); obj != nil {
+				return obj, true
+			}
+		}
+	}
+	if e.outer != nil {
+		return e.outer.Get(name)
+	}
+	return nil, false
 }
 
 func (e *Environment) Set(name string, val Object) Object {
+	for i, slotName := range e.names {
+		if slotName == name {
+			return e.SetSlot(i, val)
+		}
+	}
+	if e.store == nil {
+		e.store = make(map[string]Object)
+	}
 	e.store[name] = val
 	return val
 }
+
+// Assign rebinds an existing name in the innermost environment that defines
+// it. It reports false if the name is not bound anywhere in the chain.
+func (e *Environment) Assign(name string, val Object) bool {
+	if _, ok := e.store[name]; ok {
+		e.store[name] = val
+		return true
+	}
+	for i, slotName := range e.names {
+		if slotName == name && e.value(i) != nil {
+			e.SetSlot(i, val)
+			return true
+		}
+	}
+	if e.outer != nil {
+		return e.outer.Assign(name, val)
+	}
+	return false
+}
+
+// GetGlobal looks name up in the global environment at the root of the
+// chain.
+func (e *Environment) GetGlobal(name string) (Object, bool) {
+	obj, ok := e.global.store[name]
+	return obj, ok
+}
+
+// frame returns the environment depth steps out along the chain.
+func (e *Environment) frame(depth int) *Environment {
+	env := e
+	for ; depth > 0; depth-- {
+		env = env.outer
+	}
+	return env
+}
+
+// GetSlot reads a local depth frames out. It reports false if the local has
+// not been bound yet.
+func (e *Environment) GetSlot(depth, slot int) (Object, bool) {
+	obj := e.frame(depth).value(slot)
+	return obj, obj != nil
+}
+
+func (e *Environment) SetSlot(slot int, val Object) Object {
+	e.grow(slot)
+	if c, ok := e.slots[slot].(*cell); ok {
+		c.value = val
+		return val
+	}
+	e.slots[slot] = val
+	return val
+}
+
+// AssignSlot rebinds a local depth frames out that has already been bound.
+func (e *Environment) AssignSlot(depth, slot int, val Object) bool {
+	env := e.frame(depth)
+	if env.value(slot) == nil {
+		return false
+	}
+	env.SetSlot(slot, val)
+	return true
+}
+
+// value returns what slot is bound to, or nil.
+func (e *Environment) value(slot int) Object {
+	if slot >= len(e.slots) {
+		return nil
+	}
+	if c, ok := e.slots[slot].(*cell); ok {
+		return c.value
+	}
+	return e.slots[slot]
+}
+
+func (e *Environment) grow(slot int) {
+	if slot >= len(e.slots) {
+		slots := make([]Object, slot+1)
+		copy(slots, e.slots)
+		e.slots = slots
+	}
+}
+
+// Outer returns the environment e is enclosed in, or nil for a global
+// environment.
+func (e *Environment) Outer() *Environment {
+	return e.outer
+}
+
+// Binding is a name bound in an environment and its value.
+type Binding struct {
+	Name  string
+	Value Object
+}
+
+// Bindings returns what e binds itself, leaving out the environments around
+// it: the bound slots in order, then the names kept by name, sorted.
+func (e *Environment) Bindings() []Binding {
+	bindings := []Binding{}
+	for i, name := range e.names {
+		if value := e.value(i); value != nil {
+			bindings = append(bindings, Binding{Name: name, Value: value})
+		}
+	}
+
+	names := make([]string, 0, len(e.store))
+	for name := range e.store {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		bindings = append(bindings, Binding{Name: name, Value: e.store[name]})
+	}
+
+	return bindings
+}
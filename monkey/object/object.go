@@ -3,6 +3,8 @@ package object
 import (
 	"bytes"
 	"fmt"
+	"hash/fnv"
+	"math"
 	"monkey/ast"
 	"monkey/token"
 	"strings"
@@ -25,6 +27,13 @@ const (
 	STRING_OBJECT       = "STRING"
 	BUILTIN_OBJECT      = "BUILTIN"
 	ARRAY_OBJECT        = "ARRAY"
+	HASH_OBJECT         = "HASH"
+	RANGE_OBJECT        = "RANGE"
+	BREAK_OBJECT        = "BREAK"
+	CONTINUE_OBJECT     = "CONTINUE"
+	MODULE_OBJECT       = "MODULE"
+	QUOTE_OBJECT        = "QUOTE"
+	MACRO_OBJECT        = "MACRO"
 )
 
 type Array struct {
@@ -82,32 +91,82 @@ func (rv *ReturnValue) Inspect() string  { return rv.Value.Inspect() }
 
 type Error struct {
 	Message string
+
+	// Position is where in the source the error was raised, when known.
+	Position token.Position
 }
 
 func (e *Error) Type() ObjectType { return ERROR_OBJECT }
 func (e *Error) Inspect() string  { return "Uncaught syntax error!: " + e.Message }
 
 type Function struct {
-	Parameters []*ast.Identifier
-	Body       *ast.BlockStatement
-	Env        *Environment
+	Parameters     []ast.Pattern
+	ParameterTypes []ast.TypeExpression
+	Defaults       []ast.Expression
+	Rest           *ast.Identifier
+	RestType       ast.TypeExpression
+	ReturnType     ast.TypeExpression
+	Body           *ast.BlockStatement
+	Locals         []string
+	Env            *Environment
 }
 
 func (f *Function) Type() ObjectType { return FUNCTION_OBJECT }
 func (f *Function) Inspect() string {
 	var str bytes.Buffer
 
-	parameters := []string{}
-	for _, p := range f.Parameters {
-		parameters = append(parameters, p.String())
-	}
-
 	str.WriteString(token.FUNCTION)
 	str.WriteString("(")
-	str.WriteString(strings.Join(parameters, ", "))
-	str.WriteString(") {\n")
+	str.WriteString(ast.ParametersString(f.Parameters, f.ParameterTypes, f.Defaults, f.Rest, f.RestType))
+	str.WriteString(")")
+	if f.ReturnType != nil {
+		str.WriteString(": " + f.ReturnType.String())
+	}
+	str.WriteString(" ")
 	str.WriteString(f.Body.String())
-	str.WriteString("\n}")
+
+	return str.String()
+}
+
+// CheckedFunction is a function or builtin passed where a function type was
+// annotated. Calling it checks the arguments and the result against the
+// annotation; Name says what was annotated, for the errors. Otherwise it
+// looks and behaves like the function it wraps.
+type CheckedFunction struct {
+	Function   Object
+	Annotation *ast.FunctionType
+	Name       string
+}
+
+func (c *CheckedFunction) Type() ObjectType { return c.Function.Type() }
+func (c *CheckedFunction) Inspect() string  { return c.Function.Inspect() }
+
+// Quote is an unevaluated piece of AST, produced by `quote`.
+type Quote struct {
+	Node ast.Node
+}
+
+func (q *Quote) Type() ObjectType { return QUOTE_OBJECT }
+func (q *Quote) Inspect() string  { return "QUOTE(" + q.Node.String() + ")" }
+
+type Macro struct {
+	Parameters []ast.Pattern
+	Defaults   []ast.Expression
+	Rest       *ast.Identifier
+	Body       *ast.BlockStatement
+	Locals     []string
+	Env        *Environment
+}
+
+func (m *Macro) Type() ObjectType { return MACRO_OBJECT }
+func (m *Macro) Inspect() string {
+	var str bytes.Buffer
+
+	str.WriteString(token.MACRO)
+	str.WriteString("(")
+	str.WriteString(ast.ParametersString(m.Parameters, nil, m.Defaults, m.Rest, nil))
+	str.WriteString(") ")
+	str.WriteString(m.Body.String())
 
 	return str.String()
 }
@@ -119,3 +178,130 @@ type Builtin struct {
 
 func (b *Builtin) Type() ObjectType { return BUILTIN_OBJECT }
 func (b *Builtin) Inspect() string  { return "built-in function" }
+
+type HashKey struct {
+	Type  ObjectType
+	Value uint64
+}
+
+type Hashable interface {
+	HashKey() HashKey
+}
+
+func (i *Integer) HashKey() HashKey {
+	return HashKey{Type: i.Type(), Value: uint64(i.Value)}
+}
+
+func (b *Boolean) HashKey() HashKey {
+	var value uint64
+	if b.Value {
+		value = 1
+	}
+	return HashKey{Type: b.Type(), Value: value}
+}
+
+func (s *String) HashKey() HashKey {
+	h := fnv.New64a()
+	h.Write([]byte(s.Value))
+	return HashKey{Type: s.Type(), Value: h.Sum64()}
+}
+
+type HashPair struct {
+	Key   Object
+	Value Object
+}
+
+// Hash keeps its keys in insertion order so that printing and iterating a
+// hash is deterministic.
+type Hash struct {
+	Pairs map[HashKey]HashPair
+	Keys  []HashKey
+}
+
+func NewHash() *Hash {
+	return &Hash{Pairs: make(map[HashKey]HashPair)}
+}
+
+func (h *Hash) Set(key HashKey, pair HashPair) {
+	if _, ok := h.Pairs[key]; !ok {
+		h.Keys = append(h.Keys, key)
+	}
+	h.Pairs[key] = pair
+}
+
+func (h *Hash) Type() ObjectType { return HASH_OBJECT }
+func (h *Hash) Inspect() string {
+	var str bytes.Buffer
+
+	pairs := []string{}
+	for _, key := range h.Keys {
+		pair := h.Pairs[key]
+		pairs = append(pairs, pair.Key.Inspect()+": "+pair.Value.Inspect())
+	}
+
+	str.WriteString("{")
+	str.WriteString(strings.Join(pairs, ", "))
+	str.WriteString("}")
+
+	return str.String()
+}
+
+// Range is the half-open integer interval [Start, End) walked in steps of
+// Step. It is produced by the `range` builtin and consumed by for loops.
+type Range struct {
+	Start int64
+	End   int64
+	Step  int64
+}
+
+func (r *Range) Type() ObjectType { return RANGE_OBJECT }
+func (r *Range) Inspect() string {
+	return fmt.Sprintf("range(%d, %d, %d)", r.Start, r.End, r.Step)
+}
+
+// Len returns the number of integers in the range, or -1 when there are
+// more than an int64 can count. The span between the bounds is computed
+// unsigned, where it cannot overflow.
+func (r *Range) Len() int64 {
+	var n uint64
+	if r.Step > 0 && r.Start < r.End {
+		n = (uint64(r.End)-uint64(r.Start)-1)/uint64(r.Step) + 1
+	} else if r.Step < 0 && r.Start > r.End {
+		n = (uint64(r.Start)-uint64(r.End)-1)/-uint64(r.Step) + 1
+	}
+	if n > math.MaxInt64 {
+		return -1
+	}
+	return int64(n)
+}
+
+type Break struct{}
+
+func (b *Break) Type() ObjectType { return BREAK_OBJECT }
+func (b *Break) Inspect() string  { return "break" }
+
+type Continue struct{}
+
+func (c *Continue) Type() ObjectType { return CONTINUE_OBJECT }
+func (c *Continue) Inspect() string  { return "continue" }
+
+// Module is the namespace value produced by an import. Its members are the
+// exported bindings of the module's top-level environment.
+type Module struct {
+	Name    string
+	Path    string
+	Env     *Environment
+	Exports []string
+}
+
+func (m *Module) Type() ObjectType { return MODULE_OBJECT }
+func (m *Module) Inspect() string  { return "module(" + m.Name + ")" }
+
+func (m *Module) Member(name string) (Object, bool) {
+	for _, export := range m.Exports {
+		if export == name {
+			return m.Env.Get(name)
+		}
+	}
+	return nil, false
+}
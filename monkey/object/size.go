@@ -0,0 +1,110 @@
+package object
+
+// Approximate sizes, in bytes, of values on a 64-bit platform, rounded up
+// for the allocator's overhead.
+const (
+	stringSize      = 16  // the String and its string header
+	arraySize       = 24  // the Array and its slice header
+	elementSize     = 16  // an interface in a slice
+	hashSize        = 80  // the Hash, its map header and its key slice
+	hashEntrySize   = 88  // a map entry of a key and a pair, and the key in Keys
+	functionSize    = 160 // the Function
+	environmentSize = 80  // the Environment
+	storeEntrySize  = 48  // a map entry of a name and a value
+)
+
+// Size returns approximately how many bytes obj takes up by itself, leaving
+// out the values it refers to. Strings count their bytes, arrays and hashes
+// their elements, functions their struct and not their environment.
+// Integers, booleans and the other small values count as nothing.
+func Size(obj Object) int64 {
+	switch obj := obj.(type) {
+	case *String:
+		return StringSize(len(obj.Value))
+	case *Array:
+		return ArraySize(len(obj.Elements))
+	case *Hash:
+		return hashSize + hashEntrySize*int64(len(obj.Keys))
+	case *Function:
+		return functionSize
+	}
+	return 0
+}
+
+// StringSize returns the Size of a string of n bytes, and ArraySize that of
+// an array of n elements, so that what a value would take up is known before
+// it is made.
+func StringSize(n int) int64 { return stringSize + int64(n) }
+func ArraySize(n int) int64  { return arraySize + elementSize*int64(n) }
+
+// Size returns approximately how many bytes e takes up by itself: its
+// slots and named bindings, leaving out the values bound and the outer
+// environments.
+func (e *Environment) Size() int64 {
+	return environmentSize + elementSize*int64(len(e.slots)) + storeEntrySize*int64(len(e.store))
+}
+
+// Footprint returns approximately how many bytes the values and environments
+// reachable from envs and objects take up, as Size and Environment.Size count
+// them, counting each once however many ways it is reached.
+func Footprint(envs []*Environment, objects []Object) int64 {
+	var total int64
+	seen := make(map[interface{}]bool)
+	pending := make([]interface{}, 0, len(envs)+len(objects))
+	for _, env := range envs {
+		pending = append(pending, env)
+	}
+	for _, obj := range objects {
+		pending = append(pending, obj)
+	}
+
+	for len(pending) > 0 {
+		next := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+
+		switch next := next.(type) {
+		case *Environment:
+			if next == nil || seen[next] {
+				continue
+			}
+			seen[next] = true
+			total += next.Size()
+			for _, value := range next.store {
+				pending = append(pending, value)
+			}
+			for _, value := range next.slots {
+				pending = append(pending, value)
+			}
+			pending = append(pending, next.outer)
+		case *String, *Array, *Hash, *Function, *CheckedFunction, *Macro, *Module, *ReturnValue, *cell:
+			if seen[next] {
+				continue
+			}
+			seen[next] = true
+			total += Size(next.(Object))
+			switch next := next.(type) {
+			case *Array:
+				for _, element := range next.Elements {
+					pending = append(pending, element)
+				}
+			case *Hash:
+				for _, pair := range next.Pairs {
+					pending = append(pending, pair.Key, pair.Value)
+				}
+			case *Function:
+				pending = append(pending, next.Env)
+			case *CheckedFunction:
+				pending = append(pending, next.Function)
+			case *Macro:
+				pending = append(pending, next.Env)
+			case *Module:
+				pending = append(pending, next.Env)
+			case *ReturnValue:
+				pending = append(pending, next.Value)
+			case *cell:
+				pending = append(pending, next.value)
+			}
+		}
+	}
+	return total
+}
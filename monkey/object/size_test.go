@@ -0,0 +1,32 @@
+package object
+
+import (
+	"monkey/ast"
+	"testing"
+)
+
+func TestFootprint(t *testing.T) {
+	shared := str("shared")
+	global := NewEnvironment()
+	global.Set("a", array(shared, shared, integer(1)))
+	global.Set("h", hash(str("k"), shared))
+
+	arraySize := Size(array(shared, shared, integer(1)))
+	hashSize := Size(hash(str("k"), shared))
+	expected := global.Size() + arraySize + hashSize + Size(shared) + Size(str("k"))
+	if got := Footprint([]*Environment{global}, nil); got != expected {
+		t.Errorf("wrong footprint of the global environment. expected %d, got %d", expected, got)
+	}
+
+	// A closure reaches what it captures through its cells, and the global
+	// environment around it, but not the rest of the frame it came from.
+	frame := NewFrame(global, []string{"x", "y"})
+	frame.SetSlot(0, str("captured"))
+	frame.SetSlot(1, str("dropped"))
+	fn := &Function{Env: NewClosure(frame, []ast.FreeVariable{{Name: "x", Depth: 0, Slot: 0}})}
+
+	expected += Size(fn) + fn.Env.Size() + Size(str("captured"))
+	if got := Footprint(nil, []Object{fn, integer(5), nil}); got != expected {
+		t.Errorf("wrong footprint of a closure. expected %d, got %d", expected, got)
+	}
+}
@@ -0,0 +1,90 @@
+package parser
+
+import (
+	"monkey/ast"
+	"monkey/errors"
+	"monkey/token"
+	"path"
+	"strings"
+)
+
+// parseImportStatement parses `import "path/to/mod";` and
+// `import "path/to/mod" as name;`.
+func (p *Parser) parseImportStatement() ast.Statement {
+	stmt := &ast.ImportStatement{Token: p.currentToken}
+	if p.blockDepth > 0 {
+		p.addError(stmt.Token.Position, errors.NotAtTopLevel(stmt.Token.Value))
+	}
+
+	if !p.expectNextTokenToBe(token.STRING) {
+		return nil
+	}
+	stmt.Path = p.currentToken.Value
+
+	// `as` is not a keyword so that it stays usable as an identifier
+	// everywhere else.
+	if p.nextToken.Type == token.IDENT && p.nextToken.Value == "as" {
+		p.advanceToNextToken()
+		if !p.expectNextTokenToBe(token.IDENT) {
+			return nil
+		}
+		stmt.Name = &ast.Identifier{Token: p.currentToken, Value: p.currentToken.Value}
+	} else {
+		name := strings.TrimSuffix(path.Base(stmt.Path), path.Ext(stmt.Path))
+		if token.LookupIdentifier(name) != token.IDENT || !isIdentifier(name) {
+			p.addError(stmt.Token.Position, errors.InvalidModuleName(stmt.Path))
+			return nil
+		}
+		stmt.Name = &ast.Identifier{
+			Token: token.Token{Type: token.IDENT, Value: name},
+			Value: name,
+		}
+	}
+
+	if p.nextToken.Type == token.SEMICOLON {
+		p.advanceToNextToken()
+	}
+
+	return stmt
+}
+
+func (p *Parser) parseExportStatement() ast.Statement {
+	stmt := &ast.ExportStatement{Token: p.currentToken}
+	if p.blockDepth > 0 {
+		p.addError(stmt.Token.Position, errors.NotAtTopLevel(stmt.Token.Value))
+	}
+
+	if !p.expectNextTokenToBe(token.LET) {
+		return nil
+	}
+
+	stmt.Statement = p.parseLetStatement()
+	if stmt.Statement == nil {
+		return nil
+	}
+
+	return stmt
+}
+
+func (p *Parser) parseMemberExpression(object ast.Expression) ast.Expression {
+	expr := &ast.MemberExpression{Token: p.currentToken, Object: object}
+
+	if !p.expectNextTokenToBe(token.IDENT) {
+		return nil
+	}
+	expr.Property = &ast.Identifier{Token: p.currentToken, Value: p.currentToken.Value}
+
+	return expr
+}
+
+func isIdentifier(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, ch := range name {
+		if !('a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch == '_') {
+			return false
+		}
+	}
+	return true
+}
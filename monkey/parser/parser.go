@@ -1,6 +1,8 @@
 package parser
 
 import (
+	"fmt"
+	"io"
 	"monkey/ast"
 	"monkey/errors"
 	"monkey/lexer"
@@ -15,8 +17,15 @@ type (
 
 const (
 	LOWEST int = iota
+	ASSIGNMENT
+	LOGICAL_OR
+	LOGICAL_AND
+	BITWISE_OR
+	BITWISE_XOR
+	BITWISE_AND
 	EQUALS
 	LESSGREATER
+	SHIFT
 	SUM
 	PRODUCT
 	PREFIX
@@ -25,20 +34,36 @@ const (
 )
 
 var precedences = map[token.TokenType]int{
+	token.ASSIGN: ASSIGNMENT,
+
+	token.OR:  LOGICAL_OR,
+	token.AND: LOGICAL_AND,
+
+	token.PIPE:      BITWISE_OR,
+	token.CARET:     BITWISE_XOR,
+	token.AMPERSAND: BITWISE_AND,
+
 	token.EQUAL:     EQUALS,
 	token.NOT_EQUAL: EQUALS,
 
-	token.L_THAN: LESSGREATER,
-	token.G_THAN: LESSGREATER,
+	token.L_THAN:       LESSGREATER,
+	token.G_THAN:       LESSGREATER,
+	token.L_THAN_EQUAL: LESSGREATER,
+	token.G_THAN_EQUAL: LESSGREATER,
+
+	token.L_SHIFT: SHIFT,
+	token.R_SHIFT: SHIFT,
 
 	token.PLUS:  SUM,
 	token.MINUS: SUM,
 
 	token.SLASH:    PRODUCT,
 	token.ASTERISK: PRODUCT,
+	token.PERCENT:  PRODUCT,
 
 	token.LPAREN:   CALL,
 	token.LBRACKET: INDEX,
+	token.DOT:      INDEX,
 }
 
 type Parser struct {
@@ -47,7 +72,21 @@ type Parser struct {
 	currentToken token.Token
 	nextToken    token.Token
 
-	errors []string
+	errors   []string
+	warnings []string
+
+	// errorPositions and warningPositions run parallel to errors and
+	// warnings.
+	errorPositions   []token.Position
+	warningPositions []token.Position
+
+	// loopDepth counts the loops enclosing the current token within the
+	// current function body, so that stray break/continue can be rejected.
+	loopDepth int
+
+	// blockDepth is non-zero while parsing inside braces, where import and
+	// export are not allowed.
+	blockDepth int
 
 	prefixParseFunctions map[token.TokenType]prefixParseFunction
 	infixParseFunctions  map[token.TokenType]infixParseFunction
@@ -66,8 +105,12 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerPrefix(token.LPAREN, p.parseGroupedExpression)
 	p.registerPrefix(token.IF, p.parseIfExpression)
 	p.registerPrefix(token.FUNCTION, p.parseFunctionLiteral)
+	p.registerPrefix(token.MACRO, p.parseMacroLiteral)
 	p.registerPrefix(token.STRING, p.parseStringLiteral)
 	p.registerPrefix(token.LBRACKET, p.parseArrayLiteral)
+	p.registerPrefix(token.LBRACE, p.parseHashLiteral)
+	p.registerPrefix(token.MATCH, p.parseMatchExpression)
+	p.registerPrefix(token.ELLIPSIS, p.parseSpreadExpression)
 
 	p.infixParseFunctions = make(map[token.TokenType]infixParseFunction)
 	p.registerInfix(token.PLUS, p.parseInfixExpression)
@@ -78,8 +121,20 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerInfix(token.NOT_EQUAL, p.parseInfixExpression)
 	p.registerInfix(token.L_THAN, p.parseInfixExpression)
 	p.registerInfix(token.G_THAN, p.parseInfixExpression)
+	p.registerInfix(token.PERCENT, p.parseInfixExpression)
+	p.registerInfix(token.L_THAN_EQUAL, p.parseInfixExpression)
+	p.registerInfix(token.G_THAN_EQUAL, p.parseInfixExpression)
+	p.registerInfix(token.AMPERSAND, p.parseInfixExpression)
+	p.registerInfix(token.PIPE, p.parseInfixExpression)
+	p.registerInfix(token.CARET, p.parseInfixExpression)
+	p.registerInfix(token.L_SHIFT, p.parseInfixExpression)
+	p.registerInfix(token.R_SHIFT, p.parseInfixExpression)
+	p.registerInfix(token.AND, p.parseInfixExpression)
+	p.registerInfix(token.OR, p.parseInfixExpression)
 	p.registerInfix(token.LPAREN, p.parseCallExpression)
 	p.registerInfix(token.LBRACKET, p.parseIndexExpression)
+	p.registerInfix(token.ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.DOT, p.parseMemberExpression)
 
 	p.advanceToNextToken()
 	p.advanceToNextToken()
@@ -105,10 +160,63 @@ func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
 }
 
 func (p *Parser) parseArrayLiteral() ast.Expression {
-	return &ast.ArrayLiteral{
-		Token:    p.currentToken,
-		Elements: p.parseExpressionList(token.RBRACKET),
+	array := &ast.ArrayLiteral{Token: p.currentToken}
+	array.Elements = p.parseExpressionList(token.RBRACKET)
+	return array
+}
+
+func (p *Parser) parseHashLiteral() ast.Expression {
+	hash := &ast.HashLiteral{Token: p.currentToken, Pairs: []ast.HashPair{}}
+
+	for p.nextToken.Type != token.RBRACE {
+		p.advanceToNextToken()
+		key := p.parseExpression(LOWEST)
+
+		if !p.expectNextTokenToBe(token.COLON) {
+			return nil
+		}
+
+		p.advanceToNextToken()
+		value := p.parseExpression(LOWEST)
+
+		hash.Pairs = append(hash.Pairs, ast.HashPair{Key: key, Value: value})
+
+		if p.nextToken.Type != token.RBRACE && !p.expectNextTokenToBe(token.COMMA) {
+			return nil
+		}
+	}
+
+	if !p.expectNextTokenToBe(token.RBRACE) {
+		return nil
+	}
+
+	return hash
+}
+
+func (p *Parser) parseAssignExpression(left ast.Expression) ast.Expression {
+	if left == nil {
+		return nil
+	}
+
+	name, ok := left.(*ast.Identifier)
+	if !ok {
+		// A left side with a part missing was already reported, and could
+		// not be printed in the message.
+		if !ast.Complete(left) {
+			return nil
+		}
+		p.addError(ast.Pos(left), errors.InvalidAssignmentTarget(left.String()))
+		return nil
 	}
+
+	expr := &ast.AssignExpression{Token: p.currentToken, Name: name}
+
+	p.advanceToNextToken()
+
+	// Assignment is right associative: a = b = c is a = (b = c).
+	expr.Value = p.parseExpression(ASSIGNMENT - 1)
+
+	return expr
 }
 
 func (p *Parser) parseExpressionList(end token.TokenType) []ast.Expression {
@@ -172,9 +280,24 @@ func (p *Parser) parseStringLiteral() ast.Expression {
 func (p *Parser) parseStatement() ast.Statement {
 	switch p.currentToken.Type {
 	case token.LET:
-		return p.parseLetStatement()
+		if stmt := p.parseLetStatement(); stmt != nil {
+			return stmt
+		}
+		return nil
 	case token.RETURN:
 		return p.parseReturnStatement()
+	case token.WHILE:
+		return p.parseWhileStatement()
+	case token.FOR:
+		return p.parseForStatement()
+	case token.BREAK:
+		return p.parseBreakStatement()
+	case token.CONTINUE:
+		return p.parseContinueStatement()
+	case token.IMPORT:
+		return p.parseImportStatement()
+	case token.EXPORT:
+		return p.parseExportStatement()
 	default:
 		return p.parseExpressionStatement()
 	}
@@ -183,14 +306,18 @@ func (p *Parser) parseStatement() ast.Statement {
 func (p *Parser) parseLetStatement() *ast.LetStatement {
 	stmt := &ast.LetStatement{Token: p.currentToken}
 
-	if !p.expectNextTokenToBe(token.IDENT) {
+	p.advanceToNextToken()
+
+	stmt.Name = p.parseBindingPattern()
+	if stmt.Name == nil {
 		return nil
 	}
 
-	stmt.Name = &ast.Identifier{
-		Token: p.currentToken,
-		Value: p.currentToken.Value,
+	var ok bool
+	if stmt.Type, ok = p.parseTypeAnnotation(); !ok {
+		return nil
 	}
+
 	if !p.expectNextTokenToBe(token.ASSIGN) {
 		return nil
 	}
@@ -211,7 +338,104 @@ func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 	p.advanceToNextToken()
 	stmt.ReturnValue = p.parseExpression(LOWEST)
 
-	for !p.expectCurrentTokenToBe(token.SEMICOLON) {
+	if p.nextToken.Type == token.SEMICOLON {
+		p.advanceToNextToken()
+	}
+
+	return stmt
+}
+
+func (p *Parser) parseWhileStatement() ast.Statement {
+	stmt := &ast.WhileStatement{Token: p.currentToken}
+
+	if !p.expectNextTokenToBe(token.LPAREN) {
+		return nil
+	}
+
+	p.advanceToNextToken()
+	stmt.Condition = p.parseExpression(LOWEST)
+
+	if !p.expectNextTokenToBe(token.RPAREN) {
+		return nil
+	}
+
+	if !p.expectNextTokenToBe(token.LBRACE) {
+		return nil
+	}
+
+	stmt.Body = p.parseLoopBody()
+
+	return stmt
+}
+
+func (p *Parser) parseForStatement() ast.Statement {
+	stmt := &ast.ForStatement{Token: p.currentToken}
+
+	if !p.expectNextTokenToBe(token.LPAREN) {
+		return nil
+	}
+
+	if !p.expectNextTokenToBe(token.IDENT) {
+		return nil
+	}
+	stmt.Value = &ast.Identifier{Token: p.currentToken, Value: p.currentToken.Value}
+
+	if p.nextToken.Type == token.COMMA {
+		p.advanceToNextToken()
+		if !p.expectNextTokenToBe(token.IDENT) {
+			return nil
+		}
+		stmt.Key = stmt.Value
+		stmt.Value = &ast.Identifier{Token: p.currentToken, Value: p.currentToken.Value}
+	}
+
+	if !p.expectNextTokenToBe(token.IN) {
+		return nil
+	}
+
+	p.advanceToNextToken()
+	stmt.Iterable = p.parseExpression(LOWEST)
+
+	if !p.expectNextTokenToBe(token.RPAREN) {
+		return nil
+	}
+
+	if !p.expectNextTokenToBe(token.LBRACE) {
+		return nil
+	}
+
+	stmt.Body = p.parseLoopBody()
+
+	return stmt
+}
+
+func (p *Parser) parseLoopBody() *ast.BlockStatement {
+	p.loopDepth++
+	defer func() { p.loopDepth-- }()
+
+	return p.parseBlockStatement()
+}
+
+func (p *Parser) parseBreakStatement() ast.Statement {
+	stmt := &ast.BreakStatement{Token: p.currentToken}
+	if p.loopDepth == 0 {
+		p.addError(stmt.Token.Position, errors.OutsideOfLoop(stmt.Token.Value))
+	}
+
+	if p.nextToken.Type == token.SEMICOLON {
+		p.advanceToNextToken()
+	}
+
+	return stmt
+}
+
+func (p *Parser) parseContinueStatement() ast.Statement {
+	stmt := &ast.ContinueStatement{Token: p.currentToken}
+	if p.loopDepth == 0 {
+		p.addError(stmt.Token.Position, errors.OutsideOfLoop(stmt.Token.Value))
+	}
+
+	if p.nextToken.Type == token.SEMICOLON {
 		p.advanceToNextToken()
 	}
 
@@ -234,7 +458,7 @@ func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
 func (p *Parser) parseExpression(precedence int) ast.Expression {
 	prefix := p.prefixParseFunctions[p.currentToken.Type]
 	if prefix == nil {
-		p.errors = append(p.errors, errors.NoPrefixParseError(p.currentToken.Type))
+		p.addError(p.currentToken.Position, errors.NoPrefixParseError(p.currentToken.Type))
 		return nil
 	}
 
@@ -267,7 +491,7 @@ func (p *Parser) parseIntegerLiteral() ast.Expression {
 	}
 	value, err := strconv.ParseInt(p.currentToken.Value, 0, 64)
 	if err != nil {
-		p.errors = append(p.errors, errors.CouldNotParseInteger(p.currentToken.Value))
+		p.addError(p.currentToken.Position, errors.CouldNotParseInteger(p.currentToken.Value))
 		return nil
 	}
 
@@ -361,6 +585,9 @@ func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 	}
 	block.Statements = []ast.Statement{}
 
+	p.blockDepth++
+	defer func() { p.blockDepth-- }()
+
 	p.advanceToNextToken()
 
 	for p.currentToken.Type != token.RBRACE && p.currentToken.Type != token.EOF {
@@ -381,43 +608,125 @@ func (p *Parser) parseFunctionLiteral() ast.Expression {
 		return nil
 	}
 
-	literal.Parameters = p.parseFunctionParameters()
+	if !p.parseFunctionParameters(literal) {
+		return nil
+	}
+
+	var ok bool
+	if literal.ReturnType, ok = p.parseTypeAnnotation(); !ok {
+		return nil
+	}
 
 	if !p.expectNextTokenToBe(token.LBRACE) {
 		return nil
 	}
 
+	// A function body starts a fresh loop context: break and continue
+	// cannot cross a function boundary.
+	outerLoopDepth := p.loopDepth
+	p.loopDepth = 0
 	literal.Body = p.parseBlockStatement()
+	p.loopDepth = outerLoopDepth
 
 	return literal
 }
 
-func (p *Parser) parseFunctionParameters() []*ast.Identifier {
-	identifiers := []*ast.Identifier{}
+// parseMacroLiteral parses `macro(params) { body }`, which takes the same
+// parameter list as a function literal.
+func (p *Parser) parseMacroLiteral() ast.Expression {
+	macroToken := p.currentToken
 
-	if p.nextToken.Type == token.RPAREN {
-		p.advanceToNextToken()
-		return identifiers
+	function, ok := p.parseFunctionLiteral().(*ast.FunctionLiteral)
+	if !ok {
+		return nil
 	}
 
-	p.advanceToNextToken()
+	annotated := function.RestType != nil || function.ReturnType != nil
+	for _, t := range function.ParameterTypes {
+		annotated = annotated || t != nil
+	}
+	if annotated {
+		p.addError(function.Token.Position, errors.AnnotatedMacro())
+		return nil
+	}
 
-	identifier := &ast.Identifier{Token: p.currentToken, Value: p.currentToken.Value}
-	identifiers = append(identifiers, identifier)
+	return &ast.MacroLiteral{
+		Token:      macroToken,
+		Parameters: function.Parameters,
+		Defaults:   function.Defaults,
+		Rest:       function.Rest,
+		Body:       function.Body,
+	}
+}
 
-	for p.nextToken.Type == token.COMMA {
+// parseFunctionParameters fills in the parameters, default values and rest
+// parameter of literal. Parameters with defaults must follow the required
+// ones, and a rest parameter must come last.
+func (p *Parser) parseFunctionParameters(literal *ast.FunctionLiteral) bool {
+	literal.Parameters = []ast.Pattern{}
+	literal.ParameterTypes = []ast.TypeExpression{}
+	literal.Defaults = []ast.Expression{}
+
+	if p.nextToken.Type == token.RPAREN {
 		p.advanceToNextToken()
+		return true
+	}
+
+	for {
 		p.advanceToNextToken()
 
-		identifier := &ast.Identifier{Token: p.currentToken, Value: p.currentToken.Value}
-		identifiers = append(identifiers, identifier)
-	}
+		if p.currentToken.Type == token.ELLIPSIS {
+			if !p.expectNextTokenToBe(token.IDENT) {
+				return false
+			}
+			literal.Rest = &ast.Identifier{Token: p.currentToken, Value: p.currentToken.Value}
+
+			var ok bool
+			if literal.RestType, ok = p.parseTypeAnnotation(); !ok {
+				return false
+			}
+			break
+		}
 
-	if !p.expectNextTokenToBe(token.RPAREN) {
-		return nil
+		parameter := p.parseBindingPattern()
+		if parameter == nil {
+			return false
+		}
+
+		annotation, ok := p.parseTypeAnnotation()
+		if !ok {
+			return false
+		}
+
+		var value ast.Expression
+		if p.nextToken.Type == token.ASSIGN {
+			p.advanceToNextToken()
+			p.advanceToNextToken()
+			value = p.parseExpression(ASSIGNMENT)
+		} else if n := len(literal.Defaults); n > 0 && literal.Defaults[n-1] != nil {
+			p.addError(ast.Pos(parameter), errors.RequiredParameterAfterDefault(parameter.String()))
+		}
+
+		literal.Parameters = append(literal.Parameters, parameter)
+		literal.ParameterTypes = append(literal.ParameterTypes, annotation)
+		literal.Defaults = append(literal.Defaults, value)
+
+		if p.nextToken.Type != token.COMMA {
+			break
+		}
+		p.advanceToNextToken()
 	}
 
-	return identifiers
+	return p.expectNextTokenToBe(token.RPAREN)
+}
+
+func (p *Parser) parseSpreadExpression() ast.Expression {
+	expr := &ast.SpreadExpression{Token: p.currentToken}
+
+	p.advanceToNextToken()
+	expr.Value = p.parseExpression(PREFIX)
+
+	return expr
 }
 
 func (p *Parser) parseCallExpression(function ast.Expression) ast.Expression {
@@ -444,7 +753,7 @@ func (p *Parser) expectNextTokenToBe(token token.TokenType) bool {
 }
 
 func (p *Parser) catchPeekError(t token.TokenType) {
-	p.errors = append(p.errors, errors.ExpectedNextTokenToBe(t, token.TokenType(p.nextToken.Value)))
+	p.addError(p.nextToken.Position, errors.ExpectedNextTokenToBe(t, token.TokenType(p.nextToken.Value)))
 }
 
 func (p *Parser) tokenPrecedence(t *token.Token) int {
@@ -462,6 +771,42 @@ func (p *Parser) currentPrecedence() int {
 	return p.tokenPrecedence(&p.currentToken)
 }
 
+func (p *Parser) addError(pos token.Position, msg string) {
+	p.errors = append(p.errors, msg)
+	p.errorPositions = append(p.errorPositions, pos)
+}
+
+func (p *Parser) addWarning(pos token.Position, msg string) {
+	p.warnings = append(p.warnings, msg)
+	p.warningPositions = append(p.warningPositions, pos)
+}
+
 func (p *Parser) Errors() []string {
 	return p.errors
 }
+
+// ErrorPositions returns where each of the errors was found, in the order of
+// Errors.
+func (p *Parser) ErrorPositions() []token.Position {
+	return p.errorPositions
+}
+
+// Warnings returns problems that do not prevent the program from running,
+// such as match arms that can never be reached.
+func (p *Parser) Warnings() []string {
+	return p.warnings
+}
+
+// WarningPositions returns where each of the warnings was found, in the
+// order of Warnings.
+func (p *Parser) WarningPositions() []token.Position {
+	return p.warningPositions
+}
+
+// WriteWarnings writes the warnings to w, one per line, each preceded by
+// path and where it was found.
+func (p *Parser) WriteWarnings(w io.Writer, path string) {
+	for i, msg := range p.warnings {
+		fmt.Fprintf(w, "%s:%s: warning: %s\n", path, p.warningPositions[i], msg)
+	}
+}
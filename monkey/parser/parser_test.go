@@ -5,6 +5,7 @@ import (
 	"monkey/ast"
 	"monkey/lexer"
 	"monkey/token"
+	"reflect"
 	"strconv"
 	"strings"
 	"testing"
@@ -44,6 +45,10 @@ func TestArrayLiteral(t *testing.T) {
 		t.Fatalf("expr is not ast.ArrayLiteral, got %T", stmt.Expression)
 	}
 
+	if array.Token.Type != token.LBRACKET || array.Token.Column != 1 {
+		t.Fatalf("array.Token is not the opening bracket, got %q at %s", array.Token.Value, array.Token.Position)
+	}
+
 	if len(array.Elements) != 3 {
 		t.Fatalf("len(array.Elements) not 3, got %d", len(array.Elements))
 	}
@@ -116,8 +121,14 @@ func testLetStatement(t *testing.T, s ast.Statement, name string) bool {
 		t.Errorf("s not *ast.LetStatement, got %T", s)
 	}
 
-	if letStmt.Name.Value != name {
-		t.Errorf("letStmt.Name.Value not %s, got %s", name, letStmt.Name.Value)
+	ident, ok := letStmt.Name.(*ast.Identifier)
+	if !ok {
+		t.Errorf("letStmt.Name not *ast.Identifier, got %T", letStmt.Name)
+		return false
+	}
+
+	if ident.Value != name {
+		t.Errorf("letStmt.Name.Value not %s, got %s", name, ident.Value)
 		return false
 	}
 
@@ -307,6 +318,16 @@ func TestParsingInfixExpressions(t *testing.T) {
 		{"5 < 5;", 5, "<", 5},
 		{"5 == 5;", 5, "==", 5},
 		{"5 != 5;", 5, "!=", 5},
+		{"5 % 5;", 5, "%", 5},
+		{"5 <= 5;", 5, "<=", 5},
+		{"5 >= 5;", 5, ">=", 5},
+		{"5 & 5;", 5, "&", 5},
+		{"5 | 5;", 5, "|", 5},
+		{"5 ^ 5;", 5, "^", 5},
+		{"5 << 5;", 5, "<<", 5},
+		{"5 >> 5;", 5, ">>", 5},
+		{"true && false;", true, "&&", false},
+		{"true || false;", true, "||", false},
 		{"true == true;", true, "==", true},
 		{"true != false;", true, "!=", false},
 		{"false == false;", false, "==", false},
@@ -364,7 +385,7 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 		{"a + b - c", "((a + b) - c)"},
 		{"a * b / c", "((a * b) / c)"},
 		{"a + b / c", "(a + (b / c))"},
-		{"3 + 4; -5 * 9", "(3 + 4)((-5) * 9)"},
+		{"3 + 4; -5 * 9", "(3 + 4); ((-5) * 9)"},
 		{"5 > 4 == 3 < 4", "((5 > 4) == (3 < 4))"},
 		{"3 + 4 * 5 == 3 * 1 + 4 * 5", "((3 + (4 * 5)) == ((3 * 1) + (4 * 5)))"},
 		{"true", "true"},
@@ -388,6 +409,17 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 			"add(a * b[2], b[1], 2 * [1, 2][1])",
 			"add((a * (b[2])), (b[1]), (2 * ([1, 2][1])))",
 		},
+		{"a || b && c", "(a || (b && c))"},
+		{"a && b || c && d", "((a && b) || (c && d))"},
+		{"a < b && b <= c", "((a < b) && (b <= c))"},
+		{"a == b || a >= c", "((a == b) || (a >= c))"},
+		{"a % b * c", "((a % b) * c)"},
+		{"a + b % c", "(a + (b % c))"},
+		{"a | b ^ c & d", "(a | (b ^ (c & d)))"},
+		{"a & b == c", "(a & (b == c))"},
+		{"a << b + c", "(a << (b + c))"},
+		{"a << b < c", "((a << b) < c)"},
+		{"a || b | c", "(a || (b | c))"},
 	}
 
 	for _, tt := range tests {
@@ -624,8 +656,8 @@ func TestFunctionLiteralParsing(t *testing.T) {
 		t.Fatalf("expected 2 parameters for function literal, got %d", len(function.Parameters))
 	}
 
-	testLiteralExpression(t, function.Parameters[0], "x")
-	testLiteralExpression(t, function.Parameters[1], "y")
+	testLiteralExpression(t, function.Parameters[0].(ast.Expression), "x")
+	testLiteralExpression(t, function.Parameters[1].(ast.Expression), "y")
 
 	if len(function.Body.Statements) != 1 {
 		t.Fatalf("expected function.Body.Statements to have 1 statement, got %d", len(function.Body.Statements))
@@ -664,7 +696,7 @@ func TestFunctionParameterParsing(t *testing.T) {
 		}
 
 		for i, ident := range tt.expectedParams {
-			testLiteralExpression(t, function.Parameters[i], ident)
+			testLiteralExpression(t, function.Parameters[i].(ast.Expression), ident)
 		}
 	}
 }
@@ -727,3 +759,635 @@ func testInfixExpression(t *testing.T, exp ast.Expression, left interface{},
 
 	return true
 }
+
+func TestParsingHashLiterals(t *testing.T) {
+	input := `{"one": 1, "two": 2, "three": 3}`
+
+	p := New(lexer.New(input))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	hash, ok := stmt.Expression.(*ast.HashLiteral)
+	if !ok {
+		t.Fatalf("expr is not ast.HashLiteral, got %T", stmt.Expression)
+	}
+
+	expected := []struct {
+		key   string
+		value int64
+	}{
+		{"one", 1},
+		{"two", 2},
+		{"three", 3},
+	}
+
+	if len(hash.Pairs) != len(expected) {
+		t.Fatalf("hash.Pairs has wrong length, got %d", len(hash.Pairs))
+	}
+
+	for i, pair := range hash.Pairs {
+		literal, ok := pair.Key.(*ast.StringLiteral)
+		if !ok {
+			t.Errorf("key is not ast.StringLiteral, got %T", pair.Key)
+			continue
+		}
+		if literal.Value != expected[i].key {
+			t.Errorf("key %d not %q, got %q", i, expected[i].key, literal.Value)
+		}
+		testIntegerLiteral(t, pair.Value, expected[i].value)
+	}
+}
+
+func TestParsingEmptyHashLiteral(t *testing.T) {
+	p := New(lexer.New("{}"))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	hash, ok := stmt.Expression.(*ast.HashLiteral)
+	if !ok {
+		t.Fatalf("expr is not ast.HashLiteral, got %T", stmt.Expression)
+	}
+
+	if len(hash.Pairs) != 0 {
+		t.Errorf("hash.Pairs has wrong length, got %d", len(hash.Pairs))
+	}
+}
+
+func TestAssignExpressionParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"x = 5", "(x = 5)"},
+		{"x = y = 1 + 2", "(x = (y = (1 + 2)))"},
+		{"x = x * 2 == 4", "(x = ((x * 2) == 4))"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if got := program.String(); got != tt.expected {
+			t.Errorf("Expected %s, got %s", tt.expected, got)
+		}
+	}
+
+	p := New(lexer.New("1 = 2"))
+	p.ParseProgram()
+	if len(p.Errors()) == 0 {
+		t.Errorf("expected an error assigning to a literal")
+	}
+
+	// Incomplete left sides are reported where they are incomplete.
+	for _, input := range []string{"(1 + ) = 2", "a[1 + ] = 2", "f(1 +) = 2"} {
+		p := New(lexer.New(input))
+		p.ParseProgram()
+		if len(p.Errors()) == 0 {
+			t.Errorf("%q: expected an error", input)
+		}
+	}
+}
+
+func TestWhileStatementParsing(t *testing.T) {
+	input := `while (x < 10) { x = x + 1; }`
+
+	p := New(lexer.New(input))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("expected program.Statements to have 1 statement, got %d", len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.WhileStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.WhileStatement, got %T", program.Statements[0])
+	}
+
+	if !testInfixExpression(t, stmt.Condition, "x", "<", 10) {
+		return
+	}
+
+	if len(stmt.Body.Statements) != 1 {
+		t.Fatalf("expected while body to have 1 statement, got %d", len(stmt.Body.Statements))
+	}
+}
+
+func TestForStatementParsing(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedKey   string
+		expectedValue string
+	}{
+		{"for (x in xs) { x }", "", "x"},
+		{"for (i, x in [1, 2]) { x }", "i", "x"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt, ok := program.Statements[0].(*ast.ForStatement)
+		if !ok {
+			t.Fatalf("program.Statements[0] is not ast.ForStatement, got %T", program.Statements[0])
+		}
+
+		if tt.expectedKey == "" && stmt.Key != nil {
+			t.Errorf("expected no key variable, got %s", stmt.Key)
+		}
+		if tt.expectedKey != "" && !testIdentifier(t, stmt.Key, tt.expectedKey) {
+			return
+		}
+		if !testIdentifier(t, stmt.Value, tt.expectedValue) {
+			return
+		}
+		if len(stmt.Body.Statements) != 1 {
+			t.Errorf("expected for body to have 1 statement, got %d", len(stmt.Body.Statements))
+		}
+	}
+}
+
+func TestBreakAndContinueParsing(t *testing.T) {
+	tests := []struct {
+		input       string
+		expectedErr string
+	}{
+		{"while (true) { break; }", ""},
+		{"for (x in xs) { if (x) { continue; } }", ""},
+		{"break;", "break outside of loop"},
+		{"continue", "continue outside of loop"},
+		{"while (true) { function() { break; } }", "break outside of loop"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		if tt.expectedErr == "" {
+			checkParserErrors(t, p)
+			continue
+		}
+
+		if len(p.Errors()) != 1 || p.Errors()[0] != tt.expectedErr {
+			t.Errorf("%q: expected error %q, got %v", tt.input, tt.expectedErr, p.Errors())
+		}
+	}
+}
+
+func TestMatchExpressionParsing(t *testing.T) {
+	input := `match (x) { 0 => "zero", [head, ...tail] if head > 0 => head, {name, "age": a} => a, _ => { 1 } }`
+
+	p := New(lexer.New(input))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	match, ok := stmt.Expression.(*ast.MatchExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.MatchExpression, got %T", stmt.Expression)
+	}
+
+	if !testIdentifier(t, match.Subject, "x") {
+		return
+	}
+
+	if len(match.Arms) != 4 {
+		t.Fatalf("expected 4 match arms, got %d", len(match.Arms))
+	}
+
+	literal, ok := match.Arms[0].Pattern.(*ast.LiteralPattern)
+	if !ok {
+		t.Fatalf("arm 0 pattern is not ast.LiteralPattern, got %T", match.Arms[0].Pattern)
+	}
+	testIntegerLiteral(t, literal.Value, 0)
+
+	array, ok := match.Arms[1].Pattern.(*ast.ArrayPattern)
+	if !ok {
+		t.Fatalf("arm 1 pattern is not ast.ArrayPattern, got %T", match.Arms[1].Pattern)
+	}
+	if len(array.Elements) != 1 || array.Rest == nil || array.Rest.Value != "tail" {
+		t.Errorf("arm 1 pattern wrong, got %s", array)
+	}
+	if !testInfixExpression(t, match.Arms[1].Guard, "head", ">", 0) {
+		return
+	}
+
+	hash, ok := match.Arms[2].Pattern.(*ast.HashPattern)
+	if !ok {
+		t.Fatalf("arm 2 pattern is not ast.HashPattern, got %T", match.Arms[2].Pattern)
+	}
+	if len(hash.Pairs) != 2 {
+		t.Fatalf("expected 2 hash pattern pairs, got %d", len(hash.Pairs))
+	}
+	if !testIdentifier(t, hash.Pairs[0].Value.(ast.Expression), "name") {
+		return
+	}
+
+	if _, ok := match.Arms[3].Pattern.(*ast.WildcardPattern); !ok {
+		t.Fatalf("arm 3 pattern is not ast.WildcardPattern, got %T", match.Arms[3].Pattern)
+	}
+
+	if len(p.Warnings()) != 0 {
+		t.Errorf("expected no warnings, got %v", p.Warnings())
+	}
+}
+
+func TestUnreachableMatchArmWarnings(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{`match (x) { 1 => 1, _ => 2 }`, nil},
+		{`match (x) { n if n > 1 => 1, n => 2 }`, nil},
+		{`match (x) { _ => 1, 2 => 2, [a] => 3 }`, []string{"unreachable match arm: 2", "unreachable match arm: [a]"}},
+		{`match (x) { n => 1, _ => 2 }`, []string{"unreachable match arm: _"}},
+		{`match (x) { 1 => 1, 1 => 2 }`, []string{"unreachable match arm: 1"}},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+		checkParserErrors(t, p)
+
+		warnings := p.Warnings()
+		if len(warnings) != len(tt.expected) {
+			t.Errorf("%q: expected warnings %v, got %v", tt.input, tt.expected, warnings)
+			continue
+		}
+		for i, w := range tt.expected {
+			if warnings[i] != w {
+				t.Errorf("%q: expected warning %q, got %q", tt.input, w, warnings[i])
+			}
+		}
+	}
+}
+
+func TestErrorPositions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"let x = ;", []string{"1:9"}},
+		{"let = 1;", []string{"1:5"}},
+		{"let f = function(a = 1, b) { a };", []string{"1:25"}},
+		{"1 = 2", []string{"1:1"}},
+		{"let x: foo = 1;", []string{"1:8"}},
+		{"if (true) {\n  break;\n}", []string{"2:3"}},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		positions := []string{}
+		for _, pos := range p.ErrorPositions() {
+			positions = append(positions, pos.String())
+		}
+		if len(p.Errors()) < len(tt.expected) || !reflect.DeepEqual(positions[:len(tt.expected)], tt.expected) {
+			t.Errorf("%q: expected errors at %v, got %v %v", tt.input, tt.expected, positions, p.Errors())
+		}
+		if len(positions) != len(p.Errors()) {
+			t.Errorf("%q: %d positions for %d errors", tt.input, len(positions), len(p.Errors()))
+		}
+	}
+
+	p := New(lexer.New("match (x) { _ => 1,\n  2 => 2 }"))
+	p.ParseProgram()
+	if positions := p.WarningPositions(); len(positions) != 1 || positions[0].String() != "2:3" {
+		t.Errorf("expected a warning at 2:3, got %v", positions)
+	}
+}
+
+func TestInvalidPatterns(t *testing.T) {
+	p := New(lexer.New(`match (x) { (1 + 2) => 1 }`))
+	p.ParseProgram()
+
+	if len(p.Errors()) == 0 || p.Errors()[0] != "( cannot be used as a pattern" {
+		t.Errorf("expected invalid pattern error, got %v", p.Errors())
+	}
+}
+
+func TestDestructuringLetStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let [a, b] = xs;", "let [a, b] = xs;"},
+		{"let [a, b, ...rest] = xs;", "let [a, b, ...rest] = xs;"},
+		{"let [first, [x, _]] = xs;", "let [first, [x, _]] = xs;"},
+		{"let {name, age} = person;", "let {\"name\": name, \"age\": age} = person;"},
+		{`let {"name": n, born: [y, ..._]} = person;`, "let {\"name\": n, \"born\": [y, ..._]} = person;"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt, ok := program.Statements[0].(*ast.LetStatement)
+		if !ok {
+			t.Fatalf("program.Statements[0] is not ast.LetStatement, got %T", program.Statements[0])
+		}
+
+		switch stmt.Name.(type) {
+		case *ast.ArrayPattern, *ast.HashPattern:
+		default:
+			t.Errorf("stmt.Name is not a destructuring pattern, got %T", stmt.Name)
+		}
+
+		if got := program.String(); got != tt.expected {
+			t.Errorf("Expected %s, got %s", tt.expected, got)
+		}
+	}
+}
+
+func TestDestructuringFunctionParameters(t *testing.T) {
+	input := "function(x, [a, ...rest], {name}) { x };"
+
+	p := New(lexer.New(input))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	function := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.FunctionLiteral)
+	if len(function.Parameters) != 3 {
+		t.Fatalf("expected 3 parameters, got %d", len(function.Parameters))
+	}
+
+	testLiteralExpression(t, function.Parameters[0].(ast.Expression), "x")
+
+	if _, ok := function.Parameters[1].(*ast.ArrayPattern); !ok {
+		t.Errorf("parameter 1 is not ast.ArrayPattern, got %T", function.Parameters[1])
+	}
+	if _, ok := function.Parameters[2].(*ast.HashPattern); !ok {
+		t.Errorf("parameter 2 is not ast.HashPattern, got %T", function.Parameters[2])
+	}
+}
+
+func TestInvalidBindingPatterns(t *testing.T) {
+	tests := []string{
+		"let 5 = x;",
+		"function(1) { 1 }",
+		"let [1 + 2] = x;",
+	}
+
+	for _, input := range tests {
+		p := New(lexer.New(input))
+		p.ParseProgram()
+		if len(p.Errors()) == 0 {
+			t.Errorf("%q: expected parser errors", input)
+		}
+	}
+}
+
+func TestFunctionDefaultAndRestParameters(t *testing.T) {
+	input := "function(x, y = 10, z = x + 1, ...rest) { x };"
+
+	p := New(lexer.New(input))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	function := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.FunctionLiteral)
+	if len(function.Parameters) != 3 || len(function.Defaults) != 3 {
+		t.Fatalf("expected 3 parameters and defaults, got %d and %d", len(function.Parameters), len(function.Defaults))
+	}
+
+	if function.Defaults[0] != nil {
+		t.Errorf("expected no default for x, got %s", function.Defaults[0])
+	}
+	testIntegerLiteral(t, function.Defaults[1], 10)
+	testInfixExpression(t, function.Defaults[2], "x", "+", 1)
+
+	if function.Rest == nil || function.Rest.Value != "rest" {
+		t.Errorf("expected rest parameter named rest, got %v", function.Rest)
+	}
+
+	expected := "function(x, y = 10, z = (x + 1), ...rest) { x }"
+	if function.String() != expected {
+		t.Errorf("expected %q, got %q", expected, function.String())
+	}
+}
+
+func TestInvalidFunctionParameters(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"function(x = 1, y) { x }", "required parameter y follows a parameter with a default value"},
+		{"function(...rest, x) { x }", "Expected next token to be ) got ,"},
+		{"function(...) { 1 }", "Expected next token to be IDENT got )"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		if len(p.Errors()) == 0 || p.Errors()[0] != tt.expected {
+			t.Errorf("%q: expected error %q, got %v", tt.input, tt.expected, p.Errors())
+		}
+	}
+}
+
+func TestTypeAnnotationParsing(t *testing.T) {
+	input := "function(x: int, [a, b]: [string], f: function(int, bool): [int] = g, ...rest: [any]): hash { x };"
+
+	p := New(lexer.New(input))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	function := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.FunctionLiteral)
+	if len(function.ParameterTypes) != 3 {
+		t.Fatalf("expected 3 parameter types, got %d", len(function.ParameterTypes))
+	}
+
+	named, ok := function.ParameterTypes[0].(*ast.NamedType)
+	if !ok || named.Name != "int" {
+		t.Errorf("expected x to be annotated int, got %v", function.ParameterTypes[0])
+	}
+	array, ok := function.ParameterTypes[1].(*ast.ArrayType)
+	if !ok || array.Element.String() != "string" {
+		t.Errorf("expected [a, b] to be annotated [string], got %v", function.ParameterTypes[1])
+	}
+	fnType, ok := function.ParameterTypes[2].(*ast.FunctionType)
+	if !ok || len(fnType.Parameters) != 2 || fnType.Return.String() != "[int]" {
+		t.Errorf("expected f to be annotated function(int, bool): [int], got %v", function.ParameterTypes[2])
+	}
+	if function.RestType == nil || function.RestType.String() != "[any]" {
+		t.Errorf("expected rest to be annotated [any], got %v", function.RestType)
+	}
+	if function.ReturnType == nil || function.ReturnType.String() != "hash" {
+		t.Errorf("expected return type hash, got %v", function.ReturnType)
+	}
+
+	expected := "function(x: int, [a, b]: [string], f: function(int, bool): [int] = g, ...rest: [any]): hash { x }"
+	if function.String() != expected {
+		t.Errorf("expected %q, got %q", expected, function.String())
+	}
+
+	p = New(lexer.New("let n: int = 1; let m = 2;"))
+	program = p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if let := program.Statements[0].(*ast.LetStatement); let.Type == nil || let.Type.String() != "int" {
+		t.Errorf("expected n to be annotated int, got %v", let.Type)
+	}
+	if let := program.Statements[1].(*ast.LetStatement); let.Type != nil {
+		t.Errorf("expected m to have no annotation, got %v", let.Type)
+	}
+}
+
+func TestInvalidTypeAnnotations(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let x: integer = 1;", "unknown type integer"},
+		{"let x: 5 = 1;", "INT cannot be used as a type"},
+		{"function(x: [int) { x }", "Expected next token to be ] got )"},
+		{"function(f: function(int)) { f }", "Expected next token to be : got )"},
+		{"function(x): { x }", "{ cannot be used as a type"},
+		{"macro(x: int) { x }", "macro parameters and results cannot have type annotations"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		if len(p.Errors()) == 0 || p.Errors()[0] != tt.expected {
+			t.Errorf("%q: expected error %q, got %v", tt.input, tt.expected, p.Errors())
+		}
+	}
+}
+
+func TestSpreadArgumentParsing(t *testing.T) {
+	p := New(lexer.New("f(a, ...b, ...[1, 2])"))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	call := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.CallExpression)
+	if len(call.Arguments) != 3 {
+		t.Fatalf("expected 3 arguments, got %d", len(call.Arguments))
+	}
+
+	spread, ok := call.Arguments[1].(*ast.SpreadExpression)
+	if !ok {
+		t.Fatalf("argument 1 is not ast.SpreadExpression, got %T", call.Arguments[1])
+	}
+	testIdentifier(t, spread.Value, "b")
+
+	if program.String() != "f(a, ...b, ...[1, 2])" {
+		t.Errorf("unexpected program string %q", program.String())
+	}
+}
+
+func TestImportStatementParsing(t *testing.T) {
+	tests := []struct {
+		input        string
+		expectedPath string
+		expectedName string
+	}{
+		{`import "math";`, "math", "math"},
+		{`import "lib/strings.monkey"`, "lib/strings.monkey", "strings"},
+		{`import "../util" as u;`, "../util", "u"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt, ok := program.Statements[0].(*ast.ImportStatement)
+		if !ok {
+			t.Fatalf("program.Statements[0] is not ast.ImportStatement, got %T", program.Statements[0])
+		}
+		if stmt.Path != tt.expectedPath {
+			t.Errorf("stmt.Path not %q, got %q", tt.expectedPath, stmt.Path)
+		}
+		if stmt.Name.Value != tt.expectedName {
+			t.Errorf("stmt.Name not %q, got %q", tt.expectedName, stmt.Name.Value)
+		}
+	}
+}
+
+func TestExportAndMemberParsing(t *testing.T) {
+	p := New(lexer.New(`export let area = function(r) { r * math.pi };`))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt, ok := program.Statements[0].(*ast.ExportStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.ExportStatement, got %T", program.Statements[0])
+	}
+	if !testLetStatement(t, stmt.Statement, "area") {
+		return
+	}
+
+	expected := "export let area = function(r) { (r * (math.pi)) };"
+	if program.String() != expected {
+		t.Errorf("expected %q, got %q", expected, program.String())
+	}
+}
+
+func TestModuleStatementErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`if (true) { import "math"; }`, "import is only allowed at the top level"},
+		{`function() { export let x = 1; }`, "export is only allowed at the top level"},
+		{`import "my-lib";`, "cannot derive a module name from \"my-lib\", use `as name`"},
+		{`export 5;`, "Expected next token to be LET got 5"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		if len(p.Errors()) == 0 || p.Errors()[0] != tt.expected {
+			t.Errorf("%q: expected error %q, got %v", tt.input, tt.expected, p.Errors())
+		}
+	}
+}
+
+func TestMacroLiteralParsing(t *testing.T) {
+	input := `macro(x, y) { x + y; }`
+
+	p := New(lexer.New(input))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("expected program.Statements to have 1 statement, got %d", len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.ExpressionStatement, got %T", program.Statements[0])
+	}
+
+	macro, ok := stmt.Expression.(*ast.MacroLiteral)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.MacroLiteral, got %T", stmt.Expression)
+	}
+
+	if len(macro.Parameters) != 2 {
+		t.Fatalf("expected 2 parameters for macro literal, got %d", len(macro.Parameters))
+	}
+
+	testLiteralExpression(t, macro.Parameters[0].(ast.Expression), "x")
+	testLiteralExpression(t, macro.Parameters[1].(ast.Expression), "y")
+
+	if len(macro.Body.Statements) != 1 {
+		t.Fatalf("expected macro.Body.Statements to have 1 statement, got %d", len(macro.Body.Statements))
+	}
+
+	body, ok := macro.Body.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("macro body is not an ast.ExpressionStatement, got %T", macro.Body.Statements[0])
+	}
+
+	testInfixExpression(t, body.Expression, "x", "+", "y")
+}
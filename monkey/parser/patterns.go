@@ -0,0 +1,225 @@
+package parser
+
+import (
+	"monkey/ast"
+	"monkey/errors"
+	"monkey/token"
+)
+
+func (p *Parser) parseMatchExpression() ast.Expression {
+	expr := &ast.MatchExpression{Token: p.currentToken}
+
+	if !p.expectNextTokenToBe(token.LPAREN) {
+		return nil
+	}
+
+	p.advanceToNextToken()
+	expr.Subject = p.parseExpression(LOWEST)
+
+	if !p.expectNextTokenToBe(token.RPAREN) {
+		return nil
+	}
+
+	if !p.expectNextTokenToBe(token.LBRACE) {
+		return nil
+	}
+
+	for p.nextToken.Type != token.RBRACE {
+		p.advanceToNextToken()
+
+		arm := p.parseMatchArm()
+		if arm == nil {
+			return nil
+		}
+		expr.Arms = append(expr.Arms, arm)
+
+		if p.nextToken.Type == token.COMMA {
+			p.advanceToNextToken()
+		}
+	}
+
+	if !p.expectNextTokenToBe(token.RBRACE) {
+		return nil
+	}
+
+	p.checkMatchArmsReachable(expr.Arms)
+
+	return expr
+}
+
+func (p *Parser) parseMatchArm() *ast.MatchArm {
+	arm := &ast.MatchArm{Pattern: p.parsePattern()}
+	if arm.Pattern == nil {
+		return nil
+	}
+
+	if p.nextToken.Type == token.IF {
+		p.advanceToNextToken()
+		p.advanceToNextToken()
+		arm.Guard = p.parseExpression(LOWEST)
+	}
+
+	if !p.expectNextTokenToBe(token.ARROW) {
+		return nil
+	}
+
+	p.advanceToNextToken()
+
+	if p.currentToken.Type == token.LBRACE {
+		arm.Body = p.parseBlockStatement()
+		return arm
+	}
+
+	// A bare expression body is treated as a block holding that expression.
+	stmt := &ast.ExpressionStatement{Token: p.currentToken}
+	stmt.Expression = p.parseExpression(LOWEST)
+	arm.Body = &ast.BlockStatement{Token: stmt.Token, Statements: []ast.Statement{stmt}}
+
+	return arm
+}
+
+func (p *Parser) parsePattern() ast.Pattern {
+	switch p.currentToken.Type {
+	case token.IDENT:
+		if p.currentToken.Value == "_" {
+			return &ast.WildcardPattern{Token: p.currentToken}
+		}
+		return &ast.Identifier{Token: p.currentToken, Value: p.currentToken.Value}
+	case token.INT, token.STRING, token.TRUE, token.FALSE, token.MINUS:
+		pattern := &ast.LiteralPattern{Token: p.currentToken}
+		pattern.Value = p.parseExpression(PREFIX)
+		if pattern.Value == nil {
+			return nil
+		}
+		return pattern
+	case token.LBRACKET:
+		return p.parseArrayPattern()
+	case token.LBRACE:
+		return p.parseHashPattern()
+	default:
+		p.addError(p.currentToken.Position, errors.InvalidPattern(p.currentToken.Type))
+		return nil
+	}
+}
+
+// parseBindingPattern parses the target of a let statement or a function
+// parameter: a plain identifier or an array or hash destructuring pattern.
+func (p *Parser) parseBindingPattern() ast.Pattern {
+	switch p.currentToken.Type {
+	case token.IDENT:
+		return &ast.Identifier{Token: p.currentToken, Value: p.currentToken.Value}
+	case token.LBRACKET:
+		return p.parseArrayPattern()
+	case token.LBRACE:
+		return p.parseHashPattern()
+	default:
+		p.addError(p.currentToken.Position, errors.ExpectedNextTokenToBe(token.IDENT, token.TokenType(p.currentToken.Value)))
+		return nil
+	}
+}
+
+func (p *Parser) parseArrayPattern() ast.Pattern {
+	pattern := &ast.ArrayPattern{Token: p.currentToken, Elements: []ast.Pattern{}}
+
+	for p.nextToken.Type != token.RBRACKET {
+		p.advanceToNextToken()
+
+		if p.currentToken.Type == token.ELLIPSIS {
+			if !p.expectNextTokenToBe(token.IDENT) {
+				return nil
+			}
+			pattern.Rest = &ast.Identifier{Token: p.currentToken, Value: p.currentToken.Value}
+			break
+		}
+
+		element := p.parsePattern()
+		if element == nil {
+			return nil
+		}
+		pattern.Elements = append(pattern.Elements, element)
+
+		if p.nextToken.Type != token.RBRACKET && !p.expectNextTokenToBe(token.COMMA) {
+			return nil
+		}
+	}
+
+	if !p.expectNextTokenToBe(token.RBRACKET) {
+		return nil
+	}
+
+	return pattern
+}
+
+// parseHashPattern parses {"key": pattern, name: pattern, name}. A bare
+// identifier key stands for the string of the same name, and a key with no
+// pattern binds the value to that name.
+func (p *Parser) parseHashPattern() ast.Pattern {
+	pattern := &ast.HashPattern{Token: p.currentToken, Pairs: []ast.HashPatternPair{}}
+
+	for p.nextToken.Type != token.RBRACE {
+		p.advanceToNextToken()
+
+		var pair ast.HashPatternPair
+		switch p.currentToken.Type {
+		case token.IDENT:
+			pair.Key = &ast.StringLiteral{Token: p.currentToken, Value: p.currentToken.Value}
+			if p.nextToken.Type != token.COLON {
+				pair.Value = &ast.Identifier{Token: p.currentToken, Value: p.currentToken.Value}
+			}
+		case token.STRING, token.INT, token.TRUE, token.FALSE:
+			pair.Key = p.parseExpression(PREFIX)
+		default:
+			p.addError(p.currentToken.Position, errors.InvalidPattern(p.currentToken.Type))
+			return nil
+		}
+
+		if pair.Value == nil {
+			if !p.expectNextTokenToBe(token.COLON) {
+				return nil
+			}
+			p.advanceToNextToken()
+			pair.Value = p.parsePattern()
+			if pair.Value == nil {
+				return nil
+			}
+		}
+
+		pattern.Pairs = append(pattern.Pairs, pair)
+
+		if p.nextToken.Type != token.RBRACE && !p.expectNextTokenToBe(token.COMMA) {
+			return nil
+		}
+	}
+
+	if !p.expectNextTokenToBe(token.RBRACE) {
+		return nil
+	}
+
+	return pattern
+}
+
+// checkMatchArmsReachable warns about arms that follow an unguarded arm
+// matching every value, and about unguarded arms repeating an earlier
+// unguarded pattern.
+func (p *Parser) checkMatchArmsReachable(arms []*ast.MatchArm) {
+	seen := map[string]bool{}
+	exhausted := false
+
+	for _, arm := range arms {
+		pattern := arm.Pattern.String()
+		if exhausted || (arm.Guard == nil && seen[pattern]) {
+			p.addWarning(ast.Pos(arm.Pattern), errors.UnreachableMatchArm(pattern))
+			continue
+		}
+
+		if arm.Guard != nil {
+			continue
+		}
+		seen[pattern] = true
+
+		switch arm.Pattern.(type) {
+		case *ast.WildcardPattern, *ast.Identifier:
+			exhausted = true
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package parser
+
+import (
+	"monkey/ast"
+	"monkey/errors"
+	"monkey/token"
+)
+
+// parseTypeAnnotation parses the `: T` after a binding, if there is one.
+// ok is false when an annotation is present but malformed.
+func (p *Parser) parseTypeAnnotation() (annotation ast.TypeExpression, ok bool) {
+	if p.nextToken.Type != token.COLON {
+		return nil, true
+	}
+	p.advanceToNextToken()
+	p.advanceToNextToken()
+
+	annotation = p.parseTypeExpression()
+	return annotation, annotation != nil
+}
+
+// parseTypeExpression parses `int`, `[T]` or `function(T, U): R` starting
+// at the current token.
+func (p *Parser) parseTypeExpression() ast.TypeExpression {
+	switch p.currentToken.Type {
+	case token.IDENT:
+		if !ast.TypeNames[p.currentToken.Value] {
+			p.addError(p.currentToken.Position, errors.UnknownType(p.currentToken.Value))
+			return nil
+		}
+		return &ast.NamedType{Token: p.currentToken, Name: p.currentToken.Value}
+
+	case token.LBRACKET:
+		array := &ast.ArrayType{Token: p.currentToken}
+		p.advanceToNextToken()
+		if array.Element = p.parseTypeExpression(); array.Element == nil {
+			return nil
+		}
+		if !p.expectNextTokenToBe(token.RBRACKET) {
+			return nil
+		}
+		return array
+
+	case token.FUNCTION:
+		function := &ast.FunctionType{Token: p.currentToken, Parameters: []ast.TypeExpression{}}
+		if !p.expectNextTokenToBe(token.LPAREN) {
+			return nil
+		}
+		for p.nextToken.Type != token.RPAREN {
+			p.advanceToNextToken()
+			param := p.parseTypeExpression()
+			if param == nil {
+				return nil
+			}
+			function.Parameters = append(function.Parameters, param)
+
+			if p.nextToken.Type != token.COMMA {
+				break
+			}
+			p.advanceToNextToken()
+		}
+		if !p.expectNextTokenToBe(token.RPAREN) || !p.expectNextTokenToBe(token.COLON) {
+			return nil
+		}
+		p.advanceToNextToken()
+		if function.Return = p.parseTypeExpression(); function.Return == nil {
+			return nil
+		}
+		return function
+
+	default:
+		p.addError(p.currentToken.Position, errors.InvalidType(p.currentToken.Type))
+		return nil
+	}
+}
@@ -0,0 +1,441 @@
+// Package profiler attributes the time and memory a Monkey program spends
+// to its functions and to the places it calls them from.
+//
+// The profiler follows calls through evaluator hooks, in one of two modes.
+// Instrumenting, it reads the clock and the Go runtime's allocation counters
+// on every call and return, so its figures are exact but include its own
+// overhead. Sampling, it reads them only every so often and charges what
+// went by since to the call stack of the moment, so its times and
+// allocations are estimates, cheap enough for long runs; the numbers of
+// calls stay exact. Allocations are those of the whole process, which the
+// interpreter dominates.
+package profiler
+
+import (
+	"monkey/ast"
+	"monkey/evaluator"
+	"monkey/object"
+	"runtime/metrics"
+	"time"
+)
+
+// Function is what a function definition, or a builtin, cost. Self figures
+// leave out the functions it called; total ones count recursive calls
+// once.
+type Function struct {
+	Name    string
+	File    string
+	Line    int
+	Builtin bool
+
+	Calls       int
+	Self, Total time.Duration
+
+	SelfBytes, TotalBytes   uint64
+	SelfAllocs, TotalAllocs uint64
+}
+
+// CallSite is what the calls made by one call expression cost.
+type CallSite struct {
+	Callee string
+	File   string
+	Line   int
+	Column int
+
+	Calls       int
+	Total       time.Duration
+	TotalBytes  uint64
+	TotalAllocs uint64
+}
+
+// Edge is what the calls from one function to another cost.
+type Edge struct {
+	Caller, Callee *Function
+	Calls          int
+	Total          time.Duration
+}
+
+// Profiler records a profile of everything an interpreter evaluates
+// between New, or NewSampling, and Stop.
+type Profiler struct {
+	evaluator.NoHook
+
+	in      *evaluator.Interpreter
+	now     func() time.Time
+	counter func() (bytes, allocs uint64)
+
+	// When sampling, due reports whether a sample should be taken, and
+	// last is when the previous one was, and the counters then.
+	due                   func() bool
+	last                  time.Time
+	lastBytes, lastAllocs uint64
+
+	program   *Function
+	functions map[interface{}]*Function
+	called    map[*Function]bool
+	order     []*Function
+	sites     map[*ast.CallExpression]*CallSite
+	siteOrder []*CallSite
+	edges     map[[2]*Function]*Edge
+	edgeOrder []*Edge
+	folded    map[string]time.Duration
+
+	stack  []*frame
+	active map[interface{}]int
+}
+
+type frame struct {
+	function *Function
+	site     *CallSite
+	edge     *Edge
+	stack    string
+
+	start         time.Time
+	bytes, allocs uint64
+
+	// What the frame's callees cost, to subtract from its own.
+	childTime               time.Duration
+	childBytes, childAllocs uint64
+}
+
+// New starts profiling what in evaluates by instrumenting every call.
+func New(in *evaluator.Interpreter) *Profiler {
+	return start(in, time.Now, readAllocations, nil)
+}
+
+// NewSampling starts profiling what in evaluates by sampling its call stack
+// every interval.
+func NewSampling(in *evaluator.Interpreter, interval time.Duration) *Profiler {
+	// Samples are taken at hooks, on the interpreter's goroutine, so the
+	// stack is never read while it changes. Reading the clock at every hook
+	// would cost as much as instrumenting, so only every checkEvery do.
+	next := time.Now().Add(interval)
+	events := 0
+	return start(in, time.Now, readAllocations, func() bool {
+		events++
+		if events%checkEvery != 0 {
+			return false
+		}
+		now := time.Now()
+		if now.Before(next) {
+			return false
+		}
+		next = now.Add(interval)
+		return true
+	})
+}
+
+// checkEvery is how many hooks a sampling profiler lets go by between
+// readings of the clock.
+const checkEvery = 64
+
+// start starts a profiler that samples whenever due reports true, or that
+// instruments every call if due is nil.
+func start(in *evaluator.Interpreter, now func() time.Time, counter func() (uint64, uint64), due func() bool) *Profiler {
+	p := &Profiler{
+		in:        in,
+		now:       now,
+		counter:   counter,
+		due:       due,
+		functions: make(map[interface{}]*Function),
+		called:    make(map[*Function]bool),
+		sites:     make(map[*ast.CallExpression]*CallSite),
+		edges:     make(map[[2]*Function]*Edge),
+		folded:    make(map[string]time.Duration),
+		active:    make(map[interface{}]int),
+	}
+	p.program = &Function{Name: "<program>"}
+	p.called[p.program] = true
+	if due != nil {
+		p.last = now()
+		p.lastBytes, p.lastAllocs = counter()
+	}
+	p.push(p.program, nil, nil)
+	in.AddHook(p)
+	return p
+}
+
+var allocationMetrics = []metrics.Sample{
+	{Name: "/gc/heap/allocs:bytes"},
+	{Name: "/gc/heap/allocs:objects"},
+}
+
+func readAllocations() (uint64, uint64) {
+	metrics.Read(allocationMetrics)
+	return allocationMetrics[0].Value.Uint64(), allocationMetrics[1].Value.Uint64()
+}
+
+// Stop ends the profile. The program's own figures run until then.
+func (p *Profiler) Stop() {
+	if p.due != nil && len(p.stack) > 0 {
+		p.sample()
+	}
+	for len(p.stack) > 0 {
+		p.pop()
+	}
+}
+
+// Program returns the figures of the program as a whole.
+func (p *Profiler) Program() *Function {
+	return p.program
+}
+
+// Functions returns the functions that were called, in the order of their
+// first calls.
+func (p *Profiler) Functions() []*Function {
+	return p.order
+}
+
+// CallSites returns the call expressions that called functions, in the
+// order of their first calls.
+func (p *Profiler) CallSites() []*CallSite {
+	return p.siteOrder
+}
+
+// Edges returns which functions called which, the program counting as the
+// caller of the calls it makes outside any function.
+func (p *Profiler) Edges() []*Edge {
+	return p.edgeOrder
+}
+
+// EnterNode takes the samples that are due while code runs between calls.
+func (p *Profiler) EnterNode(node ast.Node, env *object.Environment) {
+	p.poll()
+}
+
+// ExitNode registers function literals as they are evaluated, where the
+// file they are in is known, and names them after the lets that bind them.
+func (p *Profiler) ExitNode(node ast.Node, env *object.Environment, result object.Object) {
+	switch node := node.(type) {
+	case *ast.FunctionLiteral:
+		if _, ok := p.functions[node.Body]; !ok {
+			p.functions[node.Body] = &Function{Name: "<function>", File: p.file(), Line: ast.Pos(node).Line}
+		}
+	case *ast.LetStatement:
+		literal, isFunction := node.Value.(*ast.FunctionLiteral)
+		ident, isIdent := node.Name.(*ast.Identifier)
+		if isFunction && isIdent {
+			if function := p.functions[literal.Body]; function.Name == "<function>" {
+				function.Name = ident.Value
+			}
+		}
+	}
+}
+
+func (p *Profiler) Call(fn object.Object, args []object.Object, call *ast.CallExpression, env *object.Environment) {
+	p.poll()
+	function := p.function(fn, call)
+
+	var site *CallSite
+	if call != nil {
+		site = p.sites[call]
+		if site == nil {
+			pos := ast.Pos(call)
+			site = &CallSite{Callee: evaluator.CallName(call), File: p.file(), Line: pos.Line, Column: pos.Column}
+			p.sites[call] = site
+			p.siteOrder = append(p.siteOrder, site)
+		}
+	}
+
+	caller := p.stack[len(p.stack)-1].function
+	edge := p.edges[[2]*Function{caller, function}]
+	if edge == nil {
+		edge = &Edge{Caller: caller, Callee: function}
+		p.edges[[2]*Function{caller, function}] = edge
+		p.edgeOrder = append(p.edgeOrder, edge)
+	}
+
+	p.push(function, site, edge)
+}
+
+func (p *Profiler) Return(fn object.Object, call *ast.CallExpression, result object.Object) {
+	p.poll()
+	if len(p.stack) > 1 {
+		p.pop()
+	}
+}
+
+// function returns the entry of the function fn, listing it on its first
+// call.
+func (p *Profiler) function(fn object.Object, call *ast.CallExpression) *Function {
+	var key interface{} = fn
+	if fn, ok := fn.(*object.Function); ok {
+		key = fn.Body
+	}
+
+	function := p.functions[key]
+	if function == nil {
+		// A builtin, or a function defined before the profiler started.
+		function = &Function{Name: evaluator.CallName(call), Builtin: true}
+		if fn, ok := fn.(*object.Function); ok {
+			function.Line = fn.Body.Token.Position.Line
+			function.Builtin = false
+		}
+		p.functions[key] = function
+	}
+	if function.Name == "<function>" {
+		// Anonymous functions go by the name they are first called by.
+		function.Name = evaluator.CallName(call)
+	}
+
+	if !p.called[function] {
+		p.called[function] = true
+		p.order = append(p.order, function)
+	}
+	return function
+}
+
+// file is the file of the code being evaluated: that of the innermost
+// Monkey function running, or of the module being loaded.
+func (p *Profiler) file() string {
+	for i := len(p.stack) - 1; i > 0; i-- {
+		if f := p.stack[i].function; !f.Builtin {
+			return f.File
+		}
+	}
+	return p.in.File()
+}
+
+func (p *Profiler) push(function *Function, site *CallSite, edge *Edge) {
+	// The counters are read before the frame and its stack are built, so
+	// that building them is charged to the call and not to its caller.
+	var start time.Time
+	var bytes, allocs uint64
+	if p.due == nil {
+		bytes, allocs = p.counter()
+		start = p.now()
+	}
+
+	f := &frame{
+		function: function,
+		site:     site,
+		edge:     edge,
+		stack:    function.Name,
+		start:    start,
+		bytes:    bytes,
+		allocs:   allocs,
+	}
+	if n := len(p.stack); n > 0 {
+		f.stack = p.stack[n-1].stack + ";" + function.Name
+	}
+	p.stack = append(p.stack, f)
+	if p.due != nil {
+		return
+	}
+
+	for _, key := range f.keys() {
+		p.active[key]++
+	}
+}
+
+func (p *Profiler) pop() {
+	f := p.stack[len(p.stack)-1]
+	p.stack = p.stack[:len(p.stack)-1]
+	if f.site != nil {
+		f.site.Calls++
+	}
+	if f.edge != nil {
+		f.edge.Calls++
+	}
+	f.function.Calls++
+
+	if p.due != nil {
+		return
+	}
+
+	end := p.now()
+	bytes, allocs := p.counter()
+
+	total := end.Sub(f.start)
+	totalBytes, totalAllocs := bytes-f.bytes, allocs-f.allocs
+
+	function := f.function
+	function.Self += total - f.childTime
+	function.SelfBytes += totalBytes - f.childBytes
+	function.SelfAllocs += totalAllocs - f.childAllocs
+	p.folded[f.stack] += total - f.childTime
+
+	// Count the time of recursive calls once, in the outermost.
+	for _, key := range f.keys() {
+		p.active[key]--
+		if p.active[key] > 0 {
+			continue
+		}
+		switch key := key.(type) {
+		case *Function:
+			key.Total += total
+			key.TotalBytes += totalBytes
+			key.TotalAllocs += totalAllocs
+		case *CallSite:
+			key.Total += total
+			key.TotalBytes += totalBytes
+			key.TotalAllocs += totalAllocs
+		case *Edge:
+			key.Total += total
+		}
+	}
+
+	if n := len(p.stack); n > 0 {
+		parent := p.stack[n-1]
+		parent.childTime += total
+		parent.childBytes += totalBytes
+		parent.childAllocs += totalAllocs
+	}
+}
+
+// poll takes a sample if one is due.
+func (p *Profiler) poll() {
+	if p.due != nil && p.due() {
+		p.sample()
+	}
+}
+
+// sample charges the time and allocations since the last sample to the call
+// stack as it is now: to the innermost function's self figures, and once to
+// the totals of every function, call site and edge on the stack.
+func (p *Profiler) sample() {
+	now := p.now()
+	bytes, allocs := p.counter()
+	elapsed := now.Sub(p.last)
+	newBytes, newAllocs := bytes-p.lastBytes, allocs-p.lastAllocs
+	p.last, p.lastBytes, p.lastAllocs = now, bytes, allocs
+
+	top := p.stack[len(p.stack)-1]
+	top.function.Self += elapsed
+	top.function.SelfBytes += newBytes
+	top.function.SelfAllocs += newAllocs
+	p.folded[top.stack] += elapsed
+
+	seen := make(map[interface{}]bool)
+	for _, f := range p.stack {
+		for _, key := range f.keys() {
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			switch key := key.(type) {
+			case *Function:
+				key.Total += elapsed
+				key.TotalBytes += newBytes
+				key.TotalAllocs += newAllocs
+			case *CallSite:
+				key.Total += elapsed
+				key.TotalBytes += newBytes
+				key.TotalAllocs += newAllocs
+			case *Edge:
+				key.Total += elapsed
+			}
+		}
+	}
+}
+
+func (f *frame) keys() []interface{} {
+	keys := []interface{}{f.function}
+	if f.site != nil {
+		keys = append(keys, f.site)
+	}
+	if f.edge != nil {
+		keys = append(keys, f.edge)
+	}
+	return keys
+}
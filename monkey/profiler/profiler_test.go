@@ -0,0 +1,258 @@
+package profiler
+
+import (
+	"bytes"
+	"monkey/evaluator"
+	"monkey/object"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// profile runs the main file of files under an instrumenting profiler whose
+// clock moves a millisecond, and whose allocation counters 100 bytes and 1
+// object, on every reading.
+func profile(t *testing.T, files map[string]string) *Profiler {
+	t.Helper()
+	return profileWith(t, files, nil)
+}
+
+// profileWith runs the main file of files as profile does, sampling when
+// due reports true if due is not nil.
+func profileWith(t *testing.T, files map[string]string, due func() bool) *Profiler {
+	t.Helper()
+	dir := t.TempDir()
+	for name, source := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(source), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var clock time.Time
+	var allocated, allocs uint64
+	in := evaluator.New()
+	p := start(in,
+		func() time.Time {
+			clock = clock.Add(time.Millisecond)
+			return clock
+		},
+		func() (uint64, uint64) {
+			allocated += 100
+			allocs++
+			return allocated, allocs
+		},
+		due)
+
+	result := in.EvalFile(filepath.Join(dir, "main.monkey"), object.NewEnvironment())
+	if err, ok := result.(*object.Error); ok {
+		t.Fatalf("evaluation failed: %s", err.Message)
+	}
+	p.Stop()
+	return p
+}
+
+var modules = map[string]string{
+	"main.monkey": `import "lib";
+let f = function(n) { lib.sq(n) + lib.sq(n + 1) };
+f(2);`,
+	"lib.monkey": `export let sq = function(x) { x * x };`,
+}
+
+func find(t *testing.T, p *Profiler, name string) *Function {
+	t.Helper()
+	for _, f := range p.Functions() {
+		if f.Name == name {
+			return f
+		}
+	}
+	t.Fatalf("no function %s", name)
+	return nil
+}
+
+func TestFunctions(t *testing.T) {
+	p := profile(t, modules)
+
+	tests := []struct {
+		function      *Function
+		file          string
+		line, calls   int
+		self, total   time.Duration
+		bytes, allocs uint64
+	}{
+		{p.Program(), "", 0, 1, 2 * time.Millisecond, 7 * time.Millisecond, 700, 7},
+		{find(t, p, "f"), "main.monkey", 2, 1, 3 * time.Millisecond, 5 * time.Millisecond, 500, 5},
+		{find(t, p, "sq"), "lib.monkey", 1, 2, 2 * time.Millisecond, 2 * time.Millisecond, 200, 2},
+	}
+
+	for _, tt := range tests {
+		f := tt.function
+		file := ""
+		if f.File != "" {
+			file = filepath.Base(f.File)
+		}
+		if file != tt.file || f.Line != tt.line {
+			t.Errorf("%s: wrong definition %s:%d", f.Name, f.File, f.Line)
+		}
+		if f.Calls != tt.calls || f.Self != tt.self || f.Total != tt.total {
+			t.Errorf("%s: wrong times. want %d calls, %s self, %s total; got %d, %s, %s",
+				f.Name, tt.calls, tt.self, tt.total, f.Calls, f.Self, f.Total)
+		}
+		if f.TotalBytes != tt.bytes || f.TotalAllocs != tt.allocs {
+			t.Errorf("%s: wrong allocations. want %d bytes in %d; got %d in %d",
+				f.Name, tt.bytes, tt.allocs, f.TotalBytes, f.TotalAllocs)
+		}
+	}
+}
+
+func TestCallSites(t *testing.T) {
+	p := profile(t, modules)
+
+	got := []string{}
+	for _, s := range p.CallSites() {
+		got = append(got, s.Callee+" "+location(s.File, s.Line, s.Column)+" "+duration(s.Total))
+	}
+	expected := []string{
+		"f main.monkey:3:1 5.000ms",
+		"lib.sq main.monkey:2:23 1.000ms",
+		"lib.sq main.monkey:2:35 1.000ms",
+	}
+	if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("wrong call sites.\nwant=%q\ngot= %q", expected, got)
+	}
+}
+
+func TestRecursionCountsOnce(t *testing.T) {
+	p := profile(t, map[string]string{"main.monkey": `
+let fact = function(n) { if (n < 2) { 1 } else { n * fact(n - 1) } };
+fact(3);`})
+
+	// fact(3) runs from 2ms to 7ms, with fact(2) and fact(1) inside it.
+	fact := find(t, p, "fact")
+	if fact.Calls != 3 || fact.Total != 5*time.Millisecond || fact.Self != 5*time.Millisecond {
+		t.Errorf("wrong figures for fact: %+v", fact)
+	}
+
+	var buf bytes.Buffer
+	p.WriteFolded(&buf)
+	expected := `<program> 2000000
+<program>;fact 2000000
+<program>;fact;fact 2000000
+<program>;fact;fact;fact 1000000
+`
+	if buf.String() != expected {
+		t.Errorf("wrong folded stacks.\nwant:\n%s\ngot:\n%s", expected, buf.String())
+	}
+}
+
+func TestReports(t *testing.T) {
+	p := profile(t, modules)
+
+	var flat bytes.Buffer
+	p.WriteFlat(&flat)
+	for _, want := range []string{
+		"   3.000ms   42.9%    5.000ms   71.4%       1       500B        5  f main.monkey:2\n",
+		"   2.000ms   28.6%    2.000ms   28.6%       2       200B        2  sq lib.monkey:1\n",
+		"   5.000ms   71.4%       1       500B        5  f at main.monkey:3:1\n",
+	} {
+		if !strings.Contains(flat.String(), want) {
+			t.Errorf("expected %q in the flat report, got:\n%s", want, flat.String())
+		}
+	}
+
+	var graph bytes.Buffer
+	p.WriteCallGraph(&graph)
+	expected := `f main.monkey:2: 1 calls, total 5.000ms, self 3.000ms
+    called by <program>                  1 calls    5.000ms
+    calls     sq                         2 calls    2.000ms
+`
+	if !strings.Contains(graph.String(), expected) {
+		t.Errorf("expected\n%s\nin the call graph, got:\n%s", expected, graph.String())
+	}
+}
+
+func TestAllocations(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "main.monkey")
+	source := `
+let build = function(n) { let xs = []; let i = 0; while (i < n) { xs = [xs, i]; i = i + 1; } xs };
+let idle = function() { 1 };
+build(20000);
+idle();`
+	if err := os.WriteFile(path, []byte(source), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	in := evaluator.New()
+	p := New(in)
+	in.EvalFile(path, object.NewEnvironment())
+	p.Stop()
+
+	build, idle := find(t, p, "build"), find(t, p, "idle")
+	if build.TotalBytes < 20000*16 || build.TotalAllocs < 20000 {
+		t.Errorf("build allocated at least 20000 arrays, got %d bytes in %d", build.TotalBytes, build.TotalAllocs)
+	}
+	if idle.TotalBytes >= build.TotalBytes {
+		t.Errorf("idle allocated as much as build: %d bytes", idle.TotalBytes)
+	}
+}
+
+func TestSampling(t *testing.T) {
+	// A sample at every hook charges the millisecond the clock moves by to
+	// the stack of the moment.
+	samples := 0
+	p := profileWith(t, modules, func() bool {
+		samples++
+		return true
+	})
+
+	f, sq := find(t, p, "f"), find(t, p, "sq")
+	if p.Program().Calls != 1 || f.Calls != 1 || sq.Calls != 2 {
+		t.Errorf("wrong calls: program %d, f %d, sq %d", p.Program().Calls, f.Calls, sq.Calls)
+	}
+
+	// Every sample, and the last one Stop takes, is charged once.
+	total := time.Duration(samples+1) * time.Millisecond
+	if p.Program().Total != total {
+		t.Errorf("wrong program total. expected %s, got %s", total, p.Program().Total)
+	}
+	self := p.Program().Self
+	for _, fn := range p.Functions() {
+		self += fn.Self
+	}
+	if self != total {
+		t.Errorf("self times add up to %s, expected %s", self, total)
+	}
+	if !(sq.Total > 0 && sq.Total < f.Total && f.Total < total) {
+		t.Errorf("wrong totals: sq %s, f %s, program %s", sq.Total, f.Total, total)
+	}
+	if sq.TotalBytes != 100*uint64(sq.Total/time.Millisecond) {
+		t.Errorf("wrong bytes for sq: %d over %s", sq.TotalBytes, sq.Total)
+	}
+
+	var folded bytes.Buffer
+	p.WriteFolded(&folded)
+	if !strings.Contains(folded.String(), "<program>;f;sq ") {
+		t.Errorf("no samples in sq:\n%s", folded.String())
+	}
+}
+
+func TestNewSampling(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "main.monkey")
+	source := `let loop = function(n) { let i = 0; while (i < n) { i = i + 1 } }; loop(20000)`
+	if err := os.WriteFile(path, []byte(source), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	in := evaluator.New()
+	p := NewSampling(in, time.Microsecond)
+	if result := in.EvalFile(path, object.NewEnvironment()); result.Type() == object.ERROR_OBJECT {
+		t.Fatalf("evaluation failed: %s", result.Inspect())
+	}
+	p.Stop()
+
+	if loop := find(t, p, "loop"); loop.Calls != 1 || loop.Total == 0 || loop.Total > p.Program().Total {
+		t.Errorf("wrong figures for loop: %+v, program total %s", loop, p.Program().Total)
+	}
+}
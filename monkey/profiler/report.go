@@ -0,0 +1,133 @@
+package profiler
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// WriteFlat writes a table of the functions, the program's own top-level
+// code included, by self time, then one of the call sites by total time.
+func (p *Profiler) WriteFlat(w io.Writer) error {
+	functions := append([]*Function{p.program}, p.order...)
+	sort.SliceStable(functions, func(i, j int) bool {
+		return functions[i].Self > functions[j].Self
+	})
+
+	fmt.Fprintf(w, "%10s %7s %10s %7s %7s %10s %8s  %s\n",
+		"self", "self%", "total", "total%", "calls", "bytes", "allocs", "function")
+	for _, f := range functions {
+		fmt.Fprintf(w, "%10s %7s %10s %7s %7d %10s %8d  %s\n",
+			duration(f.Self), p.percent(f.Self), duration(f.Total), p.percent(f.Total),
+			f.Calls, size(f.TotalBytes), f.TotalAllocs, describe(f))
+	}
+
+	sites := append([]*CallSite{}, p.siteOrder...)
+	sort.SliceStable(sites, func(i, j int) bool {
+		return sites[i].Total > sites[j].Total
+	})
+
+	fmt.Fprintf(w, "\n%10s %7s %7s %10s %8s  %s\n", "total", "total%", "calls", "bytes", "allocs", "call site")
+	for _, s := range sites {
+		_, err := fmt.Fprintf(w, "%10s %7s %7d %10s %8d  %s at %s\n",
+			duration(s.Total), p.percent(s.Total), s.Calls, size(s.TotalBytes), s.TotalAllocs,
+			s.Callee, location(s.File, s.Line, s.Column))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteCallGraph writes, for each function by total time, the functions
+// that called it and those it called, with the number and the total time
+// of those calls.
+func (p *Profiler) WriteCallGraph(w io.Writer) error {
+	functions := append([]*Function{p.program}, p.order...)
+	sort.SliceStable(functions, func(i, j int) bool {
+		return functions[i].Total > functions[j].Total
+	})
+
+	for i, f := range functions {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintf(w, "%s: %d calls, total %s, self %s\n", describe(f), f.Calls, duration(f.Total), duration(f.Self))
+		for _, e := range p.edgeOrder {
+			if e.Callee == f {
+				fmt.Fprintf(w, "    called by %-20s %7d calls %10s\n", e.Caller.Name, e.Calls, duration(e.Total))
+			}
+		}
+		for _, e := range p.edgeOrder {
+			if e.Caller == f {
+				_, err := fmt.Fprintf(w, "    calls     %-20s %7d calls %10s\n", e.Callee.Name, e.Calls, duration(e.Total))
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// WriteFolded writes the self time of every call stack, in nanoseconds, in
+// the folded format flame graph tools read: the names of the stack's
+// functions, outermost first, separated by semicolons, then the time.
+func (p *Profiler) WriteFolded(w io.Writer) error {
+	stacks := make([]string, 0, len(p.folded))
+	for stack := range p.folded {
+		stacks = append(stacks, stack)
+	}
+	sort.Strings(stacks)
+
+	for _, stack := range stacks {
+		if _, err := fmt.Fprintf(w, "%s %d\n", stack, p.folded[stack].Nanoseconds()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *Profiler) percent(d time.Duration) string {
+	if p.program.Total == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.1f%%", 100*float64(d)/float64(p.program.Total))
+}
+
+func duration(d time.Duration) string {
+	return fmt.Sprintf("%.3fms", float64(d)/float64(time.Millisecond))
+}
+
+func size(bytes uint64) string {
+	switch {
+	case bytes >= 1<<20:
+		return fmt.Sprintf("%.1fMiB", float64(bytes)/(1<<20))
+	case bytes >= 1<<10:
+		return fmt.Sprintf("%.1fKiB", float64(bytes)/(1<<10))
+	}
+	return fmt.Sprintf("%dB", bytes)
+}
+
+func describe(f *Function) string {
+	switch {
+	case f.Builtin:
+		return f.Name + " (builtin)"
+	case f.Line == 0:
+		return f.Name
+	}
+	return f.Name + " " + location(f.File, f.Line, 0)
+}
+
+func location(file string, line, column int) string {
+	loc := fmt.Sprintf("%d", line)
+	if file != "" {
+		loc = filepath.Base(file) + ":" + loc
+	}
+	if column > 0 {
+		loc += fmt.Sprintf(":%d", column)
+	}
+	return loc
+}
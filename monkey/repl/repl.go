@@ -8,6 +8,8 @@ import (
 	"monkey/lexer"
 	"monkey/object"
 	"monkey/parser"
+	"monkey/types"
+	"strings"
 )
 
 const PROMPT = ">>> "
@@ -15,6 +17,11 @@ const PROMPT = ">>> "
 func Start(in io.Reader, out io.Writer) {
 	scanner := bufio.NewScanner(in)
 	env := object.NewEnvironment()
+	macroEnv := object.NewEnvironment()
+	interpreter := evaluator.New()
+	// Lines typed in can import from where the REPL runs.
+	interpreter.Dir = "."
+	checker := types.NewChecker()
 
 	for {
 		fmt.Print(PROMPT)
@@ -24,15 +31,35 @@ func Start(in io.Reader, out io.Writer) {
 		}
 
 		line := scanner.Text()
+		if strings.HasPrefix(line, ":type") {
+			// Blank out the command so positions match the line as typed.
+			expr := strings.Repeat(" ", len(":type")) + strings.TrimPrefix(line, ":type")
+			printType(out, expr, interpreter, macroEnv, checker)
+			continue
+		}
+
 		l := lexer.New(line)
 		p := parser.New(l)
 
+		program := p.ParseProgram()
 		if len(p.Errors()) != 0 {
 			printParserErrors(out, p.Errors())
 			continue
 		}
 
-		evaluated := evaluator.Eval(p.ParseProgram(), env)
+		printParserWarnings(out, p.Warnings())
+
+		expanded, err := interpreter.Expand(program, macroEnv)
+		if err != nil {
+			io.WriteString(out, err.Inspect()+"\n")
+			continue
+		}
+
+		// The checker follows the session so :type knows its globals. Type
+		// errors do not stop a line from running.
+		checker.Check(expanded)
+
+		evaluated := interpreter.Eval(expanded, env)
 
 		if evaluated != nil {
 			io.WriteString(out, evaluated.Inspect())
@@ -41,9 +68,41 @@ func Start(in io.Reader, out io.Writer) {
 	}
 }
 
+// printType prints the inferred type of the expression in line, or its type
+// errors.
+func printType(out io.Writer, line string, interpreter *evaluator.Interpreter, macroEnv *object.Environment, checker *types.Checker) {
+	p := parser.New(lexer.New(line))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		printParserErrors(out, p.Errors())
+		return
+	}
+
+	expanded, err := interpreter.Expand(program, macroEnv)
+	if err != nil {
+		io.WriteString(out, err.Inspect()+"\n")
+		return
+	}
+
+	t, errors := checker.Check(expanded)
+	if len(errors) != 0 {
+		for _, e := range errors {
+			io.WriteString(out, " "+e.String()+"\n")
+		}
+		return
+	}
+	io.WriteString(out, t.String()+"\n")
+}
+
 func printParserErrors(out io.Writer, errors []string) {
 	io.WriteString(out, " parser errors:\n")
 	for _, msg := range errors {
 		io.WriteString(out, "\t"+msg+"\n")
 	}
 }
+
+func printParserWarnings(out io.Writer, warnings []string) {
+	for _, msg := range warnings {
+		io.WriteString(out, " warning: "+msg+"\n")
+	}
+}
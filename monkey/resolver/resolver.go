@@ -0,0 +1,471 @@
+// Package resolver checks the names used by a program before it runs and
+// records, on every identifier, where its binding lives.
+//
+// Scopes follow the evaluator: the program, each function body and each
+// match arm is a scope, while the blocks of if, while and for share the
+// scope around them. Every let in a scope, wherever it appears, gets a slot
+// in that scope.
+//
+// A function refers to the bindings of the functions around it through its
+// closure environment, which holds only the bindings it and the functions
+// inside it refer to: the function literal's free variables.
+package resolver
+
+import (
+	"fmt"
+	"monkey/ast"
+	"monkey/token"
+	"sort"
+	"strings"
+)
+
+type Severity int
+
+const (
+	Error Severity = iota
+	Warning
+)
+
+func (s Severity) String() string {
+	if s == Warning {
+		return "warning"
+	}
+	return "error"
+}
+
+type Diagnostic struct {
+	Position token.Position
+	Severity Severity
+	Message  string
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%s: %s: %s", d.Position, d.Severity, d.Message)
+}
+
+type binding struct {
+	ident *ast.Identifier
+	slot  int
+	param bool
+
+	// declared is set once resolution passes the binding's declaration.
+	// Before that, only code in nested functions, which runs later, may
+	// refer to it.
+	declared bool
+	used     bool
+}
+
+type scope struct {
+	outer    *scope
+	global   bool
+	function bool
+	bindings map[string]*binding
+	order    []*binding
+
+	// free lists the bindings of enclosing scopes a function scope
+	// captures, and captured the slot of each in its closure environment.
+	free     []ast.FreeVariable
+	captured map[*binding]int
+}
+
+func newScope(outer *scope) *scope {
+	return &scope{outer: outer, bindings: make(map[string]*binding)}
+}
+
+// add gives name a slot in the scope, unless it already has one.
+func (s *scope) add(ident *ast.Identifier, param bool) *binding {
+	if b, ok := s.bindings[ident.Value]; ok {
+		return b
+	}
+
+	b := &binding{ident: ident, slot: len(s.order), param: param}
+	s.bindings[ident.Value] = b
+	s.order = append(s.order, b)
+	return b
+}
+
+type Resolver struct {
+	builtins map[string]bool
+	globals  *scope
+	scope    *scope
+
+	diagnostics []Diagnostic
+
+	// Definitions, if not nil, receives for every identifier bound by a
+	// declaration or a reference the identifier that declared its binding.
+	// A binding declared several times in one scope, as by two lets of the
+	// same name, belongs to the first declaration.
+	Definitions map[*ast.Identifier]*ast.Identifier
+}
+
+// New returns a Resolver that knows the given builtin names. Globals persist
+// between calls to Resolve, so one Resolver can follow a REPL session.
+func New(builtins []string) *Resolver {
+	r := &Resolver{builtins: make(map[string]bool), globals: newScope(nil)}
+	r.globals.global = true
+	for _, name := range builtins {
+		r.builtins[name] = true
+	}
+	return r
+}
+
+// Declare makes global names defined outside the resolved code known.
+func (r *Resolver) Declare(names ...string) {
+	for _, name := range names {
+		b := r.globals.add(&ast.Identifier{Value: name}, false)
+		b.declared = true
+	}
+}
+
+// Resolve annotates the identifiers of program and returns its diagnostics,
+// ordered by position.
+func (r *Resolver) Resolve(program *ast.Program) []Diagnostic {
+	r.diagnostics = nil
+	r.scope = r.globals
+
+	for _, stmt := range program.Statements {
+		r.hoist(stmt)
+	}
+	for _, stmt := range program.Statements {
+		r.resolve(stmt)
+	}
+
+	sort.SliceStable(r.diagnostics, func(i, j int) bool {
+		return r.diagnostics[i].Position.Before(r.diagnostics[j].Position)
+	})
+	return r.diagnostics
+}
+
+func (r *Resolver) report(pos token.Position, severity Severity, format string, args ...interface{}) {
+	r.diagnostics = append(r.diagnostics, Diagnostic{
+		Position: pos,
+		Severity: severity,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+// hoist gives every binding that node introduces into the current scope a
+// slot, without descending into nested scopes.
+func (r *Resolver) hoist(node ast.Node) {
+	ast.Inspect(node, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.FunctionLiteral, *ast.MacroLiteral:
+			return false
+		case *ast.MatchExpression:
+			r.hoist(node.Subject)
+			return false
+		case *ast.CallExpression:
+			return !isCallTo(node, "quote")
+		case *ast.LetStatement:
+			for _, ident := range ast.PatternIdentifiers(node.Name) {
+				r.scope.add(ident, false)
+			}
+		case *ast.ForStatement:
+			if node.Key != nil {
+				r.scope.add(node.Key, false)
+			}
+			r.scope.add(node.Value, false)
+		case *ast.ImportStatement:
+			r.scope.add(node.Name, false)
+		}
+		return node != nil
+	})
+}
+
+func (r *Resolver) resolve(node ast.Node) {
+	if node == nil {
+		return
+	}
+
+	ast.Inspect(node, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case nil:
+			return false
+
+		case *ast.Identifier:
+			r.use(node)
+			return false
+
+		case *ast.LetStatement:
+			r.resolve(node.Value)
+			r.declare(node.Name)
+			return false
+
+		case *ast.ForStatement:
+			r.resolve(node.Iterable)
+			if node.Key != nil {
+				r.declare(node.Key)
+			}
+			r.declare(node.Value)
+			r.resolve(node.Body)
+			return false
+
+		case *ast.ImportStatement:
+			r.declare(node.Name)
+			return false
+
+		case *ast.AssignExpression:
+			r.resolve(node.Value)
+			r.use(node.Name)
+			return false
+
+		case *ast.MemberExpression:
+			r.resolve(node.Object)
+			return false
+
+		case *ast.FunctionLiteral:
+			node.Locals, node.Free = r.resolveFunction(node.Parameters, node.Defaults, node.Rest, node.Body)
+			return false
+
+		case *ast.MacroLiteral:
+			node.Locals, node.Free = r.resolveFunction(node.Parameters, node.Defaults, node.Rest, node.Body)
+			return false
+
+		case *ast.MatchExpression:
+			r.resolve(node.Subject)
+			for _, arm := range node.Arms {
+				r.resolveMatchArm(arm)
+			}
+			return false
+
+		case *ast.CallExpression:
+			if isCallTo(node, "quote") {
+				r.resolveUnquoted(node)
+				return false
+			}
+			if isCallTo(node, "unquote") {
+				for _, arg := range node.Arguments {
+					r.resolve(arg)
+				}
+				return false
+			}
+		}
+
+		return true
+	})
+}
+
+func (r *Resolver) resolveFunction(
+	parameters []ast.Pattern,
+	defaults []ast.Expression,
+	rest *ast.Identifier,
+	body *ast.BlockStatement,
+) ([]string, []ast.FreeVariable) {
+	r.scope = newScope(r.scope)
+	r.scope.function = true
+	r.scope.free = []ast.FreeVariable{}
+	r.scope.captured = make(map[*binding]int)
+
+	// Parameters take the first slots, in order, then the body's lets.
+	seen := map[string]bool{}
+	all := []*ast.Identifier{}
+	for _, param := range parameters {
+		all = append(all, ast.PatternIdentifiers(param)...)
+	}
+	if rest != nil {
+		all = append(all, rest)
+	}
+	for _, ident := range all {
+		if seen[ident.Value] && ident.Value != "_" {
+			r.report(ident.Token.Position, Error, "duplicate parameter %s", ident.Value)
+		}
+		seen[ident.Value] = true
+		r.scope.add(ident, true)
+	}
+	r.hoist(body)
+
+	for i, param := range parameters {
+		if i < len(defaults) {
+			r.resolve(defaults[i])
+		}
+		r.declareIdentifiers(ast.PatternIdentifiers(param))
+	}
+	if rest != nil {
+		r.declareIdentifiers([]*ast.Identifier{rest})
+	}
+
+	r.resolve(body)
+	free := r.scope.free
+	return r.closeScope(), free
+}
+
+func (r *Resolver) resolveMatchArm(arm *ast.MatchArm) {
+	r.scope = newScope(r.scope)
+
+	for _, ident := range ast.PatternIdentifiers(arm.Pattern) {
+		r.scope.add(ident, false)
+	}
+	r.hoist(arm.Body)
+
+	r.declare(arm.Pattern)
+	r.resolve(arm.Guard)
+	r.resolve(arm.Body)
+	arm.Locals = r.closeScope()
+}
+
+// resolveUnquoted resolves the unquote calls of a quote call, which are the
+// only parts of it evaluated in the current scope.
+func (r *Resolver) resolveUnquoted(quote *ast.CallExpression) {
+	for _, arg := range quote.Arguments {
+		ast.Inspect(arg, func(node ast.Node) bool {
+			if call, ok := node.(*ast.CallExpression); ok && isCallTo(call, "unquote") {
+				r.resolve(call)
+				return false
+			}
+			return node != nil
+		})
+	}
+}
+
+// closeScope reports the unused bindings of the current scope, leaves it and
+// returns the names of its slots.
+func (r *Resolver) closeScope() []string {
+	names := make([]string, len(r.scope.order))
+	for i, b := range r.scope.order {
+		names[i] = b.ident.Value
+
+		if b.used || strings.HasPrefix(b.ident.Value, "_") || r.builtins[b.ident.Value] {
+			continue
+		}
+		if b.param {
+			r.report(b.ident.Token.Position, Warning, "parameter %s is never used", b.ident.Value)
+		} else {
+			r.report(b.ident.Token.Position, Warning, "%s is declared but never used", b.ident.Value)
+		}
+	}
+
+	r.scope = r.scope.outer
+	return names
+}
+
+// declare marks the identifiers of pattern as bound from here on. A name
+// may only be bound once by a pattern.
+func (r *Resolver) declare(pattern ast.Pattern) {
+	idents := ast.PatternIdentifiers(pattern)
+
+	seen := map[string]bool{}
+	for _, ident := range idents {
+		if seen[ident.Value] && ident.Value != "_" {
+			r.report(ident.Token.Position, Error, "%s is bound more than once in %s", ident.Value, pattern.String())
+		}
+		seen[ident.Value] = true
+	}
+
+	r.declareIdentifiers(idents)
+}
+
+func (r *Resolver) declareIdentifiers(idents []*ast.Identifier) {
+	for _, ident := range idents {
+		if ident.Value == "_" {
+			continue
+		}
+
+		if r.builtins[ident.Value] {
+			r.report(ident.Token.Position, Warning, "%s can never be read: the builtin function %s takes precedence", ident.Value, ident.Value)
+		}
+
+		b := r.scope.add(ident, false)
+		b.declared = true
+		r.annotate(ident, r.scope, 0, b)
+	}
+}
+
+func (r *Resolver) annotate(ident *ast.Identifier, s *scope, depth int, b *binding) {
+	if r.Definitions != nil {
+		r.Definitions[ident] = b.ident
+	}
+
+	if s.global {
+		ident.Scope = ast.GlobalScope
+		ident.Depth = 0
+		ident.Slot = 0
+		return
+	}
+
+	ident.Scope = ast.LocalScope
+	ident.Depth = depth
+	ident.Slot = b.slot
+}
+
+// use resolves a reference to a name. Like the evaluator, it looks for a
+// builtin before any binding.
+func (r *Resolver) use(ident *ast.Identifier) {
+	if ident.Value == "_" {
+		return
+	}
+
+	if r.builtins[ident.Value] {
+		ident.Scope = ast.BuiltinScope
+		return
+	}
+
+	depth := 0
+	// function is the innermost function scope the reference is in, and
+	// closureDepth how many scopes out its closure environment is.
+	var function *scope
+	closureDepth := 0
+
+	for s := r.scope; s != nil; s = s.outer {
+		// Code inside a function runs after the scopes around it have been
+		// filled in, so it can see bindings declared later in them.
+		if b, ok := s.bindings[ident.Value]; ok && (b.declared || function != nil) {
+			b.used = true
+			if function == nil || s.global {
+				r.annotate(ident, s, depth, b)
+				return
+			}
+
+			if r.Definitions != nil {
+				r.Definitions[ident] = b.ident
+			}
+			ident.Scope = ast.LocalScope
+			ident.Depth = closureDepth
+			ident.Slot = r.capture(function, b)
+			return
+		}
+
+		if s.function && function == nil {
+			function = s
+			closureDepth = depth + 1
+		}
+		if !s.global {
+			depth++
+		}
+	}
+
+	ident.Scope = ast.Unresolved
+	r.report(ident.Token.Position, Error, "undefined identifier %s", ident.Value)
+}
+
+// capture makes b, a binding of a scope around the function scope fn, one
+// of fn's free variables, and of those of the function scopes in between,
+// and returns its slot in fn's closure environment.
+func (r *Resolver) capture(fn *scope, b *binding) int {
+	if slot, ok := fn.captured[b]; ok {
+		return slot
+	}
+
+	free := ast.FreeVariable{Name: b.ident.Value}
+	depth := 0
+	for s := fn.outer; ; s = s.outer {
+		if s.bindings[b.ident.Value] == b {
+			free.Depth, free.Slot = depth, b.slot
+			break
+		}
+		if s.function {
+			free.Depth, free.Slot = depth+1, r.capture(s, b)
+			break
+		}
+		depth++
+	}
+
+	slot := len(fn.free)
+	fn.captured[b] = slot
+	fn.free = append(fn.free, free)
+	return slot
+}
+
+func isCallTo(call *ast.CallExpression, name string) bool {
+	ident, ok := call.Function.(*ast.Identifier)
+	return ok && ident.Value == name
+}
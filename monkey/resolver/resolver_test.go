@@ -0,0 +1,276 @@
+package resolver
+
+import (
+	"monkey/ast"
+	"monkey/lexer"
+	"monkey/parser"
+	"reflect"
+	"testing"
+)
+
+var testBuiltins = []string{"len", "puts"}
+
+func resolve(t *testing.T, input string) (*ast.Program, []string) {
+	t.Helper()
+
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors in %q: %v", input, p.Errors())
+	}
+
+	messages := []string{}
+	for _, d := range New(testBuiltins).Resolve(program) {
+		messages = append(messages, d.String())
+	}
+	return program, messages
+}
+
+func TestDiagnostics(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{`let x = 1; x`, []string{}},
+		{`puts(len("a"))`, []string{}},
+		{`x`, []string{"1:1: error: undefined identifier x"}},
+		{`x; let x = 1;`, []string{"1:1: error: undefined identifier x"}},
+		{`let x = x;`, []string{"1:9: error: undefined identifier x"}},
+		{`x = 1`, []string{"1:1: error: undefined identifier x"}},
+		{
+			`let f = function(a, b, a) { a + b }`,
+			[]string{"1:24: error: duplicate parameter a"},
+		},
+		{
+			`let f = function([a, b], ...a) { a + b }`,
+			[]string{"1:29: error: duplicate parameter a"},
+		},
+		{
+			`let [a, a] = [1, 2];`,
+			[]string{"1:9: error: a is bound more than once in [a, a]"},
+		},
+		{
+			`let f = function(x) { let unused = 1; x }; f(1)`,
+			[]string{"1:27: warning: unused is declared but never used"},
+		},
+		{
+			`let f = function(x, _y) { 1 }; f(1)`,
+			[]string{"1:18: warning: parameter x is never used"},
+		},
+		{
+			`let len = 1; len`,
+			[]string{"1:5: warning: len can never be read: the builtin function len takes precedence"},
+		},
+		{
+			`let f = function(puts) { puts }; f`,
+			[]string{"1:18: warning: puts can never be read: the builtin function puts takes precedence"},
+		},
+		{
+			`match (1) { [a, b] => a, _ => 0 }`,
+			[]string{"1:17: warning: b is declared but never used"},
+		},
+		{
+			`match (1) { [a] if a > 1 => 1, x => x, _ => y }`,
+			[]string{"1:45: error: undefined identifier y"},
+		},
+		// Functions may refer to bindings declared after them.
+		{`let isEven = function(n) { if (n == 0) { true } else { isOdd(n - 1) } };
+		let isOdd = function(n) { if (n == 0) { false } else { isEven(n - 1) } };
+		isEven(4)`, []string{}},
+		{`let f = function() { let g = function() { h() }; let h = function() { 1 }; g() }; f()`, []string{}},
+		// Blocks of if and loops do not start a scope.
+		{`if (true) { let y = 1 }; y`, []string{}},
+		{`for (k, v in [1]) { v } k`, []string{}},
+		{`let i = 0; while (i < 3) { i = i + 1 }`, []string{}},
+		// Match arms do.
+		{`match (1) { x => x }; x`, []string{"1:23: error: undefined identifier x"}},
+		{`import "lib" as lib; lib.anything`, []string{}},
+		{`let m = macro(a) { quote(unquote(a) + b) }; m`, []string{}},
+		{`let m = macro(a) { quote(unquote(c)) }; m`, []string{
+			"1:15: warning: parameter a is never used",
+			"1:34: error: undefined identifier c",
+		}},
+	}
+
+	for _, tt := range tests {
+		_, diagnostics := resolve(t, tt.input)
+
+		if !reflect.DeepEqual(diagnostics, tt.expected) {
+			t.Errorf("wrong diagnostics for %q.\nexpected %v\n     got %v", tt.input, tt.expected, diagnostics)
+		}
+	}
+}
+
+func TestDeclare(t *testing.T) {
+	p := parser.New(lexer.New(`a + b`))
+	program := p.ParseProgram()
+
+	r := New(nil)
+	r.Declare("a")
+	diagnostics := r.Resolve(program)
+
+	if len(diagnostics) != 1 || diagnostics[0].Message != "undefined identifier b" {
+		t.Fatalf("expected only b to be undefined, got %v", diagnostics)
+	}
+
+	// Globals persist from one Resolve to the next.
+	p = parser.New(lexer.New(`let b = 1;`))
+	r.Resolve(p.ParseProgram())
+
+	p = parser.New(lexer.New(`a + b`))
+	if diagnostics := r.Resolve(p.ParseProgram()); len(diagnostics) != 0 {
+		t.Fatalf("expected no diagnostics, got %v", diagnostics)
+	}
+}
+
+func TestDefinitions(t *testing.T) {
+	p := parser.New(lexer.New(`let x = 1; let f = function(x) { x + len([x]) }; x = 2; let x = 3; f(x)`))
+	program := p.ParseProgram()
+
+	r := New(testBuiltins)
+	r.Definitions = make(map[*ast.Identifier]*ast.Identifier)
+	r.Resolve(program)
+
+	// Every x names the global from the first let, except the parameter and
+	// its uses.
+	idents := []*ast.Identifier{}
+	ast.Inspect(program, func(node ast.Node) bool {
+		if ident, ok := node.(*ast.Identifier); ok {
+			idents = append(idents, ident)
+		}
+		return node != nil
+	})
+
+	expected := []string{"1:5", "1:16", "1:29", "1:29", "", "1:29", "1:5", "1:5", "1:16", "1:5"}
+	got := []string{}
+	for _, ident := range idents {
+		if def, ok := r.Definitions[ident]; ok {
+			got = append(got, def.Token.Position.String())
+		} else {
+			got = append(got, "")
+		}
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("wrong definitions.\nexpected %v\n     got %v", expected, got)
+	}
+}
+
+type annotation struct {
+	name  string
+	scope ast.ScopeKind
+	depth int
+	slot  int
+}
+
+func TestAnnotations(t *testing.T) {
+	input := `
+let g = 1;
+let f = function(a, [b, c], ...rest) {
+	let d = a + g;
+	let inner = function(e) {
+		e + d + len(rest)
+	};
+	match (b) {
+		[x] if x > c => x + e,
+		_ => inner(x)
+	}
+};
+`
+	program, _ := resolve(t, input)
+
+	annotations := []annotation{}
+	ast.Inspect(program, func(node ast.Node) bool {
+		if ident, ok := node.(*ast.Identifier); ok {
+			annotations = append(annotations, annotation{ident.Value, ident.Scope, ident.Depth, ident.Slot})
+		}
+		return true
+	})
+
+	expected := []annotation{
+		{"g", ast.GlobalScope, 0, 0},
+		{"f", ast.GlobalScope, 0, 0},
+		{"a", ast.LocalScope, 0, 0},
+		{"b", ast.LocalScope, 0, 1},
+		{"c", ast.LocalScope, 0, 2},
+		{"rest", ast.LocalScope, 0, 3},
+		{"d", ast.LocalScope, 0, 4},
+		{"a", ast.LocalScope, 0, 0},
+		{"g", ast.GlobalScope, 0, 0},
+		{"inner", ast.LocalScope, 0, 5},
+		{"e", ast.LocalScope, 0, 0},
+		{"e", ast.LocalScope, 0, 0},
+		{"d", ast.LocalScope, 1, 0},
+		{"len", ast.BuiltinScope, 0, 0},
+		{"rest", ast.LocalScope, 1, 1},
+		{"b", ast.LocalScope, 0, 1},
+		{"x", ast.LocalScope, 0, 0},
+		{"x", ast.LocalScope, 0, 0},
+		{"c", ast.LocalScope, 1, 2},
+		{"x", ast.LocalScope, 0, 0},
+		{"e", ast.Unresolved, 0, 0},
+		{"inner", ast.LocalScope, 1, 5},
+		{"x", ast.Unresolved, 0, 0},
+	}
+
+	if !reflect.DeepEqual(annotations, expected) {
+		t.Errorf("wrong annotations.\nexpected %v\n     got %v", expected, annotations)
+	}
+}
+
+func TestFreeVariables(t *testing.T) {
+	input := `
+let g = 1;
+let f = function(a) {
+	let b = a + g;
+	let unused = [a, b];
+	match (a) {
+		[x] => function() { function() { x + b + g } },
+		_ => function() { a = b; a }
+	}
+};
+`
+	program, _ := resolve(t, input)
+
+	literals := []*ast.FunctionLiteral{}
+	ast.Inspect(program, func(node ast.Node) bool {
+		if literal, ok := node.(*ast.FunctionLiteral); ok {
+			literals = append(literals, literal)
+		}
+		return node != nil
+	})
+
+	// The middle function captures x from its match arm and b from f for
+	// the innermost one, which reaches both through its closure. f, at the
+	// top level, and the functions there capture nothing: globals are not
+	// captured.
+	expected := [][]ast.FreeVariable{
+		{},
+		{{Name: "x", Depth: 0, Slot: 0}, {Name: "b", Depth: 1, Slot: 1}},
+		{{Name: "x", Depth: 1, Slot: 0}, {Name: "b", Depth: 1, Slot: 1}},
+		{{Name: "b", Depth: 1, Slot: 1}, {Name: "a", Depth: 1, Slot: 0}},
+	}
+	if len(literals) != len(expected) {
+		t.Fatalf("wrong number of function literals. expected %d, got %d", len(expected), len(literals))
+	}
+	for i, literal := range literals {
+		if !reflect.DeepEqual(literal.Free, expected[i]) {
+			t.Errorf("wrong free variables for literal %d.\nexpected %v\n     got %v", i, expected[i], literal.Free)
+		}
+	}
+
+	annotations := []annotation{}
+	ast.Inspect(literals[2].Body, func(node ast.Node) bool {
+		if ident, ok := node.(*ast.Identifier); ok {
+			annotations = append(annotations, annotation{ident.Value, ident.Scope, ident.Depth, ident.Slot})
+		}
+		return true
+	})
+	expectedAnnotations := []annotation{
+		{"x", ast.LocalScope, 1, 0},
+		{"b", ast.LocalScope, 1, 1},
+		{"g", ast.GlobalScope, 0, 0},
+	}
+	if !reflect.DeepEqual(annotations, expectedAnnotations) {
+		t.Errorf("wrong annotations.\nexpected %v\n     got %v", expectedAnnotations, annotations)
+	}
+}
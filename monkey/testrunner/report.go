@@ -0,0 +1,142 @@
+package testrunner
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Count returns how many of results passed and how many failed.
+func Count(results []Result) (passed, failed int) {
+	for _, r := range results {
+		if r.Passed() {
+			passed++
+		} else {
+			failed++
+		}
+	}
+	return passed, failed
+}
+
+// WriteText writes a report of results meant for people: every failure with
+// its location and message, every pass too when verbose is set, and the
+// counts.
+func WriteText(w io.Writer, results []Result, verbose bool) {
+	for _, r := range results {
+		if r.Passed() {
+			if verbose {
+				fmt.Fprintf(w, "--- PASS: %s (%s:%s, %.3fs)\n", r.Name, r.File, r.Position, r.Duration.Seconds())
+			}
+			continue
+		}
+
+		fmt.Fprintf(w, "--- FAIL: %s (%s:%s, %.3fs)\n", r.Name, r.File, r.Position, r.Duration.Seconds())
+		message := fmt.Sprintf("%s:%s: %s", r.File, r.FailurePosition, r.Failure)
+		for _, line := range strings.Split(message, "\n") {
+			fmt.Fprintf(w, "    %s\n", line)
+		}
+	}
+
+	passed, failed := Count(results)
+	if failed > 0 {
+		fmt.Fprintf(w, "FAIL: %d passed, %d failed\n", passed, failed)
+	} else {
+		fmt.Fprintf(w, "ok: %d passed\n", passed)
+	}
+}
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Time     string           `xml:"time,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name     string          `xml:"name,attr"`
+	Tests    int             `xml:"tests,attr"`
+	Failures int             `xml:"failures,attr"`
+	Time     string          `xml:"time,attr"`
+	Cases    []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	File      string        `xml:"file,attr"`
+	Line      int           `xml:"line,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Body    string `xml:",chardata"`
+}
+
+// WriteJUnit writes results as a JUnit XML report, with one test suite per
+// file.
+func WriteJUnit(w io.Writer, results []Result) error {
+	report := junitTestSuites{}
+	total := 0.0
+	suites := map[string]int{}
+
+	for _, r := range results {
+		i, ok := suites[r.File]
+		if !ok {
+			i = len(report.Suites)
+			suites[r.File] = i
+			report.Suites = append(report.Suites, junitTestSuite{Name: r.File})
+		}
+		suite := &report.Suites[i]
+
+		tc := junitTestCase{
+			Name:      r.Name,
+			Classname: r.File,
+			File:      r.File,
+			Line:      r.Position.Line,
+			Time:      seconds(r.Duration.Seconds()),
+		}
+		if !r.Passed() {
+			tc.Failure = &junitFailure{
+				Message: strings.SplitN(r.Failure, "\n", 2)[0],
+				Body:    fmt.Sprintf("%s:%s: %s", r.File, r.FailurePosition, r.Failure),
+			}
+			suite.Failures++
+			report.Failures++
+		}
+
+		suite.Cases = append(suite.Cases, tc)
+		suite.Tests++
+		report.Tests++
+		total += r.Duration.Seconds()
+	}
+
+	for i := range report.Suites {
+		elapsed := 0.0
+		for _, r := range results {
+			if r.File == report.Suites[i].Name {
+				elapsed += r.Duration.Seconds()
+			}
+		}
+		report.Suites[i].Time = seconds(elapsed)
+	}
+	report.Time = seconds(total)
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(report); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+func seconds(s float64) string {
+	return fmt.Sprintf("%.3f", s)
+}
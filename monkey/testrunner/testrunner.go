@@ -0,0 +1,216 @@
+// Package testrunner finds and runs the tests written in Monkey.
+//
+// A test file is a Monkey file whose name ends in _test.monkey. Every
+// top-level call test("name", function() { ... }) in it declares a test.
+// Tests run in isolation: each one gets a fresh interpreter, which runs the
+// rest of the file and then the test function, so state left behind by one
+// test never reaches another.
+package testrunner
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"monkey/ast"
+	"monkey/evaluator"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"monkey/token"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Suffix ends the name of every test file.
+const Suffix = "_test" + evaluator.ModuleExtension
+
+// Result is the outcome of one test.
+type Result struct {
+	File     string
+	Name     string
+	Position token.Position
+	Duration time.Duration
+
+	// Failure is the message of the error that failed the test, and
+	// FailurePosition where it was raised. Both are empty for a test that
+	// passed.
+	Failure         string
+	FailurePosition token.Position
+}
+
+func (r Result) Passed() bool {
+	return r.Failure == ""
+}
+
+// Discover returns the test files among paths, sorted. Directories are
+// searched recursively; files are taken as they are.
+func Discover(paths ...string) ([]string, error) {
+	files := []string{}
+
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+
+		err = filepath.WalkDir(path, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !d.IsDir() && strings.HasSuffix(d.Name(), Suffix) {
+				files = append(files, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	sort.Strings(files)
+	return files, nil
+}
+
+type testCase struct {
+	name     string
+	position token.Position
+	function ast.Expression
+}
+
+// RunFile runs the tests in the file at path whose names match filter, or
+// all of them if filter is nil. The parser's warnings about the file and the
+// modules it imports are written to warnings, unless it is nil. The prepare
+// functions are called on the interpreter of each test before it runs, to
+// add hooks for instance. It only returns an error if the file cannot be
+// read or parsed.
+func RunFile(path string, filter *regexp.Regexp, warnings io.Writer, prepare ...func(*evaluator.Interpreter)) ([]Result, error) {
+	source, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	p := parser.New(lexer.New(string(source)))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return nil, fmt.Errorf("%s: %s", path, strings.Join(p.Errors(), "\n\t"))
+	}
+	if warnings != nil {
+		p.WriteWarnings(warnings, path)
+
+		// Every test imports the modules again, but their warnings are
+		// written once.
+		warnings = &onceWriter{w: warnings, written: map[string]bool{}}
+		prepare = append([]func(*evaluator.Interpreter){func(in *evaluator.Interpreter) {
+			in.Warnings = warnings
+		}}, prepare...)
+	}
+
+	expanded, expandErr := evaluator.New().Expand(program, object.NewEnvironment())
+	if expandErr != nil {
+		return nil, fmt.Errorf("%s: %s", path, expandErr.Message)
+	}
+
+	setup, tests := split(expanded)
+
+	results := []Result{}
+	for _, tc := range tests {
+		if filter != nil && !filter.MatchString(tc.name) {
+			continue
+		}
+		results = append(results, run(path, setup, tc, prepare))
+	}
+	return results, nil
+}
+
+// onceWriter writes each distinct line, written whole, only the first time.
+type onceWriter struct {
+	w       io.Writer
+	written map[string]bool
+}
+
+func (o *onceWriter) Write(line []byte) (int, error) {
+	if o.written[string(line)] {
+		return len(line), nil
+	}
+	o.written[string(line)] = true
+	return o.w.Write(line)
+}
+
+// split separates the top-level test calls of program from the statements
+// every test runs first.
+func split(program *ast.Program) ([]ast.Statement, []testCase) {
+	setup := []ast.Statement{}
+	tests := []testCase{}
+
+	for _, stmt := range program.Statements {
+		if tc, ok := testCall(stmt); ok {
+			tests = append(tests, tc)
+			continue
+		}
+		setup = append(setup, stmt)
+	}
+
+	return setup, tests
+}
+
+func testCall(stmt ast.Statement) (testCase, bool) {
+	es, ok := stmt.(*ast.ExpressionStatement)
+	if !ok {
+		return testCase{}, false
+	}
+	call, ok := es.Expression.(*ast.CallExpression)
+	if !ok || len(call.Arguments) != 2 {
+		return testCase{}, false
+	}
+	if ident, ok := call.Function.(*ast.Identifier); !ok || ident.Value != "test" {
+		return testCase{}, false
+	}
+	name, ok := call.Arguments[0].(*ast.StringLiteral)
+	if !ok {
+		return testCase{}, false
+	}
+
+	return testCase{name: name.Value, position: ast.Pos(call), function: call.Arguments[1]}, true
+}
+
+func run(path string, setup []ast.Statement, tc testCase, prepare []func(*evaluator.Interpreter)) Result {
+	result := Result{File: path, Name: tc.name, Position: tc.position}
+	start := time.Now()
+
+	// The program ends with the test function, so evaluating it runs the
+	// setup and produces the function to call.
+	statements := append(append([]ast.Statement{}, setup...), &ast.ExpressionStatement{
+		Token:      ast.TokenOf(tc.function),
+		Expression: tc.function,
+	})
+
+	in := evaluator.New()
+	in.Dir = filepath.Dir(path)
+	for _, f := range prepare {
+		f(in)
+	}
+
+	evaluated := in.Eval(&ast.Program{Statements: statements}, object.NewEnvironment())
+	if _, ok := evaluated.(*object.Error); !ok {
+		evaluated = in.Call(evaluated)
+	}
+	result.Duration = time.Since(start)
+
+	if err, ok := evaluated.(*object.Error); ok {
+		result.Failure = err.Message
+		result.FailurePosition = err.Position
+		if !err.Position.IsValid() {
+			result.FailurePosition = tc.position
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,259 @@
+package testrunner
+
+import (
+	"bytes"
+	"monkey/evaluator"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func writeFile(t *testing.T, dir, name, source string) string {
+	t.Helper()
+
+	path := filepath.Join(dir, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(source), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+const mathTests = `let double = function(x) { x * 2 };
+let log = [];
+
+test("double", function() {
+  assertEq(double(2), 4);
+});
+
+test("isolated", function() {
+  log = [...log, 1];
+  assertEq(len(log), 1);
+});
+
+test("isolated again", function() {
+  log = [...log, 1];
+  assertEq(len(log), 1);
+});
+
+test("arrays", function() {
+  assertEq([1, 2, 3], [1, 5, 3]);
+});
+
+test("throws", function() {
+  assertThrows(function() { double("a") }, "type mismatch");
+});
+`
+
+func TestDiscover(t *testing.T) {
+	dir := t.TempDir()
+	b := writeFile(t, dir, "b_test.monkey", "")
+	a := writeFile(t, dir, "nested/a_test.monkey", "")
+	writeFile(t, dir, "main.monkey", "")
+	writeFile(t, dir, "notes_test.txt", "")
+	named := writeFile(t, dir, "named.monkey", "")
+
+	files, err := Discover(dir, named)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{b, named, a}
+	if !reflect.DeepEqual(files, expected) {
+		t.Errorf("wrong files.\nexpected %v\n     got %v", expected, files)
+	}
+
+	if _, err := Discover(filepath.Join(dir, "missing")); err == nil {
+		t.Errorf("expected an error for a missing path")
+	}
+}
+
+func TestRunFile(t *testing.T) {
+	path := writeFile(t, t.TempDir(), "math_test.monkey", mathTests)
+
+	results, err := RunFile(path, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []struct {
+		name    string
+		line    int
+		failure string
+	}{
+		{"double", 4, ""},
+		{"isolated", 8, ""},
+		{"isolated again", 13, ""},
+		{"arrays", 18, "assertEq failed\n  expected: [1, 5, 3]\n       got: [1, 2, 3]\n                ^"},
+		{"throws", 22, ""},
+	}
+
+	if len(results) != len(expected) {
+		t.Fatalf("wrong number of results. expected %d, got %d", len(expected), len(results))
+	}
+	for i, tt := range expected {
+		r := results[i]
+		if r.Name != tt.name || r.File != path || r.Position.Line != tt.line {
+			t.Errorf("wrong result %d. expected %s at line %d, got %s at %s:%s", i, tt.name, tt.line, r.Name, r.File, r.Position)
+		}
+		if r.Failure != tt.failure {
+			t.Errorf("wrong failure for %s.\nexpected %q\n     got %q", tt.name, tt.failure, r.Failure)
+		}
+	}
+
+	if pos := results[3].FailurePosition; pos.Line != 19 || pos.Column != 3 {
+		t.Errorf("wrong failure position. expected 19:3, got %s", pos)
+	}
+}
+
+func TestRunFileFilter(t *testing.T) {
+	path := writeFile(t, t.TempDir(), "math_test.monkey", mathTests)
+
+	results, err := RunFile(path, regexp.MustCompile("^isolated"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := []string{}
+	for _, r := range results {
+		names = append(names, r.Name)
+	}
+	if expected := []string{"isolated", "isolated again"}; !reflect.DeepEqual(names, expected) {
+		t.Errorf("wrong tests run. expected %v, got %v", expected, names)
+	}
+}
+
+func TestRunFilePrepare(t *testing.T) {
+	path := writeFile(t, t.TempDir(), "math_test.monkey", mathTests)
+
+	interpreters := map[*evaluator.Interpreter]bool{}
+	results, err := RunFile(path, nil, nil, func(in *evaluator.Interpreter) {
+		interpreters[in] = true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(interpreters) != len(results) {
+		t.Errorf("wrong number of interpreters prepared. expected %d, got %d", len(results), len(interpreters))
+	}
+}
+
+func TestRunFileImportsFromSiblingDirectory(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "lib/util.monkey", "export let double = function(x) { x * 2 };")
+	path := writeFile(t, dir, "tests/util_test.monkey", `import "../lib/util";
+
+test("double", function() {
+  assertEq(util.double(2), 4);
+});
+`)
+
+	// Imports from outside the test file's directory need the filesystem
+	// capability, which the prepare functions can grant.
+	results, err := RunFile(path, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || !strings.Contains(results[0].Failure, "needs the filesystem capability") {
+		t.Errorf("expected the import to need the filesystem capability, got %+v", results)
+	}
+
+	results, err = RunFile(path, nil, nil, func(in *evaluator.Interpreter) {
+		in.Grant(evaluator.Filesystem)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || !results[0].Passed() {
+		t.Errorf("expected the test to pass with the filesystem capability, got %+v", results)
+	}
+}
+
+func TestRunFileErrors(t *testing.T) {
+	dir := t.TempDir()
+
+	path := writeFile(t, dir, "broken_test.monkey", `test("a", function() {`)
+	if _, err := RunFile(path, nil, nil); err == nil || !strings.HasPrefix(err.Error(), path+": ") {
+		t.Errorf("expected a parse error naming the file, got %v", err)
+	}
+
+	// A failing setup fails every test. Errors without a position of their
+	// own are reported at the test.
+	path = writeFile(t, dir, "setup_test.monkey", "let x = 1 + true;\ntest(\"a\", function() { x });")
+	results, err := RunFile(path, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Passed() || results[0].FailurePosition.Line != 2 {
+		t.Errorf("expected the test to fail on line 2, got %+v", results)
+	}
+}
+
+func TestRunFileWarnings(t *testing.T) {
+	dir := t.TempDir()
+	lib := writeFile(t, dir, "lib.monkey", "export let f = function(x) { match (x) { _ => 1, 2 => 2 } };")
+	path := writeFile(t, dir, "lib_test.monkey", `import "lib";
+let g = function(x) { match (x) { y => y, 3 => 3 } };
+test("a", function() { assertEq(lib.f(2), 1) });
+test("b", function() { assertEq(g(3), 3) });
+`)
+
+	var warnings bytes.Buffer
+	results, err := RunFile(path, nil, &warnings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if passed, _ := Count(results); passed != 2 {
+		t.Errorf("expected both tests to pass, got %+v", results)
+	}
+
+	// The module's warning is written once, though each test imports it.
+	expected := path + ":2:43: warning: unreachable match arm: 3\n" +
+		lib + ":1:50: warning: unreachable match arm: 2\n"
+	if warnings.String() != expected {
+		t.Errorf("wrong warnings.\nexpected %q\n     got %q", expected, warnings.String())
+	}
+}
+
+func TestReports(t *testing.T) {
+	path := writeFile(t, t.TempDir(), "math_test.monkey", mathTests)
+	results, err := RunFile(path, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var text bytes.Buffer
+	WriteText(&text, results, false)
+	expected := "--- FAIL: arrays (" + path + ":18:1, "
+	if !strings.HasPrefix(text.String(), expected) {
+		t.Errorf("report does not start with %q:\n%s", expected, text.String())
+	}
+	for _, want := range []string{"    " + path + ":19:3: assertEq failed\n", "FAIL: 4 passed, 1 failed\n"} {
+		if !strings.Contains(text.String(), want) {
+			t.Errorf("report does not contain %q:\n%s", want, text.String())
+		}
+	}
+	if strings.Contains(text.String(), "PASS") {
+		t.Errorf("report lists passing tests without verbose:\n%s", text.String())
+	}
+
+	var junit bytes.Buffer
+	if err := WriteJUnit(&junit, results); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`<testsuites tests="5" failures="1"`,
+		`<testsuite name="` + path + `" tests="5" failures="1"`,
+		`<testcase name="double" classname="` + path + `" file="` + path + `" line="4"`,
+		`<failure message="assertEq failed">`,
+	} {
+		if !strings.Contains(junit.String(), want) {
+			t.Errorf("JUnit report does not contain %q:\n%s", want, junit.String())
+		}
+	}
+}
@@ -1,10 +1,54 @@
 package token
 
+import (
+	"fmt"
+	"sort"
+)
+
 type TokenType string
 
 type Token struct {
-	Type  TokenType
-	Value string
+	Type  TokenType `json:"type"`
+	Value string    `json:"value"`
+	Position
+}
+
+// Position is a location in source code. Lines and columns start at 1;
+// columns count bytes. The zero Position is unknown.
+type Position struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+func (p Position) IsValid() bool { return p.Line > 0 }
+
+func (p Position) String() string { return fmt.Sprintf("%d:%d", p.Line, p.Column) }
+
+// Before reports whether p comes before other in the source.
+func (p Position) Before(other Position) bool {
+	return p.Line < other.Line || p.Line == other.Line && p.Column < other.Column
+}
+
+// End returns the position just past the token's source text.
+func (t Token) End() Position {
+	text := t.Value
+	switch t.Type {
+	case STRING:
+		text = `"` + text + `"`
+	case EOF:
+		text = ""
+	}
+
+	end := t.Position
+	for i := 0; i < len(text); i++ {
+		if text[i] == '\n' {
+			end.Line++
+			end.Column = 1
+		} else {
+			end.Column++
+		}
+	}
+	return end
 }
 
 const (
@@ -20,11 +64,28 @@ const (
 	BANG     = "!"
 	ASTERISK = "*"
 	SLASH    = "/"
+	PERCENT  = "%"
 	L_THAN   = "<"
 	G_THAN   = ">"
 
+	L_THAN_EQUAL = "<="
+	G_THAN_EQUAL = ">="
+
+	AMPERSAND = "&"
+	PIPE      = "|"
+	CARET     = "^"
+	L_SHIFT   = "<<"
+	R_SHIFT   = ">>"
+
+	AND = "&&"
+	OR  = "||"
+
 	COMMA     = ","
 	SEMICOLON = ";"
+	COLON     = ":"
+	ARROW     = "=>"
+	ELLIPSIS  = "..."
+	DOT       = "."
 
 	LPAREN = "("
 	RPAREN = ")"
@@ -40,6 +101,16 @@ const (
 	ELSE   = "else"
 	RETURN = "return"
 
+	WHILE    = "while"
+	FOR      = "for"
+	IN       = "in"
+	BREAK    = "break"
+	CONTINUE = "continue"
+	MATCH    = "match"
+	IMPORT   = "import"
+	EXPORT   = "export"
+	MACRO    = "macro"
+
 	EQUAL     = "=="
 	NOT_EQUAL = "!="
 
@@ -57,6 +128,25 @@ var keywords = map[string]TokenType{
 	"if":       IF,
 	"else":     ELSE,
 	"return":   RETURN,
+	"while":    WHILE,
+	"for":      FOR,
+	"in":       IN,
+	"break":    BREAK,
+	"continue": CONTINUE,
+	"match":    MATCH,
+	"import":   IMPORT,
+	"export":   EXPORT,
+	"macro":    MACRO,
+}
+
+// Keywords returns the reserved words of the language, sorted.
+func Keywords() []string {
+	words := make([]string, 0, len(keywords))
+	for word := range keywords {
+		words = append(words, word)
+	}
+	sort.Strings(words)
+	return words
 }
 
 func LookupIdentifier(ident string) TokenType {
@@ -0,0 +1,105 @@
+package tracer
+
+import (
+	"encoding/json"
+	"io"
+	"monkey/ast"
+	"monkey/evaluator"
+	"monkey/object"
+	"time"
+)
+
+// ChromeTrace records calls as events of the Trace Event Format, a begin
+// event on each call and an end event on each return, and errors as instant
+// events. Write them out as JSON once the program has run.
+type ChromeTrace struct {
+	evaluator.NoHook
+
+	// Builtins traces calls of builtins too.
+	Builtins bool
+
+	start  time.Time
+	now    func() time.Time
+	events []traceEvent
+}
+
+// traceEvent is an event of the Trace Event Format. Timestamps are in
+// microseconds.
+type traceEvent struct {
+	Name      string                 `json:"name"`
+	Category  string                 `json:"cat,omitempty"`
+	Phase     string                 `json:"ph"`
+	Timestamp float64                `json:"ts"`
+	Process   int                    `json:"pid"`
+	Thread    int                    `json:"tid"`
+	Scope     string                 `json:"s,omitempty"`
+	Args      map[string]interface{} `json:"args,omitempty"`
+}
+
+func NewChromeTrace() *ChromeTrace {
+	return &ChromeTrace{start: time.Now(), now: time.Now}
+}
+
+func (t *ChromeTrace) Call(fn object.Object, args []object.Object, call *ast.CallExpression, env *object.Environment) {
+	category, ok := t.category(fn)
+	if !ok {
+		return
+	}
+	event := t.event("B", evaluator.CallName(call), category)
+	event.Args = map[string]interface{}{"arguments": arguments(args)}
+	if call != nil {
+		event.Args["line"] = ast.Pos(call).Line
+	}
+	t.events = append(t.events, event)
+}
+
+func (t *ChromeTrace) Return(fn object.Object, call *ast.CallExpression, result object.Object) {
+	category, ok := t.category(fn)
+	if !ok {
+		return
+	}
+	event := t.event("E", evaluator.CallName(call), category)
+	event.Args = map[string]interface{}{"result": value(result)}
+	t.events = append(t.events, event)
+}
+
+func (t *ChromeTrace) Error(err *object.Error, node ast.Node, env *object.Environment) {
+	event := t.event("i", "error", "error")
+	event.Scope = "t"
+	event.Args = map[string]interface{}{"message": err.Message}
+	if pos := ast.Pos(node); pos.IsValid() {
+		event.Args["line"] = pos.Line
+	}
+	t.events = append(t.events, event)
+}
+
+func (t *ChromeTrace) category(fn object.Object) (string, bool) {
+	if _, builtin := fn.(*object.Builtin); builtin {
+		return "builtin", t.Builtins
+	}
+	return "function", true
+}
+
+func (t *ChromeTrace) event(phase, name, category string) traceEvent {
+	elapsed := t.now().Sub(t.start)
+	return traceEvent{
+		Name:      name,
+		Category:  category,
+		Phase:     phase,
+		Timestamp: float64(elapsed.Nanoseconds()) / 1e3,
+		Process:   1,
+		Thread:    1,
+	}
+}
+
+// Write writes the events recorded so far as a JSON trace file.
+func (t *ChromeTrace) Write(w io.Writer) error {
+	events := t.events
+	if events == nil {
+		events = []traceEvent{}
+	}
+	return json.NewEncoder(w).Encode(struct {
+		TraceEvents     []traceEvent `json:"traceEvents"`
+		DisplayTimeUnit string       `json:"displayTimeUnit"`
+	}{events, "ms"})
+}
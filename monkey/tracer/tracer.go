@@ -0,0 +1,101 @@
+// Package tracer provides evaluator hooks that record the calls a program
+// makes: CallTrace prints them as they happen, indented by depth, and
+// ChromeTrace collects them as trace events for a trace viewer such as
+// chrome://tracing or Perfetto.
+package tracer
+
+import (
+	"fmt"
+	"io"
+	"monkey/ast"
+	"monkey/evaluator"
+	"monkey/object"
+	"strconv"
+	"strings"
+)
+
+// CallTrace prints every call and return, indented by call depth, and every
+// error where it is created.
+type CallTrace struct {
+	evaluator.NoHook
+
+	// Builtins traces calls of builtins too.
+	Builtins bool
+
+	w     io.Writer
+	depth int
+}
+
+func NewCallTrace(w io.Writer) *CallTrace {
+	return &CallTrace{w: w}
+}
+
+func (t *CallTrace) Call(fn object.Object, args []object.Object, call *ast.CallExpression, env *object.Environment) {
+	if !t.traces(fn) {
+		return
+	}
+	where := ""
+	if call != nil {
+		where = at(call)
+	}
+	fmt.Fprintf(t.w, "%s-> %s(%s)%s\n", t.indent(), evaluator.CallName(call), arguments(args), where)
+	t.depth++
+}
+
+func (t *CallTrace) Return(fn object.Object, call *ast.CallExpression, result object.Object) {
+	if !t.traces(fn) {
+		return
+	}
+	t.depth--
+	fmt.Fprintf(t.w, "%s<- %s = %s\n", t.indent(), evaluator.CallName(call), value(result))
+}
+
+func (t *CallTrace) Error(err *object.Error, node ast.Node, env *object.Environment) {
+	fmt.Fprintf(t.w, "%s!! %s%s\n", t.indent(), err.Message, at(node))
+}
+
+func (t *CallTrace) traces(fn object.Object) bool {
+	_, builtin := fn.(*object.Builtin)
+	return t.Builtins || !builtin
+}
+
+func (t *CallTrace) indent() string {
+	return strings.Repeat("  ", t.depth)
+}
+
+// at locates node for a trace, if it has a position.
+func at(node ast.Node) string {
+	if pos := ast.Pos(node); pos.IsValid() {
+		return " at " + pos.String()
+	}
+	return ""
+}
+
+func arguments(args []object.Object) string {
+	values := make([]string, len(args))
+	for i, arg := range args {
+		values[i] = value(arg)
+	}
+	return strings.Join(values, ", ")
+}
+
+// value shows a value briefly, on one line: strings are quoted and long
+// values, as functions usually are, cut short.
+func value(obj object.Object) string {
+	switch obj := obj.(type) {
+	case nil:
+		return "null"
+	case *object.String:
+		return abbreviate(strconv.Quote(obj.Value))
+	case *object.Error:
+		return "error: " + obj.Message
+	}
+	return abbreviate(strings.Join(strings.Fields(obj.Inspect()), " "))
+}
+
+func abbreviate(s string) string {
+	if len(s) > 40 {
+		return s[:37] + "..."
+	}
+	return s
+}
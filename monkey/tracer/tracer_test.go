@@ -0,0 +1,127 @@
+package tracer
+
+import (
+	"bytes"
+	"encoding/json"
+	"monkey/evaluator"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"reflect"
+	"testing"
+	"time"
+)
+
+const program = `let fact = function(n) {
+  if (n < 2) { return 1; }
+  n * fact(n - 1)
+};
+let greet = function(name) { "hi " + name };
+greet("ann");
+fact(len([1, 2]));
+fact(true)`
+
+func run(t *testing.T, hooks ...evaluator.Hook) {
+	t.Helper()
+	p := parser.New(lexer.New(program))
+	parsed := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+
+	in := evaluator.New()
+	for _, h := range hooks {
+		in.AddHook(h)
+	}
+	in.Eval(parsed, object.NewEnvironment())
+}
+
+func TestCallTrace(t *testing.T) {
+	var out bytes.Buffer
+	run(t, NewCallTrace(&out))
+
+	expected := `-> greet("ann") at 6:1
+<- greet = "hi ann"
+-> fact(2) at 7:1
+  -> fact(1) at 3:7
+  <- fact = 1
+<- fact = 2
+-> fact(true) at 8:1
+  !! type mismatch: BOOLEAN < INTEGER at 2:7
+<- fact = error: type mismatch: BOOLEAN < INTEGER
+`
+	if out.String() != expected {
+		t.Errorf("wrong trace.\nwant:\n%s\ngot:\n%s", expected, out.String())
+	}
+}
+
+func TestCallTraceBuiltins(t *testing.T) {
+	var out bytes.Buffer
+	trace := NewCallTrace(&out)
+	trace.Builtins = true
+	run(t, trace)
+
+	if !bytes.Contains(out.Bytes(), []byte("-> len([1, 2]) at 7:6\n<- len = 2\n")) {
+		t.Errorf("expected the call of len in the trace, got:\n%s", out.String())
+	}
+}
+
+func TestChromeTrace(t *testing.T) {
+	trace := NewChromeTrace()
+	tick := trace.start
+	trace.now = func() time.Time {
+		tick = tick.Add(time.Millisecond)
+		return tick
+	}
+	run(t, trace)
+
+	var out bytes.Buffer
+	if err := trace.Write(&out); err != nil {
+		t.Fatal(err)
+	}
+
+	var file struct {
+		TraceEvents []struct {
+			Name string                 `json:"name"`
+			Cat  string                 `json:"cat"`
+			Ph   string                 `json:"ph"`
+			Ts   float64                `json:"ts"`
+			Pid  int                    `json:"pid"`
+			Tid  int                    `json:"tid"`
+			Args map[string]interface{} `json:"args"`
+		} `json:"traceEvents"`
+	}
+	if err := json.Unmarshal(out.Bytes(), &file); err != nil {
+		t.Fatalf("invalid JSON: %s\n%s", err, out.String())
+	}
+
+	phases := []string{}
+	for i, e := range file.TraceEvents {
+		phases = append(phases, e.Ph+" "+e.Name)
+		if want := float64(i+1) * 1000; e.Ts != want {
+			t.Errorf("event %d: wrong timestamp. want=%v, got=%v", i, want, e.Ts)
+		}
+		if e.Pid != 1 || e.Tid != 1 {
+			t.Errorf("event %d: wrong process or thread: %d, %d", i, e.Pid, e.Tid)
+		}
+	}
+	expected := []string{
+		"B greet", "E greet",
+		"B fact", "B fact", "E fact", "E fact",
+		"B fact", "i error", "E fact",
+	}
+	if !reflect.DeepEqual(phases, expected) {
+		t.Errorf("wrong events.\nwant=%q\ngot= %q", expected, phases)
+	}
+
+	first := file.TraceEvents[0]
+	if first.Cat != "function" || first.Args["arguments"] != `"ann"` || first.Args["line"] != 6.0 {
+		t.Errorf("wrong call event: %+v", first)
+	}
+	if result := file.TraceEvents[1].Args["result"]; result != `"hi ann"` {
+		t.Errorf("wrong result: %v", result)
+	}
+	if msg := file.TraceEvents[7].Args["message"]; msg != "type mismatch: BOOLEAN < INTEGER" {
+		t.Errorf("wrong error message: %v", msg)
+	}
+}
@@ -0,0 +1,674 @@
+package types
+
+import (
+	"fmt"
+	"monkey/ast"
+	"monkey/token"
+	"sort"
+)
+
+// Error is a type error found by a Checker.
+type Error struct {
+	Position token.Position
+	Message  string
+}
+
+func (e Error) String() string {
+	return fmt.Sprintf("%s: type error: %s", e.Position, e.Message)
+}
+
+type scope struct {
+	outer *scope
+	types map[string]Type
+}
+
+func newScope(outer *scope) *scope {
+	return &scope{outer: outer, types: make(map[string]Type)}
+}
+
+func (s *scope) lookup(name string) (Type, bool) {
+	for ; s != nil; s = s.outer {
+		if t, ok := s.types[name]; ok {
+			return t, true
+		}
+	}
+	return nil, false
+}
+
+// Checker infers the types of programs. The types of globals persist between
+// calls to Check, so one Checker can follow a REPL session.
+type Checker struct {
+	scope   *scope
+	level   int
+	returns []result
+	errors  []Error
+}
+
+// result is the return type of the function being checked.
+type result struct {
+	t         Type
+	annotated bool
+}
+
+func (r result) subject() string {
+	if r.annotated {
+		return "return value"
+	}
+	return ""
+}
+
+func NewChecker() *Checker {
+	return &Checker{scope: newScope(nil)}
+}
+
+// Check infers the types in program and returns the type of its value along
+// with the type errors found, ordered by position.
+func (c *Checker) Check(program *ast.Program) (Type, []Error) {
+	c.errors = nil
+	c.level = 0
+	c.returns = nil
+
+	t := c.statements(program.Statements)
+
+	sort.SliceStable(c.errors, func(i, j int) bool {
+		return c.errors[i].Position.Before(c.errors[j].Position)
+	})
+	return t, c.errors
+}
+
+func (c *Checker) errorf(node ast.Node, format string, args ...interface{}) {
+	c.errors = append(c.errors, Error{
+		Position: ast.Pos(node),
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+// unify reports an error at node unless actual fits expected.
+func (c *Checker) unify(node ast.Node, expected, actual Type) {
+	c.unifyAnnotated(node, "", expected, actual)
+}
+
+// unifyAnnotated is unify for a value checked against an annotation, whose
+// subject the error message names, if given.
+func (c *Checker) unifyAnnotated(node ast.Node, subject string, expected, actual Type) {
+	err := unify(expected, actual)
+	switch {
+	case err == nil:
+	case subject != "":
+		c.errorf(node, "%s: %s", subject, err)
+	default:
+		c.errorf(node, "%s", err)
+	}
+}
+
+func (c *Checker) fresh() *Variable {
+	return &Variable{level: c.level}
+}
+
+func (c *Checker) define(ident *ast.Identifier, t Type) {
+	if ident.Value != "_" {
+		c.scope.types[ident.Value] = t
+	}
+}
+
+// generalize makes the variables introduced since the current level generic.
+func (c *Checker) generalize(t Type) {
+	switch t := prune(t).(type) {
+	case *Variable:
+		if t.level > c.level {
+			t.level = genericLevel
+		}
+	case *Constructor:
+		for _, arg := range t.Args {
+			c.generalize(arg)
+		}
+	case *Function:
+		for _, param := range t.Params {
+			c.generalize(param)
+		}
+		if t.Rest != nil {
+			c.generalize(t.Rest)
+		}
+		c.generalize(t.Return)
+	}
+}
+
+// settle moves the variables of a binding that is not generalised to the
+// current level, so later lets do not generalise them either.
+func (c *Checker) settle(t Type) {
+	v := &Variable{level: c.level}
+	occurs(v, t)
+}
+
+// instantiate replaces the generic variables of t with fresh ones.
+func (c *Checker) instantiate(t Type) Type {
+	fresh := map[*Variable]*Variable{}
+
+	var copy func(t Type) Type
+	copy = func(t Type) Type {
+		switch t := prune(t).(type) {
+		case *Variable:
+			if t.level != genericLevel {
+				return t
+			}
+			v, ok := fresh[t]
+			if !ok {
+				v = c.fresh()
+				v.addable = t.addable
+				v.ordered = t.ordered
+				fresh[t] = v
+			}
+			return v
+		case *Constructor:
+			if len(t.Args) == 0 {
+				return t
+			}
+			args := make([]Type, len(t.Args))
+			for i, arg := range t.Args {
+				args[i] = copy(arg)
+			}
+			return &Constructor{Name: t.Name, Args: args}
+		case *Function:
+			params := make([]Type, len(t.Params))
+			for i, param := range t.Params {
+				params[i] = copy(param)
+			}
+			var rest Type
+			if t.Rest != nil {
+				rest = copy(t.Rest)
+			}
+			return &Function{Params: params, Return: copy(t.Return), Rest: rest, Names: t.Names}
+		default:
+			return t
+		}
+	}
+
+	return copy(t)
+}
+
+func (c *Checker) statements(stmts []ast.Statement) Type {
+	var t Type = Null
+	for _, stmt := range stmts {
+		t = c.statement(stmt)
+	}
+	return t
+}
+
+func (c *Checker) statement(stmt ast.Statement) Type {
+	switch stmt := stmt.(type) {
+	case *ast.ExpressionStatement:
+		return c.infer(stmt.Expression)
+
+	case *ast.LetStatement:
+		c.let(stmt)
+		return Null
+
+	case *ast.ExportStatement:
+		c.let(stmt.Statement)
+		return Null
+
+	case *ast.ReturnStatement:
+		if stmt.ReturnValue == nil {
+			return c.fresh()
+		}
+		t := c.infer(stmt.ReturnValue)
+		if n := len(c.returns); n > 0 {
+			r := c.returns[n-1]
+			c.unifyAnnotated(stmt.ReturnValue, r.subject(), r.t, t)
+		}
+		// Control never reaches the end of a block that returns, so the
+		// block's own value may have any type.
+		return c.fresh()
+
+	case *ast.BlockStatement:
+		return c.statements(stmt.Statements)
+
+	case *ast.WhileStatement:
+		c.infer(stmt.Condition)
+		c.statements(stmt.Body.Statements)
+		return Null
+
+	case *ast.ForStatement:
+		c.forStatement(stmt)
+		return Null
+
+	case *ast.ImportStatement:
+		c.define(stmt.Name, c.fresh())
+		return Null
+
+	case *ast.BreakStatement, *ast.ContinueStatement:
+		return c.fresh()
+	}
+
+	return c.fresh()
+}
+
+// let binds the names of a let statement. Only functions are generalised:
+// other values can be reassigned, so their type must stay the same.
+func (c *Checker) let(stmt *ast.LetStatement) {
+	_, isFunction := stmt.Value.(*ast.FunctionLiteral)
+
+	c.level++
+	var self *Variable
+	if ident, ok := stmt.Name.(*ast.Identifier); ok && isFunction {
+		// A function may call itself, but only at a single type.
+		self = c.fresh()
+		c.define(ident, self)
+	}
+	t := c.infer(stmt.Value)
+	if stmt.Type != nil {
+		declared := annotationType(stmt.Type)
+		c.unifyAnnotated(stmt.Value, "let "+stmt.Name.String(), declared, t)
+		t = declared
+	}
+	if self != nil {
+		c.unify(stmt.Value, self, t)
+	}
+	c.level--
+
+	if isFunction {
+		c.generalize(t)
+	} else {
+		c.settle(t)
+	}
+	c.bindPattern(stmt.Name, t, false)
+}
+
+func (c *Checker) forStatement(stmt *ast.ForStatement) {
+	iterable := c.infer(stmt.Iterable)
+
+	var key, value Type
+	switch t := prune(iterable).(type) {
+	case *Constructor:
+		switch {
+		case t.Name == "array":
+			key, value = Int, t.Args[0]
+		case t == String:
+			key, value = Int, String
+		case t == Range:
+			key, value = Int, Int
+		case t == Hash:
+			key, value = c.fresh(), c.fresh()
+		default:
+			c.errorf(stmt.Iterable, "cannot iterate over %s", t)
+		}
+	}
+	if value == nil {
+		key, value = c.fresh(), c.fresh()
+	}
+
+	if stmt.Key != nil {
+		c.define(stmt.Key, key)
+	}
+	c.define(stmt.Value, value)
+	c.statements(stmt.Body.Statements)
+}
+
+// bindPattern binds the names of pattern to the parts of a value of type t.
+// Match arms test the shape of their subject at run time, so when the
+// subject's type is not known, a match pattern does not decide it.
+func (c *Checker) bindPattern(pattern ast.Pattern, t Type, match bool) {
+	switch pattern := pattern.(type) {
+	case *ast.Identifier:
+		c.define(pattern, t)
+		return
+	case *ast.WildcardPattern:
+		return
+	}
+
+	if _, ok := prune(t).(*Variable); ok && match {
+		for _, ident := range ast.PatternIdentifiers(pattern) {
+			c.define(ident, c.fresh())
+		}
+		return
+	}
+
+	switch pattern := pattern.(type) {
+	case *ast.LiteralPattern:
+		c.unify(pattern, t, c.infer(pattern.Value))
+
+	case *ast.ArrayPattern:
+		element := c.fresh()
+		c.unify(pattern, t, Array(element))
+		for _, el := range pattern.Elements {
+			c.bindPattern(el, element, match)
+		}
+		if pattern.Rest != nil {
+			c.define(pattern.Rest, Array(element))
+		}
+
+	case *ast.HashPattern:
+		c.unify(pattern, t, Hash)
+		for _, pair := range pattern.Pairs {
+			c.infer(pair.Key)
+			c.bindPattern(pair.Value, c.fresh(), match)
+		}
+	}
+}
+
+func (c *Checker) infer(node ast.Expression) Type {
+	switch node := node.(type) {
+	case *ast.IntegerLiteral:
+		return Int
+	case *ast.StringLiteral:
+		return String
+	case *ast.Boolean:
+		return Bool
+
+	case *ast.Identifier:
+		if t, ok := builtins[node.Value]; ok {
+			return c.instantiate(t)
+		}
+		if t, ok := c.scope.lookup(node.Value); ok {
+			return c.instantiate(t)
+		}
+		return c.fresh()
+
+	case *ast.PrefixExpression:
+		right := c.infer(node.Right)
+		if node.Operator == "-" {
+			c.unify(node.Right, Int, right)
+			return Int
+		}
+		return Bool
+
+	case *ast.InfixExpression:
+		return c.infix(node)
+
+	case *ast.IfExpression:
+		c.infer(node.Condition)
+		consequence := c.statements(node.Consequence.Statements)
+		if node.Alternative == nil {
+			// Without an else, the value is null whenever the condition
+			// does not hold.
+			return c.fresh()
+		}
+		alternative := c.statements(node.Alternative.Statements)
+		c.unify(node.Alternative, consequence, alternative)
+		return consequence
+
+	case *ast.FunctionLiteral:
+		return c.function(node)
+
+	case *ast.CallExpression:
+		return c.call(node)
+
+	case *ast.ArrayLiteral:
+		element := c.fresh()
+		for _, el := range node.Elements {
+			if spread, ok := el.(*ast.SpreadExpression); ok {
+				c.unify(spread.Value, Array(element), c.infer(spread.Value))
+				continue
+			}
+			c.unify(el, element, c.infer(el))
+		}
+		return Array(element)
+
+	case *ast.HashLiteral:
+		for _, pair := range node.Pairs {
+			c.infer(pair.Key)
+			c.infer(pair.Value)
+		}
+		return Hash
+
+	case *ast.IndexExpression:
+		return c.index(node)
+
+	case *ast.AssignExpression:
+		value := c.infer(node.Value)
+		if _, ok := builtins[node.Name.Value]; ok {
+			return value
+		}
+		if t, ok := c.scope.lookup(node.Name.Value); ok {
+			c.unify(node.Value, c.instantiate(t), value)
+		}
+		return value
+
+	case *ast.MatchExpression:
+		subject := c.infer(node.Subject)
+		result := c.fresh()
+		for _, arm := range node.Arms {
+			c.scope = newScope(c.scope)
+			c.bindPattern(arm.Pattern, subject, true)
+			if arm.Guard != nil {
+				c.infer(arm.Guard)
+			}
+			c.unify(arm.Body, result, c.statements(arm.Body.Statements))
+			c.scope = c.scope.outer
+		}
+		return result
+
+	case *ast.MemberExpression:
+		c.infer(node.Object)
+		return c.fresh()
+
+	case *ast.SpreadExpression:
+		c.infer(node.Value)
+		return c.fresh()
+	}
+
+	return c.fresh()
+}
+
+func (c *Checker) infix(node *ast.InfixExpression) Type {
+	left := c.infer(node.Left)
+	right := c.infer(node.Right)
+
+	switch node.Operator {
+	case "+":
+		t := c.fresh()
+		t.addable = true
+		errors := len(c.errors)
+		c.unify(node.Left, t, left)
+		c.unify(node.Right, t, right)
+		if len(c.errors) > errors {
+			// Say nothing more about a sum already reported.
+			return c.fresh()
+		}
+		return t
+	case "-", "*", "/", "%", "&", "|", "^", "<<", ">>":
+		c.unify(node.Left, Int, left)
+		c.unify(node.Right, Int, right)
+		return Int
+	case "<", ">", "<=", ">=":
+		t := c.fresh()
+		t.ordered = true
+		c.unify(node.Left, t, left)
+		c.unify(node.Right, t, right)
+		return Bool
+	default:
+		// == and != compare any two values, which are unequal if their
+		// types differ, and && and || take any values. All of them
+		// produce a boolean.
+		return Bool
+	}
+}
+
+func (c *Checker) index(node *ast.IndexExpression) Type {
+	left := c.infer(node.Left)
+	index := c.infer(node.Index)
+
+	_, unknown := prune(left).(*Variable)
+	switch {
+	case prune(left) == Hash:
+		return c.fresh()
+	case prune(index) == String:
+		c.unify(node.Left, Hash, left)
+		return c.fresh()
+	case unknown && prune(index) != Int:
+		// Without more to go on, left may be an array or a hash.
+		return c.fresh()
+	}
+
+	element := c.fresh()
+	c.unify(node.Left, Array(element), left)
+	c.unify(node.Index, Int, index)
+	return element
+}
+
+func (c *Checker) function(node *ast.FunctionLiteral) Type {
+	c.scope = newScope(c.scope)
+	defer func() { c.scope = c.scope.outer }()
+
+	optional := false
+	params := make([]Type, len(node.Parameters))
+	names := make([]string, len(node.Parameters))
+	for i, param := range node.Parameters {
+		params[i] = c.fresh()
+		if i < len(node.ParameterTypes) && node.ParameterTypes[i] != nil {
+			params[i] = annotationType(node.ParameterTypes[i])
+			names[i] = "parameter " + param.String()
+		}
+		if i < len(node.Defaults) && node.Defaults[i] != nil {
+			optional = true
+			c.unifyAnnotated(node.Defaults[i], names[i], params[i], c.infer(node.Defaults[i]))
+		}
+		c.bindPattern(param, params[i], false)
+	}
+	var rest Type
+	if node.Rest != nil {
+		rest = c.fresh()
+		array := Array(rest)
+		if node.RestType != nil {
+			rest = Any
+			if t, ok := annotationType(node.RestType).(*Constructor); ok && t.Name == "array" {
+				rest, array = t.Args[0], t
+			}
+			names = append(names, "parameter ..."+node.Rest.Value)
+		}
+		c.define(node.Rest, array)
+	}
+
+	ret := result{t: c.fresh()}
+	if node.ReturnType != nil {
+		ret = result{t: annotationType(node.ReturnType), annotated: true}
+	}
+	c.returns = append(c.returns, ret)
+	body := c.statements(node.Body.Statements)
+	c.returns = c.returns[:len(c.returns)-1]
+	c.unifyAnnotated(lastStatement(node.Body), ret.subject(), ret.t, body)
+
+	// A function type has a fixed number of parameters, and maybe a rest
+	// parameter after them, which functions with defaults do not.
+	if optional {
+		return c.fresh()
+	}
+	return &Function{Params: params, Return: ret.t, Rest: rest, Names: names}
+}
+
+func (c *Checker) call(node *ast.CallExpression) Type {
+	if ident, ok := node.Function.(*ast.Identifier); ok {
+		switch ident.Value {
+		case "puts":
+			for _, arg := range node.Arguments {
+				c.infer(arg)
+			}
+			return Null
+		case "range":
+			if n := len(node.Arguments); n < 1 || n > 3 {
+				c.errorf(node, "wrong number of arguments to range: expected 1 to 3, got %d", n)
+			}
+			for _, arg := range node.Arguments {
+				c.unify(arg, Int, c.infer(arg))
+			}
+			return Range
+		case "quote", "unquote":
+			return c.fresh()
+		}
+	}
+
+	fn := c.infer(node.Function)
+
+	args := make([]Type, len(node.Arguments))
+	spread := false
+	for i, arg := range node.Arguments {
+		if s, ok := arg.(*ast.SpreadExpression); ok {
+			spread = true
+			c.unify(s.Value, Array(c.fresh()), c.infer(s.Value))
+			continue
+		}
+		args[i] = c.infer(arg)
+	}
+	if spread {
+		return c.fresh()
+	}
+
+	switch f := prune(fn).(type) {
+	case *Function:
+		switch {
+		case f.Rest == nil && len(args) != len(f.Params):
+			c.errorf(node, "wrong number of arguments: expected %d, got %d", len(f.Params), len(args))
+			return f.Return
+		case len(args) < len(f.Params):
+			c.errorf(node, "wrong number of arguments: expected at least %d, got %d", len(f.Params), len(args))
+			return f.Return
+		}
+		for i, arg := range node.Arguments {
+			// Arguments past the parameters go to the rest parameter.
+			param, n := f.Rest, len(f.Params)
+			if i < n {
+				param, n = f.Params[i], i
+			}
+			subject := ""
+			if n < len(f.Names) {
+				subject = f.Names[n]
+			}
+			c.unifyAnnotated(arg, subject, param, args[i])
+		}
+		return f.Return
+	case *Constructor:
+		c.errorf(node.Function, "cannot call %s", f)
+		return c.fresh()
+	}
+
+	ret := c.fresh()
+	c.unify(node, fn, &Function{Params: args, Return: ret})
+	return ret
+}
+
+// annotationType returns the type written in an annotation.
+func annotationType(annotation ast.TypeExpression) Type {
+	switch annotation := annotation.(type) {
+	case *ast.NamedType:
+		switch annotation.Name {
+		case "int":
+			return Int
+		case "string":
+			return String
+		case "bool":
+			return Bool
+		case "null":
+			return Null
+		case "hash":
+			return Hash
+		case "range":
+			return Range
+		}
+	case *ast.ArrayType:
+		return Array(annotationType(annotation.Element))
+	case *ast.FunctionType:
+		params := make([]Type, len(annotation.Parameters))
+		for i, param := range annotation.Parameters {
+			params[i] = annotationType(param)
+		}
+		return &Function{Params: params, Return: annotationType(annotation.Return)}
+	}
+	return Any
+}
+
+// lastStatement returns the node whose value a block produces.
+func lastStatement(block *ast.BlockStatement) ast.Node {
+	if n := len(block.Statements); n > 0 {
+		return block.Statements[n-1]
+	}
+	return block
+}
+
+// builtins holds the types of the builtin functions that have one. puts and
+// range take a varying number of arguments and are checked where called.
+var builtins = map[string]Type{
+	"len": &Function{
+		Params: []Type{&Variable{level: genericLevel}},
+		Return: Int,
+	},
+}
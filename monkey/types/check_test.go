@@ -0,0 +1,226 @@
+package types
+
+import (
+	"monkey/ast"
+	"monkey/lexer"
+	"monkey/parser"
+	"reflect"
+	"testing"
+)
+
+func parse(t *testing.T, input string) *ast.Program {
+	t.Helper()
+
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors in %q: %v", input, p.Errors())
+	}
+	return program
+}
+
+func check(t *testing.T, c *Checker, input string) (string, []string) {
+	t.Helper()
+
+	typ, errors := c.Check(parse(t, input))
+	messages := []string{}
+	for _, e := range errors {
+		messages = append(messages, e.String())
+	}
+	return typ.String(), messages
+}
+
+func TestInferredTypes(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`5`, "int"},
+		{`"monkey"`, "string"},
+		{`!5`, "bool"},
+		{`1 + 2 * 3`, "int"},
+		{`"a" + "b"`, "string"},
+		{`1 < 2 && 2 != 3`, "bool"},
+		{`1 == "a"`, "bool"},
+		{`function(x, y) { x != y }`, "function(a, b): bool"},
+		{`"a" < "b"`, "bool"},
+		{`[1, 2] >= [1]`, "bool"},
+		{`let x = 5;`, "null"},
+		{`[1, 2, 3]`, "[int]"},
+		{`[[1], []]`, "[[int]]"},
+		{`[]`, "[a]"},
+		{`{"a": 1, 2: true}`, "hash"},
+		{`[1, 2][0]`, "int"},
+		{`{"a": 1}["a"]`, "a"},
+		{`range(10)`, "range"},
+		{`puts(1, "a")`, "null"},
+		{`len`, "function(a): int"},
+		{`function(x) { x }`, "function(a): a"},
+		{`function(x, y) { x }`, "function(a, b): a"},
+		{`function(x) { x + 1 }`, "function(int): int"},
+		{`function(x, y) { x + y }`, "function(a, a): a"},
+		{`function(x, y) { x < y }`, "function(a, a): bool"},
+		{`function(xs) { xs < [["a"]] }`, "function([[string]]): bool"},
+		{`function(f, x) { f(f(x)) }`, "function(function(a): a, a): a"},
+		{`function(arr) { arr[0] }`, "function([a]): a"},
+		{`function([a, b]) { a + b }`, "function([a]): a"},
+		{`function(x) { if (x) { 1 } else { 2 } }`, "function(a): int"},
+		{`function(x) { if (x > 0) { return "positive"; } "other" }`, "function(int): string"},
+		{`function(n) { for (i in range(n)) { puts(i) } }`, "function(int): null"},
+		{`function(s) { for (c in s) { c + "" } }`, "function(a): null"},
+		{`function(x) { match (x) { 0 => { "zero" }, n => { "many" } } }`, "function(a): string"},
+		{`match (5) { 0 => { 1 }, n => { n } }`, "int"},
+		{`function(x) { match (x) { [a, b] => { a }, _ => { 0 } } }`, "function(a): int"},
+		// Let-polymorphism: a function bound by let works at every type.
+		{`let id = function(x) { x }; [id(1), id(2)]`, "[int]"},
+		{`let id = function(x) { x }; id("a") + id("b")`, "string"},
+		{`let id = function(x) { x }; let apply = function(f) { f(1) }; apply(id)`, "int"},
+		{`let fib = function(n) { if (n < 2) { return n; } fib(n - 1) + fib(n - 2) }; fib`, "function(int): int"},
+		{`let compose = function(f, g) { function(x) { g(f(x)) } }; compose`, "function(function(a): b, function(b): c): function(a): c"},
+		{`let twice = function(f) { function(x) { f(f(x)) } }; twice(function(s) { s + "!" })("hi")`, "string"},
+		// Values other than functions are not generalised.
+		{`let empty = []; empty`, "[a]"},
+		{`let empty = []; let f = function() { empty }; f`, "function(): [a]"},
+		// Functions with defaults are not typed; rest parameters take any
+		// number of arguments of one type.
+		{`function(x, y = 2) { x + y }`, "a"},
+		{`function(...xs) { xs }`, "function(...a): [a]"},
+		{`let f = function(x, ...rest) { [x, ...rest] }; f(1, 2, 3)`, "[int]"},
+		{`let f = function(...xs) { xs }; [f(), f("a")]`, "[[string]]"},
+		{`import "lib" as lib; lib.member`, "a"},
+	}
+
+	for _, tt := range tests {
+		typ, errors := check(t, NewChecker(), tt.input)
+
+		if len(errors) != 0 {
+			t.Errorf("unexpected type errors for %q: %v", tt.input, errors)
+			continue
+		}
+		if typ != tt.expected {
+			t.Errorf("wrong type for %q. expected %s, got %s", tt.input, tt.expected, typ)
+		}
+	}
+}
+
+func TestTypeErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{`1 + "a"`, []string{"1:5: type error: expected int, got string"}},
+		{`true + false`, []string{
+			"1:1: type error: expected int or string, got bool",
+			"1:8: type error: expected int or string, got bool",
+		}},
+		{`-"a"`, []string{"1:2: type error: expected int, got string"}},
+		{`true < false`, []string{
+			"1:1: type error: expected int, string or array, got bool",
+			"1:8: type error: expected int, string or array, got bool",
+		}},
+		{`"a" < 1`, []string{"1:7: type error: expected string, got int"}},
+		{`[{}] < []`, []string{"1:1: type error: expected int, string or array, got [hash]"}},
+		{`function(x, y) { [x] < [y]; x + 1; y + true }`, []string{"1:40: type error: expected int, got bool"}},
+		{`let f = function(x) { [x] < [] }; f(len)`, []string{"1:37: type error: expected int, string or array, got function(a): int"}},
+		{`[1, "a"]`, []string{"1:5: type error: expected int, got string"}},
+		{`[1, ...["a"]]`, []string{"1:8: type error: expected [int], got [string]"}},
+		{`5[0]`, []string{"1:1: type error: expected [a], got int"}},
+		{`[1]["a"]`, []string{"1:1: type error: expected hash, got [int]"}},
+		{`5(1)`, []string{"1:1: type error: cannot call int"}},
+		{`let f = function(a) { a }; f(1, 2)`, []string{"1:28: type error: wrong number of arguments: expected 1, got 2"}},
+		{`let f = function(a) { a + 1 }; f("a")`, []string{"1:34: type error: expected int, got string"}},
+		{`len(1, 2)`, []string{"1:1: type error: wrong number of arguments: expected 1, got 2"}},
+		{`range("a")`, []string{"1:7: type error: expected int, got string"}},
+		{`range()`, []string{"1:1: type error: wrong number of arguments to range: expected 1 to 3, got 0"}},
+		{`if (true) { 1 } else { "a" }`, []string{"1:22: type error: expected int, got string"}},
+		{`let x = 1; x = "a"`, []string{"1:16: type error: expected int, got string"}},
+		{`for (x in 5) { x }`, []string{"1:11: type error: cannot iterate over int"}},
+		{`let [a, b] = 5;`, []string{"1:5: type error: expected int, got [a]"}},
+		{`match (5) { "five" => { 1 } }`, []string{"1:13: type error: expected int, got string"}},
+		{`match (5) { 5 => { 1 }, _ => { "a" } }`, []string{"1:30: type error: expected int, got string"}},
+		{`function(x) { if (x) { return 1; } "a" }`, []string{"1:36: type error: expected int, got string"}},
+		{`function(x) { x(x) }`, []string{"1:15: type error: infinite type: a occurs in function(a): b"}},
+		// A function is only polymorphic outside its own definition.
+		{`let f = function(x) { f(1); f("a") }`, []string{"1:31: type error: expected int, got string"}},
+		// Values other than functions keep a single type.
+		{`let empty = []; let f = function(x) { x + 1 }; f(empty)`, []string{"1:50: type error: expected int, got [a]"}},
+		{`let empty = []; empty = [1]; empty = ["a"]`, []string{"1:38: type error: expected [int], got [string]"}},
+		// A sum that is already wrong is not reported again.
+		{`let s = [] + []; s = 1`, []string{
+			"1:9: type error: expected int or string, got [a]",
+			"1:14: type error: expected int or string, got [a]",
+		}},
+	}
+
+	for _, tt := range tests {
+		_, errors := check(t, NewChecker(), tt.input)
+
+		if !reflect.DeepEqual(errors, tt.expected) {
+			t.Errorf("wrong type errors for %q.\nexpected %v\n     got %v", tt.input, tt.expected, errors)
+		}
+	}
+}
+
+func TestAnnotations(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		errors   []string
+	}{
+		{`function(x: int, y: string): bool { true }`, "function(int, string): bool", nil},
+		{`function(xs: [int], f: function(int): string) { f(xs[0]) }`, "function([int], function(int): string): string", nil},
+		{`let n: int = 1; n`, "int", nil},
+		{`let id: function(int): int = function(x) { x }; id`, "function(int): int", nil},
+		{`let empty: [string] = []; empty`, "[string]", nil},
+		{`function(h: hash, r: range): null { puts(h, r) }`, "function(hash, range): null", nil},
+		// any opts out of static checks.
+		{`function(x: any) { x + 1 }`, "function(any): any", nil},
+		{`let f = function(x: any): any { x }; [f(1), f("a")]`, "[any]", nil},
+		{`let x: any = 1; x = "a"`, "string", nil},
+		{`let n: int = "one";`, "null", []string{"1:14: type error: let n: expected int, got string"}},
+		{`let [a, b]: [int] = ["a", "b"];`, "null", []string{"1:21: type error: let [a, b]: expected [int], got [string]"}},
+		{`let f = function(x: int) { x }; f("a")`, "int", []string{"1:35: type error: parameter x: expected int, got string"}},
+		{`let f = function(x: int, y = "a") { x }; f(1)`, "a", nil},
+		{`function(x: int = "a") { x }`, "a", []string{"1:19: type error: parameter x: expected int, got string"}},
+		{`function(x: string) { x * 2 }`, "function(string): int", []string{"1:23: type error: expected int, got string"}},
+		{`function(...xs: [int]) { xs[0] + "" }`, "function(...int): a", []string{"1:34: type error: expected int, got string"}},
+		{`let q = function(a, ...r: [string]) { r }; q(1, "a")`, "[string]", nil},
+		{`let q = function(a, ...r: [string]) { r }; q(1, "a", 2)`, "[string]", []string{"1:54: type error: parameter ...r: expected string, got int"}},
+		{`let f = function(a, ...r) { a }; f()`, "a", []string{"1:34: type error: wrong number of arguments: expected at least 1, got 0"}},
+		{`let f = function(...xs) { xs }; f(1, "a")`, "[int]", []string{"1:38: type error: expected int, got string"}},
+		{`function(): int { "a" }`, "function(): int", []string{"1:19: type error: return value: expected int, got string"}},
+		{`function(x): bool { if (x) { return 1; } true }`, "function(a): bool", []string{"1:37: type error: return value: expected bool, got int"}},
+		{`let apply = function(f: function(int): int) { f(1) }; apply(function(s) { s + "" })`, "int", []string{
+			"1:61: type error: parameter f: expected function(int): int, got function(string): string",
+		}},
+	}
+
+	for _, tt := range tests {
+		typ, errors := check(t, NewChecker(), tt.input)
+
+		if typ != tt.expected {
+			t.Errorf("wrong type for %q. expected %s, got %s", tt.input, tt.expected, typ)
+		}
+		if len(errors) != 0 || len(tt.errors) != 0 {
+			if !reflect.DeepEqual(errors, tt.errors) {
+				t.Errorf("wrong type errors for %q.\nexpected %v\n     got %v", tt.input, tt.errors, errors)
+			}
+		}
+	}
+}
+
+func TestCheckerFollowsSession(t *testing.T) {
+	c := NewChecker()
+
+	check(t, c, `let id = function(x) { x };`)
+	check(t, c, `let n = 1;`)
+
+	typ, errors := check(t, c, `[id(n), id(2)]`)
+	if len(errors) != 0 || typ != "[int]" {
+		t.Fatalf("expected [int] without errors, got %s %v", typ, errors)
+	}
+
+	if _, errors := check(t, c, `n = "a"`); len(errors) != 1 {
+		t.Fatalf("expected the type of n to persist, got %v", errors)
+	}
+}
@@ -0,0 +1,287 @@
+// Package types infers the types of Monkey programs without running them.
+//
+// Inference follows Hindley–Milner: every expression gets a type, possibly
+// containing type variables, and the uses of a value narrow those variables
+// down by unification. Functions bound by let are generalised, so one
+// definition can be used at several types.
+//
+// Type annotations in the source narrow types further, and `any` opts a value
+// out of static checking.
+//
+// Monkey is dynamically typed and some of its values do not fit this scheme.
+// Hashes are typed as a single hash type whose contents are unknown, and the
+// parts of a program the checker cannot follow, such as module members or
+// calls with spread arguments, get fresh type variables that fit anything.
+package types
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Type is the type of a Monkey value.
+type Type interface {
+	String() string
+	typeNode()
+}
+
+// genericLevel marks the variables of a generalised type. Every use of the
+// type replaces them with fresh variables.
+const genericLevel = math.MaxInt32
+
+// Variable is a type not known yet. Once unification decides it, instance
+// holds the type it stands for.
+type Variable struct {
+	level    int
+	instance Type
+
+	// addable restricts the variable to the types + works on, and ordered
+	// to those <, >, <= and >= work on.
+	addable bool
+	ordered bool
+}
+
+func (v *Variable) typeNode()      {}
+func (v *Variable) String() string { return format(v) }
+
+// Constructor is a named type, such as int or [string], applied to the types
+// in Args.
+type Constructor struct {
+	Name string
+	Args []Type
+}
+
+func (c *Constructor) typeNode()      {}
+func (c *Constructor) String() string { return format(c) }
+
+var (
+	Int    = &Constructor{Name: "int"}
+	String = &Constructor{Name: "string"}
+	Bool   = &Constructor{Name: "bool"}
+	Null   = &Constructor{Name: "null"}
+	Hash   = &Constructor{Name: "hash"}
+	Range  = &Constructor{Name: "range"}
+
+	// Any is the type of values annotated `any`. It fits every type, so
+	// values of this type are only checked at run time.
+	Any = &Constructor{Name: "any"}
+)
+
+// Array returns the type of arrays whose elements have type element.
+func Array(element Type) *Constructor {
+	return &Constructor{Name: "array", Args: []Type{element}}
+}
+
+type Function struct {
+	Params []Type
+	Return Type
+
+	// Rest is the type of each argument after Params, for a function with
+	// a rest parameter, and nil for one that takes exactly Params.
+	Rest Type
+
+	// Names holds, for error messages, the names of annotated parameters,
+	// followed by that of the rest parameter, and is empty for the others.
+	// It does not take part in unification.
+	Names []string
+}
+
+func (f *Function) typeNode()      {}
+func (f *Function) String() string { return format(f) }
+
+// prune returns the type t stands for, following decided variables.
+func prune(t Type) Type {
+	for {
+		v, ok := t.(*Variable)
+		if !ok || v.instance == nil {
+			return t
+		}
+		t = v.instance
+	}
+}
+
+func format(t Type) string {
+	return formatAll(t)[0]
+}
+
+// formatAll writes each of ts with their variables named a, b, c… in order of
+// appearance, so a variable has the same name in all of them.
+func formatAll(ts ...Type) []string {
+	names := map[*Variable]string{}
+
+	var write func(t Type) string
+	write = func(t Type) string {
+		switch t := prune(t).(type) {
+		case *Variable:
+			name, ok := names[t]
+			if !ok {
+				name = variableName(len(names))
+				names[t] = name
+			}
+			return name
+		case *Constructor:
+			if t.Name == "array" {
+				return "[" + write(t.Args[0]) + "]"
+			}
+			return t.Name
+		case *Function:
+			params := []string{}
+			for _, param := range t.Params {
+				params = append(params, write(param))
+			}
+			if t.Rest != nil {
+				params = append(params, "..."+write(t.Rest))
+			}
+			return "function(" + strings.Join(params, ", ") + "): " + write(t.Return)
+		}
+		return "?"
+	}
+
+	written := make([]string, len(ts))
+	for i, t := range ts {
+		written[i] = write(t)
+	}
+	return written
+}
+
+func variableName(i int) string {
+	name := string(rune('a' + i%26))
+	if i >= 26 {
+		name += fmt.Sprint(i / 26)
+	}
+	return name
+}
+
+// unify makes a and b the same type, deciding variables as needed.
+func unify(a, b Type) error {
+	a, b = prune(a), prune(b)
+	if a == b {
+		return nil
+	}
+
+	if v, ok := a.(*Variable); ok {
+		return bindVariable(v, b)
+	}
+	if v, ok := b.(*Variable); ok {
+		return bindVariable(v, a)
+	}
+
+	if a == Any || b == Any {
+		return nil
+	}
+
+	failed := mismatch(a, b)
+
+	switch a := a.(type) {
+	case *Constructor:
+		b, ok := b.(*Constructor)
+		if !ok || a.Name != b.Name || len(a.Args) != len(b.Args) {
+			return failed
+		}
+		for i := range a.Args {
+			if unify(a.Args[i], b.Args[i]) != nil {
+				return failed
+			}
+		}
+		return nil
+
+	case *Function:
+		b, ok := b.(*Function)
+		if !ok || len(a.Params) != len(b.Params) || (a.Rest == nil) != (b.Rest == nil) {
+			return failed
+		}
+		for i := range a.Params {
+			if unify(a.Params[i], b.Params[i]) != nil {
+				return failed
+			}
+		}
+		if a.Rest != nil && unify(a.Rest, b.Rest) != nil {
+			return failed
+		}
+		if unify(a.Return, b.Return) != nil {
+			return failed
+		}
+		return nil
+	}
+
+	return failed
+}
+
+func mismatch(expected, actual Type) error {
+	written := formatAll(expected, actual)
+	return fmt.Errorf("expected %s, got %s", written[0], written[1])
+}
+
+func bindVariable(v *Variable, t Type) error {
+	if other, ok := t.(*Variable); ok {
+		other.addable = other.addable || v.addable
+		other.ordered = other.ordered || v.ordered
+		if v.level < other.level {
+			other.level = v.level
+		}
+		v.instance = other
+		return nil
+	}
+
+	if v.addable && t != Int && t != String && t != Any {
+		return fmt.Errorf("expected int or string, got %s", t)
+	}
+	if v.ordered && !order(t) {
+		return fmt.Errorf("expected int, string or array, got %s", t)
+	}
+	if occurs(v, t) {
+		written := formatAll(v, t)
+		return fmt.Errorf("infinite type: %s occurs in %s", written[0], written[1])
+	}
+
+	v.instance = t
+	return nil
+}
+
+// order reports whether <, >, <= and >= work on t: ints, strings and arrays
+// of what they work on. It restricts the variables in t to those types.
+func order(t Type) bool {
+	switch t := prune(t).(type) {
+	case *Variable:
+		t.ordered = true
+		return true
+	case *Constructor:
+		if t.Name == "array" {
+			return order(t.Args[0])
+		}
+		return t == Int || t == String || t == Any
+	}
+	return false
+}
+
+// occurs reports whether v appears in t, and lowers the level of every
+// variable in t to v's, since they now belong to the same binding.
+func occurs(v *Variable, t Type) bool {
+	switch t := prune(t).(type) {
+	case *Variable:
+		if t == v {
+			return true
+		}
+		if t.level > v.level {
+			t.level = v.level
+		}
+	case *Constructor:
+		for _, arg := range t.Args {
+			if occurs(v, arg) {
+				return true
+			}
+		}
+	case *Function:
+		for _, param := range t.Params {
+			if occurs(v, param) {
+				return true
+			}
+		}
+		if t.Rest != nil && occurs(v, t.Rest) {
+			return true
+		}
+		return occurs(v, t.Return)
+	}
+	return false
+}